@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/sunr3d/image-processor/internal/config"
+	"github.com/sunr3d/image-processor/internal/entrypoint"
+)
+
+func main() {
+	zlog.Init()
+	zlog.Logger.Info().Msg("Запуск API и Worker в одном процессе...")
+
+	cfg, err := config.GetConfig("config.yml")
+	if err != nil {
+		zlog.Logger.Fatal().Err(err).Msg("config.GetConfig")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := entrypoint.RunAllInOne(ctx, cfg); err != nil {
+		zlog.Logger.Fatal().Err(err).Msg("entrypoint.RunAllInOne")
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/sunr3d/image-processor/internal/config"
+	"github.com/sunr3d/image-processor/internal/entrypoint"
+)
+
+func main() {
+	repair := flag.Bool("repair", false, "исправить найденные несоответствия (по умолчанию только отчет)")
+	minAge := flag.Duration("min-age", time.Hour, "файлы без метаданных моложе этого возраста не считаются брошенными")
+	flag.Parse()
+
+	zlog.Init()
+	zlog.Logger.Info().Msg("Сверка хранилища изображений с метаданными...")
+
+	cfg, err := config.GetConfig("config.yml")
+	if err != nil {
+		zlog.Logger.Fatal().Err(err).Msg("config.GetConfig")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := entrypoint.RunGC(ctx, cfg, *repair, *minAge); err != nil {
+		zlog.Logger.Fatal().Err(err).Msg("entrypoint.RunGC")
+	}
+}
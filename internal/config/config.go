@@ -1,13 +1,93 @@
 package config
 
+import "time"
+
 type Config struct {
 	HTTPPort      string `mapstructure:"HTTP_PORT"`
 	LogLevel      string `mapstructure:"LOG_LEVEL"`
 	KafkaBrokers  string `mapstructure:"KAFKA_BROKERS"`
 	KafkaTopic    string `mapstructure:"KAFKA_TOPIC"`
 	KafkaGroup    string `mapstructure:"KAFKA_GROUP"`
+	KafkaDLQTopic string `mapstructure:"KAFKA_DLQ_TOPIC"`
+	// KafkaBulkTopic - топик задач приоритета bulk; KafkaTopic - топик задач interactive.
+	KafkaBulkTopic string `mapstructure:"KAFKA_BULK_TOPIC"`
+	// KafkaResultsTopic - топик событий image.completed и image.failed; пусто - события не публикуются.
+	KafkaResultsTopic string `mapstructure:"KAFKA_RESULTS_TOPIC"`
+
+	// Broker - брокер задач: kafka, nats, redis или memory (только cmd/allinone).
+	Broker           string `mapstructure:"BROKER"`
+	MemoryBrokerPath string `mapstructure:"MEMORY_BROKER_PATH"`
+
+	// NATS - поток задач JetStream, префикс его субъектов (<subject>.interactive, .bulk, .dlq),
+	// имя постоянных потребителей и срок подтверждения сообщения.
+	NATSURL     string        `mapstructure:"NATS_URL"`
+	NATSStream  string        `mapstructure:"NATS_STREAM"`
+	NATSSubject string        `mapstructure:"NATS_SUBJECT"`
+	NATSDurable string        `mapstructure:"NATS_DURABLE"`
+	NATSAckWait time.Duration `mapstructure:"NATS_ACK_WAIT"`
+
+	// Redis - потоки задач <stream>:<приоритет> и <stream>:dlq, группа потребителей, имя потребителя
+	// (пусто - имя хоста) и срок, после которого неподтвержденную задачу забирает другой потребитель.
+	RedisAddr      string        `mapstructure:"REDIS_ADDR"`
+	RedisPassword  string        `mapstructure:"REDIS_PASSWORD"`
+	RedisStream    string        `mapstructure:"REDIS_STREAM"`
+	RedisGroup     string        `mapstructure:"REDIS_GROUP"`
+	RedisConsumer  string        `mapstructure:"REDIS_CONSUMER"`
+	RedisClaimIdle time.Duration `mapstructure:"REDIS_CLAIM_IDLE"`
+
+	PriorityInteractiveWeight int `mapstructure:"PRIORITY_INTERACTIVE_WEIGHT"`
+	PriorityBulkWeight        int `mapstructure:"PRIORITY_BULK_WEIGHT"`
+
 	StoragePath   string `mapstructure:"STORAGE_PATH"`
 	MetadataPath  string `mapstructure:"METADATA_PATH"`
+	MetadataStore string `mapstructure:"METADATA_STORE"`
+	SQLitePath    string `mapstructure:"SQLITE_PATH"`
+	PostgresDSN   string `mapstructure:"POSTGRES_DSN"`
+	ImageStore    string `mapstructure:"IMAGE_STORE"`
 	ThumbnailSize int    `mapstructure:"THUMBNAIL_SIZE"`
 	ResizeWidth   int    `mapstructure:"RESIZE_WIDTH"`
+	Tenants       string `mapstructure:"TENANTS"`
+
+	RateLimitUploadRPS   float64 `mapstructure:"RATE_LIMIT_UPLOAD_RPS"`
+	RateLimitUploadBurst int     `mapstructure:"RATE_LIMIT_UPLOAD_BURST"`
+	RateLimitReadRPS     float64 `mapstructure:"RATE_LIMIT_READ_RPS"`
+	RateLimitReadBurst   int     `mapstructure:"RATE_LIMIT_READ_BURST"`
+
+	S3Endpoint       string `mapstructure:"S3_ENDPOINT"`
+	S3PublicEndpoint string `mapstructure:"S3_PUBLIC_ENDPOINT"`
+	S3AccessKey      string `mapstructure:"S3_ACCESS_KEY"`
+	S3SecretKey      string `mapstructure:"S3_SECRET_KEY"`
+	S3Bucket         string `mapstructure:"S3_BUCKET"`
+	S3Region         string `mapstructure:"S3_REGION"`
+	S3UseSSL         bool   `mapstructure:"S3_USE_SSL"`
+	S3PartSizeMB     int    `mapstructure:"S3_PART_SIZE_MB"`
+
+	ImageDelivery string        `mapstructure:"IMAGE_DELIVERY"`
+	PresignTTL    time.Duration `mapstructure:"PRESIGN_TTL"`
+
+	ColdStore         string        `mapstructure:"COLD_STORE"`
+	ColdStoragePath   string        `mapstructure:"COLD_STORAGE_PATH"`
+	ColdS3Bucket      string        `mapstructure:"COLD_S3_BUCKET"`
+	ColdAfterDays     int           `mapstructure:"COLD_AFTER_DAYS"`
+	LifecycleInterval time.Duration `mapstructure:"LIFECYCLE_INTERVAL"`
+
+	RetentionInterval time.Duration `mapstructure:"RETENTION_INTERVAL"`
+	RestoreWindow     time.Duration `mapstructure:"RESTORE_WINDOW"`
+	PurgeInterval     time.Duration `mapstructure:"PURGE_INTERVAL"`
+
+	OutboxInterval  time.Duration `mapstructure:"OUTBOX_INTERVAL"`
+	OutboxBatchSize int           `mapstructure:"OUTBOX_BATCH_SIZE"`
+
+	StuckTaskThreshold   time.Duration `mapstructure:"STUCK_TASK_THRESHOLD"`
+	StuckTaskMaxAttempts int           `mapstructure:"STUCK_TASK_MAX_ATTEMPTS"`
+	StuckTaskInterval    time.Duration `mapstructure:"STUCK_TASK_INTERVAL"`
+
+	TaskRetryAttempts int           `mapstructure:"TASK_RETRY_ATTEMPTS"`
+	TaskRetryDelay    time.Duration `mapstructure:"TASK_RETRY_DELAY"`
+	TaskRetryBackoff  float64       `mapstructure:"TASK_RETRY_BACKOFF"`
+
+	WorkerConcurrency   int           `mapstructure:"WORKER_CONCURRENCY"`
+	WorkerShutdownGrace time.Duration `mapstructure:"WORKER_SHUTDOWN_GRACE"`
+
+	AdminAPIKey string `mapstructure:"ADMIN_API_KEY"`
 }
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sunr3d/image-processor/models"
+)
+
+var tenantIDRe = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// ParseTenants - разбирает список тенантов из строки вида "id:api_key[:max_images[:max_bytes[:default_ttl]]],...".
+// default_ttl задается в формате time.ParseDuration, например 72h.
+// Пустая строка означает однотенантный режим.
+func ParseTenants(raw string) ([]models.Tenant, error) {
+	var tenants []models.Tenant
+	seenIDs := make(map[string]struct{})
+	seenKeys := make(map[string]struct{})
+
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.Split(entry, ":")
+		if len(parts) < 2 || len(parts) > 5 {
+			return nil, fmt.Errorf("некорректное описание тенанта: %q", entry)
+		}
+
+		t := models.Tenant{
+			ID:     strings.TrimSpace(parts[0]),
+			APIKey: strings.TrimSpace(parts[1]),
+		}
+
+		if !tenantIDRe.MatchString(t.ID) {
+			return nil, fmt.Errorf("некорректный ID тенанта: %q", t.ID)
+		}
+		if t.APIKey == "" {
+			return nil, fmt.Errorf("пустой API ключ у тенанта: %s", t.ID)
+		}
+
+		if len(parts) >= 3 {
+			maxImages, err := strconv.Atoi(strings.TrimSpace(parts[2]))
+			if err != nil {
+				return nil, fmt.Errorf("strconv.Atoi: %w", err)
+			}
+			t.MaxImages = maxImages
+		}
+
+		if len(parts) >= 4 {
+			maxBytes, err := strconv.ParseInt(strings.TrimSpace(parts[3]), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("strconv.ParseInt: %w", err)
+			}
+			t.MaxBytes = maxBytes
+		}
+
+		if len(parts) == 5 {
+			ttl, err := time.ParseDuration(strings.TrimSpace(parts[4]))
+			if err != nil {
+				return nil, fmt.Errorf("time.ParseDuration: %w", err)
+			}
+			if ttl < 0 {
+				return nil, fmt.Errorf("отрицательный срок хранения у тенанта: %s", t.ID)
+			}
+			t.DefaultTTL = ttl
+		}
+
+		if _, ok := seenIDs[t.ID]; ok {
+			return nil, fmt.Errorf("тенант указан повторно: %s", t.ID)
+		}
+		if _, ok := seenKeys[t.APIKey]; ok {
+			return nil, fmt.Errorf("API ключ используется несколькими тенантами: %s", t.ID)
+		}
+		seenIDs[t.ID] = struct{}{}
+		seenKeys[t.APIKey] = struct{}{}
+
+		tenants = append(tenants, t)
+	}
+
+	return tenants, nil
+}
@@ -0,0 +1,72 @@
+package entrypoint
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/sunr3d/image-processor/internal/config"
+	"github.com/sunr3d/image-processor/internal/interfaces/infra"
+)
+
+// RunAllInOne - запускает HTTP API и worker в одном процессе с общими хранилищами. С BROKER=memory
+// задачи передаются через очередь внутри процесса, и внешний брокер не нужен.
+func RunAllInOne(ctx context.Context, cfg *config.Config) error {
+	settings, err := parseAppConfig(cfg)
+	if err != nil {
+		return fmt.Errorf("parseAppConfig: %w", err)
+	}
+
+	stor, closeStor, err := openStorages(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("openStorages: %w", err)
+	}
+	defer closeStor()
+
+	var (
+		publisher   infra.Publisher
+		deadLetters infra.DeadLetterQueue
+		subscriber  infra.Subscriber
+	)
+	if cfg.Broker == "memory" {
+		b, err := newMemoryBroker(cfg)
+		if err != nil {
+			return fmt.Errorf("newMemoryBroker: %w", err)
+		}
+		publisher, deadLetters, subscriber = b, b, b
+	} else {
+		var closeApp, closeWorker func()
+		publisher, deadLetters, closeApp, err = newAppBroker(ctx, cfg)
+		if err != nil {
+			return fmt.Errorf("newAppBroker: %w", err)
+		}
+		defer closeApp()
+
+		subscriber, closeWorker, err = newWorkerSubscriber(ctx, cfg)
+		if err != nil {
+			return fmt.Errorf("newWorkerSubscriber: %w", err)
+		}
+		defer closeWorker()
+	}
+
+	// Остановка одной из частей останавливает и другую.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	workerErr := make(chan error, 1)
+	go func() {
+		err := runWorker(ctx, cfg, stor, subscriber)
+		if err != nil {
+			zlog.Logger.Error().Err(err).Msg("Worker остановлен с ошибкой")
+		}
+		cancel()
+		workerErr <- err
+	}()
+
+	appErr := runApp(ctx, cfg, settings, stor, publisher, deadLetters)
+	cancel()
+
+	return errors.Join(appErr, <-workerErr)
+}
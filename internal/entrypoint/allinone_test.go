@@ -0,0 +1,193 @@
+package entrypoint
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/textproto"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sunr3d/image-processor/internal/config"
+)
+
+// Сквозной тест: загрузка через HTTP API, обработка worker через брокер внутри процесса
+// и получение результата, без внешних сервисов.
+func TestRunAllInOne_MemoryBroker(t *testing.T) {
+	for _, persisted := range []bool{false, true} {
+		t.Run(fmt.Sprintf("persisted=%t", persisted), func(t *testing.T) {
+			cfg := allInOneConfig(t)
+			if persisted {
+				cfg.MemoryBrokerPath = filepath.Join(t.TempDir(), "queue")
+			}
+			baseURL := "http://127.0.0.1:" + cfg.HTTPPort
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error, 1)
+			go func() { done <- RunAllInOne(ctx, cfg) }()
+
+			require.Eventually(t, func() bool {
+				resp, err := http.Get(baseURL + "/usage")
+				if err != nil {
+					return false
+				}
+				resp.Body.Close()
+				return true
+			}, 5*time.Second, 20*time.Millisecond, "HTTP сервер не запустился")
+
+			id := uploadPNG(t, baseURL)
+
+			require.Eventually(t, func() bool {
+				return imageStatus(t, baseURL, id) == "completed"
+			}, 10*time.Second, 50*time.Millisecond, "изображение не обработано")
+
+			resp, err := http.Get(baseURL + "/image/" + id + "?type=thumbnail")
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+			thumbnail, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			cfgImg, _, err := image.DecodeConfig(bytes.NewReader(thumbnail))
+			require.NoError(t, err)
+			assert.Equal(t, cfg.ThumbnailSize, cfgImg.Width)
+
+			cancel()
+			select {
+			case err := <-done:
+				assert.NoError(t, err)
+			case <-time.After(10 * time.Second):
+				t.Fatal("RunAllInOne не завершился после остановки")
+			}
+		})
+	}
+}
+
+func TestRunAllInOne_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(cfg *config.Config)
+	}{
+		{name: "retention interval", modify: func(cfg *config.Config) { cfg.RetentionInterval = 0 }},
+		{name: "restore window", modify: func(cfg *config.Config) { cfg.RestoreWindow = -time.Hour }},
+		{name: "purge interval", modify: func(cfg *config.Config) { cfg.PurgeInterval = 0 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := allInOneConfig(t)
+			tt.modify(cfg)
+
+			err := RunAllInOne(context.Background(), cfg)
+
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "parseAppConfig")
+			// Ошибка найдена до открытия хранилищ и запуска фоновых задач.
+			assert.NoDirExists(t, cfg.MetadataPath)
+			assert.NoDirExists(t, cfg.StoragePath)
+		})
+	}
+}
+
+// helpers
+func allInOneConfig(t *testing.T) *config.Config {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	return &config.Config{
+		HTTPPort:                  freePort(t),
+		Broker:                    "memory",
+		StoragePath:               filepath.Join(dir, "storage"),
+		MetadataPath:              filepath.Join(dir, "metadata"),
+		MetadataStore:             "file",
+		ImageStore:                "file",
+		ThumbnailSize:             50,
+		ResizeWidth:               100,
+		PriorityInteractiveWeight: 4,
+		PriorityBulkWeight:        1,
+		RetentionInterval:         time.Minute,
+		RestoreWindow:             time.Hour,
+		PurgeInterval:             time.Minute,
+		OutboxInterval:            20 * time.Millisecond,
+		OutboxBatchSize:           100,
+		StuckTaskThreshold:        time.Minute,
+		StuckTaskMaxAttempts:      3,
+		StuckTaskInterval:         time.Minute,
+		TaskRetryAttempts:         1,
+		TaskRetryBackoff:          1,
+		WorkerConcurrency:         2,
+		WorkerShutdownGrace:       time.Second,
+	}
+}
+
+func freePort(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	return fmt.Sprint(l.Addr().(*net.TCPAddr).Port)
+}
+
+func uploadPNG(t *testing.T, baseURL string) string {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, 320, 240))
+	for x := range 320 {
+		for y := range 240 {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="image"; filename="gradient.png"`)
+	header.Set("Content-Type", "image/png")
+	part, err := form.CreatePart(header)
+	require.NoError(t, err)
+	require.NoError(t, png.Encode(part, img))
+	require.NoError(t, form.Close())
+
+	resp, err := http.Post(baseURL+"/upload", form.FormDataContentType(), &body)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var uploaded struct {
+		ID string `json:"id"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&uploaded))
+	require.NotEmpty(t, uploaded.ID)
+
+	return uploaded.ID
+}
+
+func imageStatus(t *testing.T, baseURL, id string) string {
+	t.Helper()
+
+	resp, err := http.Get(baseURL + "/status/" + id)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var status struct {
+		Status string `json:"status"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&status))
+
+	return status.Status
+}
@@ -2,30 +2,153 @@ package entrypoint
 
 import (
 	"context"
-	"strings"
+	"fmt"
+	"time"
+
+	"github.com/wb-go/wbf/zlog"
 
 	"github.com/sunr3d/image-processor/internal/config"
 	httphandlers "github.com/sunr3d/image-processor/internal/handlers"
-	"github.com/sunr3d/image-processor/internal/infra/broker/kafka"
-	"github.com/sunr3d/image-processor/internal/infra/storage/filestorage"
+	"github.com/sunr3d/image-processor/internal/interfaces/infra"
 	"github.com/sunr3d/image-processor/internal/server"
 	"github.com/sunr3d/image-processor/internal/services/imagesvc"
+	"github.com/sunr3d/image-processor/internal/services/lifecycle"
+	"github.com/sunr3d/image-processor/internal/services/purge"
+	"github.com/sunr3d/image-processor/internal/services/relay"
+	"github.com/sunr3d/image-processor/internal/services/retention"
+	"github.com/sunr3d/image-processor/internal/services/sweeper"
+	"github.com/sunr3d/image-processor/models"
 )
 
 func RunApp(ctx context.Context, cfg *config.Config) error {
+	settings, err := parseAppConfig(cfg)
+	if err != nil {
+		return fmt.Errorf("parseAppConfig: %w", err)
+	}
+
 	// Инфраслой (Infrastructure layer)
-	imageStor := filestorage.NewFileStorage(cfg.StoragePath)
-	metadataStor := filestorage.NewMetadataStorage(cfg.MetadataPath)
+	stor, closeStor, err := openStorages(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("openStorages: %w", err)
+	}
+	defer closeStor()
+
+	publisher, deadLetters, closeBroker, err := newAppBroker(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("newAppBroker: %w", err)
+	}
+	defer closeBroker()
+
+	return runApp(ctx, cfg, settings, stor, publisher, deadLetters)
+}
+
+// appSettings - разобранные и проверенные настройки app.
+type appSettings struct {
+	tenants    []models.Tenant
+	presignTTL time.Duration
+	coldAfter  time.Duration
+}
+
+// parseAppConfig - разбирает и проверяет настройки app. Вызывается до открытия хранилищ и запуска
+// фоновых задач, чтобы ошибка конфигурации не оставляла работающих горутин.
+func parseAppConfig(cfg *config.Config) (*appSettings, error) {
+	tenants, err := config.ParseTenants(cfg.Tenants)
+	if err != nil {
+		return nil, fmt.Errorf("config.ParseTenants: %w", err)
+	}
+
+	ttl, err := presignTTL(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("presignTTL: %w", err)
+	}
+
+	if cfg.OutboxInterval <= 0 || cfg.OutboxBatchSize <= 0 {
+		return nil, fmt.Errorf("OUTBOX_INTERVAL и OUTBOX_BATCH_SIZE должны быть положительными")
+	}
+
+	if cfg.StuckTaskThreshold <= 0 || cfg.StuckTaskInterval <= 0 || cfg.StuckTaskMaxAttempts < 0 {
+		return nil, fmt.Errorf("STUCK_TASK_THRESHOLD и STUCK_TASK_INTERVAL должны быть положительными, STUCK_TASK_MAX_ATTEMPTS - неотрицательным")
+	}
 
-	kafkaBrokers := strings.Split(cfg.KafkaBrokers, ",")
-	publisher := kafka.NewPublisher(kafkaBrokers, cfg.KafkaTopic)
-	defer publisher.Close()
+	if cfg.ColdStore != "" && (cfg.ColdAfterDays <= 0 || cfg.LifecycleInterval <= 0) {
+		return nil, fmt.Errorf("COLD_AFTER_DAYS и LIFECYCLE_INTERVAL должны быть положительными")
+	}
+
+	if cfg.RetentionInterval <= 0 {
+		return nil, fmt.Errorf("RETENTION_INTERVAL должен быть положительным: %s", cfg.RetentionInterval)
+	}
+
+	if cfg.RestoreWindow < 0 || cfg.PurgeInterval <= 0 {
+		return nil, fmt.Errorf("RESTORE_WINDOW не может быть отрицательным, PURGE_INTERVAL должен быть положительным")
+	}
+
+	return &appSettings{
+		tenants:    tenants,
+		presignTTL: ttl,
+		coldAfter:  time.Duration(cfg.ColdAfterDays) * 24 * time.Hour,
+	}, nil
+}
+
+// runApp - запускает HTTP API и фоновые задачи app поверх готовых хранилищ и брокера.
+func runApp(
+	ctx context.Context,
+	cfg *config.Config,
+	settings *appSettings,
+	stor *storages,
+	publisher infra.Publisher,
+	deadLetters infra.DeadLetterQueue,
+) error {
+	tenants := settings.tenants
+	imageStor, coldStor, metadataStor, outbox := stor.images, stor.cold, stor.metadata, stor.outbox
 
 	// Сервисный слой (Application / Use Cases layer)
-	imageSvc := imagesvc.New(imageStor, metadataStor, publisher)
+	imageSvc := imagesvc.New(imageStor, metadataStor, outbox, tenants, settings.presignTTL, coldStor, cfg.RestoreWindow, deadLetters)
+
+	relaySvc := relay.New(outbox, publisher, cfg.OutboxInterval, cfg.OutboxBatchSize)
+	go func() {
+		if err := relaySvc.Start(ctx); err != nil {
+			zlog.Logger.Error().Err(err).Msg("Публикация задач из outbox остановлена с ошибкой")
+		}
+	}()
+
+	events, closeEvents := newEventPublisher(cfg)
+	defer closeEvents()
+
+	sweeperSvc := sweeper.New(metadataStor, outbox, events, tenants, cfg.StuckTaskThreshold, cfg.StuckTaskMaxAttempts, cfg.StuckTaskInterval)
+	go func() {
+		if err := sweeperSvc.Start(ctx); err != nil {
+			zlog.Logger.Error().Err(err).Msg("Поиск зависших задач остановлен с ошибкой")
+		}
+	}()
+
+	if coldStor != nil {
+		lifecycleSvc := lifecycle.New(coldStor, metadataStor, tenants, settings.coldAfter, cfg.LifecycleInterval)
+		go func() {
+			if err := lifecycleSvc.Start(ctx); err != nil {
+				zlog.Logger.Error().Err(err).Msg("Политики жизненного цикла остановлены с ошибкой")
+			}
+		}()
+	}
+
+	reaper := retention.New(imageSvc, metadataStor, tenants, cfg.RetentionInterval)
+	go func() {
+		if err := reaper.Start(ctx); err != nil {
+			zlog.Logger.Error().Err(err).Msg("Удаление изображений с истекшим сроком хранения остановлено с ошибкой")
+		}
+	}()
+
+	purger := purge.New(imageStor, metadataStor, tenants, cfg.RestoreWindow, cfg.PurgeInterval)
+	go func() {
+		if err := purger.Start(ctx); err != nil {
+			zlog.Logger.Error().Err(err).Msg("Очистка удаленных изображений остановлена с ошибкой")
+		}
+	}()
 
 	// Слой представления (Presentation layer)
-	h := httphandlers.New(imageSvc)
+	h := httphandlers.New(imageSvc, tenants, httphandlers.RateLimits{
+		Upload: httphandlers.RateLimit{RPS: cfg.RateLimitUploadRPS, Burst: cfg.RateLimitUploadBurst},
+		Read:   httphandlers.RateLimit{RPS: cfg.RateLimitReadRPS, Burst: cfg.RateLimitReadBurst},
+	}, cfg.AdminAPIKey)
 	engine := h.RegisterHandlers()
 
 	// Сервер
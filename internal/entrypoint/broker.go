@@ -0,0 +1,219 @@
+package entrypoint
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/wb-go/wbf/retry"
+
+	"github.com/sunr3d/image-processor/internal/config"
+	"github.com/sunr3d/image-processor/internal/infra/broker/kafka"
+	"github.com/sunr3d/image-processor/internal/infra/broker/memory"
+	"github.com/sunr3d/image-processor/internal/infra/broker/nats"
+	"github.com/sunr3d/image-processor/internal/infra/broker/redis"
+	"github.com/sunr3d/image-processor/internal/interfaces/infra"
+	"github.com/sunr3d/image-processor/models"
+)
+
+// newAppBroker - публикация задач и очередь необработанных задач брокера, выбранного в BROKER.
+// Возвращаемая функция освобождает ресурсы брокера.
+func newAppBroker(ctx context.Context, cfg *config.Config) (infra.Publisher, infra.DeadLetterQueue, func(), error) {
+	switch cfg.Broker {
+	case "", "kafka":
+		kafkaBrokers := strings.Split(cfg.KafkaBrokers, ",")
+		publisher := kafka.NewPublisher(kafkaBrokers, map[models.TaskPriority]string{
+			models.PriorityInteractive: cfg.KafkaTopic,
+			models.PriorityBulk:        cfg.KafkaBulkTopic,
+		})
+		deadLetters := kafka.NewDeadLetterQueue(kafkaBrokers, cfg.KafkaDLQTopic, cfg.KafkaGroup+"-dlq-replay",
+			[]string{cfg.KafkaTopic, cfg.KafkaBulkTopic})
+
+		return publisher, deadLetters, func() {
+			publisher.Close()
+			deadLetters.Close()
+		}, nil
+	case "nats":
+		publisher, err := nats.NewPublisher(ctx, cfg.NATSURL, cfg.NATSStream, cfg.NATSSubject)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("nats.NewPublisher: %w", err)
+		}
+		deadLetters, err := nats.NewDeadLetterQueue(ctx, cfg.NATSURL, cfg.NATSStream, cfg.NATSSubject, cfg.NATSDurable+"-dlq-replay")
+		if err != nil {
+			publisher.Close()
+			return nil, nil, nil, fmt.Errorf("nats.NewDeadLetterQueue: %w", err)
+		}
+
+		return publisher, deadLetters, func() {
+			publisher.Close()
+			deadLetters.Close()
+		}, nil
+	case "redis":
+		publisher, err := redis.NewPublisher(ctx, cfg.RedisAddr, cfg.RedisPassword, cfg.RedisStream)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("redis.NewPublisher: %w", err)
+		}
+		deadLetters, err := redis.NewDeadLetterQueue(ctx, cfg.RedisAddr, cfg.RedisPassword, cfg.RedisStream)
+		if err != nil {
+			publisher.Close()
+			return nil, nil, nil, fmt.Errorf("redis.NewDeadLetterQueue: %w", err)
+		}
+
+		return publisher, deadLetters, func() {
+			publisher.Close()
+			deadLetters.Close()
+		}, nil
+	case "memory":
+		return nil, nil, nil, fmt.Errorf("брокер memory работает только внутри одного процесса (cmd/allinone)")
+	default:
+		return nil, nil, nil, fmt.Errorf("неизвестный брокер: %s", cfg.Broker)
+	}
+}
+
+// newWorkerSubscriber - подписка на задачи брокера, выбранного в BROKER.
+// Возвращаемая функция освобождает ресурсы брокера.
+func newWorkerSubscriber(ctx context.Context, cfg *config.Config) (infra.Subscriber, func(), error) {
+	handleRetry, err := taskRetry(cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("taskRetry: %w", err)
+	}
+	concurrency, err := workerConcurrency(cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("workerConcurrency: %w", err)
+	}
+	weights, err := priorityWeights(cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("priorityWeights: %w", err)
+	}
+
+	switch cfg.Broker {
+	case "", "kafka":
+		topics := []kafka.WeightedTopic{
+			{Topic: cfg.KafkaTopic, Weight: weights[models.PriorityInteractive]},
+			{Topic: cfg.KafkaBulkTopic, Weight: weights[models.PriorityBulk]},
+		}
+		subscriber := kafka.NewSubscriber(strings.Split(cfg.KafkaBrokers, ","), topics, cfg.KafkaGroup, cfg.KafkaDLQTopic,
+			handleRetry, concurrency)
+
+		return subscriber, func() { subscriber.Close() }, nil
+	case "nats":
+		subscriber, err := nats.NewSubscriber(ctx, cfg.NATSURL, cfg.NATSStream, cfg.NATSSubject, cfg.NATSDurable,
+			weights, cfg.NATSAckWait, handleRetry, concurrency)
+		if err != nil {
+			return nil, nil, fmt.Errorf("nats.NewSubscriber: %w", err)
+		}
+
+		return subscriber, func() { subscriber.Close() }, nil
+	case "redis":
+		consumer, err := redisConsumer(cfg)
+		if err != nil {
+			return nil, nil, fmt.Errorf("redisConsumer: %w", err)
+		}
+		subscriber, err := redis.NewSubscriber(ctx, cfg.RedisAddr, cfg.RedisPassword, cfg.RedisStream, cfg.RedisGroup, consumer,
+			weights, cfg.RedisClaimIdle, handleRetry, concurrency)
+		if err != nil {
+			return nil, nil, fmt.Errorf("redis.NewSubscriber: %w", err)
+		}
+
+		return subscriber, func() { subscriber.Close() }, nil
+	case "memory":
+		return nil, nil, fmt.Errorf("брокер memory работает только внутри одного процесса (cmd/allinone)")
+	default:
+		return nil, nil, fmt.Errorf("неизвестный брокер: %s", cfg.Broker)
+	}
+}
+
+// newEventPublisher - публикация событий об обработке в KAFKA_RESULTS_TOPIC. Если топик не задан,
+// возвращает nil: события не публикуются. Возвращаемая функция освобождает ресурсы публикации.
+func newEventPublisher(cfg *config.Config) (infra.EventPublisher, func()) {
+	if cfg.KafkaResultsTopic == "" {
+		return nil, func() {}
+	}
+
+	events := kafka.NewEventPublisher(strings.Split(cfg.KafkaBrokers, ","), cfg.KafkaResultsTopic)
+
+	return events, func() { events.Close() }
+}
+
+// newMemoryBroker - брокер задач внутри процесса. Если задан MEMORY_BROKER_PATH, очереди
+// переживают перезапуск.
+func newMemoryBroker(cfg *config.Config) (interface {
+	infra.Publisher
+	infra.Subscriber
+	infra.DeadLetterQueue
+}, error) {
+	handleRetry, err := taskRetry(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("taskRetry: %w", err)
+	}
+	concurrency, err := workerConcurrency(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("workerConcurrency: %w", err)
+	}
+	weights, err := priorityWeights(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("priorityWeights: %w", err)
+	}
+
+	b, err := memory.New(cfg.MemoryBrokerPath, weights, handleRetry, concurrency)
+	if err != nil {
+		return nil, fmt.Errorf("memory.New: %w", err)
+	}
+
+	return b, nil
+}
+
+// taskRetry - стратегия повторов обработки задачи в worker.
+func taskRetry(cfg *config.Config) (retry.Strategy, error) {
+	if cfg.TaskRetryAttempts <= 0 || cfg.TaskRetryDelay < 0 || cfg.TaskRetryBackoff < 1 {
+		return retry.Strategy{}, fmt.Errorf("TASK_RETRY_ATTEMPTS должен быть положительным, TASK_RETRY_DELAY - неотрицательным, TASK_RETRY_BACKOFF - не меньше 1")
+	}
+
+	return retry.Strategy{
+		Attempts: cfg.TaskRetryAttempts,
+		Delay:    cfg.TaskRetryDelay,
+		Backoff:  cfg.TaskRetryBackoff,
+	}, nil
+}
+
+// workerConcurrency - сколько задач worker обрабатывает параллельно.
+func workerConcurrency(cfg *config.Config) (int, error) {
+	if cfg.WorkerConcurrency < 0 {
+		return 0, fmt.Errorf("WORKER_CONCURRENCY не может быть отрицательным")
+	}
+
+	if cfg.WorkerConcurrency == 0 {
+		return runtime.NumCPU(), nil
+	}
+
+	return cfg.WorkerConcurrency, nil
+}
+
+// redisConsumer - имя потребителя worker в группе Redis. По умолчанию - имя хоста: оно сохраняется
+// между перезапусками контейнера, и worker дочитывает свои неподтвержденные задачи.
+func redisConsumer(cfg *config.Config) (string, error) {
+	if cfg.RedisConsumer != "" {
+		return cfg.RedisConsumer, nil
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", fmt.Errorf("os.Hostname: %w", err)
+	}
+
+	return hostname, nil
+}
+
+// priorityWeights - веса очередей приоритетов при чтении задач worker.
+func priorityWeights(cfg *config.Config) (map[models.TaskPriority]int, error) {
+	if cfg.PriorityInteractiveWeight <= 0 || cfg.PriorityBulkWeight <= 0 {
+		return nil, fmt.Errorf("PRIORITY_INTERACTIVE_WEIGHT и PRIORITY_BULK_WEIGHT должны быть положительными")
+	}
+
+	return map[models.TaskPriority]int{
+		models.PriorityInteractive: cfg.PriorityInteractiveWeight,
+		models.PriorityBulk:        cfg.PriorityBulkWeight,
+	}, nil
+}
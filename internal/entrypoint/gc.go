@@ -0,0 +1,78 @@
+package entrypoint
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/sunr3d/image-processor/internal/config"
+	"github.com/sunr3d/image-processor/internal/interfaces/infra"
+	"github.com/sunr3d/image-processor/internal/services/gc"
+	"github.com/sunr3d/image-processor/models"
+)
+
+// RunGC - сверяет горячее хранилище изображений с метаданными и печатает найденные несоответствия.
+// С repair = true несоответствия исправляются; файлы моложе minAge не считаются брошенными.
+// Хранилища только открываются, без переноса старой раскладки и карантина, поэтому пробный
+// запуск ничего не меняет.
+func RunGC(ctx context.Context, cfg *config.Config, repair bool, minAge time.Duration) error {
+	tenants, err := config.ParseTenants(cfg.Tenants)
+	if err != nil {
+		return fmt.Errorf("config.ParseTenants: %w", err)
+	}
+
+	imgStor, err := newImageBackend(ctx, cfg, cfg.ImageStore, cfg.StoragePath, cfg.S3Bucket)
+	if err != nil {
+		return fmt.Errorf("newImageBackend: %w", err)
+	}
+	inventory, ok := imgStor.(infra.ImageInventory)
+	if !ok {
+		return fmt.Errorf("хранилище изображений %s не поддерживает сверку", cfg.ImageStore)
+	}
+
+	metaStor, closeMeta, err := newMetadataStorage(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("newMetadataStorage: %w", err)
+	}
+	defer closeMeta()
+
+	// Задачи повторной обработки пишутся в outbox и публикуются relay процесса app
+	// в брокер, выбранный в BROKER.
+	outbox, ok := metaStor.(infra.Outbox)
+	if !ok {
+		return fmt.Errorf("хранилище метаданных %s не поддерживает outbox", cfg.MetadataStore)
+	}
+
+	collector := gc.New(imgStor, inventory, metaStor, outbox, tenants, minAge)
+
+	report, err := collector.Run(ctx, repair)
+	if err != nil {
+		return fmt.Errorf("collector.Run: %w", err)
+	}
+
+	for _, issue := range report.Issues {
+		ev := zlog.Logger.Warn()
+		if issue.Repaired {
+			ev = zlog.Logger.Info()
+		}
+		ev.Str("kind", string(issue.Kind)).
+			Str("tenant", issue.TenantID).
+			Str("image", issue.ImageID).
+			Bool("repaired", issue.Repaired).
+			Msg(issue.Details)
+	}
+
+	zlog.Logger.Info().Msgf("Сверка завершена: проверено %d, брошенных файлов %d, без оригинала %d, без производных %d",
+		report.ImagesChecked,
+		report.Count(models.GCOrphanFiles),
+		report.Count(models.GCMissingOriginal),
+		report.Count(models.GCMissingDerivatives),
+	)
+	if !repair && len(report.Issues) > 0 {
+		zlog.Logger.Info().Msg("Пробный запуск: для исправления запустите с флагом -repair")
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package entrypoint
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Пробный запуск не должен переносить старую раскладку, перемещать файлы в карантин
+// и удалять брошенные файлы.
+func TestRunGC_DryRunLeavesTreeUntouched(t *testing.T) {
+	cfg := allInOneConfig(t)
+	root := filepath.Dir(cfg.StoragePath)
+
+	writeFile(t, filepath.Join(cfg.StoragePath, "original", "legacy", "original.jpg"), "jpeg")
+	writeFile(t, filepath.Join(cfg.StoragePath, "default", "processed", "broken", "resized.jpg"), "")
+	writeFile(t, filepath.Join(cfg.StoragePath, "default", "original", "orphan", "original.jpg"), "jpeg")
+	writeFile(t, filepath.Join(cfg.MetadataPath, "legacy.json"), `{"id":"legacy","status":"pending"}`)
+	writeFile(t, filepath.Join(cfg.MetadataPath, "default", "broken.json"), `{"id":`)
+
+	before := snapshotTree(t, root)
+
+	require.NoError(t, RunGC(context.Background(), cfg, false, 0))
+
+	assert.Equal(t, before, snapshotTree(t, root))
+}
+
+// helpers
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(data), 0644))
+}
+
+func snapshotTree(t *testing.T, root string) map[string]string {
+	t.Helper()
+
+	tree := make(map[string]string)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			tree[rel+"/"] = ""
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		tree[rel] = string(data)
+		return nil
+	})
+	require.NoError(t, err)
+
+	return tree
+}
@@ -0,0 +1,102 @@
+package entrypoint
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/sunr3d/image-processor/internal/config"
+	"github.com/sunr3d/image-processor/internal/infra/storage/filestorage"
+	"github.com/sunr3d/image-processor/internal/infra/storage/sqlitestorage"
+	"github.com/sunr3d/image-processor/models"
+)
+
+// RunMetadataMigration - импортирует JSON метаданные из METADATA_PATH в SQLite (SQLITE_PATH).
+// Уже импортированные записи пропускаются, поэтому команду можно запускать повторно.
+func RunMetadataMigration(ctx context.Context, cfg *config.Config) error {
+	src := filestorage.NewMetadataStorage(cfg.MetadataPath)
+
+	dst, err := sqlitestorage.NewMetadataStorage(ctx, cfg.SQLitePath)
+	if err != nil {
+		return fmt.Errorf("sqlitestorage.NewMetadataStorage: %w", err)
+	}
+	defer dst.Close()
+
+	entries, err := os.ReadDir(cfg.MetadataPath)
+	if err != nil {
+		return fmt.Errorf("os.ReadDir: %w", err)
+	}
+
+	imported, skipped := 0, 0
+	importMeta := func(meta *models.ImageMetadata) error {
+		if _, err := dst.Get(ctx, meta.TenantID, meta.ID); err == nil {
+			skipped++
+			return nil
+		}
+
+		if err := dst.Save(ctx, meta); err != nil {
+			return fmt.Errorf("dst.Save %s/%s: %w", meta.TenantID, meta.ID, err)
+		}
+		imported++
+
+		return nil
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		// Служебные каталоги (например, карантин) начинаются с точки.
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		// Файлы в корне - метаданные раскладки до появления тенантов, они относятся к тенанту по умолчанию.
+		if !entry.IsDir() {
+			if !strings.HasSuffix(name, ".json") {
+				continue
+			}
+			meta, err := filestorage.ReadLegacyMetadata(filepath.Join(cfg.MetadataPath, name))
+			if err != nil {
+				if os.IsNotExist(err) {
+					continue
+				}
+				return fmt.Errorf("filestorage.ReadLegacyMetadata %s: %w", name, err)
+			}
+			if err := importMeta(meta); err != nil {
+				return err
+			}
+			continue
+		}
+
+		query := &models.ImageQuery{
+			TenantID: name,
+			SortBy:   models.SortByCreatedAt,
+			Limit:    models.MaxPageLimit,
+		}
+
+		for {
+			page, err := src.List(ctx, query)
+			if err != nil {
+				return fmt.Errorf("src.List: %w", err)
+			}
+
+			for _, meta := range page.Items {
+				if err := importMeta(meta); err != nil {
+					return err
+				}
+			}
+
+			if page.NextCursor == "" {
+				break
+			}
+			query.Cursor = page.NextCursor
+		}
+	}
+
+	zlog.Logger.Info().Msgf("Импорт метаданных завершен: импортировано %d, пропущено %d", imported, skipped)
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package entrypoint
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sunr3d/image-processor/internal/config"
+	"github.com/sunr3d/image-processor/internal/infra/storage/filestorage"
+	"github.com/sunr3d/image-processor/internal/infra/storage/sqlitestorage"
+	"github.com/sunr3d/image-processor/models"
+)
+
+func TestRunMetadataMigration(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		MetadataPath: t.TempDir(),
+		SQLitePath:   filepath.Join(t.TempDir(), "metadata.db"),
+	}
+
+	legacy := filepath.Join(cfg.MetadataPath, "img-1.json")
+	legacyData := []byte(`{"ID":"img-1","OriginalPath":"storage/original/img-1/original.jpg","Status":"completed"}`)
+	require.NoError(t, os.WriteFile(legacy, legacyData, 0644))
+	require.NoError(t, filestorage.NewMetadataStorage(cfg.MetadataPath).Save(ctx, &models.ImageMetadata{ID: "img-2", TenantID: "t1"}))
+
+	require.NoError(t, RunMetadataMigration(ctx, cfg))
+	// Повторный запуск пропускает импортированные записи.
+	require.NoError(t, RunMetadataMigration(ctx, cfg))
+
+	data, err := os.ReadFile(legacy)
+	require.NoError(t, err)
+	assert.Equal(t, legacyData, data)
+
+	dst, err := sqlitestorage.NewMetadataStorage(ctx, cfg.SQLitePath)
+	require.NoError(t, err)
+	defer dst.Close()
+
+	meta, err := dst.Get(ctx, models.DefaultTenantID, "img-1")
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusCompleted, meta.Status)
+	assert.Equal(t, filepath.Join("storage", models.DefaultTenantID, "original", "img-1", "original.jpg"), meta.OriginalPath)
+
+	_, err = dst.Get(ctx, "t1", "img-2")
+	assert.NoError(t, err)
+}
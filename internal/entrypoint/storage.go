@@ -0,0 +1,180 @@
+package entrypoint
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/sunr3d/image-processor/internal/config"
+	"github.com/sunr3d/image-processor/internal/infra/storage/filestorage"
+	"github.com/sunr3d/image-processor/internal/infra/storage/pgstorage"
+	"github.com/sunr3d/image-processor/internal/infra/storage/s3storage"
+	"github.com/sunr3d/image-processor/internal/infra/storage/sqlitestorage"
+	"github.com/sunr3d/image-processor/internal/infra/storage/tieredstorage"
+	"github.com/sunr3d/image-processor/internal/interfaces/infra"
+)
+
+// storages - хранилища app и worker.
+type storages struct {
+	images   infra.ImageStorage
+	cold     infra.ColdStorage
+	metadata infra.MetadataStorage
+	outbox   infra.Outbox
+}
+
+// openStorages - создает хранилища изображений и метаданных и готовит их к работе (см. recoverStorage).
+// Хранилище метаданных должно поддерживать outbox. Возвращаемая функция освобождает ресурсы хранилищ.
+func openStorages(ctx context.Context, cfg *config.Config) (*storages, func(), error) {
+	images, cold, err := newImageStorage(ctx, cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("newImageStorage: %w", err)
+	}
+
+	metadata, closeMeta, err := newMetadataStorage(ctx, cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("newMetadataStorage: %w", err)
+	}
+
+	if err := recoverStorage(ctx, metadata, "хранилище метаданных"); err != nil {
+		closeMeta()
+		return nil, nil, fmt.Errorf("recoverStorage: %w", err)
+	}
+
+	outbox, ok := metadata.(infra.Outbox)
+	if !ok {
+		closeMeta()
+		return nil, nil, fmt.Errorf("хранилище метаданных %s не поддерживает outbox", cfg.MetadataStore)
+	}
+
+	return &storages{images: images, cold: cold, metadata: metadata, outbox: outbox}, closeMeta, nil
+}
+
+// newImageStorage - создает хранилище изображений, выбранное в IMAGE_STORE, и готовит его к работе
+// (см. recoverStorage). Если задан COLD_STORE, хранилище становится двухуровневым и вторым значением
+// возвращается доступ к архиву.
+func newImageStorage(ctx context.Context, cfg *config.Config) (infra.ImageStorage, infra.ColdStorage, error) {
+	hot, err := newImageBackend(ctx, cfg, cfg.ImageStore, cfg.StoragePath, cfg.S3Bucket)
+	if err != nil {
+		return nil, nil, fmt.Errorf("newImageBackend(hot): %w", err)
+	}
+	if err := recoverStorage(ctx, hot, "хранилище изображений "+cfg.StoragePath); err != nil {
+		return nil, nil, fmt.Errorf("recoverStorage(hot): %w", err)
+	}
+
+	if cfg.ColdStore == "" {
+		return hot, nil, nil
+	}
+
+	cold, err := newImageBackend(ctx, cfg, cfg.ColdStore, cfg.ColdStoragePath, cfg.ColdS3Bucket)
+	if err != nil {
+		return nil, nil, fmt.Errorf("newImageBackend(cold): %w", err)
+	}
+	if err := recoverStorage(ctx, cold, "хранилище изображений "+cfg.ColdStoragePath); err != nil {
+		return nil, nil, fmt.Errorf("recoverStorage(cold): %w", err)
+	}
+
+	tiered := tieredstorage.NewImageStorage(hot, cold)
+
+	return tiered, tiered, nil
+}
+
+// newImageBackend - создает одно хранилище изображений заданного типа, не меняя его содержимого.
+func newImageBackend(ctx context.Context, cfg *config.Config, store, path, bucket string) (infra.ImageStorage, error) {
+	switch store {
+	case "", "file":
+		return filestorage.NewFileStorage(path), nil
+	case "s3":
+		stor, err := s3storage.NewImageStorage(ctx, s3storage.Config{
+			Endpoint:       cfg.S3Endpoint,
+			PublicEndpoint: cfg.S3PublicEndpoint,
+			AccessKey:      cfg.S3AccessKey,
+			SecretKey:      cfg.S3SecretKey,
+			Bucket:         bucket,
+			Region:         cfg.S3Region,
+			UseSSL:         cfg.S3UseSSL,
+			PartSize:       uint64(cfg.S3PartSizeMB) << 20,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("s3storage.NewImageStorage: %w", err)
+		}
+
+		return stor, nil
+	default:
+		return nil, fmt.Errorf("неизвестное хранилище изображений: %s", store)
+	}
+}
+
+// presignTTL - время жизни подписанных ссылок; 0 означает проксирование байт через сервис.
+func presignTTL(cfg *config.Config) (time.Duration, error) {
+	switch cfg.ImageDelivery {
+	case "", "proxy":
+		return 0, nil
+	case "redirect":
+		if cfg.PresignTTL <= 0 {
+			return 0, fmt.Errorf("PRESIGN_TTL должен быть положительным: %s", cfg.PresignTTL)
+		}
+		return cfg.PresignTTL, nil
+	default:
+		return 0, fmt.Errorf("неизвестный способ отдачи изображений: %s", cfg.ImageDelivery)
+	}
+}
+
+// newMetadataStorage - создает хранилище метаданных, выбранное в METADATA_STORE. Файлы хранилища
+// не меняются; схема БД SQLite и PostgreSQL обновляется миграциями. Возвращаемая функция
+// освобождает ресурсы хранилища.
+func newMetadataStorage(ctx context.Context, cfg *config.Config) (infra.MetadataStorage, func(), error) {
+	switch cfg.MetadataStore {
+	case "", "file":
+		return filestorage.NewMetadataStorage(cfg.MetadataPath), func() {}, nil
+	case "sqlite":
+		stor, err := sqlitestorage.NewMetadataStorage(ctx, cfg.SQLitePath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("sqlitestorage.NewMetadataStorage: %w", err)
+		}
+		return stor, func() { stor.Close() }, nil
+	case "postgres":
+		stor, err := pgstorage.NewMetadataStorage(ctx, cfg.PostgresDSN)
+		if err != nil {
+			return nil, nil, fmt.Errorf("pgstorage.NewMetadataStorage: %w", err)
+		}
+		return stor, func() { stor.Close() }, nil
+	default:
+		return nil, nil, fmt.Errorf("неизвестное хранилище метаданных: %s", cfg.MetadataStore)
+	}
+}
+
+// recoverable - хранилище на локальном диске, которое перед работой нужно привести в порядок.
+type recoverable interface {
+	MigrateLegacy(ctx context.Context) (int, error)
+	Recover(ctx context.Context) (int, error)
+}
+
+// recoverStorage - готовит хранилище на локальном диске к работе app и worker: данные раскладки
+// без тенантов переносятся в тенант по умолчанию, а в карантин - файлы, недописанные до сбоя
+// предыдущего запуска. Остальные хранилища не меняются. name - хранилище для журнала.
+func recoverStorage(ctx context.Context, stor any, name string) error {
+	r, ok := stor.(recoverable)
+	if !ok {
+		return nil
+	}
+
+	migrated, err := r.MigrateLegacy(ctx)
+	if err != nil {
+		return fmt.Errorf("MigrateLegacy: %w", err)
+	}
+	if migrated > 0 {
+		zlog.Logger.Info().Msgf("Данные без тенанта перенесены в тенант по умолчанию (%s): %d", name, migrated)
+	}
+
+	moved, err := r.Recover(ctx)
+	if err != nil {
+		return fmt.Errorf("Recover: %w", err)
+	}
+	if moved > 0 {
+		zlog.Logger.Warn().Msgf("В карантин перемещено файлов (%s): %d", name, moved)
+	}
+
+	return nil
+}
@@ -2,28 +2,44 @@ package entrypoint
 
 import (
 	"context"
-	"strings"
+	"fmt"
 
 	"github.com/sunr3d/image-processor/internal/config"
-	"github.com/sunr3d/image-processor/internal/infra/broker/kafka"
-	"github.com/sunr3d/image-processor/internal/infra/storage/filestorage"
+	"github.com/sunr3d/image-processor/internal/interfaces/infra"
 	"github.com/sunr3d/image-processor/internal/services/processor"
 	"github.com/sunr3d/image-processor/internal/services/worker"
 )
 
 func RunWorker(ctx context.Context, cfg *config.Config) error {
 	// Инфраслой
-	imgStor := filestorage.NewFileStorage(cfg.StoragePath)
-	metaStor := filestorage.NewMetadataStorage(cfg.MetadataPath)
+	stor, closeStor, err := openStorages(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("openStorages: %w", err)
+	}
+	defer closeStor()
 
-	kafkaBrokers := strings.Split(cfg.KafkaBrokers, ",")
-	subscriber := kafka.NewSubscriber(kafkaBrokers, cfg.KafkaTopic, cfg.KafkaGroup)
-	defer subscriber.Close()
+	subscriber, closeBroker, err := newWorkerSubscriber(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("newWorkerSubscriber: %w", err)
+	}
+	defer closeBroker()
 
+	return runWorker(ctx, cfg, stor, subscriber)
+}
+
+// runWorker - запускает обработку задач поверх готовых хранилищ и брокера.
+func runWorker(ctx context.Context, cfg *config.Config, stor *storages, subscriber infra.Subscriber) error {
 	// Сервисный слой
 	proc := processor.New(cfg.ThumbnailSize, cfg.ResizeWidth)
 
-	workerSvc := worker.New(proc, imgStor, metaStor, subscriber)
+	if cfg.WorkerShutdownGrace < 0 {
+		return fmt.Errorf("WORKER_SHUTDOWN_GRACE не может быть отрицательным")
+	}
+
+	events, closeEvents := newEventPublisher(cfg)
+	defer closeEvents()
+
+	workerSvc := worker.New(proc, stor.images, stor.metadata, subscriber, events, cfg.WorkerShutdownGrace)
 
 	return workerSvc.Start(ctx)
 }
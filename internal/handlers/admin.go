@@ -0,0 +1,54 @@
+package httphandlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/wb-go/wbf/ginext"
+	"github.com/wb-go/wbf/zlog"
+)
+
+const (
+	defaultReplayLimit = 100
+	maxReplayLimit     = 1000
+)
+
+type replayResp struct {
+	Replayed int    `json:"replayed"`
+	Message  string `json:"message"`
+}
+
+func (h *Handler) replayDeadLetters(c *ginext.Context) {
+	limit, err := parseIntParam(c, "limit")
+	if err != nil || limit > maxReplayLimit {
+		if err == nil {
+			err = fmt.Errorf("limit не может превышать %d", maxReplayLimit)
+		}
+		c.JSON(http.StatusBadRequest, errResp{
+			Error:   "Некорректные параметры запроса",
+			Code:    http.StatusBadRequest,
+			Details: err.Error(),
+		})
+		return
+	}
+	if limit == 0 {
+		limit = defaultReplayLimit
+	}
+
+	replayed, err := h.svc.ReplayDeadLetters(c.Request.Context(), limit)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Msg("Ошибка при повторе задач из DLQ")
+
+		c.JSON(http.StatusInternalServerError, errResp{
+			Error:   "Ошибка при повторе задач из DLQ",
+			Code:    http.StatusInternalServerError,
+			Details: fmt.Sprintf("возвращено задач до ошибки: %d: %s", replayed, err.Error()),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, replayResp{
+		Replayed: replayed,
+		Message:  "Задачи из DLQ возвращены в очередь обработки",
+	})
+}
@@ -4,27 +4,55 @@ import (
 	"github.com/wb-go/wbf/ginext"
 
 	"github.com/sunr3d/image-processor/internal/interfaces/services"
+	"github.com/sunr3d/image-processor/models"
 )
 
 type Handler struct {
-	svc services.ImageService
+	svc           services.ImageService
+	tenants       map[string]string // API ключ -> ID тенанта
+	uploadLimiter *rateLimiter
+	readLimiter   *rateLimiter
+	adminKey      string
 }
 
-func New(svc services.ImageService) *Handler {
+// New - конструктор Handler. adminKey - ключ администратора для /admin (пусто - эндпоинты отключены).
+func New(svc services.ImageService, tenants []models.Tenant, limits RateLimits, adminKey string) *Handler {
+	keys := make(map[string]string, len(tenants))
+	for _, t := range tenants {
+		keys[t.APIKey] = t.ID
+	}
+
 	return &Handler{
-		svc: svc,
+		svc:           svc,
+		tenants:       keys,
+		uploadLimiter: newRateLimiter(limits.Upload),
+		readLimiter:   newRateLimiter(limits.Read),
+		adminKey:      adminKey,
 	}
 }
 
 func (h *Handler) RegisterHandlers() *ginext.Engine {
 	router := ginext.New("")
-	router.Use(ginext.Logger(), ginext.Recovery())
+	router.Use(ginext.Logger(), ginext.Recovery(), requestIDMiddleware())
 
 	// API
-	router.POST("/upload", h.uploadImage)
-	router.GET("/image/:id", h.getImage)
-	router.DELETE("/image/:id", h.deleteImage)
-	router.GET("/status/:id", h.getStatus)
+	api := router.Group("")
+	api.Use(h.tenantMiddleware())
+	uploadLimit := h.uploadLimiter.middleware(h.rateLimitKey)
+	readLimit := h.readLimiter.middleware(h.rateLimitKey)
+	api.POST("/upload", uploadLimit, h.uploadImage)
+	api.GET("/image/:id", readLimit, h.getImage)
+	api.DELETE("/image/:id", uploadLimit, h.deleteImage)
+	api.POST("/image/:id/restore", uploadLimit, h.restoreImage)
+	api.POST("/image/:id/retry", uploadLimit, h.retryImage)
+	api.GET("/status/:id", readLimit, h.getStatus)
+	api.GET("/usage", readLimit, h.getUsage)
+	api.GET("/images", readLimit, h.listImages)
+
+	// Администрирование
+	admin := router.Group("/admin")
+	admin.Use(h.adminMiddleware())
+	admin.POST("/dlq/replay", h.replayDeadLetters)
 
 	// Web-UI
 	router.Static("/web", "./web")
@@ -1,11 +1,14 @@
 package httphandlers
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 
 	"github.com/wb-go/wbf/ginext"
 	"github.com/wb-go/wbf/zlog"
+
+	"github.com/sunr3d/image-processor/models"
 )
 
 func (h *Handler) uploadImage(c *ginext.Context) {
@@ -30,9 +33,51 @@ func (h *Handler) uploadImage(c *ginext.Context) {
 		return
 	}
 
-	id, err := h.svc.UploadImage(c.Request.Context(), file, header.Filename)
+	tags, err := parseTags(c.PostFormArray("tags"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errResp{
+			Error:   "Некорректные теги",
+			Code:    http.StatusBadRequest,
+			Details: err.Error(),
+		})
+		return
+	}
+
+	ttl, err := parseTTL(c.PostForm("ttl"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errResp{
+			Error:   "Некорректный срок хранения",
+			Code:    http.StatusBadRequest,
+			Details: err.Error(),
+		})
+		return
+	}
+
+	priority, err := parsePriority(c.PostForm("priority"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errResp{
+			Error:   "Некорректный приоритет",
+			Code:    http.StatusBadRequest,
+			Details: err.Error(),
+		})
+		return
+	}
+
+	opts := models.UploadOptions{Tags: tags, TTL: ttl, Priority: priority}
+
+	id, err := h.svc.UploadImage(c.Request.Context(), tenantFromCtx(c), file, header.Filename, opts)
 	if err != nil {
 		zlog.Logger.Error().Err(err).Msgf("Ошибка при загрузке изображения: %s", header.Filename)
+
+		if errors.Is(err, models.ErrQuotaExceeded) {
+			c.JSON(http.StatusForbidden, errResp{
+				Error:   "Превышена квота хранилища",
+				Code:    http.StatusForbidden,
+				Details: err.Error(),
+			})
+			return
+		}
+
 		c.JSON(http.StatusInternalServerError, errResp{
 			Error:   "Ошибка при загрузке изображения",
 			Code:    http.StatusInternalServerError,
@@ -52,6 +97,15 @@ func (h *Handler) getImage(c *ginext.Context) {
 	id := c.Param("id")
 	imageType := c.Query("type")
 
+	if !validateID(id) {
+		c.JSON(http.StatusBadRequest, errResp{
+			Error:   "Некорректный ID изображения",
+			Code:    http.StatusBadRequest,
+			Details: id,
+		})
+		return
+	}
+
 	if !validateImgType(imageType) {
 		c.JSON(http.StatusBadRequest, errResp{
 			Error:   "Неподдерживаемый тип изображения",
@@ -61,7 +115,7 @@ func (h *Handler) getImage(c *ginext.Context) {
 		return
 	}
 
-	path, err := h.svc.GetImage(c.Request.Context(), id, imageType)
+	content, err := h.svc.GetImage(c.Request.Context(), tenantFromCtx(c), id, imageType)
 	if err != nil {
 		zlog.Logger.Error().Err(err).Msgf("Ошибка при получении изображения: %s", id)
 
@@ -89,13 +143,30 @@ func (h *Handler) getImage(c *ginext.Context) {
 		return
 	}
 
-	c.File(path)
+	if content.RedirectURL != "" {
+		c.Redirect(http.StatusFound, content.RedirectURL)
+		return
+	}
+	defer content.Body.Close()
+
+	// ServeContent поддерживает Range и If-Modified-Since за счет произвольного доступа к телу.
+	c.Header("Content-Type", content.ContentType)
+	http.ServeContent(c.Writer, c.Request, "", content.ModTime, content.Body)
 }
 
 func (h *Handler) deleteImage(c *ginext.Context) {
 	id := c.Param("id")
 
-	if err := h.svc.DeleteImage(c.Request.Context(), id); err != nil {
+	if !validateID(id) {
+		c.JSON(http.StatusBadRequest, errResp{
+			Error:   "Некорректный ID изображения",
+			Code:    http.StatusBadRequest,
+			Details: id,
+		})
+		return
+	}
+
+	if err := h.svc.DeleteImage(c.Request.Context(), tenantFromCtx(c), id); err != nil {
 		zlog.Logger.Error().Err(err).Msgf("Ошибка при удалении изображения: %s", id)
 		if strings.Contains(err.Error(), "не найден") {
 			c.JSON(http.StatusNotFound, errResp{
@@ -111,18 +182,126 @@ func (h *Handler) deleteImage(c *ginext.Context) {
 			Code:    http.StatusInternalServerError,
 			Details: err.Error(),
 		})
+		return
 	}
 
 	c.JSON(http.StatusOK, deleteResp{
 		Status:  "deleted",
-		Message: "Изображение успешно удалено",
+		Message: "Изображение удалено, его можно восстановить через POST /image/:id/restore",
+	})
+}
+
+func (h *Handler) restoreImage(c *ginext.Context) {
+	id := c.Param("id")
+
+	if !validateID(id) {
+		c.JSON(http.StatusBadRequest, errResp{
+			Error:   "Некорректный ID изображения",
+			Code:    http.StatusBadRequest,
+			Details: id,
+		})
+		return
+	}
+
+	if err := h.svc.RestoreImage(c.Request.Context(), tenantFromCtx(c), id); err != nil {
+		zlog.Logger.Error().Err(err).Msgf("Ошибка при восстановлении изображения: %s", id)
+
+		if strings.Contains(err.Error(), "не найден") {
+			c.JSON(http.StatusNotFound, errResp{
+				Error:   "Изображение не найдено",
+				Code:    http.StatusNotFound,
+				Details: err.Error(),
+			})
+			return
+		} else if strings.Contains(err.Error(), "не удалено") {
+			c.JSON(http.StatusConflict, errResp{
+				Error:   "Изображение не удалено",
+				Code:    http.StatusConflict,
+				Details: err.Error(),
+			})
+			return
+		} else if strings.Contains(err.Error(), "срок восстановления") {
+			c.JSON(http.StatusGone, errResp{
+				Error:   "Срок восстановления изображения истек",
+				Code:    http.StatusGone,
+				Details: err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errResp{
+			Error:   "Ошибка при восстановлении изображения",
+			Code:    http.StatusInternalServerError,
+			Details: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, deleteResp{
+		Status:  "restored",
+		Message: "Изображение успешно восстановлено",
+	})
+}
+
+func (h *Handler) retryImage(c *ginext.Context) {
+	id := c.Param("id")
+
+	if !validateID(id) {
+		c.JSON(http.StatusBadRequest, errResp{
+			Error:   "Некорректный ID изображения",
+			Code:    http.StatusBadRequest,
+			Details: id,
+		})
+		return
+	}
+
+	if err := h.svc.RetryImage(c.Request.Context(), tenantFromCtx(c), id); err != nil {
+		zlog.Logger.Error().Err(err).Msgf("Ошибка при повторной обработке изображения: %s", id)
+
+		if strings.Contains(err.Error(), "не найден") {
+			c.JSON(http.StatusNotFound, errResp{
+				Error:   "Изображение не найдено",
+				Code:    http.StatusNotFound,
+				Details: err.Error(),
+			})
+			return
+		} else if strings.Contains(err.Error(), "не в статусе failed") || errors.Is(err, models.ErrVersionConflict) {
+			c.JSON(http.StatusConflict, errResp{
+				Error:   "Изображение не требует повторной обработки",
+				Code:    http.StatusConflict,
+				Details: err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errResp{
+			Error:   "Ошибка при повторной обработке изображения",
+			Code:    http.StatusInternalServerError,
+			Details: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, statusResp{
+		ID:      id,
+		Status:  string(models.StatusPending),
+		Message: "Изображение поставлено в очередь на повторную обработку",
 	})
 }
 
 func (h *Handler) getStatus(c *ginext.Context) {
 	id := c.Param("id")
 
-	meta, err := h.svc.GetImgMeta(c.Request.Context(), id)
+	if !validateID(id) {
+		c.JSON(http.StatusBadRequest, errResp{
+			Error:   "Некорректный ID изображения",
+			Code:    http.StatusBadRequest,
+			Details: id,
+		})
+		return
+	}
+
+	meta, err := h.svc.GetImgMeta(c.Request.Context(), tenantFromCtx(c), id)
 	if err != nil {
 		if strings.Contains(err.Error(), "не найден") {
 			c.JSON(http.StatusNotFound, errResp{
@@ -149,8 +328,95 @@ func (h *Handler) getStatus(c *ginext.Context) {
 	}
 
 	c.JSON(http.StatusOK, statusResp{
-		ID:      meta.ID,
-		Status:  string(meta.Status),
-		Message: meta.ErrorMessage,
+		ID:        meta.ID,
+		Status:    string(meta.Status),
+		Message:   meta.ErrorMessage,
+		Attempts:  meta.Attempts,
+		ExpiresAt: optionalTime(meta.ExpiresAt),
+	})
+}
+
+func (h *Handler) getUsage(c *ginext.Context) {
+	usage, err := h.svc.GetUsage(c.Request.Context(), tenantFromCtx(c))
+	if err != nil {
+		zlog.Logger.Error().Err(err).Msgf("Ошибка при получении использования хранилища: %s", tenantFromCtx(c))
+		c.JSON(http.StatusInternalServerError, errResp{
+			Error:   "Ошибка при получении использования хранилища",
+			Code:    http.StatusInternalServerError,
+			Details: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, usageResp{
+		TenantID: usage.TenantID,
+		Originals: usageCounter{
+			Count: usage.OriginalsCount,
+			Bytes: usage.OriginalsBytes,
+		},
+		Derivatives: usageCounter{
+			Count: usage.DerivativesCount,
+			Bytes: usage.DerivativesBytes,
+		},
+		TotalBytes: usage.TotalBytes(),
+		Quota: quotaResp{
+			MaxImages: usage.MaxImages,
+			MaxBytes:  usage.MaxBytes,
+		},
 	})
 }
+
+func (h *Handler) listImages(c *ginext.Context) {
+	query, err := parseImageQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errResp{
+			Error:   "Некорректные параметры поиска",
+			Code:    http.StatusBadRequest,
+			Details: err.Error(),
+		})
+		return
+	}
+
+	page, err := h.svc.ListImages(c.Request.Context(), tenantFromCtx(c), query)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Msg("Ошибка при поиске изображений")
+
+		if strings.Contains(err.Error(), "некорректн") {
+			c.JSON(http.StatusBadRequest, errResp{
+				Error:   "Некорректные параметры поиска",
+				Code:    http.StatusBadRequest,
+				Details: err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errResp{
+			Error:   "Ошибка при поиске изображений",
+			Code:    http.StatusInternalServerError,
+			Details: err.Error(),
+		})
+		return
+	}
+
+	resp := listResp{
+		Items:      make([]imageResp, 0, len(page.Items)),
+		NextCursor: page.NextCursor,
+	}
+	for _, meta := range page.Items {
+		resp.Items = append(resp.Items, imageResp{
+			ID:           meta.ID,
+			Status:       string(meta.Status),
+			OriginalName: meta.OriginalName,
+			Format:       meta.Format,
+			Width:        meta.Width,
+			Height:       meta.Height,
+			Size:         meta.OriginalSize,
+			Tags:         meta.Tags,
+			ExpiresAt:    optionalTime(meta.ExpiresAt),
+			CreatedAt:    meta.CreatedAt,
+			UpdatedAt:    meta.UpdatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,104 @@
+package httphandlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/wb-go/wbf/ginext"
+
+	"github.com/sunr3d/image-processor/models"
+)
+
+const (
+	apiKeyHeader   = "X-API-Key"
+	apiKeyQuery    = "api_key"
+	adminKeyHeader = "X-Admin-Key"
+	tenantCtxKey   = "tenant_id"
+
+	requestIDHeader    = "X-Request-ID"
+	maxRequestIDLength = 128
+)
+
+// requestIDMiddleware - берет ID запроса из X-Request-ID (или генерирует новый), возвращает его в
+// ответе и кладет в контекст запроса, чтобы поставленные задачи несли ID корреляции.
+func requestIDMiddleware() ginext.HandlerFunc {
+	return func(c *ginext.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if id == "" || len(id) > maxRequestIDLength {
+			id = uuid.New().String()
+		}
+
+		c.Header(requestIDHeader, id)
+		c.Request = c.Request.WithContext(models.WithCorrelationID(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+// tenantMiddleware - определяет тенанта по API ключу. Без настроенных тенантов все запросы
+// относятся к тенанту по умолчанию.
+func (h *Handler) tenantMiddleware() ginext.HandlerFunc {
+	return func(c *ginext.Context) {
+		if len(h.tenants) == 0 {
+			c.Set(tenantCtxKey, models.DefaultTenantID)
+			c.Next()
+			return
+		}
+
+		apiKey := c.GetHeader(apiKeyHeader)
+		if apiKey == "" {
+			apiKey = c.Query(apiKeyQuery)
+		}
+
+		tenantID, ok := h.tenants[apiKey]
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, errResp{
+				Error: "Необходим действительный API ключ",
+				Code:  http.StatusUnauthorized,
+			})
+			return
+		}
+
+		c.Set(tenantCtxKey, tenantID)
+		c.Next()
+	}
+}
+
+// adminMiddleware - пропускает только запросы с ключом администратора. Без настроенного ключа
+// эндпоинты администрирования недоступны.
+func (h *Handler) adminMiddleware() ginext.HandlerFunc {
+	return func(c *ginext.Context) {
+		if h.adminKey == "" {
+			c.AbortWithStatusJSON(http.StatusNotFound, errResp{
+				Error: "Администрирование отключено",
+				Code:  http.StatusNotFound,
+			})
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(c.GetHeader(adminKeyHeader)), []byte(h.adminKey)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, errResp{
+				Error: "Необходим действительный ключ администратора",
+				Code:  http.StatusUnauthorized,
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// rateLimitKey - ключ корзины лимита запросов: тенант, определенный по API ключу, а без
+// настроенных тенантов - IP клиента. Непроверенный API ключ ключом не служит, иначе клиент
+// получал бы новую корзину на каждый запрос со случайным ключом.
+func (h *Handler) rateLimitKey(c *ginext.Context) string {
+	if len(h.tenants) == 0 {
+		return "ip:" + c.ClientIP()
+	}
+
+	return "tenant:" + tenantFromCtx(c)
+}
+
+func tenantFromCtx(c *ginext.Context) string {
+	return c.GetString(tenantCtxKey)
+}
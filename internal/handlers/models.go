@@ -1,5 +1,7 @@
 package httphandlers
 
+import "time"
+
 type uploadResp struct {
 	ID      string `json:"id"`
 	Status  string `json:"status"`
@@ -12,9 +14,48 @@ type deleteResp struct {
 }
 
 type statusResp struct {
-	ID      string `json:"id"`
-	Status  string `json:"status"`
-	Message string `json:"message"`
+	ID        string     `json:"id"`
+	Status    string     `json:"status"`
+	Message   string     `json:"message"`
+	Attempts  int        `json:"attempts,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type usageResp struct {
+	TenantID    string       `json:"tenant_id"`
+	Originals   usageCounter `json:"originals"`
+	Derivatives usageCounter `json:"derivatives"`
+	TotalBytes  int64        `json:"total_bytes"`
+	Quota       quotaResp    `json:"quota"`
+}
+
+type usageCounter struct {
+	Count int   `json:"count"`
+	Bytes int64 `json:"bytes"`
+}
+
+type quotaResp struct {
+	MaxImages int   `json:"max_images"`
+	MaxBytes  int64 `json:"max_bytes"`
+}
+
+type imageResp struct {
+	ID           string     `json:"id"`
+	Status       string     `json:"status"`
+	OriginalName string     `json:"original_name"`
+	Format       string     `json:"format,omitempty"`
+	Width        int        `json:"width,omitempty"`
+	Height       int        `json:"height,omitempty"`
+	Size         int64      `json:"size"`
+	Tags         []string   `json:"tags,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+type listResp struct {
+	Items      []imageResp `json:"items"`
+	NextCursor string      `json:"next_cursor,omitempty"`
 }
 
 type errResp struct {
@@ -22,3 +63,11 @@ type errResp struct {
 	Code    int    `json:"code,omitempty"`
 	Details string `json:"details,omitempty"`
 }
+
+// optionalTime - нулевое время не попадает в ответ.
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
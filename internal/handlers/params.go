@@ -0,0 +1,170 @@
+package httphandlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wb-go/wbf/ginext"
+
+	"github.com/sunr3d/image-processor/models"
+)
+
+const (
+	maxTags      = 20
+	maxTagLength = 64
+)
+
+// parseTags - разбирает теги, переданные через запятую или несколькими значениями.
+func parseTags(values []string) ([]string, error) {
+	var tags []string
+	seen := make(map[string]struct{})
+
+	for _, value := range values {
+		for _, tag := range strings.Split(value, ",") {
+			tag = strings.ToLower(strings.TrimSpace(tag))
+			if tag == "" {
+				continue
+			}
+			if len(tag) > maxTagLength {
+				return nil, fmt.Errorf("слишком длинный тег: %s", tag)
+			}
+			if _, ok := seen[tag]; ok {
+				continue
+			}
+			seen[tag] = struct{}{}
+			tags = append(tags, tag)
+		}
+	}
+
+	if len(tags) > maxTags {
+		return nil, fmt.Errorf("слишком много тегов: %d (максимум %d)", len(tags), maxTags)
+	}
+
+	return tags, nil
+}
+
+// parsePriority - разбирает приоритет обработки загружаемого изображения. Пустое значение
+// означает интерактивный приоритет.
+func parsePriority(raw string) (models.TaskPriority, error) {
+	switch priority := models.TaskPriority(strings.ToLower(strings.TrimSpace(raw))); priority {
+	case "", models.PriorityInteractive:
+		return models.PriorityInteractive, nil
+	case models.PriorityBulk:
+		return priority, nil
+	default:
+		return "", fmt.Errorf("неизвестный приоритет: %s (допустимо interactive, bulk)", raw)
+	}
+}
+
+// parseTTL - разбирает срок хранения загружаемого изображения: длительность вида 24h или число секунд.
+// Пустое значение означает срок по умолчанию тенанта.
+func parseTTL(raw string) (time.Duration, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return 0, nil
+	}
+
+	ttl, err := time.ParseDuration(raw)
+	if err != nil {
+		secs, convErr := strconv.ParseInt(raw, 10, 64)
+		if convErr != nil {
+			return 0, fmt.Errorf("некорректный срок хранения: %s", raw)
+		}
+		ttl = time.Duration(secs) * time.Second
+	}
+
+	if ttl <= 0 {
+		return 0, fmt.Errorf("срок хранения должен быть положительным: %s", raw)
+	}
+
+	return ttl, nil
+}
+
+// parseImageQuery - разбирает параметры поиска GET /images.
+func parseImageQuery(c *ginext.Context) (*models.ImageQuery, error) {
+	q := &models.ImageQuery{
+		NameContains: c.Query("name"),
+		Format:       c.Query("format"),
+		SortBy:       c.Query("sort"),
+		Cursor:       c.Query("cursor"),
+	}
+
+	for _, st := range strings.Split(c.Query("status"), ",") {
+		st = strings.TrimSpace(st)
+		if st == "" {
+			continue
+		}
+		if !validateStatus(st) {
+			return nil, fmt.Errorf("некорректный статус: %s", st)
+		}
+		q.Statuses = append(q.Statuses, models.ImageStatus(st))
+	}
+
+	switch order := c.DefaultQuery("order", "desc"); order {
+	case "asc":
+	case "desc":
+		q.Desc = true
+	default:
+		return nil, fmt.Errorf("некорректный порядок сортировки: %s", order)
+	}
+
+	var err error
+	if q.CreatedFrom, err = parseTimeParam(c, "created_from"); err != nil {
+		return nil, err
+	}
+	if q.CreatedTo, err = parseTimeParam(c, "created_to"); err != nil {
+		return nil, err
+	}
+
+	ints := []struct {
+		name string
+		dst  *int
+	}{
+		{"min_width", &q.MinWidth},
+		{"max_width", &q.MaxWidth},
+		{"min_height", &q.MinHeight},
+		{"max_height", &q.MaxHeight},
+		{"limit", &q.Limit},
+	}
+	for _, p := range ints {
+		if *p.dst, err = parseIntParam(c, p.name); err != nil {
+			return nil, err
+		}
+	}
+
+	if q.Tags, err = parseTags(c.QueryArray("tag")); err != nil {
+		return nil, err
+	}
+
+	return q, nil
+}
+
+func parseTimeParam(c *ginext.Context, name string) (time.Time, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("некорректное значение %s (ожидается RFC3339): %s", name, raw)
+	}
+
+	return t, nil
+}
+
+func parseIntParam(c *ginext.Context, name string) (int, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return 0, nil
+	}
+
+	v, err := strconv.Atoi(raw)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("некорректное значение %s: %s", name, raw)
+	}
+
+	return v, nil
+}
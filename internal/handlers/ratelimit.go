@@ -0,0 +1,114 @@
+package httphandlers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/wb-go/wbf/ginext"
+	"golang.org/x/time/rate"
+)
+
+const (
+	limiterIdleTTL       = 10 * time.Minute
+	limiterSweepInterval = time.Minute
+)
+
+// RateLimit - параметры token bucket: RPS - скорость пополнения, Burst - емкость. RPS <= 0 отключает лимит.
+type RateLimit struct {
+	RPS   float64
+	Burst int
+}
+
+// RateLimits - лимиты по группам эндпоинтов: Upload - загрузка, удаление и запросы, ставящие
+// задачи на обработку, Read - остальные запросы API.
+type RateLimits struct {
+	Upload RateLimit
+	Read   RateLimit
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+type rateLimiter struct {
+	limit     RateLimit
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func newRateLimiter(limit RateLimit) *rateLimiter {
+	return &rateLimiter{
+		limit:     limit,
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// middleware - ограничивает частоту запросов по ключу клиента, который возвращает key.
+func (rl *rateLimiter) middleware(key func(c *ginext.Context) string) ginext.HandlerFunc {
+	return func(c *ginext.Context) {
+		if rl.limit.RPS <= 0 {
+			c.Next()
+			return
+		}
+
+		key := key(c)
+		delay := rl.reserve(key)
+		if delay > 0 {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, errResp{
+				Error: "Слишком много запросов",
+				Code:  http.StatusTooManyRequests,
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// reserve - берет токен из корзины ключа. Если токена нет, возвращает время до его появления.
+func (rl *rateLimiter) reserve(key string) time.Duration {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	rl.sweep(now)
+
+	b, ok := rl.buckets[key]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(rate.Limit(rl.limit.RPS), max(rl.limit.Burst, 1))}
+		rl.buckets[key] = b
+	}
+	b.lastSeen = now
+
+	r := b.limiter.ReserveN(now, 1)
+	if !r.OK() {
+		return time.Second
+	}
+
+	delay := r.DelayFrom(now)
+	if delay > 0 {
+		r.CancelAt(now)
+	}
+
+	return delay
+}
+
+func (rl *rateLimiter) sweep(now time.Time) {
+	if now.Sub(rl.lastSweep) < limiterSweepInterval {
+		return
+	}
+
+	for key, b := range rl.buckets {
+		if now.Sub(b.lastSeen) > limiterIdleTTL {
+			delete(rl.buckets, key)
+		}
+	}
+	rl.lastSweep = now
+}
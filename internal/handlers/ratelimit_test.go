@@ -0,0 +1,111 @@
+package httphandlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/sunr3d/image-processor/mocks"
+	"github.com/sunr3d/image-processor/models"
+)
+
+const testImageID = "550e8400-e29b-41d4-a716-446655440000"
+
+func TestRateLimit_SingleTenantByIP(t *testing.T) {
+	svc := mocks.NewImageService(t)
+	svc.EXPECT().
+		GetImgMeta(mock.Anything, models.DefaultTenantID, testImageID).
+		Return(&models.ImageMetadata{ID: testImageID, Status: models.StatusPending}, nil).
+		Once()
+
+	h := New(svc, nil, RateLimits{Read: RateLimit{RPS: 0.5, Burst: 1}}, "")
+	router := h.RegisterHandlers()
+
+	first := serve(router, http.MethodGet, "/status/"+testImageID, "key-1")
+	// Случайный API ключ без настроенных тенантов не дает новой корзины.
+	second := serve(router, http.MethodGet, "/status/"+testImageID, "key-2")
+
+	assert.Equal(t, http.StatusOK, first.Code)
+	assert.Equal(t, http.StatusTooManyRequests, second.Code)
+	assert.Equal(t, "2", second.Header().Get("Retry-After"))
+}
+
+func TestRateLimit_PerTenant(t *testing.T) {
+	svc := mocks.NewImageService(t)
+	svc.EXPECT().
+		GetImgMeta(mock.Anything, mock.Anything, testImageID).
+		Return(&models.ImageMetadata{ID: testImageID, Status: models.StatusPending}, nil).
+		Twice()
+
+	tenants := []models.Tenant{{ID: "a", APIKey: "key-a"}, {ID: "b", APIKey: "key-b"}}
+	h := New(svc, tenants, RateLimits{Read: RateLimit{RPS: 1, Burst: 1}}, "")
+	router := h.RegisterHandlers()
+
+	assert.Equal(t, http.StatusOK, serve(router, http.MethodGet, "/status/"+testImageID, "key-a").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve(router, http.MethodGet, "/status/"+testImageID, "key-a").Code)
+	assert.Equal(t, http.StatusOK, serve(router, http.MethodGet, "/status/"+testImageID, "key-b").Code)
+	// Недействительный ключ отклоняется до лимита и не расходует корзины.
+	assert.Equal(t, http.StatusUnauthorized, serve(router, http.MethodGet, "/status/"+testImageID, "key-x").Code)
+}
+
+func TestRateLimit_DeleteUsesUploadLimit(t *testing.T) {
+	svc := mocks.NewImageService(t)
+	svc.EXPECT().
+		DeleteImage(mock.Anything, models.DefaultTenantID, testImageID).
+		Return(nil).
+		Once()
+	svc.EXPECT().
+		GetImgMeta(mock.Anything, models.DefaultTenantID, testImageID).
+		Return(&models.ImageMetadata{ID: testImageID, Status: models.StatusPending}, nil).
+		Once()
+
+	h := New(svc, nil, RateLimits{
+		Upload: RateLimit{RPS: 1, Burst: 1},
+		Read:   RateLimit{RPS: 1, Burst: 1},
+	}, "")
+	router := h.RegisterHandlers()
+
+	assert.Equal(t, http.StatusOK, serve(router, http.MethodDelete, "/image/"+testImageID, "").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve(router, http.MethodPost, "/upload", "").Code)
+	// Удаление не расходует корзину чтения.
+	assert.Equal(t, http.StatusOK, serve(router, http.MethodGet, "/status/"+testImageID, "").Code)
+}
+
+func TestRateLimit_RestoreAndRetryUseUploadLimit(t *testing.T) {
+	svc := mocks.NewImageService(t)
+	svc.EXPECT().
+		RestoreImage(mock.Anything, models.DefaultTenantID, testImageID).
+		Return(nil).
+		Once()
+	svc.EXPECT().
+		GetImgMeta(mock.Anything, models.DefaultTenantID, testImageID).
+		Return(&models.ImageMetadata{ID: testImageID, Status: models.StatusPending}, nil).
+		Once()
+
+	h := New(svc, nil, RateLimits{
+		Upload: RateLimit{RPS: 1, Burst: 1},
+		Read:   RateLimit{RPS: 1, Burst: 1},
+	}, "")
+	router := h.RegisterHandlers()
+
+	assert.Equal(t, http.StatusOK, serve(router, http.MethodPost, "/image/"+testImageID+"/restore", "").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve(router, http.MethodPost, "/image/"+testImageID+"/retry", "").Code)
+	// Корзина чтения не тронута.
+	assert.Equal(t, http.StatusOK, serve(router, http.MethodGet, "/status/"+testImageID, "").Code)
+}
+
+// helpers
+func serve(h http.Handler, method, path, apiKey string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if apiKey != "" {
+		req.Header.Set(apiKeyHeader, apiKey)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	return w
+}
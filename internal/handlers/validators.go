@@ -1,5 +1,11 @@
 package httphandlers
 
+import (
+	"github.com/google/uuid"
+
+	"github.com/sunr3d/image-processor/models"
+)
+
 func validateContentType(contentType string) bool {
 	validTypes := []string{
 		"image/jpeg",
@@ -33,3 +39,25 @@ func validateImgType(imageType string) bool {
 
 	return false
 }
+
+func validateID(id string) bool {
+	_, err := uuid.Parse(id)
+	return err == nil
+}
+
+func validateStatus(status string) bool {
+	validStatuses := []models.ImageStatus{
+		models.StatusPending,
+		models.StatusProcessing,
+		models.StatusCompleted,
+		models.StatusFailed,
+	}
+
+	for _, validStatus := range validStatuses {
+		if string(validStatus) == status {
+			return true
+		}
+	}
+
+	return false
+}
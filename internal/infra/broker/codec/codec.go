@@ -0,0 +1,48 @@
+// Package codec - формат задач в брокерах: конверт с версией схемы и служебными полями.
+package codec
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/sunr3d/image-processor/models"
+)
+
+// Encode - сериализует задачу в конверт текущей версии схемы.
+func Encode(env *models.TaskEnvelope) ([]byte, error) {
+	out := *env
+	out.SchemaVersion = models.TaskSchemaVersion
+	if out.Type == "" {
+		out.Type = models.TaskTypeProcessImage
+	}
+
+	data, err := json.Marshal(&out)
+	if err != nil {
+		return nil, fmt.Errorf("json.Marshal: %w", err)
+	}
+
+	return data, nil
+}
+
+// Decode - разбирает задачу в конверте любой версии схемы до текущей включительно или задачу
+// без конверта (версия 0). Неизвестные поля игнорируются. Задачи более новой версии схемы
+// и неизвестных типов не принимаются: их нужно обработать после обновления worker.
+func Decode(data []byte) (*models.TaskEnvelope, error) {
+	var env models.TaskEnvelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal: %w", err)
+	}
+
+	if env.SchemaVersion > models.TaskSchemaVersion {
+		return nil, fmt.Errorf("неподдерживаемая версия схемы задачи: %d (поддерживается до %d)",
+			env.SchemaVersion, models.TaskSchemaVersion)
+	}
+	if env.SchemaVersion == 0 {
+		env.Type = models.TaskTypeProcessImage
+	}
+	if env.Type != models.TaskTypeProcessImage {
+		return nil, fmt.Errorf("неизвестный тип задачи: %s", env.Type)
+	}
+
+	return &env, nil
+}
@@ -0,0 +1,92 @@
+package codec
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sunr3d/image-processor/models"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	createdAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	env := &models.TaskEnvelope{
+		CreatedAt:      createdAt,
+		Attempt:        2,
+		IdempotencyKey: "entry-1",
+		ProcessingTask: models.ProcessingTask{
+			TenantID:      "acme",
+			ImageID:       "img-1",
+			Priority:      models.PriorityBulk,
+			CorrelationID: "req-1",
+		},
+	}
+
+	data, err := Encode(env)
+	require.NoError(t, err)
+
+	got, err := Decode(data)
+	require.NoError(t, err)
+	assert.Equal(t, models.TaskSchemaVersion, got.SchemaVersion)
+	assert.Equal(t, models.TaskTypeProcessImage, got.Type)
+	assert.Equal(t, createdAt, got.CreatedAt)
+	assert.Equal(t, 2, got.Attempt)
+	assert.Equal(t, "entry-1", got.IdempotencyKey)
+	assert.Equal(t, env.ProcessingTask, got.ProcessingTask)
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    models.ProcessingTask
+		version int
+		wantErr string
+	}{
+		{
+			name:    "bare task",
+			data:    `{"TenantID":"acme","ImageID":"img-1","OriginalPath":"","Priority":"bulk"}`,
+			want:    models.ProcessingTask{TenantID: "acme", ImageID: "img-1", Priority: models.PriorityBulk},
+			version: 0,
+		},
+		{
+			name:    "unknown fields",
+			data:    `{"SchemaVersion":1,"Type":"image.process","ImageID":"img-1","TraceParent":"00-abc"}`,
+			want:    models.ProcessingTask{ImageID: "img-1"},
+			version: 1,
+		},
+		{
+			name:    "newer schema",
+			data:    `{"SchemaVersion":2,"Type":"image.process","ImageID":"img-1"}`,
+			wantErr: "неподдерживаемая версия схемы задачи",
+		},
+		{
+			name:    "unknown type",
+			data:    `{"SchemaVersion":1,"Type":"video.process","ImageID":"img-1"}`,
+			wantErr: "неизвестный тип задачи",
+		},
+		{
+			name:    "not json",
+			data:    `not json`,
+			wantErr: "json.Unmarshal",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode([]byte(tt.data))
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.version, got.SchemaVersion)
+			assert.Equal(t, models.TaskTypeProcessImage, got.Type)
+			assert.Equal(t, tt.want, got.ProcessingTask)
+		})
+	}
+}
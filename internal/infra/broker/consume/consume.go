@@ -0,0 +1,59 @@
+// Package consume - общая для брокеров логика обработки задач: повторы с растущей задержкой,
+// выбор сообщений из очередей приоритетов по весам и распределение задач по горутинам
+// с сохранением порядка задач одного изображения.
+package consume
+
+import (
+	"context"
+	"hash/fnv"
+	"time"
+
+	"github.com/wb-go/wbf/retry"
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/sunr3d/image-processor/models"
+)
+
+// Handle - выполняет handler, повторяя его при ошибке по стратегии strategy. Повторы прекращаются
+// при отмене ctx. Последняя попытка получает контекст с отметкой models.WithLastAttempt.
+// Возвращает количество сделанных попыток и ошибку последней попытки.
+func Handle(
+	ctx context.Context,
+	handler func(ctx context.Context, task *models.ProcessingTask) error,
+	task *models.ProcessingTask,
+	strategy retry.Strategy,
+) (int, error) {
+	attempts := max(strategy.Attempts, 1)
+	delay := strategy.Delay
+
+	for attempt := 1; ; attempt++ {
+		attemptCtx := ctx
+		if attempt == attempts {
+			attemptCtx = models.WithLastAttempt(ctx)
+		}
+
+		err := handler(attemptCtx, task)
+		if err == nil || attempt == attempts {
+			return attempt, err
+		}
+
+		zlog.Logger.Warn().Err(err).Msgf("Попытка %d из %d обработки задачи %s не удалась, повтор через %s",
+			attempt, attempts, task.ImageID, delay)
+
+		select {
+		case <-ctx.Done():
+			return attempt, err
+		case <-time.After(delay):
+		}
+		delay = time.Duration(float64(delay) * strategy.Backoff)
+	}
+}
+
+// Lane - номер горутины обработки из lanes для задачи с ключом key (ID изображения).
+// Задачи с одним ключом всегда попадают в одну горутину.
+func Lane(key string, lanes int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+
+	return int(h.Sum32() % uint32(lanes))
+}
@@ -0,0 +1,61 @@
+package consume
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wb-go/wbf/retry"
+
+	"github.com/sunr3d/image-processor/models"
+)
+
+func TestHandle_RetriesUntilSuccess(t *testing.T) {
+	calls := 0
+	attempts, err := Handle(context.Background(), func(ctx context.Context, task *models.ProcessingTask) error {
+		calls++
+		if calls < 2 {
+			return errors.New("disk is busy")
+		}
+		return nil
+	}, &models.ProcessingTask{ImageID: "img-1"}, retry.Strategy{Attempts: 3, Delay: time.Millisecond, Backoff: 2})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+}
+
+func TestHandle_Exhausted(t *testing.T) {
+	var last []bool
+	attempts, err := Handle(context.Background(), func(ctx context.Context, task *models.ProcessingTask) error {
+		last = append(last, models.IsLastAttempt(ctx))
+		return errors.New("disk is full")
+	}, &models.ProcessingTask{ImageID: "img-1"}, retry.Strategy{Attempts: 3, Delay: time.Millisecond, Backoff: 2})
+
+	assert.Error(t, err)
+	assert.Equal(t, 3, attempts)
+	// Только последняя попытка отмечена в контексте.
+	assert.Equal(t, []bool{false, false, true}, last)
+}
+
+func TestHandle_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	attempts, err := Handle(ctx, func(ctx context.Context, task *models.ProcessingTask) error {
+		cancel()
+		return ctx.Err()
+	}, &models.ProcessingTask{ImageID: "img-1"}, retry.Strategy{Attempts: 3, Delay: time.Hour, Backoff: 2})
+
+	assert.Error(t, err)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestLane(t *testing.T) {
+	assert.Equal(t, Lane("img-1", 8), Lane("img-1", 8))
+	for _, key := range []string{"", "img-1", "img-2", "img-3"} {
+		lane := Lane(key, 4)
+		assert.GreaterOrEqual(t, lane, 0)
+		assert.Less(t, lane, 4)
+	}
+}
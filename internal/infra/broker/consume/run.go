@@ -0,0 +1,199 @@
+package consume
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/wb-go/wbf/zlog"
+)
+
+// laneBuffer - сколько сообщений может ждать своей очереди в одной горутине обработки.
+const laneBuffer = 1
+
+// Source - очередь приоритета брокера и ее вес: при занятых горутинах обработки из очереди
+// с весом w берется w сообщений на каждое сообщение очереди с весом 1.
+type Source[T any] struct {
+	Weight int
+	// Fetch - ждет следующие сообщения очереди. Временные ошибки брокера Fetch повторяет сам;
+	// возвращенная ошибка, кроме отмены ctx, останавливает подписку.
+	Fetch func(ctx context.Context) ([]T, error)
+}
+
+// Broker - операции брокера над сообщениями типа T, из которых Run собирает подписку.
+type Broker[T any] struct {
+	// Name - имя брокера для журнала.
+	Name    string
+	Sources []Source[T]
+	// Key - ключ сообщения (ID изображения): сообщения с одним ключом обрабатываются по порядку.
+	Key func(msg T) string
+	// Dispatched - вызывается перед передачей сообщения в горутину обработки. Может быть nil.
+	Dispatched func(msg T)
+	// Consume - обрабатывает сообщение. nil - сообщение можно подтвердить: задача обработана
+	// или отправлена в DLQ; ошибка, кроме отмены ctx, останавливает подписку.
+	Consume func(ctx context.Context, msg T) error
+	// Ack - подтверждает сообщение после Consume без ошибки. Может быть nil.
+	Ack func(ctx context.Context, msg T)
+	// Release - отпускает сообщение, которое не будет подтверждено: полученное, но не начатое
+	// при остановке, или прерванное. Может быть nil.
+	Release func(msg T)
+}
+
+// Run - читает сообщения из очередей брокера по весам и обрабатывает их в concurrency горутинах
+// до отмены ctx или ошибки. Сообщения с одним ключом всегда попадают в одну горутину и
+// обрабатываются по порядку; пока горутина занята, чтение новых сообщений для нее приостанавливается.
+// После остановки чтения новые задачи не начинаются, а уже начатые дожидаются завершения.
+// Возвращает nil при отмене ctx, иначе ошибку чтения или обработки.
+func Run[T any](ctx context.Context, b Broker[T], concurrency int) error {
+	r := &runner[T]{b: b}
+
+	// Ошибка одной из горутин останавливает чтение новых сообщений.
+	dispatchCtx, stop := context.WithCancelCause(ctx)
+	defer stop(nil)
+
+	var fetchers sync.WaitGroup
+	notify := make(chan struct{}, 1)
+	inputs := make([]<-chan T, len(b.Sources))
+	ready := make([]chan T, len(b.Sources))
+	weights := make([]int, len(b.Sources))
+	for i, src := range b.Sources {
+		ready[i] = make(chan T, 1)
+		inputs[i] = ready[i]
+		weights[i] = max(src.Weight, 1)
+
+		fetchers.Add(1)
+		go func() {
+			defer fetchers.Done()
+			r.fetch(dispatchCtx, src, ready[i], notify, stop)
+		}()
+	}
+	scheduler := NewScheduler(inputs, weights, notify)
+
+	lanes := make([]chan T, max(concurrency, 1))
+	var wg sync.WaitGroup
+	for i := range lanes {
+		lanes[i] = make(chan T, laneBuffer)
+		wg.Add(1)
+		go func(lane <-chan T) {
+			defer wg.Done()
+			r.runLane(ctx, dispatchCtx, lane, stop)
+		}(lanes[i])
+	}
+
+	err := r.dispatch(ctx, dispatchCtx, scheduler, lanes)
+
+	for _, lane := range lanes {
+		close(lane)
+	}
+	wg.Wait()
+	fetchers.Wait()
+
+	// Сообщения, полученные, но не выбранные планировщиком.
+	for _, ch := range ready {
+		for len(ch) > 0 {
+			r.release(<-ch)
+		}
+	}
+
+	return err
+}
+
+// helpers
+type runner[T any] struct {
+	b Broker[T]
+}
+
+// fetch - читает сообщения одной очереди и передает их планировщику до остановки чтения.
+func (r *runner[T]) fetch(dispatchCtx context.Context, src Source[T], ready chan<- T, notify chan<- struct{}, stop context.CancelCauseFunc) {
+	for {
+		msgs, err := src.Fetch(dispatchCtx)
+		if err != nil {
+			if dispatchCtx.Err() == nil {
+				stop(fmt.Errorf("fetch: %w", err))
+			}
+			for _, msg := range msgs {
+				r.release(msg)
+			}
+			return
+		}
+
+		for i, msg := range msgs {
+			select {
+			case ready <- msg:
+			case <-dispatchCtx.Done():
+				for _, rest := range msgs[i:] {
+					r.release(rest)
+				}
+				return
+			}
+
+			select {
+			case notify <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// dispatch - выбирает сообщения по весам очередей и распределяет их по горутинам обработки
+// до остановки или ошибки.
+func (r *runner[T]) dispatch(ctx, dispatchCtx context.Context, scheduler *Scheduler[T], lanes []chan T) error {
+	for {
+		msg, ok := scheduler.Next(dispatchCtx)
+		if !ok {
+			return r.stopErr(ctx, dispatchCtx)
+		}
+
+		if r.b.Dispatched != nil {
+			r.b.Dispatched(msg)
+		}
+
+		select {
+		case lanes[Lane(r.b.Key(msg), len(lanes))] <- msg:
+		case <-dispatchCtx.Done():
+			r.release(msg)
+			return r.stopErr(ctx, dispatchCtx)
+		}
+	}
+}
+
+// stopErr - причина остановки чтения: nil при завершении ctx, иначе ошибка чтения или обработки.
+func (r *runner[T]) stopErr(ctx, dispatchCtx context.Context) error {
+	if ctx.Err() != nil {
+		zlog.Logger.Info().Msgf("Получен сигнал завершения контекста, остановка подписки на %s", r.b.Name)
+		return nil
+	}
+
+	return context.Cause(dispatchCtx)
+}
+
+// runLane - обрабатывает сообщения одной горутины. После остановки чтения новые задачи
+// не начинаются и отпускаются неподтвержденными.
+func (r *runner[T]) runLane(ctx, dispatchCtx context.Context, lane <-chan T, stop context.CancelCauseFunc) {
+	for msg := range lane {
+		if dispatchCtx.Err() != nil {
+			r.release(msg)
+			continue
+		}
+
+		if err := r.b.Consume(ctx, msg); err != nil {
+			r.release(msg)
+			if ctx.Err() != nil {
+				zlog.Logger.Info().Msgf("Задача %s прервана остановкой, не подтверждена и будет доставлена повторно", r.b.Key(msg))
+				continue
+			}
+			stop(fmt.Errorf("consume: %w", err))
+			continue
+		}
+
+		if r.b.Ack != nil {
+			r.b.Ack(ctx, msg)
+		}
+	}
+}
+
+func (r *runner[T]) release(msg T) {
+	if r.b.Release != nil {
+		r.b.Release(msg)
+	}
+}
@@ -0,0 +1,129 @@
+package consume
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun_OrderPerKey(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		mu    sync.Mutex
+		acked = make(map[string][]string)
+		total int
+	)
+	b := testBroker(listSource(20, "img-%d", 3), func(ctx context.Context, msg string) error { return nil })
+	b.Ack = func(_ context.Context, msg string) {
+		mu.Lock()
+		defer mu.Unlock()
+		key := b.Key(msg)
+		acked[key] = append(acked[key], msg)
+		if total++; total == 20 {
+			cancel()
+		}
+	}
+
+	require.NoError(t, Run(ctx, b, 4))
+
+	assert.Equal(t, []string{"img-0#0", "img-0#3", "img-0#6", "img-0#9", "img-0#12", "img-0#15", "img-0#18"}, acked["img-0"])
+}
+
+func TestRun_ConsumeError(t *testing.T) {
+	released := make(chan string, 10)
+	b := testBroker(listSource(5, "img-%d", 5), func(ctx context.Context, msg string) error {
+		return errors.New("dlq is down")
+	})
+	b.Release = func(msg string) { released <- msg }
+
+	err := Run(context.Background(), b, 1)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "dlq is down")
+	assert.NotEmpty(t, released)
+}
+
+func TestRun_FetchError(t *testing.T) {
+	b := testBroker(Source[string]{Fetch: func(ctx context.Context) ([]string, error) {
+		return nil, errors.New("connection closed")
+	}}, func(ctx context.Context, msg string) error { return nil })
+
+	err := Run(context.Background(), b, 1)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "connection closed")
+}
+
+func TestRun_ReleaseOnStop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+
+	var (
+		mu       sync.Mutex
+		released []string
+	)
+	b := testBroker(listSource(5, "img-%d", 1), func(ctx context.Context, msg string) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	b.Release = func(msg string) {
+		mu.Lock()
+		defer mu.Unlock()
+		released = append(released, msg)
+	}
+
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	require.NoError(t, Run(ctx, b, 1))
+
+	// Прерванная задача и полученные, но не начатые задачи отпускаются.
+	assert.Contains(t, released, "img-0#0")
+	assert.GreaterOrEqual(t, len(released), 2)
+}
+
+// helpers
+// listSource - очередь из n сообщений "<ключ>#<номер>"; ключи повторяются с периодом keys.
+// Когда сообщения заканчиваются, Fetch ждет отмены ctx.
+func listSource(n int, keyFormat string, keys int) Source[string] {
+	var (
+		mu   sync.Mutex
+		next int
+	)
+
+	return Source[string]{Fetch: func(ctx context.Context) ([]string, error) {
+		mu.Lock()
+		i := next
+		next++
+		mu.Unlock()
+
+		if i >= n {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return []string{fmt.Sprintf(keyFormat, i%keys) + fmt.Sprintf("#%d", i)}, nil
+	}}
+}
+
+func testBroker(src Source[string], consume func(ctx context.Context, msg string) error) Broker[string] {
+	return Broker[string]{
+		Name:    "test",
+		Sources: []Source[string]{src},
+		Key: func(msg string) string {
+			key, _, _ := strings.Cut(msg, "#")
+			return key
+		},
+		Consume: consume,
+	}
+}
@@ -0,0 +1,69 @@
+package consume
+
+import (
+	"context"
+)
+
+// Scheduler - выбор следующего сообщения из нескольких очередей с весами. Пока во всех
+// очередях есть сообщения, из очереди с весом w берется w сообщений за круг; пустые очереди
+// свой круг пропускают, и свободная емкость достается остальным.
+type Scheduler[T any] struct {
+	inputs  []<-chan T
+	weights []int
+	credits []int
+	// notify - сигнал о новом сообщении в одной из очередей.
+	notify <-chan struct{}
+}
+
+// NewScheduler - конструктор Scheduler. Очередь inputs[i] читается с весом weights[i];
+// notify должен получать сигнал после каждой записи в одну из очередей.
+func NewScheduler[T any](inputs []<-chan T, weights []int, notify <-chan struct{}) *Scheduler[T] {
+	return &Scheduler[T]{
+		inputs:  inputs,
+		weights: weights,
+		credits: append([]int(nil), weights...),
+		notify:  notify,
+	}
+}
+
+// Next - возвращает следующее сообщение или false после отмены ctx.
+func (s *Scheduler[T]) Next(ctx context.Context) (T, bool) {
+	for {
+		if v, ok := s.take(); ok {
+			return v, true
+		}
+
+		// Круг исчерпан или готовы только очереди без остатка веса: начинаем новый круг.
+		copy(s.credits, s.weights)
+		if v, ok := s.take(); ok {
+			return v, true
+		}
+
+		select {
+		case <-s.notify:
+		case <-ctx.Done():
+			var zero T
+			return zero, false
+		}
+	}
+}
+
+// helpers
+// take - забирает готовое сообщение из первой по порядку очереди с остатком веса.
+func (s *Scheduler[T]) take() (T, bool) {
+	for i, input := range s.inputs {
+		if s.credits[i] <= 0 {
+			continue
+		}
+
+		select {
+		case v := <-input:
+			s.credits[i]--
+			return v, true
+		default:
+		}
+	}
+
+	var zero T
+	return zero, false
+}
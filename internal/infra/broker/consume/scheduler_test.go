@@ -0,0 +1,51 @@
+package consume
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduler_Next(t *testing.T) {
+	interactive := make(chan string, 10)
+	bulk := make(chan string, 10)
+	for range 10 {
+		interactive <- "interactive"
+		bulk <- "bulk"
+	}
+	scheduler := NewScheduler([]<-chan string{interactive, bulk}, []int{3, 1}, make(chan struct{}))
+
+	var queues []string
+	for range 8 {
+		queue, ok := scheduler.Next(context.Background())
+		require.True(t, ok)
+		queues = append(queues, queue)
+	}
+
+	assert.Equal(t, []string{
+		"interactive", "interactive", "interactive", "bulk",
+		"interactive", "interactive", "interactive", "bulk",
+	}, queues)
+}
+
+func TestScheduler_NextIdleQueue(t *testing.T) {
+	interactive := make(chan string, 10)
+	bulk := make(chan string, 10)
+	for range 5 {
+		bulk <- "bulk"
+	}
+	scheduler := NewScheduler([]<-chan string{interactive, bulk}, []int{3, 1}, make(chan struct{}))
+
+	for range 5 {
+		queue, ok := scheduler.Next(context.Background())
+		require.True(t, ok)
+		assert.Equal(t, "bulk", queue)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, ok := scheduler.Next(ctx)
+	assert.False(t, ok)
+}
@@ -0,0 +1,175 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	wbkafka "github.com/wb-go/wbf/kafka"
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/sunr3d/image-processor/internal/interfaces/infra"
+)
+
+var _ infra.DeadLetterQueue = (*deadLetterQueue)(nil)
+
+// Заголовки сообщений DLQ с контекстом ошибки.
+const (
+	headerError          = "x-error"
+	headerErrorKind      = "x-error-kind"
+	headerAttempts       = "x-attempts"
+	headerOriginalTopic  = "x-original-topic"
+	headerOriginalOffset = "x-original-offset"
+	headerFailedAt       = "x-failed-at"
+)
+
+// Виды ошибок в заголовке x-error-kind.
+const (
+	errorKindDecode  = "decode"
+	errorKindHandler = "handler"
+)
+
+// replayIdleTimeout - сколько ждать следующего сообщения DLQ, прежде чем считать очередь пустой.
+// С запасом на вступление в группу потребителей при первом чтении.
+const replayIdleTimeout = 10 * time.Second
+
+type deadLetterQueue struct {
+	brokers      []string
+	topic        string
+	groupID      string
+	producers    map[string]*wbkafka.Producer
+	defaultTopic string
+	mu           sync.Mutex
+}
+
+// NewDeadLetterQueue - конструктор DeadLetterQueue. Сообщения читаются из topic группой groupID
+// и публикуются повторно в исходный топик из заголовка x-original-topic, если он есть среди
+// targetTopics. Сообщения без заголовка или из другого топика публикуются в первый из targetTopics.
+func NewDeadLetterQueue(brokers []string, topic, groupID string, targetTopics []string) *deadLetterQueue {
+	producers := make(map[string]*wbkafka.Producer, len(targetTopics))
+	for _, target := range targetTopics {
+		if _, ok := producers[target]; target != "" && !ok {
+			producers[target] = wbkafka.NewProducer(brokers, target)
+		}
+	}
+
+	var defaultTopic string
+	if len(targetTopics) > 0 {
+		defaultTopic = targetTopics[0]
+	}
+
+	return &deadLetterQueue{
+		brokers:      brokers,
+		topic:        topic,
+		groupID:      groupID,
+		producers:    producers,
+		defaultTopic: defaultTopic,
+	}
+}
+
+// Replay - возвращает до limit сообщений DLQ в исходные топики. Сообщения, попавшие в DLQ
+// после начала повтора (например, снова упавшие задачи), остаются до следующего вызова.
+func (q *deadLetterQueue) Replay(ctx context.Context, limit int) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers: q.brokers,
+		Topic:   q.topic,
+		GroupID: q.groupID,
+	})
+	defer reader.Close()
+
+	start := time.Now()
+	replayed := 0
+
+	for replayed < limit {
+		fetchCtx, cancel := context.WithTimeout(ctx, replayIdleTimeout)
+		msg, err := reader.FetchMessage(fetchCtx)
+		cancel()
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+				break
+			}
+			return replayed, fmt.Errorf("reader.FetchMessage: %w", err)
+		}
+
+		if msg.Time.After(start) {
+			break
+		}
+
+		target := q.targetTopic(msg)
+		producer, ok := q.producers[target]
+		if !ok {
+			return replayed, fmt.Errorf("не настроен топик для повтора сообщений DLQ")
+		}
+		if err := producer.Send(ctx, msg.Key, msg.Value); err != nil {
+			return replayed, fmt.Errorf("producer.Send: %w", err)
+		}
+		if err := reader.CommitMessages(ctx, msg); err != nil {
+			return replayed, fmt.Errorf("reader.CommitMessages: %w", err)
+		}
+		replayed++
+
+		zlog.Logger.Info().Msgf("Сообщение DLQ возвращено в топик %s: %s (ошибка: %s)", target, msg.Key, header(msg, headerError))
+	}
+
+	return replayed, nil
+}
+
+func (q *deadLetterQueue) Close() error {
+	var errs []error
+	for _, producer := range q.producers {
+		if err := producer.Close(); err != nil {
+			zlog.Logger.Warn().Err(err).Msg("producer.Close")
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// helpers
+// deadLetterMessage - копия исходного сообщения с заголовками контекста ошибки.
+func deadLetterMessage(msg kafka.Message, kind string, attempts int, cause error) kafka.Message {
+	return kafka.Message{
+		Key:   msg.Key,
+		Value: msg.Value,
+		Headers: append(append([]kafka.Header{}, msg.Headers...),
+			kafka.Header{Key: headerError, Value: []byte(cause.Error())},
+			kafka.Header{Key: headerErrorKind, Value: []byte(kind)},
+			kafka.Header{Key: headerAttempts, Value: []byte(strconv.Itoa(attempts))},
+			kafka.Header{Key: headerOriginalTopic, Value: []byte(msg.Topic)},
+			kafka.Header{Key: headerOriginalOffset, Value: []byte(fmt.Sprintf("%d/%d", msg.Partition, msg.Offset))},
+			kafka.Header{Key: headerFailedAt, Value: []byte(time.Now().UTC().Format(time.RFC3339))},
+		),
+	}
+}
+
+// targetTopic - топик, в который возвращается сообщение DLQ.
+func (q *deadLetterQueue) targetTopic(msg kafka.Message) string {
+	original := header(msg, headerOriginalTopic)
+	if _, ok := q.producers[original]; ok {
+		return original
+	}
+	if original != "" {
+		zlog.Logger.Warn().Msgf("Исходный топик %s сообщения DLQ %s не настроен, сообщение возвращается в %s",
+			original, msg.Key, q.defaultTopic)
+	}
+
+	return q.defaultTopic
+}
+
+func header(msg kafka.Message, key string) string {
+	for _, h := range msg.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,37 @@
+package kafka
+
+import (
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeadLetterQueue_TargetTopic(t *testing.T) {
+	q := NewDeadLetterQueue([]string{"localhost:9092"}, "dlq", "replay", []string{"interactive", "bulk", "bulk", ""})
+	defer q.Close()
+
+	assert.Len(t, q.producers, 2)
+
+	tests := []struct {
+		name     string
+		original string
+		want     string
+	}{
+		{name: "interactive", original: "interactive", want: "interactive"},
+		{name: "bulk", original: "bulk", want: "bulk"},
+		{name: "no header", original: "", want: "interactive"},
+		{name: "unknown topic", original: "removed", want: "interactive"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := kafka.Message{Key: []byte("img-1")}
+			if tt.original != "" {
+				msg.Headers = []kafka.Header{{Key: headerOriginalTopic, Value: []byte(tt.original)}}
+			}
+
+			assert.Equal(t, tt.want, q.targetTopic(msg))
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/segmentio/kafka-go"
+	wbkafka "github.com/wb-go/wbf/kafka"
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/sunr3d/image-processor/internal/interfaces/infra"
+	"github.com/sunr3d/image-processor/models"
+)
+
+var _ infra.EventPublisher = (*eventPublisher)(nil)
+
+// headerEventType - заголовок с типом события, чтобы потребители могли отбирать события
+// без разбора тела.
+const headerEventType = "x-event-type"
+
+type eventPublisher struct {
+	writer messageWriter
+	topic  string
+}
+
+// NewEventPublisher - конструктор EventPublisher. События публикуются в topic с ключом ID изображения,
+// поэтому события одного изображения читаются по порядку.
+func NewEventPublisher(brokers []string, topic string) *eventPublisher {
+	return &eventPublisher{
+		writer: wbkafka.NewProducer(brokers, topic).Writer,
+		topic:  topic,
+	}
+}
+
+// PublishEvent - отправляет событие об обработке изображения в топик результатов. Повторы
+// записи - только внутри writer, чтобы не задерживать подтверждение задачи worker.
+func (p *eventPublisher) PublishEvent(ctx context.Context, event *models.ImageEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %w", err)
+	}
+
+	msg := kafka.Message{
+		Key:     []byte(event.ImageID),
+		Value:   data,
+		Headers: []kafka.Header{{Key: headerEventType, Value: []byte(event.Type)}},
+	}
+
+	if err := p.writer.WriteMessages(ctx, msg); err != nil {
+		return fmt.Errorf("writer.WriteMessages: %w", err)
+	}
+	zlog.Logger.Info().Msgf("Событие %s изображения %s отправлено в Kafka (топик %s)", event.Type, event.ImageID, p.topic)
+
+	return nil
+}
+
+func (p *eventPublisher) Close() error {
+	return p.writer.Close()
+}
@@ -0,0 +1,34 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sunr3d/image-processor/models"
+)
+
+func TestEventPublisher_PublishEvent(t *testing.T) {
+	writer := &fakeWriter{}
+	p := &eventPublisher{writer: writer, topic: "image-results"}
+
+	err := p.PublishEvent(context.Background(), &models.ImageEvent{
+		Type:     models.EventImageCompleted,
+		TenantID: models.DefaultTenantID,
+		ImageID:  "img-1",
+		Variants: []models.ImageVariant{{Name: "thumbnail", Path: "/thumb.jpg", Size: 10, Width: 200, Height: 200}},
+	})
+
+	require.NoError(t, err)
+	require.Len(t, writer.msgs, 1)
+	assert.Equal(t, "img-1", string(writer.msgs[0].Key))
+	assert.Equal(t, string(models.EventImageCompleted), header(writer.msgs[0], headerEventType))
+
+	var event models.ImageEvent
+	require.NoError(t, json.Unmarshal(writer.msgs[0].Value, &event))
+	assert.Equal(t, "img-1", event.ImageID)
+	assert.Equal(t, 200, event.Variants[0].Width)
+}
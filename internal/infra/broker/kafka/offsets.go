@@ -0,0 +1,67 @@
+package kafka
+
+import (
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// offsetTracker - учет сообщений, обрабатываемых параллельно. Смещение партиции можно подтвердить
+// только до первого незавершенного сообщения: подтверждение в Kafka сдвигает смещение целиком.
+type offsetTracker struct {
+	mu      sync.Mutex
+	pending map[topicPartition][]*trackedMessage
+}
+
+type topicPartition struct {
+	topic     string
+	partition int
+}
+
+type trackedMessage struct {
+	msg  kafka.Message
+	done bool
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{pending: make(map[topicPartition][]*trackedMessage)}
+}
+
+// add - регистрирует полученное сообщение. Сообщения партиции добавляются в порядке смещений.
+func (t *offsetTracker) add(msg kafka.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := topicPartition{topic: msg.Topic, partition: msg.Partition}
+	t.pending[key] = append(t.pending[key], &trackedMessage{msg: msg})
+}
+
+// done - отмечает сообщение завершенным и возвращает последнее сообщение непрерывного
+// завершенного префикса партиции, если префикс сдвинулся.
+func (t *offsetTracker) done(msg kafka.Message) (kafka.Message, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := topicPartition{topic: msg.Topic, partition: msg.Partition}
+	queue := t.pending[key]
+	for _, tracked := range queue {
+		if tracked.msg.Offset == msg.Offset {
+			tracked.done = true
+			break
+		}
+	}
+
+	var last kafka.Message
+	n := 0
+	for n < len(queue) && queue[n].done {
+		last = queue[n].msg
+		n++
+	}
+	if n == 0 {
+		return kafka.Message{}, false
+	}
+
+	t.pending[key] = queue[n:]
+
+	return last, true
+}
@@ -2,7 +2,7 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -10,6 +10,7 @@ import (
 	"github.com/wb-go/wbf/retry"
 	"github.com/wb-go/wbf/zlog"
 
+	"github.com/sunr3d/image-processor/internal/infra/broker/codec"
 	"github.com/sunr3d/image-processor/internal/interfaces/infra"
 	"github.com/sunr3d/image-processor/models"
 )
@@ -17,25 +18,27 @@ import (
 var _ infra.Publisher = (*publisher)(nil)
 
 type publisher struct {
-	producer *wbkafka.Producer
-	topic    string
+	producers map[models.TaskPriority]*wbkafka.Producer
 }
 
-// NewPublisher - конструктор publisher.
-func NewPublisher(brokers []string, topic string) *publisher {
-	producer := wbkafka.NewProducer(brokers, topic)
+// NewPublisher - конструктор publisher. Задачи публикуются в топик своего приоритета из topics;
+// задачи без приоритета или с приоритетом без топика - в топик PriorityInteractive.
+func NewPublisher(brokers []string, topics map[models.TaskPriority]string) *publisher {
+	producers := make(map[models.TaskPriority]*wbkafka.Producer, len(topics))
+	for priority, topic := range topics {
+		producers[priority] = wbkafka.NewProducer(brokers, topic)
+	}
 
 	return &publisher{
-		producer: producer,
-		topic:    topic,
+		producers: producers,
 	}
 }
 
 // Publish - отправляет задачу обработки изображения в очередь Kafka.
-func (p *publisher) Publish(ctx context.Context, task *models.ProcessingTask) error {
-	data, err := json.Marshal(task)
+func (p *publisher) Publish(ctx context.Context, env *models.TaskEnvelope) error {
+	data, err := codec.Encode(env)
 	if err != nil {
-		return fmt.Errorf("json.Marshal: %w", err)
+		return fmt.Errorf("codec.Encode: %w", err)
 	}
 
 	strategy := retry.Strategy{
@@ -44,19 +47,30 @@ func (p *publisher) Publish(ctx context.Context, task *models.ProcessingTask) er
 		Backoff:  2,
 	}
 
-	if err := p.producer.SendWithRetry(ctx, strategy, []byte(task.ImageID), data); err != nil {
+	producer, ok := p.producers[env.Priority]
+	if !ok {
+		producer, ok = p.producers[models.PriorityInteractive]
+	}
+	if !ok {
+		return fmt.Errorf("не настроен топик для приоритета %s", env.Priority)
+	}
+
+	if err := producer.SendWithRetry(ctx, strategy, []byte(env.ImageID), data); err != nil {
 		return fmt.Errorf("producer.SendWithRetry: %w", err)
 	}
-	zlog.Logger.Info().Msgf("Задача обработки изображения отправлена в Kafka: %s", task.ImageID)
+	zlog.Logger.Info().Msgf("Задача обработки изображения отправлена в Kafka: %s (топик %s)", env.ImageID, producer.Writer.Topic)
 
 	return nil
 }
 
 func (p *publisher) Close() error {
-	if err := p.producer.Close(); err != nil {
-		zlog.Logger.Warn().Err(err).Msg("producer.Close")
-		return err
+	var errs []error
+	for _, producer := range p.producers {
+		if err := producer.Close(); err != nil {
+			zlog.Logger.Warn().Err(err).Msg("producer.Close")
+			errs = append(errs, err)
+		}
 	}
 
-	return nil
+	return errors.Join(errs...)
 }
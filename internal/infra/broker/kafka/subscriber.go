@@ -2,7 +2,8 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/segmentio/kafka-go"
@@ -10,69 +11,200 @@ import (
 	"github.com/wb-go/wbf/retry"
 	"github.com/wb-go/wbf/zlog"
 
+	"github.com/sunr3d/image-processor/internal/infra/broker/codec"
+	"github.com/sunr3d/image-processor/internal/infra/broker/consume"
 	"github.com/sunr3d/image-processor/internal/interfaces/infra"
 	"github.com/sunr3d/image-processor/models"
 )
 
 var _ infra.Subscriber = (*subscriber)(nil)
 
+// commitTimeout - сколько ждать подтверждения обработанного сообщения, в том числе при остановке.
+const commitTimeout = 5 * time.Second
+
+// messageReader - чтение сообщений группой потребителей с явным подтверждением (*kafka.Reader).
+type messageReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// messageWriter - запись сообщений в топик (*kafka.Writer).
+type messageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// WeightedTopic - топик задач и его вес: при занятом worker из топика с весом w берется
+// w сообщений на каждое сообщение топика с весом 1.
+type WeightedTopic struct {
+	Topic  string
+	Weight int
+}
+
+// source - топик, из которого читает subscriber.
+type source struct {
+	reader messageReader
+	weight int
+}
+
+// delivery - сообщение вместе с топиком, через который его нужно подтвердить.
+type delivery struct {
+	msg kafka.Message
+	src *source
+}
+
 type subscriber struct {
-	consumer *wbkafka.Consumer
-	topic    string
+	sources     []*source
+	dlq         messageWriter
+	handleRetry retry.Strategy
+	concurrency int
+	commitMu    sync.Mutex
 }
 
-// NewSubscriber - конструктор subscriber.
-func NewSubscriber(brokers []string, topic, groupID string) *subscriber {
-	consumer := wbkafka.NewConsumer(brokers, topic, groupID)
+// NewSubscriber - конструктор subscriber. Задачи читаются из topics с весами в группе groupID.
+// Ошибка обработки задачи повторяется по стратегии handleRetry; задачи, не обработанные после
+// всех попыток, и сообщения, которые не удалось разобрать, отправляются в dlqTopic.
+// Задачи обрабатываются параллельно в concurrency горутинах.
+func NewSubscriber(
+	brokers []string,
+	topics []WeightedTopic,
+	groupID, dlqTopic string,
+	handleRetry retry.Strategy,
+	concurrency int,
+) *subscriber {
+	sources := make([]*source, 0, len(topics))
+	for _, topic := range topics {
+		consumer := wbkafka.NewConsumer(brokers, topic.Topic, groupID)
+		sources = append(sources, &source{reader: consumer.Reader, weight: max(topic.Weight, 1)})
+	}
 
 	return &subscriber{
-		consumer: consumer,
-		topic:    topic,
+		sources:     sources,
+		dlq:         wbkafka.NewProducer(brokers, dlqTopic).Writer,
+		handleRetry: handleRetry,
+		concurrency: max(concurrency, 1),
 	}
 }
 
-// Subscribe - подписывается на очередь Kafka и выполняет обработку задач handler.
+// Subscribe - подписывается на очереди Kafka и выполняет обработку задач handler в concurrency
+// горутинах. Очереди читаются по весам, поэтому задачи с меньшим весом не вытесняют остальные
+// полностью. Задачи одного изображения (ключ сообщения) всегда попадают в одну горутину и
+// обрабатываются по порядку; пока горутина занята, чтение новых сообщений для нее приостанавливается.
+//
+// Смещение подтверждается только после успешной обработки задачи или ее отправки в DLQ (и всех
+// предшествующих задач партиции), поэтому задача, прерванная сбоем или остановкой worker,
+// будет доставлена повторно. При остановке подписка дожидается уже начатых задач.
 func (s *subscriber) Subscribe(ctx context.Context, handler func(ctx context.Context, task *models.ProcessingTask) error) error {
-	msgChan := make(chan kafka.Message)
+	tracker := newOffsetTracker()
 
-	strategy := retry.Strategy{
-		Attempts: 3,
-		Delay:    time.Second,
-		Backoff:  2,
+	sources := make([]consume.Source[delivery], 0, len(s.sources))
+	for _, src := range s.sources {
+		sources = append(sources, consume.Source[delivery]{Weight: src.weight, Fetch: src.fetch})
 	}
 
-	s.consumer.StartConsuming(ctx, msgChan, strategy)
-
-	for {
-		select {
-		case <-ctx.Done():
-			zlog.Logger.Info().Msg("Получен сигнал завершения контекста, остановка подписки на Kafka")
-			return nil
-		case msg := <-msgChan:
-			if len(msg.Value) == 0 {
-				continue
-			}
-
-			var task models.ProcessingTask
-			if err := json.Unmarshal(msg.Value, &task); err != nil {
-				zlog.Logger.Error().Err(err).Msgf("Ошибка при разборе задачи обработки изображения из Kafka: %s", msg.Value)
-				continue
-			}
-
-			zlog.Logger.Info().Msgf("Получена задача обработки изображения из Kafka: %s", task.ImageID)
-
-			if err := handler(ctx, &task); err != nil {
-				zlog.Logger.Error().Err(err).Msgf("Ошибка при обработке задачи обработки изображения из Kafka: %s", task.ImageID)
-			}
-		}
-	}
+	return consume.Run(ctx, consume.Broker[delivery]{
+		Name:       "Kafka",
+		Sources:    sources,
+		Key:        func(d delivery) string { return string(d.msg.Key) },
+		Dispatched: func(d delivery) { tracker.add(d.msg) },
+		Consume: func(ctx context.Context, d delivery) error {
+			return s.consume(ctx, handler, d.msg)
+		},
+		Ack: func(ctx context.Context, d delivery) { s.complete(ctx, tracker, d) },
+	}, s.concurrency)
 }
 
 func (s *subscriber) Close() error {
-	if err := s.consumer.Close(); err != nil {
-		zlog.Logger.Warn().Err(err).Msg("consumer.Close")
+	for _, src := range s.sources {
+		if err := src.reader.Close(); err != nil {
+			zlog.Logger.Warn().Err(err).Msg("reader.Close")
+			return err
+		}
+	}
+
+	if err := s.dlq.Close(); err != nil {
+		zlog.Logger.Warn().Err(err).Msg("dlq.Close")
 		return err
 	}
 
 	return nil
 }
+
+// helpers
+// fetch - ждет следующее сообщение топика.
+func (src *source) fetch(ctx context.Context) ([]delivery, error) {
+	msg, err := src.reader.FetchMessage(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("reader.FetchMessage: %w", err)
+	}
+
+	return []delivery{{msg: msg, src: src}}, nil
+}
+
+// complete - отмечает сообщение обработанным и подтверждает завершенный префикс партиции.
+// Подтверждения выполняются по очереди, чтобы смещение не откатывалось назад.
+func (s *subscriber) complete(ctx context.Context, tracker *offsetTracker, d delivery) {
+	s.commitMu.Lock()
+	defer s.commitMu.Unlock()
+
+	if last, ok := tracker.done(d.msg); ok {
+		s.commit(ctx, d.src.reader, last)
+	}
+}
+
+// consume - разбирает и обрабатывает сообщение. Возвращает nil, если сообщение можно подтвердить:
+// задача обработана или отправлена в DLQ.
+func (s *subscriber) consume(
+	ctx context.Context,
+	handler func(ctx context.Context, task *models.ProcessingTask) error,
+	msg kafka.Message,
+) error {
+	if len(msg.Value) == 0 {
+		return nil
+	}
+
+	env, err := codec.Decode(msg.Value)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Msgf("Ошибка при разборе задачи обработки изображения из Kafka: %s", msg.Value)
+		return s.deadLetter(ctx, msg, errorKindDecode, 0, err)
+	}
+	task := &env.ProcessingTask
+
+	zlog.Logger.Info().Msgf("Получена задача обработки изображения из Kafka: %s (схема v%d, попытка %d, ключ %s, корреляция %s)",
+		task.ImageID, env.SchemaVersion, env.Attempt, env.IdempotencyKey, task.CorrelationID)
+
+	attempts, err := consume.Handle(ctx, handler, task, s.handleRetry)
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	zlog.Logger.Error().Err(err).Msgf("Ошибка при обработке задачи обработки изображения из Kafka: %s", task.ImageID)
+
+	return s.deadLetter(ctx, msg, errorKindHandler, attempts, err)
+}
+
+// commit - подтверждает сообщение. Неудачное подтверждение не прерывает подписку: следующее
+// подтверждение сдвинет смещение дальше, а при перезапуске задача придет повторно.
+func (s *subscriber) commit(ctx context.Context, reader messageReader, msg kafka.Message) {
+	commitCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), commitTimeout)
+	defer cancel()
+
+	if err := reader.CommitMessages(commitCtx, msg); err != nil {
+		zlog.Logger.Warn().Err(err).Msgf("Не удалось подтвердить сообщение Kafka %s %d/%d: %s", msg.Topic, msg.Partition, msg.Offset, msg.Key)
+	}
+}
+
+// deadLetter - отправляет сообщение в DLQ с контекстом ошибки.
+func (s *subscriber) deadLetter(ctx context.Context, msg kafka.Message, kind string, attempts int, cause error) error {
+	if err := s.dlq.WriteMessages(ctx, deadLetterMessage(msg, kind, attempts, cause)); err != nil {
+		return fmt.Errorf("dlq.WriteMessages: %w", err)
+	}
+
+	zlog.Logger.Warn().Msgf("Сообщение отправлено в DLQ (%s): %s", kind, msg.Key)
+
+	return nil
+}
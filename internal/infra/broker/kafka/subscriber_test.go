@@ -0,0 +1,265 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wb-go/wbf/retry"
+
+	"github.com/sunr3d/image-processor/models"
+)
+
+func TestSubscriber_Subscribe_CommitsAfterSuccess(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reader := &fakeReader{msgs: []kafka.Message{
+		taskMessage(1, "img-ok"),
+		taskMessage(2, "img-fail"),
+		{Offset: 3, Key: []byte("broken"), Value: []byte("not json")},
+	}, cancelAfter: 3, cancel: cancel}
+	dlq := &fakeWriter{}
+	s := &subscriber{sources: sourcesOf(reader), dlq: dlq, handleRetry: retry.Strategy{Attempts: 1}, concurrency: 1}
+
+	err := s.Subscribe(ctx, func(ctx context.Context, task *models.ProcessingTask) error {
+		if task.ImageID == "img-fail" {
+			return errors.New("disk is full")
+		}
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1, 2, 3}, reader.committed)
+	require.Len(t, dlq.msgs, 2)
+	assert.Equal(t, errorKindHandler, header(dlq.msgs[0], headerErrorKind))
+	assert.Equal(t, errorKindDecode, header(dlq.msgs[1], headerErrorKind))
+}
+
+func TestSubscriber_Subscribe_DeadLetterError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reader := &fakeReader{msgs: []kafka.Message{taskMessage(1, "img-fail"), taskMessage(2, "img-ok")}}
+	s := &subscriber{sources: sourcesOf(reader), dlq: &fakeWriter{err: errors.New("broker is down")}, handleRetry: retry.Strategy{Attempts: 1}, concurrency: 1}
+
+	err := s.Subscribe(ctx, func(ctx context.Context, task *models.ProcessingTask) error {
+		return errors.New("disk is full")
+	})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "broker is down")
+	assert.Empty(t, reader.committed)
+}
+
+func TestSubscriber_Subscribe_CancelledDuringHandle(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reader := &fakeReader{msgs: []kafka.Message{taskMessage(1, "img-1")}}
+	dlq := &fakeWriter{}
+	s := &subscriber{sources: sourcesOf(reader), dlq: dlq, handleRetry: retry.Strategy{Attempts: 3, Delay: time.Hour}, concurrency: 1}
+
+	err := s.Subscribe(ctx, func(ctx context.Context, task *models.ProcessingTask) error {
+		cancel()
+		return ctx.Err()
+	})
+
+	assert.NoError(t, err)
+	assert.Empty(t, reader.committed)
+	assert.Empty(t, dlq.msgs)
+}
+
+func TestSubscriber_Subscribe_Concurrent(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var msgs []kafka.Message
+	for i := range 40 {
+		msgs = append(msgs, taskMessage(int64(i+1), fmt.Sprintf("img-%d", i%8)))
+	}
+	reader := &fakeReader{msgs: msgs, cancelAfter: 40, cancel: cancel}
+	s := &subscriber{sources: sourcesOf(reader), dlq: &fakeWriter{}, handleRetry: retry.Strategy{Attempts: 1}, concurrency: 4}
+
+	var (
+		mu            sync.Mutex
+		active, peak  int
+		inflightByImg = make(map[string]bool)
+	)
+	err := s.Subscribe(ctx, func(ctx context.Context, task *models.ProcessingTask) error {
+		mu.Lock()
+		assert.False(t, inflightByImg[task.ImageID], "задачи одного изображения обрабатываются параллельно")
+		inflightByImg[task.ImageID] = true
+		active++
+		peak = max(peak, active)
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		inflightByImg[task.ImageID] = false
+		active--
+		mu.Unlock()
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Greater(t, peak, 1)
+	assert.LessOrEqual(t, peak, 4)
+	require.NotEmpty(t, reader.committed)
+	assert.Equal(t, int64(40), reader.committed[len(reader.committed)-1])
+	assert.IsIncreasing(t, reader.committed)
+}
+
+func TestSubscriber_Subscribe_Topics(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	interactive := &fakeReader{msgs: []kafka.Message{taskMessage(1, "img-1"), taskMessage(2, "img-2")}}
+	bulk := &fakeReader{msgs: []kafka.Message{taskMessage(1, "img-3")}}
+	for i := range interactive.msgs {
+		interactive.msgs[i].Topic = "interactive"
+	}
+	bulk.msgs[0].Topic = "bulk"
+	s := &subscriber{sources: sourcesOf(interactive, bulk), dlq: &fakeWriter{}, handleRetry: retry.Strategy{Attempts: 1}, concurrency: 2}
+
+	var (
+		mu        sync.Mutex
+		processed []string
+	)
+	err := s.Subscribe(ctx, func(ctx context.Context, task *models.ProcessingTask) error {
+		mu.Lock()
+		defer mu.Unlock()
+		processed = append(processed, task.ImageID)
+		if len(processed) == 3 {
+			cancel()
+		}
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"img-1", "img-2", "img-3"}, processed)
+}
+
+func TestOffsetTracker_Done(t *testing.T) {
+	tracker := newOffsetTracker()
+	for offset := int64(1); offset <= 3; offset++ {
+		tracker.add(kafka.Message{Partition: 0, Offset: offset})
+	}
+	tracker.add(kafka.Message{Partition: 1, Offset: 1})
+
+	_, ok := tracker.done(kafka.Message{Partition: 0, Offset: 2})
+	assert.False(t, ok)
+
+	last, ok := tracker.done(kafka.Message{Partition: 1, Offset: 1})
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), last.Offset)
+
+	last, ok = tracker.done(kafka.Message{Partition: 0, Offset: 1})
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), last.Offset)
+
+	last, ok = tracker.done(kafka.Message{Partition: 0, Offset: 3})
+	assert.True(t, ok)
+	assert.Equal(t, int64(3), last.Offset)
+}
+
+func TestDeadLetterMessage_Headers(t *testing.T) {
+	msg := kafka.Message{Topic: "image-processing", Partition: 2, Offset: 42, Key: []byte("img-1"), Value: []byte("{}")}
+
+	dl := deadLetterMessage(msg, errorKindHandler, 3, errors.New("disk is full"))
+
+	assert.Equal(t, msg.Key, dl.Key)
+	assert.Equal(t, msg.Value, dl.Value)
+	assert.Equal(t, "disk is full", header(dl, headerError))
+	assert.Equal(t, errorKindHandler, header(dl, headerErrorKind))
+	assert.Equal(t, "3", header(dl, headerAttempts))
+	assert.Equal(t, "image-processing", header(dl, headerOriginalTopic))
+	assert.Equal(t, "2/42", header(dl, headerOriginalOffset))
+	assert.NotEmpty(t, header(dl, headerFailedAt))
+}
+
+// fakeReader - messageReader поверх списка сообщений. Когда сообщения заканчиваются, ждет
+// отмены контекста; после cancelAfter подтвержденных сообщений отменяет контекст подписки.
+type fakeReader struct {
+	mu          sync.Mutex
+	msgs        []kafka.Message
+	committed   []int64
+	cancelAfter int
+	cancel      context.CancelFunc
+}
+
+func (r *fakeReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	r.mu.Lock()
+	if len(r.msgs) == 0 {
+		r.mu.Unlock()
+		<-ctx.Done()
+		return kafka.Message{}, ctx.Err()
+	}
+
+	msg := r.msgs[0]
+	r.msgs = r.msgs[1:]
+	r.mu.Unlock()
+
+	return msg, nil
+}
+
+func (r *fakeReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, msg := range msgs {
+		r.committed = append(r.committed, msg.Offset)
+	}
+	if r.cancelAfter > 0 && msgs[len(msgs)-1].Offset >= int64(r.cancelAfter) {
+		r.cancel()
+	}
+
+	return nil
+}
+
+func (r *fakeReader) Close() error {
+	return nil
+}
+
+// fakeWriter - messageWriter, запоминающий записанные сообщения.
+type fakeWriter struct {
+	msgs []kafka.Message
+	err  error
+}
+
+func (w *fakeWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if w.err != nil {
+		return w.err
+	}
+	w.msgs = append(w.msgs, msgs...)
+
+	return nil
+}
+
+func (w *fakeWriter) Close() error {
+	return nil
+}
+
+func sourcesOf(readers ...messageReader) []*source {
+	sources := make([]*source, 0, len(readers))
+	for _, reader := range readers {
+		sources = append(sources, &source{reader: reader, weight: 1})
+	}
+
+	return sources
+}
+
+func taskMessage(offset int64, imageID string) kafka.Message {
+	return kafka.Message{
+		Offset: offset,
+		Key:    []byte(imageID),
+		Value:  []byte(`{"TenantID":"default","ImageID":"` + imageID + `"}`),
+	}
+}
@@ -0,0 +1,316 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/wb-go/wbf/retry"
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/sunr3d/image-processor/internal/infra/broker/consume"
+	"github.com/sunr3d/image-processor/internal/interfaces/infra"
+	"github.com/sunr3d/image-processor/models"
+)
+
+var (
+	_ infra.Publisher       = (*broker)(nil)
+	_ infra.Subscriber      = (*broker)(nil)
+	_ infra.DeadLetterQueue = (*broker)(nil)
+)
+
+// priorities - порядок очередей приоритетов при выборе следующей задачи.
+var priorities = []models.TaskPriority{models.PriorityInteractive, models.PriorityBulk}
+
+// message - задача в очереди брокера.
+type message struct {
+	ID       uint64
+	Task     *models.TaskEnvelope
+	Attempts int       `json:",omitempty"`
+	Error    string    `json:",omitempty"`
+	FailedAt time.Time `json:",omitzero"`
+}
+
+type broker struct {
+	mu      sync.Mutex
+	queues  map[models.TaskPriority][]*message
+	dead    []*message
+	nextID  uint64
+	weights map[models.TaskPriority]int
+	credits map[models.TaskPriority]int
+	// notify - сигнал о новой задаче в одной из очередей.
+	notify chan struct{}
+	// store - копия очередей на диске; nil - только в памяти.
+	store *diskStore
+
+	handleRetry retry.Strategy
+	concurrency int
+}
+
+// New - конструктор брокера задач внутри процесса. Если path не пуст, очереди сохраняются
+// в каталог path и восстанавливаются при следующем запуске, иначе живут только в памяти.
+// Очереди приоритетов читаются с весами weights; ошибка обработки задачи повторяется по стратегии
+// handleRetry, после чего задача попадает в очередь необработанных. Задачи обрабатываются
+// параллельно в concurrency горутинах.
+func New(
+	path string,
+	weights map[models.TaskPriority]int,
+	handleRetry retry.Strategy,
+	concurrency int,
+) (*broker, error) {
+	b := &broker{
+		queues:      make(map[models.TaskPriority][]*message),
+		weights:     make(map[models.TaskPriority]int),
+		credits:     make(map[models.TaskPriority]int),
+		notify:      make(chan struct{}, 1),
+		handleRetry: handleRetry,
+		concurrency: max(concurrency, 1),
+	}
+	for _, priority := range priorities {
+		b.weights[priority] = max(weights[priority], 1)
+	}
+
+	if path == "" {
+		return b, nil
+	}
+
+	store, err := newDiskStore(path)
+	if err != nil {
+		return nil, fmt.Errorf("newDiskStore: %w", err)
+	}
+	b.store = store
+
+	queued, dead, err := store.load()
+	if err != nil {
+		return nil, fmt.Errorf("store.load: %w", err)
+	}
+	for _, msg := range queued {
+		priority := priorityOf(&msg.Task.ProcessingTask)
+		b.queues[priority] = append(b.queues[priority], msg)
+		b.nextID = max(b.nextID, msg.ID)
+	}
+	for _, msg := range dead {
+		b.dead = append(b.dead, msg)
+		b.nextID = max(b.nextID, msg.ID)
+	}
+	if len(queued) > 0 || len(dead) > 0 {
+		zlog.Logger.Info().Msgf("Очередь задач восстановлена из %s: задач %d, необработанных %d", path, len(queued), len(dead))
+	}
+
+	return b, nil
+}
+
+// Publish - ставит задачу в очередь ее приоритета.
+func (b *broker) Publish(ctx context.Context, env *models.TaskEnvelope) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	msg := &message{ID: b.nextID, Task: env}
+
+	if b.store != nil {
+		if err := b.store.put(queueDir, msg); err != nil {
+			return fmt.Errorf("store.put: %w", err)
+		}
+	}
+
+	priority := priorityOf(&env.ProcessingTask)
+	b.queues[priority] = append(b.queues[priority], msg)
+	b.signal()
+
+	zlog.Logger.Info().Msgf("Задача обработки изображения поставлена в очередь: %s", env.ImageID)
+
+	return nil
+}
+
+// Subscribe - выполняет обработку задач handler в concurrency горутинах. Задачи одного
+// изображения всегда попадают в одну горутину и обрабатываются по порядку. Задача удаляется
+// из очереди только после успешной обработки или переноса в очередь необработанных; задачи,
+// прерванные остановкой, возвращаются в начало очереди. При остановке подписка дожидается
+// уже начатых задач.
+func (b *broker) Subscribe(ctx context.Context, handler func(ctx context.Context, task *models.ProcessingTask) error) error {
+	// Веса приоритетов учитывает next, поэтому для consume.Run очередь одна.
+	return consume.Run(ctx, consume.Broker[*message]{
+		Name: "очередь задач",
+		Sources: []consume.Source[*message]{{
+			Weight: 1,
+			Fetch: func(ctx context.Context) ([]*message, error) {
+				msg, ok := b.next(ctx)
+				if !ok {
+					return nil, ctx.Err()
+				}
+				return []*message{msg}, nil
+			},
+		}},
+		Key: func(msg *message) string { return msg.Task.ImageID },
+		Consume: func(ctx context.Context, msg *message) error {
+			return b.consume(ctx, handler, msg)
+		},
+		Release: b.requeue,
+	}, b.concurrency)
+}
+
+// Replay - возвращает до limit необработанных задач в очереди их приоритетов.
+func (b *broker) Replay(ctx context.Context, limit int) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	replayed := 0
+	for len(b.dead) > 0 && replayed < limit {
+		msg := b.dead[0]
+		msg.Attempts, msg.Error, msg.FailedAt = 0, "", time.Time{}
+
+		if b.store != nil {
+			if err := b.store.move(deadDir, queueDir, msg); err != nil {
+				return replayed, fmt.Errorf("store.move: %w", err)
+			}
+		}
+
+		b.dead = b.dead[1:]
+		priority := priorityOf(&msg.Task.ProcessingTask)
+		b.queues[priority] = append(b.queues[priority], msg)
+		replayed++
+
+		zlog.Logger.Info().Msgf("Необработанная задача возвращена в очередь: %s", msg.Task.ImageID)
+	}
+	if replayed > 0 {
+		b.signal()
+	}
+
+	return replayed, nil
+}
+
+func (b *broker) Close() error {
+	return nil
+}
+
+// helpers
+// next - забирает следующую задачу с учетом весов приоритетов или возвращает false после отмены ctx.
+// Пока есть задачи всех приоритетов, из очереди с весом w берется w задач за круг; пустые очереди
+// свой круг пропускают.
+func (b *broker) next(ctx context.Context) (*message, bool) {
+	for {
+		if msg, ok := b.take(); ok {
+			return msg, true
+		}
+
+		select {
+		case <-b.notify:
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+}
+
+func (b *broker) take() (*message, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for round := 0; round < 2; round++ {
+		for _, priority := range priorities {
+			if b.credits[priority] <= 0 || len(b.queues[priority]) == 0 {
+				continue
+			}
+
+			msg := b.queues[priority][0]
+			b.queues[priority] = b.queues[priority][1:]
+			b.credits[priority]--
+
+			return msg, true
+		}
+
+		// Круг исчерпан или задачи есть только в очередях без остатка веса: начинаем новый круг.
+		for priority, weight := range b.weights {
+			b.credits[priority] = weight
+		}
+	}
+
+	return nil, false
+}
+
+// consume - обрабатывает задачу. Возвращает nil, если задача обработана и удалена из очереди
+// или перенесена в очередь необработанных.
+func (b *broker) consume(
+	ctx context.Context,
+	handler func(ctx context.Context, task *models.ProcessingTask) error,
+	msg *message,
+) error {
+	attempts, err := consume.Handle(ctx, handler, &msg.Task.ProcessingTask, b.handleRetry)
+	if err == nil {
+		if err := b.ack(msg); err != nil {
+			return fmt.Errorf("ack: %w", err)
+		}
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	zlog.Logger.Error().Err(err).Msgf("Ошибка при обработке задачи обработки изображения: %s", msg.Task.ImageID)
+
+	if err := b.deadLetter(msg, attempts, err); err != nil {
+		return fmt.Errorf("deadLetter: %w", err)
+	}
+
+	return nil
+}
+
+// ack - удаляет обработанную задачу.
+func (b *broker) ack(msg *message) error {
+	if b.store == nil {
+		return nil
+	}
+
+	if err := b.store.remove(queueDir, msg); err != nil {
+		return fmt.Errorf("store.remove: %w", err)
+	}
+
+	return nil
+}
+
+// deadLetter - переносит задачу в очередь необработанных с контекстом ошибки.
+func (b *broker) deadLetter(msg *message, attempts int, cause error) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	msg.Attempts, msg.Error, msg.FailedAt = attempts, cause.Error(), time.Now().UTC()
+
+	if b.store != nil {
+		if err := b.store.move(queueDir, deadDir, msg); err != nil {
+			return fmt.Errorf("store.move: %w", err)
+		}
+	}
+	b.dead = append(b.dead, msg)
+
+	zlog.Logger.Warn().Msgf("Задача перенесена в очередь необработанных: %s", msg.Task.ImageID)
+
+	return nil
+}
+
+// requeue - возвращает невыполненную задачу в начало очереди ее приоритета.
+func (b *broker) requeue(msg *message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	priority := priorityOf(&msg.Task.ProcessingTask)
+	b.queues[priority] = append([]*message{msg}, b.queues[priority]...)
+	b.signal()
+}
+
+// signal - будит выдачу задач; вызывается под b.mu.
+func (b *broker) signal() {
+	select {
+	case b.notify <- struct{}{}:
+	default:
+	}
+}
+
+// priorityOf - очередь задачи; задачи без приоритета и с неизвестным приоритетом - интерактивные.
+func priorityOf(task *models.ProcessingTask) models.TaskPriority {
+	if task.Priority == models.PriorityBulk {
+		return models.PriorityBulk
+	}
+
+	return models.PriorityInteractive
+}
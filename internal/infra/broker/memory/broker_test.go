@@ -0,0 +1,146 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wb-go/wbf/retry"
+
+	"github.com/sunr3d/image-processor/models"
+)
+
+func TestBroker_PublishSubscribe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	b, err := New("", nil, retry.Strategy{Attempts: 1}, 4)
+	require.NoError(t, err)
+
+	for i := range 20 {
+		require.NoError(t, b.Publish(ctx, models.NewTaskEnvelope(models.ProcessingTask{ImageID: fmt.Sprintf("img-%d", i%5)})))
+	}
+
+	var (
+		mu        sync.Mutex
+		processed int
+		inflight  = make(map[string]bool)
+	)
+	err = b.Subscribe(ctx, func(ctx context.Context, task *models.ProcessingTask) error {
+		mu.Lock()
+		assert.False(t, inflight[task.ImageID], "задачи одного изображения обрабатываются параллельно")
+		inflight[task.ImageID] = true
+		mu.Unlock()
+
+		time.Sleep(time.Millisecond)
+
+		mu.Lock()
+		defer mu.Unlock()
+		inflight[task.ImageID] = false
+		processed++
+		if processed == 20 {
+			cancel()
+		}
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 20, processed)
+}
+
+func TestBroker_Priorities(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	b, err := New("", map[models.TaskPriority]int{models.PriorityInteractive: 3, models.PriorityBulk: 1}, retry.Strategy{Attempts: 1}, 1)
+	require.NoError(t, err)
+
+	for i := range 8 {
+		require.NoError(t, b.Publish(ctx, models.NewTaskEnvelope(models.ProcessingTask{ImageID: fmt.Sprintf("bulk-%d", i), Priority: models.PriorityBulk})))
+		require.NoError(t, b.Publish(ctx, models.NewTaskEnvelope(models.ProcessingTask{ImageID: fmt.Sprintf("interactive-%d", i)})))
+	}
+
+	var order []models.TaskPriority
+	err = b.Subscribe(ctx, func(ctx context.Context, task *models.ProcessingTask) error {
+		order = append(order, priorityOf(task))
+		if len(order) == 8 {
+			cancel()
+		}
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []models.TaskPriority{
+		models.PriorityInteractive, models.PriorityInteractive, models.PriorityInteractive, models.PriorityBulk,
+		models.PriorityInteractive, models.PriorityInteractive, models.PriorityInteractive, models.PriorityBulk,
+	}, order)
+}
+
+func TestBroker_DeadLetterAndReplay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	b, err := New(t.TempDir(), nil, retry.Strategy{Attempts: 2, Delay: time.Millisecond, Backoff: 1}, 1)
+	require.NoError(t, err)
+	require.NoError(t, b.Publish(ctx, models.NewTaskEnvelope(models.ProcessingTask{ImageID: "img-1"})))
+
+	done := make(chan error, 1)
+	go func() {
+		done <- b.Subscribe(ctx, func(ctx context.Context, task *models.ProcessingTask) error {
+			return errors.New("disk is full")
+		})
+	}()
+
+	require.Eventually(t, func() bool {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		return len(b.dead) == 1
+	}, time.Second, 10*time.Millisecond)
+	cancel()
+	require.NoError(t, <-done)
+	assert.Equal(t, 2, b.dead[0].Attempts)
+	assert.Equal(t, "disk is full", b.dead[0].Error)
+
+	replayed, err := b.Replay(context.Background(), 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, replayed)
+	assert.Empty(t, b.dead)
+	assert.Len(t, b.queues[models.PriorityInteractive], 1)
+}
+
+func TestBroker_Persistence(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	b, err := New(dir, nil, retry.Strategy{Attempts: 1}, 1)
+	require.NoError(t, err)
+	require.NoError(t, b.Publish(ctx, models.NewTaskEnvelope(models.ProcessingTask{TenantID: "acme", ImageID: "img-1"})))
+	require.NoError(t, b.Publish(ctx, models.NewTaskEnvelope(models.ProcessingTask{TenantID: "acme", ImageID: "img-2", Priority: models.PriorityBulk})))
+
+	// Первая задача обработана, вторая прервана остановкой.
+	err = b.Subscribe(ctx, func(ctx context.Context, task *models.ProcessingTask) error {
+		if task.ImageID == "img-2" {
+			cancel()
+			return ctx.Err()
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	restored, err := New(dir, nil, retry.Strategy{Attempts: 1}, 1)
+	require.NoError(t, err)
+
+	assert.Empty(t, restored.queues[models.PriorityInteractive])
+	require.Len(t, restored.queues[models.PriorityBulk], 1)
+	assert.Equal(t, "img-2", restored.queues[models.PriorityBulk][0].Task.ImageID)
+	assert.Equal(t, "acme", restored.queues[models.PriorityBulk][0].Task.TenantID)
+
+	require.NoError(t, restored.Publish(context.Background(), models.NewTaskEnvelope(models.ProcessingTask{ImageID: "img-3"})))
+	assert.Greater(t, restored.queues[models.PriorityInteractive][0].ID, restored.queues[models.PriorityBulk][0].ID)
+}
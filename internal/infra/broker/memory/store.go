@@ -0,0 +1,143 @@
+package memory
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/wb-go/wbf/zlog"
+)
+
+// Каталоги очередей на диске.
+const (
+	queueDir = "queue"
+	deadDir  = "dead"
+)
+
+// diskStore - очереди брокера на диске: по JSON файлу на задачу, имя файла - ID задачи
+// с ведущими нулями, поэтому порядок файлов совпадает с порядком постановки.
+type diskStore struct {
+	path string
+}
+
+func newDiskStore(path string) (*diskStore, error) {
+	for _, dir := range []string{queueDir, deadDir} {
+		if err := os.MkdirAll(filepath.Join(path, dir), 0o755); err != nil {
+			return nil, fmt.Errorf("os.MkdirAll: %w", err)
+		}
+	}
+
+	return &diskStore{path: path}, nil
+}
+
+// load - читает очередь задач и очередь необработанных в порядке постановки.
+func (s *diskStore) load() ([]*message, []*message, error) {
+	queued, err := s.loadDir(queueDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("loadDir(%s): %w", queueDir, err)
+	}
+
+	dead, err := s.loadDir(deadDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("loadDir(%s): %w", deadDir, err)
+	}
+
+	return queued, dead, nil
+}
+
+// put - атомарно записывает задачу в каталог dir.
+func (s *diskStore) put(dir string, msg *message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %w", err)
+	}
+
+	path := s.file(dir, msg)
+	tmp := path + ".tmp"
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("os.Create: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("f.Write: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("f.Sync: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("f.Close: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("os.Rename: %w", err)
+	}
+
+	return nil
+}
+
+// move - переносит задачу из каталога from в каталог to с ее текущим состоянием.
+func (s *diskStore) move(from, to string, msg *message) error {
+	if err := s.put(to, msg); err != nil {
+		return fmt.Errorf("put: %w", err)
+	}
+
+	return s.remove(from, msg)
+}
+
+// remove - удаляет задачу из каталога dir.
+func (s *diskStore) remove(dir string, msg *message) error {
+	if err := os.Remove(s.file(dir, msg)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("os.Remove: %w", err)
+	}
+
+	return nil
+}
+
+// helpers
+func (s *diskStore) loadDir(dir string) ([]*message, error) {
+	entries, err := os.ReadDir(filepath.Join(s.path, dir))
+	if err != nil {
+		return nil, fmt.Errorf("os.ReadDir: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+
+	msgs := make([]*message, 0, len(names))
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(s.path, dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("os.ReadFile: %w", err)
+		}
+
+		var msg message
+		if err := json.Unmarshal(data, &msg); err != nil || msg.Task == nil {
+			zlog.Logger.Warn().Err(err).Msgf("Пропущен поврежденный файл очереди задач: %s", name)
+			continue
+		}
+		msgs = append(msgs, &msg)
+	}
+
+	return msgs, nil
+}
+
+func (s *diskStore) file(dir string, msg *message) string {
+	return filepath.Join(s.path, dir, fmt.Sprintf("%020d.json", msg.ID))
+}
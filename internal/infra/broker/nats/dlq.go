@@ -0,0 +1,150 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/sunr3d/image-processor/internal/interfaces/infra"
+	"github.com/sunr3d/image-processor/models"
+)
+
+var _ infra.DeadLetterQueue = (*deadLetterQueue)(nil)
+
+// Заголовки сообщений DLQ с контекстом ошибки.
+const (
+	headerError            = "x-error"
+	headerErrorKind        = "x-error-kind"
+	headerAttempts         = "x-attempts"
+	headerOriginalSubject  = "x-original-subject"
+	headerOriginalSequence = "x-original-sequence"
+	headerFailedAt         = "x-failed-at"
+)
+
+// Виды ошибок в заголовке x-error-kind.
+const (
+	errorKindDecode  = "decode"
+	errorKindHandler = "handler"
+)
+
+// replayIdleTimeout - сколько ждать следующего сообщения DLQ, прежде чем считать очередь пустой.
+const replayIdleTimeout = 2 * time.Second
+
+type deadLetterQueue struct {
+	nc      *nats.Conn
+	js      jetstream.JetStream
+	stream  string
+	subject string
+	durable string
+	mu      sync.Mutex
+}
+
+// NewDeadLetterQueue - конструктор DeadLetterQueue. Сообщения читаются из субъекта <subject>.dlq
+// постоянным потребителем durable и публикуются повторно в исходный субъект задачи.
+func NewDeadLetterQueue(ctx context.Context, url, stream, subject, durable string) (*deadLetterQueue, error) {
+	nc, js, err := connect(ctx, url, stream, subject)
+	if err != nil {
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+
+	return &deadLetterQueue{
+		nc:      nc,
+		js:      js,
+		stream:  stream,
+		subject: subject,
+		durable: durable,
+	}, nil
+}
+
+// Replay - возвращает до limit сообщений DLQ в очереди их приоритетов. Сообщения, попавшие в DLQ
+// после начала повтора (например, снова упавшие задачи), остаются до следующего вызова.
+func (q *deadLetterQueue) Replay(ctx context.Context, limit int) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	consumer, err := q.js.CreateOrUpdateConsumer(ctx, dlqStream(q.stream), jetstream.ConsumerConfig{
+		Durable:       q.durable,
+		FilterSubject: dlqSubject(q.subject),
+		AckPolicy:     jetstream.AckExplicitPolicy,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("js.CreateOrUpdateConsumer: %w", err)
+	}
+
+	start := time.Now()
+	replayed := 0
+
+	for replayed < limit {
+		fetchCtx, cancel := context.WithTimeout(ctx, replayIdleTimeout)
+		msg, err := consumer.Next(jetstream.FetchContext(fetchCtx))
+		cancel()
+		if err != nil {
+			if ctx.Err() == nil && (errors.Is(err, context.DeadlineExceeded) || errors.Is(err, nats.ErrTimeout)) {
+				break
+			}
+			return replayed, fmt.Errorf("consumer.Next: %w", err)
+		}
+
+		if meta, err := msg.Metadata(); err == nil && meta.Timestamp.After(start) {
+			if err := msg.Nak(); err != nil {
+				zlog.Logger.Warn().Err(err).Msg("msg.Nak")
+			}
+			break
+		}
+
+		subject := msg.Headers().Get(headerOriginalSubject)
+		if subject == "" {
+			subject = taskSubject(q.subject, models.PriorityInteractive)
+		}
+		if _, err := q.js.Publish(ctx, subject, msg.Data()); err != nil {
+			return replayed, fmt.Errorf("js.Publish: %w", err)
+		}
+		if err := msg.DoubleAck(ctx); err != nil {
+			return replayed, fmt.Errorf("msg.DoubleAck: %w", err)
+		}
+		replayed++
+
+		zlog.Logger.Info().Msgf("Сообщение DLQ возвращено в очередь %s (ошибка: %s)", subject, msg.Headers().Get(headerError))
+	}
+
+	return replayed, nil
+}
+
+func (q *deadLetterQueue) Close() error {
+	if err := q.nc.Drain(); err != nil {
+		zlog.Logger.Warn().Err(err).Msg("nc.Drain")
+		return err
+	}
+
+	return nil
+}
+
+// helpers
+// deadLetterMessage - копия исходного сообщения для субъекта subject с заголовками контекста ошибки.
+func deadLetterMessage(subject string, msg jetstream.Msg, kind string, attempts int, cause error) *nats.Msg {
+	header := nats.Header{}
+	for key, values := range msg.Headers() {
+		header[key] = append([]string(nil), values...)
+	}
+	header.Set(headerError, cause.Error())
+	header.Set(headerErrorKind, kind)
+	header.Set(headerAttempts, strconv.Itoa(attempts))
+	header.Set(headerOriginalSubject, msg.Subject())
+	if meta, err := msg.Metadata(); err == nil {
+		header.Set(headerOriginalSequence, strconv.FormatUint(meta.Sequence.Stream, 10))
+	}
+	header.Set(headerFailedAt, time.Now().UTC().Format(time.RFC3339))
+
+	return &nats.Msg{
+		Subject: subject,
+		Data:    msg.Data(),
+		Header:  header,
+	}
+}
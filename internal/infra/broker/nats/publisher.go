@@ -0,0 +1,74 @@
+package nats
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/wb-go/wbf/retry"
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/sunr3d/image-processor/internal/infra/broker/codec"
+	"github.com/sunr3d/image-processor/internal/interfaces/infra"
+	"github.com/sunr3d/image-processor/models"
+)
+
+var _ infra.Publisher = (*publisher)(nil)
+
+type publisher struct {
+	nc      *nats.Conn
+	js      jetstream.JetStream
+	subject string
+}
+
+// NewPublisher - конструктор publisher. Задачи публикуются в поток stream, в субъект
+// <subject>.<приоритет>; поток создается, если его еще нет.
+func NewPublisher(ctx context.Context, url, stream, subject string) (*publisher, error) {
+	nc, js, err := connect(ctx, url, stream, subject)
+	if err != nil {
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+
+	return &publisher{
+		nc:      nc,
+		js:      js,
+		subject: subject,
+	}, nil
+}
+
+// Publish - отправляет задачу обработки изображения в поток JetStream и дожидается
+// подтверждения сохранения.
+func (p *publisher) Publish(ctx context.Context, env *models.TaskEnvelope) error {
+	data, err := codec.Encode(env)
+	if err != nil {
+		return fmt.Errorf("codec.Encode: %w", err)
+	}
+
+	strategy := retry.Strategy{
+		Attempts: 3,
+		Delay:    time.Second,
+		Backoff:  2,
+	}
+
+	subject := taskSubject(p.subject, env.Priority)
+	if err := retry.Do(func() error {
+		_, err := p.js.Publish(ctx, subject, data)
+		return err
+	}, strategy); err != nil {
+		return fmt.Errorf("js.Publish: %w", err)
+	}
+	zlog.Logger.Info().Msgf("Задача обработки изображения отправлена в NATS: %s (субъект %s)", env.ImageID, subject)
+
+	return nil
+}
+
+func (p *publisher) Close() error {
+	if err := p.nc.Drain(); err != nil {
+		zlog.Logger.Warn().Err(err).Msg("nc.Drain")
+		return err
+	}
+
+	return nil
+}
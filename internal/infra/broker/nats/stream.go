@@ -0,0 +1,70 @@
+package nats
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+
+	"github.com/sunr3d/image-processor/models"
+)
+
+// priorities - очереди приоритетов: задачи приоритета p публикуются в субъект <subject>.<p>.
+var priorities = []models.TaskPriority{models.PriorityInteractive, models.PriorityBulk}
+
+// dlqSuffix - субъект необработанных задач <subject>.dlq; хранится в отдельном потоке <stream>_DLQ.
+const dlqSuffix = "dlq"
+
+// connect - подключается к NATS и создает потоки задач и необработанных задач, если их еще нет.
+// Потоки работают как очереди: сообщение удаляется после подтверждения.
+func connect(ctx context.Context, url, stream, subject string) (*nats.Conn, jetstream.JetStream, error) {
+	nc, err := nats.Connect(url, nats.Name("image-processor"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, nil, fmt.Errorf("nats.Connect: %w", err)
+	}
+
+	js, err := jetstream.New(nc)
+	if err != nil {
+		nc.Close()
+		return nil, nil, fmt.Errorf("jetstream.New: %w", err)
+	}
+
+	subjects := make([]string, 0, len(priorities))
+	for _, priority := range priorities {
+		subjects = append(subjects, taskSubject(subject, priority))
+	}
+
+	streams := []jetstream.StreamConfig{
+		{Name: stream, Subjects: subjects},
+		{Name: dlqStream(stream), Subjects: []string{dlqSubject(subject)}},
+	}
+	for _, cfg := range streams {
+		cfg.Retention = jetstream.WorkQueuePolicy
+		cfg.Storage = jetstream.FileStorage
+		if _, err := js.CreateOrUpdateStream(ctx, cfg); err != nil {
+			nc.Close()
+			return nil, nil, fmt.Errorf("js.CreateOrUpdateStream %s: %w", cfg.Name, err)
+		}
+	}
+
+	return nc, js, nil
+}
+
+// taskSubject - субъект задач приоритета priority; задачи без приоритета и с неизвестным
+// приоритетом - интерактивные.
+func taskSubject(subject string, priority models.TaskPriority) string {
+	if priority != models.PriorityBulk {
+		priority = models.PriorityInteractive
+	}
+
+	return subject + "." + string(priority)
+}
+
+func dlqSubject(subject string) string {
+	return subject + "." + dlqSuffix
+}
+
+func dlqStream(stream string) string {
+	return stream + "_DLQ"
+}
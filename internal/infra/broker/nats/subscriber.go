@@ -0,0 +1,271 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/wb-go/wbf/retry"
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/sunr3d/image-processor/internal/infra/broker/codec"
+	"github.com/sunr3d/image-processor/internal/infra/broker/consume"
+	"github.com/sunr3d/image-processor/internal/interfaces/infra"
+	"github.com/sunr3d/image-processor/models"
+)
+
+var _ infra.Subscriber = (*subscriber)(nil)
+
+// fetchRetryDelay - пауза перед повторным чтением после ошибки, например на время переподключения.
+const fetchRetryDelay = time.Second
+
+// defaultAckWait - срок подтверждения сообщения, если он не задан.
+const defaultAckWait = 30 * time.Second
+
+// redeliveryDelay - через сколько возвращенное в очередь сообщение доставляется снова. Без задержки
+// сервер может отдать его запросу на чтение, который остановленный subscriber еще не успел отозвать,
+// и сообщение пролежит до истечения срока подтверждения.
+const redeliveryDelay = time.Second
+
+// source - очередь приоритета, из которой читает subscriber.
+type source struct {
+	consumer jetstream.Consumer
+	weight   int
+}
+
+// delivery - полученное сообщение и разобранная из него задача.
+type delivery struct {
+	msg       jetstream.Msg
+	env       *models.TaskEnvelope
+	decodeErr error
+	// stopProgress - прекращает продление срока подтверждения сообщения.
+	stopProgress context.CancelFunc
+}
+
+// imageID - ID изображения задачи; пусто, если сообщение не удалось разобрать.
+func (d delivery) imageID() string {
+	if d.env == nil {
+		return ""
+	}
+
+	return d.env.ImageID
+}
+
+type subscriber struct {
+	nc          *nats.Conn
+	js          jetstream.JetStream
+	sources     []*source
+	dlqSubject  string
+	ackWait     time.Duration
+	handleRetry retry.Strategy
+	concurrency int
+}
+
+// NewSubscriber - конструктор subscriber. Задачи читаются из потока stream постоянными
+// потребителями <durable>-<приоритет> с весами weights; потоки и потребители создаются, если их
+// еще нет. Сообщение, не подтвержденное за ackWait (например, после падения worker), доставляется
+// повторно; пока задача обрабатывается, срок продлевается. Ошибка обработки задачи повторяется
+// по стратегии handleRetry; задачи, не обработанные после всех попыток, и сообщения, которые
+// не удалось разобрать, отправляются в субъект <subject>.dlq. Задачи обрабатываются параллельно
+// в concurrency горутинах.
+func NewSubscriber(
+	ctx context.Context,
+	url, stream, subject, durable string,
+	weights map[models.TaskPriority]int,
+	ackWait time.Duration,
+	handleRetry retry.Strategy,
+	concurrency int,
+) (*subscriber, error) {
+	nc, js, err := connect(ctx, url, stream, subject)
+	if err != nil {
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+	if ackWait <= 0 {
+		ackWait = defaultAckWait
+	}
+
+	sources := make([]*source, 0, len(priorities))
+	for _, priority := range priorities {
+		consumer, err := js.CreateOrUpdateConsumer(ctx, stream, jetstream.ConsumerConfig{
+			Durable:       durable + "-" + string(priority),
+			FilterSubject: taskSubject(subject, priority),
+			AckPolicy:     jetstream.AckExplicitPolicy,
+			AckWait:       ackWait,
+		})
+		if err != nil {
+			nc.Close()
+			return nil, fmt.Errorf("js.CreateOrUpdateConsumer: %w", err)
+		}
+		sources = append(sources, &source{consumer: consumer, weight: max(weights[priority], 1)})
+	}
+
+	return &subscriber{
+		nc:          nc,
+		js:          js,
+		sources:     sources,
+		dlqSubject:  dlqSubject(subject),
+		ackWait:     ackWait,
+		handleRetry: handleRetry,
+		concurrency: max(concurrency, 1),
+	}, nil
+}
+
+// Subscribe - читает задачи из очередей приоритетов по весам и выполняет их обработку handler
+// в concurrency горутинах. Задачи одного изображения всегда попадают в одну горутину и
+// обрабатываются по порядку; пока горутина занята, чтение новых сообщений для нее приостанавливается.
+//
+// Сообщение подтверждается (ack) только после успешной обработки задачи или ее отправки в DLQ.
+// Задачи, прерванные остановкой, и полученные, но не начатые задачи возвращаются в очередь (nak)
+// и будут доставлены повторно. При остановке подписка дожидается уже начатых задач.
+func (s *subscriber) Subscribe(ctx context.Context, handler func(ctx context.Context, task *models.ProcessingTask) error) error {
+	sources := make([]consume.Source[delivery], 0, len(s.sources))
+	for _, src := range s.sources {
+		sources = append(sources, consume.Source[delivery]{
+			Weight: src.weight,
+			Fetch:  func(ctx context.Context) ([]delivery, error) { return s.fetch(ctx, src) },
+		})
+	}
+
+	return consume.Run(ctx, consume.Broker[delivery]{
+		Name:    "NATS",
+		Sources: sources,
+		Key:     delivery.imageID,
+		Consume: func(ctx context.Context, d delivery) error {
+			return s.consume(ctx, handler, d)
+		},
+		Ack:     func(_ context.Context, d delivery) { s.ack(d) },
+		Release: s.nak,
+	}, s.concurrency)
+}
+
+func (s *subscriber) Close() error {
+	if err := s.nc.Drain(); err != nil {
+		zlog.Logger.Warn().Err(err).Msg("nc.Drain")
+		return err
+	}
+
+	return nil
+}
+
+// helpers
+// fetch - ждет следующее сообщение очереди приоритета. Ошибки чтения при живом соединении
+// повторяются: клиент NATS сам переподключается к серверу.
+func (s *subscriber) fetch(ctx context.Context, src *source) ([]delivery, error) {
+	for {
+		msg, err := src.consumer.Next(jetstream.FetchContext(ctx))
+		if err == nil {
+			return []delivery{s.newDelivery(ctx, msg)}, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if errors.Is(err, nats.ErrConnectionClosed) {
+			return nil, fmt.Errorf("consumer.Next: %w", err)
+		}
+		if !errors.Is(err, nats.ErrTimeout) {
+			zlog.Logger.Warn().Err(err).Msgf("Ошибка при чтении задач из NATS, повтор через %s", fetchRetryDelay)
+			select {
+			case <-time.After(fetchRetryDelay):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	}
+}
+
+// newDelivery - разбирает задачу из сообщения и продлевает срок его подтверждения, пока
+// сообщение не будет подтверждено или возвращено в очередь.
+func (s *subscriber) newDelivery(ctx context.Context, msg jetstream.Msg) delivery {
+	d := delivery{msg: msg}
+
+	if env, err := codec.Decode(msg.Data()); err != nil {
+		d.decodeErr = err
+	} else {
+		d.env = env
+	}
+
+	progressCtx, stopProgress := context.WithCancel(context.WithoutCancel(ctx))
+	d.stopProgress = stopProgress
+	go s.keepInProgress(progressCtx, msg)
+
+	return d
+}
+
+// keepInProgress - продлевает срок подтверждения сообщения до отмены ctx.
+func (s *subscriber) keepInProgress(ctx context.Context, msg jetstream.Msg) {
+	ticker := time.NewTicker(s.ackWait / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := msg.InProgress(); err != nil {
+				zlog.Logger.Warn().Err(err).Msgf("Не удалось продлить срок подтверждения сообщения NATS %s", msg.Subject())
+			}
+		}
+	}
+}
+
+// consume - обрабатывает задачу сообщения. Возвращает nil, если сообщение можно подтвердить:
+// задача обработана или отправлена в DLQ.
+func (s *subscriber) consume(
+	ctx context.Context,
+	handler func(ctx context.Context, task *models.ProcessingTask) error,
+	d delivery,
+) error {
+	if d.decodeErr != nil {
+		zlog.Logger.Error().Err(d.decodeErr).Msgf("Ошибка при разборе задачи обработки изображения из NATS: %s", d.msg.Data())
+		return s.deadLetter(ctx, d.msg, errorKindDecode, 0, d.decodeErr)
+	}
+
+	task := &d.env.ProcessingTask
+	zlog.Logger.Info().Msgf("Получена задача обработки изображения из NATS: %s (схема v%d, попытка %d, ключ %s, корреляция %s)",
+		task.ImageID, d.env.SchemaVersion, d.env.Attempt, d.env.IdempotencyKey, task.CorrelationID)
+
+	attempts, err := consume.Handle(ctx, handler, task, s.handleRetry)
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	zlog.Logger.Error().Err(err).Msgf("Ошибка при обработке задачи обработки изображения из NATS: %s", task.ImageID)
+
+	return s.deadLetter(ctx, d.msg, errorKindHandler, attempts, err)
+}
+
+// ack - подтверждает сообщение. Неудачное подтверждение не прерывает подписку: задача
+// будет доставлена повторно по истечении срока подтверждения.
+func (s *subscriber) ack(d delivery) {
+	d.stopProgress()
+
+	if err := d.msg.Ack(); err != nil {
+		zlog.Logger.Warn().Err(err).Msgf("Не удалось подтвердить сообщение NATS %s", d.msg.Subject())
+	}
+}
+
+// nak - возвращает сообщение в очередь для повторной доставки через redeliveryDelay.
+func (s *subscriber) nak(d delivery) {
+	d.stopProgress()
+
+	if err := d.msg.NakWithDelay(redeliveryDelay); err != nil {
+		zlog.Logger.Warn().Err(err).Msgf("Не удалось вернуть в очередь сообщение NATS %s", d.msg.Subject())
+	}
+}
+
+// deadLetter - отправляет сообщение в DLQ с контекстом ошибки.
+func (s *subscriber) deadLetter(ctx context.Context, msg jetstream.Msg, kind string, attempts int, cause error) error {
+	if _, err := s.js.PublishMsg(ctx, deadLetterMessage(s.dlqSubject, msg, kind, attempts, cause)); err != nil {
+		return fmt.Errorf("js.PublishMsg: %w", err)
+	}
+
+	zlog.Logger.Warn().Msgf("Сообщение отправлено в DLQ (%s): %s", kind, msg.Subject())
+
+	return nil
+}
@@ -0,0 +1,248 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wb-go/wbf/retry"
+
+	"github.com/sunr3d/image-processor/models"
+)
+
+const (
+	testStream  = "IMAGE_PROCESSING"
+	testSubject = "image.processing"
+	testDurable = "image-processor"
+)
+
+func TestSubscriber_PublishSubscribe(t *testing.T) {
+	url := runServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pub := newTestPublisher(t, url)
+	for i := range 20 {
+		require.NoError(t, pub.Publish(ctx, models.NewTaskEnvelope(models.ProcessingTask{ImageID: fmt.Sprintf("img-%d", i%5)})))
+	}
+	require.NoError(t, pub.Publish(ctx, models.NewTaskEnvelope(models.ProcessingTask{ImageID: "img-bulk", Priority: models.PriorityBulk})))
+
+	sub := newTestSubscriber(t, url, time.Minute, retry.Strategy{Attempts: 1}, 4)
+
+	var (
+		mu        sync.Mutex
+		processed []string
+		inflight  = make(map[string]bool)
+	)
+	err := sub.Subscribe(ctx, func(ctx context.Context, task *models.ProcessingTask) error {
+		mu.Lock()
+		assert.False(t, inflight[task.ImageID], "задачи одного изображения обрабатываются параллельно")
+		inflight[task.ImageID] = true
+		mu.Unlock()
+
+		time.Sleep(time.Millisecond)
+
+		mu.Lock()
+		defer mu.Unlock()
+		inflight[task.ImageID] = false
+		processed = append(processed, task.ImageID)
+		if len(processed) == 21 {
+			cancel()
+		}
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Len(t, processed, 21)
+	assert.Contains(t, processed, "img-bulk")
+	assert.Zero(t, streamMsgs(t, url, testStream), "подтвержденные задачи удаляются из потока")
+}
+
+func TestSubscriber_NakOnShutdown(t *testing.T) {
+	url := runServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	require.NoError(t, newTestPublisher(t, url).Publish(ctx, models.NewTaskEnvelope(models.ProcessingTask{ImageID: "img-1"})))
+
+	// Задача прервана остановкой worker.
+	sub := newTestSubscriber(t, url, time.Minute, retry.Strategy{Attempts: 1}, 1)
+	err := sub.Subscribe(ctx, func(ctx context.Context, task *models.ProcessingTask) error {
+		cancel()
+		return ctx.Err()
+	})
+	require.NoError(t, err)
+
+	// Возвращенная в очередь задача доставляется снова, не дожидаясь срока подтверждения.
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var got string
+	err = newTestSubscriber(t, url, time.Minute, retry.Strategy{Attempts: 1}, 1).Subscribe(ctx,
+		func(_ context.Context, task *models.ProcessingTask) error {
+			got = task.ImageID
+			cancel()
+			return nil
+		})
+	require.NoError(t, err)
+	assert.Equal(t, "img-1", got)
+}
+
+func TestSubscriber_RedeliveryAfterAckWait(t *testing.T) {
+	url := runServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	sub := newTestSubscriber(t, url, 500*time.Millisecond, retry.Strategy{Attempts: 1}, 1)
+	require.NoError(t, newTestPublisher(t, url).Publish(ctx, models.NewTaskEnvelope(models.ProcessingTask{ImageID: "img-1"})))
+
+	// Другой worker получил задачу и упал, не подтвердив ее.
+	js := newTestJetStream(t, url)
+	consumer, err := js.Consumer(ctx, testStream, testDurable+"-"+string(models.PriorityInteractive))
+	require.NoError(t, err)
+	_, err = consumer.Next(jetstream.FetchMaxWait(time.Second))
+	require.NoError(t, err)
+
+	started := time.Now()
+	var got string
+	err = sub.Subscribe(ctx, func(_ context.Context, task *models.ProcessingTask) error {
+		got = task.ImageID
+		cancel()
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "img-1", got)
+	assert.Less(t, time.Since(started), 5*time.Second)
+}
+
+func TestSubscriber_DeadLetterAndReplay(t *testing.T) {
+	url := runServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	require.NoError(t, newTestPublisher(t, url).Publish(ctx, models.NewTaskEnvelope(models.ProcessingTask{ImageID: "img-1", Priority: models.PriorityBulk})))
+	js := newTestJetStream(t, url)
+	_, err := js.Publish(ctx, taskSubject(testSubject, models.PriorityInteractive), []byte("not json"))
+	require.NoError(t, err)
+
+	sub := newTestSubscriber(t, url, time.Minute, retry.Strategy{Attempts: 2, Delay: time.Millisecond, Backoff: 1}, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- sub.Subscribe(ctx, func(ctx context.Context, task *models.ProcessingTask) error {
+			return errors.New("disk is full")
+		})
+	}()
+
+	require.Eventually(t, func() bool {
+		return streamMsgs(t, url, dlqStream(testStream)) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	require.NoError(t, <-done)
+	assert.Zero(t, streamMsgs(t, url, testStream))
+
+	stream, err := js.Stream(context.Background(), dlqStream(testStream))
+	require.NoError(t, err)
+	kinds := map[string]nats.Header{}
+	for seq := uint64(1); seq <= 2; seq++ {
+		msg, err := stream.GetMsg(context.Background(), seq)
+		require.NoError(t, err)
+		kinds[msg.Header.Get(headerErrorKind)] = msg.Header
+	}
+	require.Contains(t, kinds, errorKindDecode)
+	require.Contains(t, kinds, errorKindHandler)
+	assert.Equal(t, "disk is full", kinds[errorKindHandler].Get(headerError))
+	assert.Equal(t, "2", kinds[errorKindHandler].Get(headerAttempts))
+	assert.Equal(t, taskSubject(testSubject, models.PriorityBulk), kinds[errorKindHandler].Get(headerOriginalSubject))
+
+	dlq, err := NewDeadLetterQueue(context.Background(), url, testStream, testSubject, testDurable+"-dlq-replay")
+	require.NoError(t, err)
+	t.Cleanup(func() { dlq.Close() })
+
+	replayed, err := dlq.Replay(context.Background(), 10)
+	require.NoError(t, err)
+	assert.Equal(t, 2, replayed)
+	assert.Zero(t, streamMsgs(t, url, dlqStream(testStream)))
+
+	bulk, err := js.Stream(context.Background(), testStream)
+	require.NoError(t, err)
+	replayedTask, err := bulk.GetLastMsgForSubject(context.Background(), taskSubject(testSubject, models.PriorityBulk))
+	require.NoError(t, err)
+	var task models.ProcessingTask
+	require.NoError(t, json.Unmarshal(replayedTask.Data, &task))
+	assert.Equal(t, "img-1", task.ImageID)
+}
+
+// helpers
+// runServer - запускает встроенный сервер NATS с JetStream и возвращает его адрес.
+func runServer(t *testing.T) string {
+	t.Helper()
+
+	ns, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	require.NoError(t, err)
+
+	go ns.Start()
+	require.True(t, ns.ReadyForConnections(5*time.Second), "сервер NATS не запустился")
+	t.Cleanup(ns.Shutdown)
+
+	return ns.ClientURL()
+}
+
+func newTestPublisher(t *testing.T, url string) *publisher {
+	t.Helper()
+
+	pub, err := NewPublisher(context.Background(), url, testStream, testSubject)
+	require.NoError(t, err)
+	t.Cleanup(func() { pub.Close() })
+
+	return pub
+}
+
+func newTestSubscriber(t *testing.T, url string, ackWait time.Duration, handleRetry retry.Strategy, concurrency int) *subscriber {
+	t.Helper()
+
+	sub, err := NewSubscriber(context.Background(), url, testStream, testSubject, testDurable,
+		map[models.TaskPriority]int{models.PriorityInteractive: 3, models.PriorityBulk: 1}, ackWait, handleRetry, concurrency)
+	require.NoError(t, err)
+	t.Cleanup(func() { sub.Close() })
+
+	return sub
+}
+
+func newTestJetStream(t *testing.T, url string) jetstream.JetStream {
+	t.Helper()
+
+	nc, err := nats.Connect(url)
+	require.NoError(t, err)
+	t.Cleanup(nc.Close)
+
+	js, err := jetstream.New(nc)
+	require.NoError(t, err)
+
+	return js
+}
+
+func streamMsgs(t *testing.T, url, name string) uint64 {
+	t.Helper()
+
+	stream, err := newTestJetStream(t, url).Stream(context.Background(), name)
+	require.NoError(t, err)
+	info, err := stream.Info(context.Background())
+	require.NoError(t, err)
+
+	return info.State.Msgs
+}
@@ -0,0 +1,114 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/sunr3d/image-processor/internal/interfaces/infra"
+	"github.com/sunr3d/image-processor/models"
+)
+
+var _ infra.DeadLetterQueue = (*deadLetterQueue)(nil)
+
+// Поля записей DLQ с контекстом ошибки; задача хранится в поле task без изменений.
+const (
+	fieldError          = "x-error"
+	fieldErrorKind      = "x-error-kind"
+	fieldAttempts       = "x-attempts"
+	fieldOriginalStream = "x-original-stream"
+	fieldOriginalID     = "x-original-id"
+	fieldFailedAt       = "x-failed-at"
+)
+
+// Виды ошибок в поле x-error-kind.
+const (
+	errorKindDecode  = "decode"
+	errorKindHandler = "handler"
+)
+
+type deadLetterQueue struct {
+	client *redis.Client
+	stream string
+	mu     sync.Mutex
+}
+
+// NewDeadLetterQueue - конструктор DeadLetterQueue. Записи читаются из потока <stream>:dlq
+// и добавляются повторно в исходный поток задачи.
+func NewDeadLetterQueue(ctx context.Context, addr, password, stream string) (*deadLetterQueue, error) {
+	client, err := connect(ctx, addr, password)
+	if err != nil {
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+
+	return &deadLetterQueue{
+		client: client,
+		stream: stream,
+	}, nil
+}
+
+// Replay - возвращает до limit самых старых записей DLQ в потоки их приоритетов. Запись
+// переносится атомарно: добавление в исходный поток и удаление из DLQ выполняются в одной транзакции.
+func (q *deadLetterQueue) Replay(ctx context.Context, limit int) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	msgs, err := q.client.XRangeN(ctx, dlqStream(q.stream), "-", "+", int64(limit)).Result()
+	if err != nil {
+		return 0, fmt.Errorf("client.XRangeN: %w", err)
+	}
+
+	replayed := 0
+	for _, msg := range msgs {
+		stream, _ := msg.Values[fieldOriginalStream].(string)
+		if stream == "" {
+			stream = taskStream(q.stream, models.PriorityInteractive)
+		}
+
+		if _, err := q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.XAdd(ctx, &redis.XAddArgs{
+				Stream: stream,
+				Values: map[string]any{fieldTask: msg.Values[fieldTask]},
+			})
+			pipe.XDel(ctx, dlqStream(q.stream), msg.ID)
+			return nil
+		}); err != nil {
+			return replayed, fmt.Errorf("client.TxPipelined: %w", err)
+		}
+		replayed++
+
+		zlog.Logger.Info().Msgf("Запись DLQ возвращена в поток %s (ошибка: %v)", stream, msg.Values[fieldError])
+	}
+
+	return replayed, nil
+}
+
+func (q *deadLetterQueue) Close() error {
+	if err := q.client.Close(); err != nil {
+		zlog.Logger.Warn().Err(err).Msg("client.Close")
+		return err
+	}
+
+	return nil
+}
+
+// helpers
+// deadLetterValues - поля записи DLQ: исходная задача и контекст ошибки.
+func deadLetterValues(stream string, msg redis.XMessage, kind string, attempts int, cause error) map[string]any {
+	task, _ := msg.Values[fieldTask].(string)
+
+	return map[string]any{
+		fieldTask:           task,
+		fieldError:          cause.Error(),
+		fieldErrorKind:      kind,
+		fieldAttempts:       strconv.Itoa(attempts),
+		fieldOriginalStream: stream,
+		fieldOriginalID:     msg.ID,
+		fieldFailedAt:       time.Now().UTC().Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,71 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/wb-go/wbf/retry"
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/sunr3d/image-processor/internal/infra/broker/codec"
+	"github.com/sunr3d/image-processor/internal/interfaces/infra"
+	"github.com/sunr3d/image-processor/models"
+)
+
+var _ infra.Publisher = (*publisher)(nil)
+
+type publisher struct {
+	client *redis.Client
+	stream string
+}
+
+// NewPublisher - конструктор publisher. Задачи добавляются в поток <stream>:<приоритет>.
+func NewPublisher(ctx context.Context, addr, password, stream string) (*publisher, error) {
+	client, err := connect(ctx, addr, password)
+	if err != nil {
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+
+	return &publisher{
+		client: client,
+		stream: stream,
+	}, nil
+}
+
+// Publish - добавляет задачу обработки изображения в поток Redis.
+func (p *publisher) Publish(ctx context.Context, env *models.TaskEnvelope) error {
+	data, err := codec.Encode(env)
+	if err != nil {
+		return fmt.Errorf("codec.Encode: %w", err)
+	}
+
+	strategy := retry.Strategy{
+		Attempts: 3,
+		Delay:    time.Second,
+		Backoff:  2,
+	}
+
+	stream := taskStream(p.stream, env.Priority)
+	if err := retry.Do(func() error {
+		return p.client.XAdd(ctx, &redis.XAddArgs{
+			Stream: stream,
+			Values: map[string]any{fieldTask: data},
+		}).Err()
+	}, strategy); err != nil {
+		return fmt.Errorf("client.XAdd: %w", err)
+	}
+	zlog.Logger.Info().Msgf("Задача обработки изображения отправлена в Redis: %s (поток %s)", env.ImageID, stream)
+
+	return nil
+}
+
+func (p *publisher) Close() error {
+	if err := p.client.Close(); err != nil {
+		zlog.Logger.Warn().Err(err).Msg("client.Close")
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/sunr3d/image-processor/models"
+)
+
+// priorities - очереди приоритетов: задачи приоритета p добавляются в поток <stream>:<p>.
+var priorities = []models.TaskPriority{models.PriorityInteractive, models.PriorityBulk}
+
+// fieldTask - поле записи потока с задачей в JSON.
+const fieldTask = "task"
+
+// dlqSuffix - поток необработанных задач <stream>:dlq.
+const dlqSuffix = "dlq"
+
+// connect - подключается к Redis и проверяет соединение.
+func connect(ctx context.Context, addr, password string) (*redis.Client, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: password,
+	})
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("client.Ping: %w", err)
+	}
+
+	return client, nil
+}
+
+// taskStream - поток задач приоритета priority; задачи без приоритета и с неизвестным
+// приоритетом - интерактивные.
+func taskStream(stream string, priority models.TaskPriority) string {
+	if priority != models.PriorityBulk {
+		priority = models.PriorityInteractive
+	}
+
+	return stream + ":" + string(priority)
+}
+
+func dlqStream(stream string) string {
+	return stream + ":" + dlqSuffix
+}
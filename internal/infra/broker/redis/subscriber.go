@@ -0,0 +1,389 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/wb-go/wbf/retry"
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/sunr3d/image-processor/internal/infra/broker/codec"
+	"github.com/sunr3d/image-processor/internal/infra/broker/consume"
+	"github.com/sunr3d/image-processor/internal/interfaces/infra"
+	"github.com/sunr3d/image-processor/models"
+)
+
+var _ infra.Subscriber = (*subscriber)(nil)
+
+// readBlock - сколько ждать новых записей в одном XREADGROUP (но не дольше claimIdle/2, чтобы
+// не откладывать проверку зависших записей). Ограничивает и задержку остановки чтения.
+const readBlock = time.Second
+
+// fetchRetryDelay - пауза перед повторным чтением после ошибки.
+const fetchRetryDelay = time.Second
+
+// ackTimeout - сколько ждать подтверждения обработанной записи, в том числе при остановке.
+const ackTimeout = 5 * time.Second
+
+// defaultClaimIdle - срок, после которого неподтвержденную запись забирает другой потребитель,
+// если он не задан.
+const defaultClaimIdle = time.Minute
+
+// source - поток приоритета, из которого читает subscriber.
+type source struct {
+	stream string
+	weight int
+}
+
+// delivery - полученная запись потока и разобранная из нее задача.
+type delivery struct {
+	src       *source
+	msg       redis.XMessage
+	env       *models.TaskEnvelope
+	decodeErr error
+	// stopProgress - прекращает продление владения записью.
+	stopProgress context.CancelFunc
+}
+
+// imageID - ID изображения задачи; пусто, если запись не удалось разобрать.
+func (d delivery) imageID() string {
+	if d.env == nil {
+		return ""
+	}
+
+	return d.env.ImageID
+}
+
+type subscriber struct {
+	client      *redis.Client
+	sources     []*source
+	group       string
+	consumer    string
+	dlqStream   string
+	claimIdle   time.Duration
+	handleRetry retry.Strategy
+	concurrency int
+}
+
+// NewSubscriber - конструктор subscriber. Задачи читаются из потоков <stream>:<приоритет> с весами
+// weights группой потребителей group под именем consumer; группы создаются, если их еще нет.
+// Имя потребителя должно сохраняться между перезапусками: после старта он сначала дочитывает
+// свои неподтвержденные записи. Записи других потребителей, не подтвержденные дольше claimIdle
+// (например, после падения worker), забираются через XCLAIM; пока задача обрабатывается,
+// владение записью продлевается. Ошибка обработки задачи повторяется по стратегии handleRetry;
+// задачи, не обработанные после всех попыток, и записи, которые не удалось разобрать,
+// добавляются в поток <stream>:dlq. Задачи обрабатываются параллельно в concurrency горутинах.
+func NewSubscriber(
+	ctx context.Context,
+	addr, password, stream, group, consumer string,
+	weights map[models.TaskPriority]int,
+	claimIdle time.Duration,
+	handleRetry retry.Strategy,
+	concurrency int,
+) (*subscriber, error) {
+	client, err := connect(ctx, addr, password)
+	if err != nil {
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+	if claimIdle <= 0 {
+		claimIdle = defaultClaimIdle
+	}
+
+	sources := make([]*source, 0, len(priorities))
+	for _, priority := range priorities {
+		name := taskStream(stream, priority)
+		if err := client.XGroupCreateMkStream(ctx, name, group, "0").Err(); err != nil &&
+			!strings.Contains(err.Error(), "BUSYGROUP") {
+			client.Close()
+			return nil, fmt.Errorf("client.XGroupCreateMkStream: %w", err)
+		}
+		sources = append(sources, &source{stream: name, weight: max(weights[priority], 1)})
+	}
+
+	return &subscriber{
+		client:      client,
+		sources:     sources,
+		group:       group,
+		consumer:    consumer,
+		dlqStream:   dlqStream(stream),
+		claimIdle:   claimIdle,
+		handleRetry: handleRetry,
+		concurrency: max(concurrency, 1),
+	}, nil
+}
+
+// Subscribe - читает задачи из потоков приоритетов по весам и выполняет их обработку handler
+// в concurrency горутинах. Задачи одного изображения всегда попадают в одну горутину и
+// обрабатываются по порядку; пока горутина занята, чтение новых записей для нее приостанавливается.
+//
+// Запись подтверждается (XACK) и удаляется из потока только после успешной обработки задачи или
+// ее отправки в DLQ. Задачи, прерванные остановкой, и полученные, но не начатые задачи остаются
+// неподтвержденными: их дочитает этот же потребитель после перезапуска или заберет другой
+// по истечении claimIdle. При остановке подписка дожидается уже начатых задач.
+func (s *subscriber) Subscribe(ctx context.Context, handler func(ctx context.Context, task *models.ProcessingTask) error) error {
+	sources := make([]consume.Source[delivery], 0, len(s.sources))
+	for _, src := range s.sources {
+		sources = append(sources, consume.Source[delivery]{Weight: src.weight, Fetch: s.fetcher(src)})
+	}
+
+	return consume.Run(ctx, consume.Broker[delivery]{
+		Name:    "Redis",
+		Sources: sources,
+		Key:     delivery.imageID,
+		Consume: func(ctx context.Context, d delivery) error {
+			return s.consume(ctx, handler, d)
+		},
+		Ack:     s.ack,
+		Release: s.release,
+	}, s.concurrency)
+}
+
+func (s *subscriber) Close() error {
+	if err := s.client.Close(); err != nil {
+		zlog.Logger.Warn().Err(err).Msg("client.Close")
+		return err
+	}
+
+	return nil
+}
+
+// helpers
+// fetcher - чтение записей потока src для одной подписки. Сначала дочитываются собственные
+// неподтвержденные записи, затем читаются новые; раз в claimIdle/2 проверяются записи,
+// зависшие у других потребителей.
+func (s *subscriber) fetcher(src *source) func(ctx context.Context) ([]delivery, error) {
+	cursor := "0"
+	var nextClaim time.Time
+
+	return func(ctx context.Context) ([]delivery, error) {
+		for {
+			var (
+				msgs []redis.XMessage
+				err  error
+			)
+			if time.Now().After(nextClaim) {
+				msgs, err = s.claim(ctx, src)
+				if err == nil && len(msgs) == 0 {
+					nextClaim = time.Now().Add(s.claimIdle / 2)
+				}
+			}
+			if err == nil && len(msgs) == 0 {
+				msgs, err = s.read(ctx, src, &cursor)
+			}
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				if errors.Is(err, redis.ErrClosed) {
+					return nil, err
+				}
+				zlog.Logger.Warn().Err(err).Msgf("Ошибка при чтении задач из Redis, повтор через %s", fetchRetryDelay)
+				select {
+				case <-time.After(fetchRetryDelay):
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+				continue
+			}
+			if len(msgs) == 0 {
+				continue
+			}
+
+			deliveries := make([]delivery, 0, len(msgs))
+			for _, msg := range msgs {
+				deliveries = append(deliveries, s.newDelivery(ctx, src, msg))
+			}
+
+			return deliveries, nil
+		}
+	}
+}
+
+// read - читает следующую запись группы. cursor "0" - собственные неподтвержденные записи начиная
+// с начала истории; когда они заканчиваются, cursor переключается на новые записи (">").
+func (s *subscriber) read(ctx context.Context, src *source, cursor *string) ([]redis.XMessage, error) {
+	args := &redis.XReadGroupArgs{
+		Group:    s.group,
+		Consumer: s.consumer,
+		Streams:  []string{src.stream, *cursor},
+		Count:    1,
+		Block:    min(readBlock, s.claimIdle/2),
+	}
+	if *cursor != ">" {
+		// История неподтвержденных записей читается без ожидания.
+		args.Block = -1
+	}
+
+	streams, err := s.client.XReadGroup(ctx, args).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("client.XReadGroup: %w", err)
+	}
+
+	var msgs []redis.XMessage
+	for _, stream := range streams {
+		msgs = append(msgs, stream.Messages...)
+	}
+
+	if *cursor != ">" {
+		if len(msgs) == 0 {
+			*cursor = ">"
+			return nil, nil
+		}
+		*cursor = msgs[len(msgs)-1].ID
+	}
+
+	return msgs, nil
+}
+
+// claim - забирает запись, не подтвержденную дольше claimIdle.
+func (s *subscriber) claim(ctx context.Context, src *source) ([]redis.XMessage, error) {
+	pending, err := s.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: src.stream,
+		Group:  s.group,
+		Idle:   s.claimIdle,
+		Start:  "-",
+		End:    "+",
+		Count:  1,
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("client.XPendingExt: %w", err)
+	}
+	if len(pending) == 0 {
+		return nil, nil
+	}
+
+	msgs, err := s.client.XClaim(ctx, &redis.XClaimArgs{
+		Stream:   src.stream,
+		Group:    s.group,
+		Consumer: s.consumer,
+		MinIdle:  s.claimIdle,
+		Messages: []string{pending[0].ID},
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("client.XClaim: %w", err)
+	}
+
+	for _, msg := range msgs {
+		zlog.Logger.Info().Msgf("Запись %s потока %s забрана у потребителя %s, не подтвердившего ее за %s",
+			msg.ID, src.stream, pending[0].Consumer, pending[0].Idle.Round(time.Second))
+	}
+
+	return msgs, nil
+}
+
+// newDelivery - разбирает задачу из записи и продлевает владение ею, пока запись не будет
+// подтверждена или отпущена.
+func (s *subscriber) newDelivery(ctx context.Context, src *source, msg redis.XMessage) delivery {
+	d := delivery{src: src, msg: msg}
+
+	data, ok := msg.Values[fieldTask].(string)
+	if !ok {
+		d.decodeErr = fmt.Errorf("в записи нет поля %s", fieldTask)
+	} else {
+		if env, err := codec.Decode([]byte(data)); err != nil {
+			d.decodeErr = err
+		} else {
+			d.env = env
+		}
+	}
+
+	progressCtx, stopProgress := context.WithCancel(context.WithoutCancel(ctx))
+	d.stopProgress = stopProgress
+	go s.keepInProgress(progressCtx, src, msg.ID)
+
+	return d
+}
+
+// keepInProgress - до отмены ctx сбрасывает время простоя записи, чтобы ее не забрал другой потребитель.
+func (s *subscriber) keepInProgress(ctx context.Context, src *source, id string) {
+	ticker := time.NewTicker(s.claimIdle / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.client.XClaimJustID(ctx, &redis.XClaimArgs{
+				Stream:   src.stream,
+				Group:    s.group,
+				Consumer: s.consumer,
+				Messages: []string{id},
+			}).Err(); err != nil && ctx.Err() == nil {
+				zlog.Logger.Warn().Err(err).Msgf("Не удалось продлить владение записью %s потока %s", id, src.stream)
+			}
+		}
+	}
+}
+
+// consume - обрабатывает задачу записи. Возвращает nil, если запись можно подтвердить:
+// задача обработана или отправлена в DLQ.
+func (s *subscriber) consume(
+	ctx context.Context,
+	handler func(ctx context.Context, task *models.ProcessingTask) error,
+	d delivery,
+) error {
+	if d.decodeErr != nil {
+		zlog.Logger.Error().Err(d.decodeErr).Msgf("Ошибка при разборе задачи обработки изображения из Redis: %v", d.msg.Values)
+		return s.deadLetter(ctx, d, errorKindDecode, 0, d.decodeErr)
+	}
+
+	task := &d.env.ProcessingTask
+	zlog.Logger.Info().Msgf("Получена задача обработки изображения из Redis: %s (схема v%d, попытка %d, ключ %s, корреляция %s)",
+		task.ImageID, d.env.SchemaVersion, d.env.Attempt, d.env.IdempotencyKey, task.CorrelationID)
+
+	attempts, err := consume.Handle(ctx, handler, task, s.handleRetry)
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	zlog.Logger.Error().Err(err).Msgf("Ошибка при обработке задачи обработки изображения из Redis: %s", task.ImageID)
+
+	return s.deadLetter(ctx, d, errorKindHandler, attempts, err)
+}
+
+// ack - подтверждает запись и удаляет ее из потока. Неудачное подтверждение не прерывает подписку:
+// запись будет доставлена повторно.
+func (s *subscriber) ack(ctx context.Context, d delivery) {
+	d.stopProgress()
+
+	ackCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), ackTimeout)
+	defer cancel()
+
+	if _, err := s.client.TxPipelined(ackCtx, func(pipe redis.Pipeliner) error {
+		pipe.XAck(ackCtx, d.src.stream, s.group, d.msg.ID)
+		pipe.XDel(ackCtx, d.src.stream, d.msg.ID)
+		return nil
+	}); err != nil {
+		zlog.Logger.Warn().Err(err).Msgf("Не удалось подтвердить запись %s потока %s", d.msg.ID, d.src.stream)
+	}
+}
+
+// release - прекращает продление владения неподтвержденной записью.
+func (s *subscriber) release(d delivery) {
+	d.stopProgress()
+}
+
+// deadLetter - добавляет запись в поток DLQ с контекстом ошибки.
+func (s *subscriber) deadLetter(ctx context.Context, d delivery, kind string, attempts int, cause error) error {
+	if err := s.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: s.dlqStream,
+		Values: deadLetterValues(d.src.stream, d.msg, kind, attempts, cause),
+	}).Err(); err != nil {
+		return fmt.Errorf("client.XAdd: %w", err)
+	}
+
+	zlog.Logger.Warn().Msgf("Запись отправлена в DLQ (%s): %s", kind, d.msg.ID)
+
+	return nil
+}
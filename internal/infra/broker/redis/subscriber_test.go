@@ -0,0 +1,225 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wb-go/wbf/retry"
+
+	"github.com/sunr3d/image-processor/models"
+)
+
+const (
+	testStream = "image-processing"
+	testGroup  = "image-processor-group"
+)
+
+func TestSubscriber_PublishSubscribe(t *testing.T) {
+	srv := miniredis.RunT(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sub := newTestSubscriber(t, srv, "worker-1", time.Minute, retry.Strategy{Attempts: 1}, 4)
+	pub := newTestPublisher(t, srv)
+	for i := range 20 {
+		require.NoError(t, pub.Publish(ctx, models.NewTaskEnvelope(models.ProcessingTask{ImageID: fmt.Sprintf("img-%d", i%5)})))
+	}
+	require.NoError(t, pub.Publish(ctx, models.NewTaskEnvelope(models.ProcessingTask{ImageID: "img-bulk", Priority: models.PriorityBulk})))
+
+	var (
+		mu        sync.Mutex
+		processed []string
+		inflight  = make(map[string]bool)
+	)
+	err := sub.Subscribe(ctx, func(ctx context.Context, task *models.ProcessingTask) error {
+		mu.Lock()
+		assert.False(t, inflight[task.ImageID], "задачи одного изображения обрабатываются параллельно")
+		inflight[task.ImageID] = true
+		mu.Unlock()
+
+		time.Sleep(time.Millisecond)
+
+		mu.Lock()
+		defer mu.Unlock()
+		inflight[task.ImageID] = false
+		processed = append(processed, task.ImageID)
+		if len(processed) == 21 {
+			cancel()
+		}
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Len(t, processed, 21)
+	assert.Contains(t, processed, "img-bulk")
+
+	client := newTestClient(t, srv)
+	for _, priority := range priorities {
+		assert.Zero(t, client.XLen(context.Background(), taskStream(testStream, priority)).Val(),
+			"подтвержденные задачи удаляются из потока")
+	}
+}
+
+func TestSubscriber_PendingAfterRestart(t *testing.T) {
+	srv := miniredis.RunT(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sub := newTestSubscriber(t, srv, "worker-1", time.Hour, retry.Strategy{Attempts: 1}, 1)
+	require.NoError(t, newTestPublisher(t, srv).Publish(ctx, models.NewTaskEnvelope(models.ProcessingTask{ImageID: "img-1"})))
+
+	// Задача прервана остановкой worker.
+	err := sub.Subscribe(ctx, func(ctx context.Context, task *models.ProcessingTask) error {
+		cancel()
+		return ctx.Err()
+	})
+	require.NoError(t, err)
+
+	// После перезапуска потребитель с тем же именем сразу дочитывает свою неподтвержденную запись.
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var got string
+	err = newTestSubscriber(t, srv, "worker-1", time.Hour, retry.Strategy{Attempts: 1}, 1).Subscribe(ctx,
+		func(_ context.Context, task *models.ProcessingTask) error {
+			got = task.ImageID
+			cancel()
+			return nil
+		})
+	require.NoError(t, err)
+	assert.Equal(t, "img-1", got)
+}
+
+func TestSubscriber_ClaimFromDeadConsumer(t *testing.T) {
+	srv := miniredis.RunT(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	sub := newTestSubscriber(t, srv, "worker-2", 300*time.Millisecond, retry.Strategy{Attempts: 1}, 1)
+	require.NoError(t, newTestPublisher(t, srv).Publish(ctx, models.NewTaskEnvelope(models.ProcessingTask{ImageID: "img-1"})))
+
+	// Другой worker получил задачу и упал, не подтвердив ее.
+	client := newTestClient(t, srv)
+	stream := taskStream(testStream, models.PriorityInteractive)
+	require.NoError(t, client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    testGroup,
+		Consumer: "worker-1",
+		Streams:  []string{stream, ">"},
+		Count:    1,
+	}).Err())
+
+	var got string
+	err := sub.Subscribe(ctx, func(_ context.Context, task *models.ProcessingTask) error {
+		got = task.ImageID
+		cancel()
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "img-1", got)
+
+	pending, err := client.XPending(context.Background(), stream, testGroup).Result()
+	require.NoError(t, err)
+	assert.Zero(t, pending.Count)
+}
+
+func TestSubscriber_DeadLetterAndReplay(t *testing.T) {
+	srv := miniredis.RunT(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sub := newTestSubscriber(t, srv, "worker-1", time.Minute, retry.Strategy{Attempts: 2, Delay: time.Millisecond, Backoff: 1}, 1)
+	require.NoError(t, newTestPublisher(t, srv).Publish(ctx, models.NewTaskEnvelope(models.ProcessingTask{ImageID: "img-1", Priority: models.PriorityBulk})))
+	client := newTestClient(t, srv)
+	require.NoError(t, client.XAdd(ctx, &redis.XAddArgs{
+		Stream: taskStream(testStream, models.PriorityInteractive),
+		Values: map[string]any{fieldTask: "not json"},
+	}).Err())
+
+	done := make(chan error, 1)
+	go func() {
+		done <- sub.Subscribe(ctx, func(ctx context.Context, task *models.ProcessingTask) error {
+			return errors.New("disk is full")
+		})
+	}()
+
+	require.Eventually(t, func() bool {
+		return client.XLen(context.Background(), dlqStream(testStream)).Val() == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	require.NoError(t, <-done)
+
+	dead, err := client.XRange(context.Background(), dlqStream(testStream), "-", "+").Result()
+	require.NoError(t, err)
+	require.Len(t, dead, 2)
+	kinds := map[string]map[string]any{}
+	for _, msg := range dead {
+		kinds[msg.Values[fieldErrorKind].(string)] = msg.Values
+	}
+	require.Contains(t, kinds, errorKindDecode)
+	require.Contains(t, kinds, errorKindHandler)
+	assert.Equal(t, "disk is full", kinds[errorKindHandler][fieldError])
+	assert.Equal(t, "2", kinds[errorKindHandler][fieldAttempts])
+	assert.Equal(t, taskStream(testStream, models.PriorityBulk), kinds[errorKindHandler][fieldOriginalStream])
+
+	dlq, err := NewDeadLetterQueue(context.Background(), srv.Addr(), "", testStream)
+	require.NoError(t, err)
+	t.Cleanup(func() { dlq.Close() })
+
+	replayed, err := dlq.Replay(context.Background(), 10)
+	require.NoError(t, err)
+	assert.Equal(t, 2, replayed)
+	assert.Zero(t, client.XLen(context.Background(), dlqStream(testStream)).Val())
+
+	bulk, err := client.XRange(context.Background(), taskStream(testStream, models.PriorityBulk), "-", "+").Result()
+	require.NoError(t, err)
+	require.Len(t, bulk, 1)
+	var task models.ProcessingTask
+	require.NoError(t, json.Unmarshal([]byte(bulk[0].Values[fieldTask].(string)), &task))
+	assert.Equal(t, "img-1", task.ImageID)
+}
+
+// helpers
+func newTestPublisher(t *testing.T, srv *miniredis.Miniredis) *publisher {
+	t.Helper()
+
+	pub, err := NewPublisher(context.Background(), srv.Addr(), "", testStream)
+	require.NoError(t, err)
+	t.Cleanup(func() { pub.Close() })
+
+	return pub
+}
+
+func newTestSubscriber(
+	t *testing.T,
+	srv *miniredis.Miniredis,
+	consumer string,
+	claimIdle time.Duration,
+	handleRetry retry.Strategy,
+	concurrency int,
+) *subscriber {
+	t.Helper()
+
+	sub, err := NewSubscriber(context.Background(), srv.Addr(), "", testStream, testGroup, consumer,
+		map[models.TaskPriority]int{models.PriorityInteractive: 3, models.PriorityBulk: 1}, claimIdle, handleRetry, concurrency)
+	require.NoError(t, err)
+	t.Cleanup(func() { sub.Close() })
+
+	return sub
+}
+
+func newTestClient(t *testing.T, srv *miniredis.Miniredis) *redis.Client {
+	t.Helper()
+
+	client := redis.NewClient(&redis.Options{Addr: srv.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return client
+}
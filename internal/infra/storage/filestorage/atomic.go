@@ -0,0 +1,113 @@
+package filestorage
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// tempSuffix - суффикс временных файлов, которые еще не переименованы в итоговый путь.
+const tempSuffix = ".tmp"
+
+// writeFileAtomic - записывает данные во временный файл рядом с path, выполняет fsync
+// и переименовывает его в path. При сбое посреди записи итоговый файл либо отсутствует,
+// либо содержит предыдущую полную версию.
+func writeFileAtomic(path string, r io.Reader, perm os.FileMode) error {
+	tmpPath, err := writeTemp(path, r, perm)
+	if err != nil {
+		return fmt.Errorf("writeTemp: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("os.Rename: %w", err)
+	}
+
+	if err := syncDir(filepath.Dir(path)); err != nil {
+		return fmt.Errorf("syncDir: %w", err)
+	}
+
+	return nil
+}
+
+// writeBytesExclusive - атомарно создает файл path со срезом байт, только если его еще нет.
+// Если файл уже существует, возвращает ошибку, для которой errors.Is(err, os.ErrExist).
+func writeBytesExclusive(path string, data []byte, perm os.FileMode) error {
+	tmpPath, err := writeTemp(path, bytes.NewReader(data), perm)
+	if err != nil {
+		return fmt.Errorf("writeTemp: %w", err)
+	}
+	defer os.Remove(tmpPath)
+
+	if err := os.Link(tmpPath, path); err != nil {
+		return fmt.Errorf("os.Link: %w", err)
+	}
+
+	if err := syncDir(filepath.Dir(path)); err != nil {
+		return fmt.Errorf("syncDir: %w", err)
+	}
+
+	return nil
+}
+
+// writeBytesAtomic - атомарно записывает срез байт в path.
+func writeBytesAtomic(path string, data []byte, perm os.FileMode) error {
+	return writeFileAtomic(path, bytes.NewReader(data), perm)
+}
+
+// syncDir - сбрасывает на диск запись каталога, чтобы переименование пережило сбой питания.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("os.Open: %w", err)
+	}
+	defer d.Close()
+
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("d.Sync: %w", err)
+	}
+
+	return nil
+}
+
+// writeTemp - записывает данные во временный файл рядом с path и выполняет fsync.
+// Возвращает путь временного файла.
+func writeTemp(path string, r io.Reader, perm os.FileMode) (string, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*"+tempSuffix)
+	if err != nil {
+		return "", fmt.Errorf("os.CreateTemp: %w", err)
+	}
+	tmpPath := tmp.Name()
+
+	committed := false
+	defer func() {
+		if !committed {
+			tmp.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		return "", fmt.Errorf("io.Copy: %w", err)
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		return "", fmt.Errorf("tmp.Chmod: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return "", fmt.Errorf("tmp.Sync: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("tmp.Close: %w", err)
+	}
+	committed = true
+
+	return tmpPath, nil
+}
+
+// isTempFile - сообщает, является ли файл незавершенной временной записью.
+func isTempFile(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.HasSuffix(name, tempSuffix)
+}
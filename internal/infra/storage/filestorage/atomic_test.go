@@ -0,0 +1,60 @@
+package filestorage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "img-1.json")
+
+	require.NoError(t, writeFileAtomic(path, strings.NewReader("first"), 0644))
+	require.NoError(t, writeFileAtomic(path, strings.NewReader("second"), 0600))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "second", string(data))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	assert.Equal(t, []string{"img-1.json"}, listFiles(t, dir))
+}
+
+func TestWriteFileAtomic_MissingDir(t *testing.T) {
+	dir := t.TempDir()
+
+	err := writeFileAtomic(filepath.Join(dir, "missing", "img-1.json"), strings.NewReader("data"), 0644)
+
+	assert.Error(t, err)
+	assert.Empty(t, listFiles(t, dir))
+}
+
+func TestWriteBytesExclusive(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "img-1.json")
+
+	require.NoError(t, writeBytesExclusive(path, []byte("first"), 0644))
+	err := writeBytesExclusive(path, []byte("second"), 0644)
+
+	assert.True(t, errors.Is(err, os.ErrExist))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "first", string(data))
+	assert.Equal(t, []string{"img-1.json"}, listFiles(t, dir))
+}
+
+func TestIsTempFile(t *testing.T) {
+	assert.True(t, isTempFile(".img-1.json.123"+tempSuffix))
+	assert.False(t, isTempFile("img-1.json"+tempSuffix))
+	assert.False(t, isTempFile(".img-1.json"))
+}
@@ -4,13 +4,14 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"mime/multipart"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/wb-go/wbf/zlog"
 
 	"github.com/sunr3d/image-processor/internal/interfaces/infra"
+	"github.com/sunr3d/image-processor/models"
 )
 
 var _ infra.ImageStorage = (*fileStorage)(nil)
@@ -26,22 +27,16 @@ func NewFileStorage(basePath string) *fileStorage {
 	}
 }
 
-// SaveOriginal - сохраняет оригинал изображения и возвращает путь к нему.
-func (fs *fileStorage) SaveOriginal(ctx context.Context, id string, file multipart.File, filename string) (string, error) {
-	dir := filepath.Join(fs.basePath, "original", id)
+// SaveOriginal - сохраняет оригинал изображения тенанта из потока и возвращает путь к нему.
+func (fs *fileStorage) SaveOriginal(ctx context.Context, tenantID, id string, r io.Reader, size int64) (string, error) {
+	dir := filepath.Join(fs.basePath, tenantID, "original", id)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return "", fmt.Errorf("os.MkdirAll: %w", err)
 	}
 
 	path := filepath.Join(dir, "original.jpg")
-	dst, err := os.Create(path)
-	if err != nil {
-		return "", fmt.Errorf("os.Create: %w", err)
-	}
-	defer dst.Close()
-
-	if _, err := io.Copy(dst, file); err != nil {
-		return "", fmt.Errorf("io.Copy: %w", err)
+	if err := writeFileAtomic(path, r, 0644); err != nil {
+		return "", fmt.Errorf("writeFileAtomic: %w", err)
 	}
 
 	zlog.Logger.Info().Msgf("Оригинал изображения сохранен в %s", path)
@@ -49,9 +44,9 @@ func (fs *fileStorage) SaveOriginal(ctx context.Context, id string, file multipa
 	return path, nil
 }
 
-// SaveProcessed - сохраняет обработанное изображение с указанием типа и возвращает путь к нему.
-func (fs *fileStorage) SaveProcessed(ctx context.Context, id, imageType string, data []byte) (string, error) {
-	dir := filepath.Join(fs.basePath, "processed", id)
+// SaveProcessed - сохраняет обработанное изображение тенанта с указанием типа из потока и возвращает путь к нему.
+func (fs *fileStorage) SaveProcessed(ctx context.Context, tenantID, id, imageType string, r io.Reader, size int64) (string, error) {
+	dir := filepath.Join(fs.basePath, tenantID, "processed", id)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return "", fmt.Errorf("os.MkdirAll: %w", err)
 	}
@@ -59,8 +54,8 @@ func (fs *fileStorage) SaveProcessed(ctx context.Context, id, imageType string,
 	filename := fmt.Sprintf("%s.jpg", imageType)
 	path := filepath.Join(dir, filename)
 
-	if err := os.WriteFile(path, data, 0644); err != nil {
-		return "", fmt.Errorf("os.WriteFile: %w", err)
+	if err := writeFileAtomic(path, r, 0644); err != nil {
+		return "", fmt.Errorf("writeFileAtomic: %w", err)
 	}
 
 	zlog.Logger.Info().Msgf("Обработанное изображение (type: %s) сохранено в %s", imageType, path)
@@ -68,27 +63,57 @@ func (fs *fileStorage) SaveProcessed(ctx context.Context, id, imageType string,
 	return path, nil
 }
 
-// GetPath - находит путь к изображению по его ID и типу.
-func (fs *fileStorage) GetPath(id, imageType string) (string, error) {
-	path := ""
+// Open - открывает изображение тенанта по его ID и типу для чтения с произвольным доступом.
+func (fs *fileStorage) Open(ctx context.Context, tenantID, id, imageType string) (io.ReadSeekCloser, *models.ObjectInfo, error) {
+	path, err := fs.path(tenantID, id, imageType)
+	if err != nil {
+		return nil, nil, fmt.Errorf("fs.path: %w", err)
+	}
 
-	switch imageType {
-	case "original":
-		path = filepath.Join(fs.basePath, "original", id, "original.jpg")
-	case "resized", "thumbnail", "watermarked":
-		filename := fmt.Sprintf("%s.jpg", imageType)
-		path = filepath.Join(fs.basePath, "processed", id, filename)
-	default:
-		return "", fmt.Errorf("неизвестный тип изображения: %s", imageType)
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, fmt.Errorf("%w: %s", models.ErrImageNotFound, path)
+		}
+		return nil, nil, fmt.Errorf("os.Open: %w", err)
 	}
 
-	return path, nil
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("f.Stat: %w", err)
+	}
+
+	return f, fileInfo(fi), nil
 }
 
-// DeleteImage - удаляет изображение (оригинал и обработанные версии) по его ID.
-func (fs *fileStorage) DeleteImage(ctx context.Context, id string) error {
-	originalPath := filepath.Join(fs.basePath, "original", id)
-	processedPath := filepath.Join(fs.basePath, "processed", id)
+// Stat - возвращает сведения об изображении тенанта по его ID и типу без открытия файла.
+func (fs *fileStorage) Stat(ctx context.Context, tenantID, id, imageType string) (*models.ObjectInfo, error) {
+	path, err := fs.path(tenantID, id, imageType)
+	if err != nil {
+		return nil, fmt.Errorf("fs.path: %w", err)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s", models.ErrImageNotFound, path)
+		}
+		return nil, fmt.Errorf("os.Stat: %w", err)
+	}
+
+	return fileInfo(fi), nil
+}
+
+// PresignURL - локальный диск не выдает ссылки, изображения отдаются через сервис.
+func (fs *fileStorage) PresignURL(ctx context.Context, tenantID, id, imageType string, ttl time.Duration) (string, error) {
+	return "", models.ErrPresignNotSupported
+}
+
+// DeleteImage - удаляет изображение тенанта (оригинал и обработанные версии) по его ID.
+func (fs *fileStorage) DeleteImage(ctx context.Context, tenantID, id string) error {
+	originalPath := filepath.Join(fs.basePath, tenantID, "original", id)
+	processedPath := filepath.Join(fs.basePath, tenantID, "processed", id)
 
 	if err := os.RemoveAll(originalPath); err != nil {
 		zlog.Logger.Warn().Err(err).Msgf("Ошибка удаления оригинального изображения: %s", originalPath)
@@ -102,3 +127,33 @@ func (fs *fileStorage) DeleteImage(ctx context.Context, id string) error {
 
 	return nil
 }
+
+// Recover - перемещает в карантин недописанные файлы изображений, оставшиеся после сбоя.
+// Вызывается при старте процесса и возвращает количество перемещенных файлов.
+func (fs *fileStorage) Recover(ctx context.Context) (int, error) {
+	moved, err := quarantineScan(fs.basePath, checkImageFile)
+	if err != nil {
+		return moved, fmt.Errorf("quarantineScan: %w", err)
+	}
+
+	return moved, nil
+}
+
+// helpers
+func fileInfo(fi os.FileInfo) *models.ObjectInfo {
+	return &models.ObjectInfo{
+		Size:    fi.Size(),
+		ModTime: fi.ModTime(),
+	}
+}
+
+func (fs *fileStorage) path(tenantID, id, imageType string) (string, error) {
+	switch imageType {
+	case "original":
+		return filepath.Join(fs.basePath, tenantID, "original", id, "original.jpg"), nil
+	case "resized", "thumbnail", "watermarked":
+		return filepath.Join(fs.basePath, tenantID, "processed", id, fmt.Sprintf("%s.jpg", imageType)), nil
+	default:
+		return "", fmt.Errorf("неизвестный тип изображения: %s", imageType)
+	}
+}
@@ -0,0 +1,102 @@
+package filestorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sunr3d/image-processor/internal/interfaces/infra"
+	"github.com/sunr3d/image-processor/models"
+)
+
+var _ infra.ImageInventory = (*fileStorage)(nil)
+
+// Tenants - возвращает тенантов, у которых есть каталоги в хранилище. Служебные каталоги
+// (например, карантин) пропускаются.
+func (fs *fileStorage) Tenants(ctx context.Context) ([]string, error) {
+	entries, err := os.ReadDir(fs.basePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("os.ReadDir: %w", err)
+	}
+
+	var tenants []string
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			tenants = append(tenants, entry.Name())
+		}
+	}
+
+	return tenants, nil
+}
+
+// Images - возвращает изображения тенанта, у которых на диске есть каталог оригинала
+// или обработанных версий.
+func (fs *fileStorage) Images(ctx context.Context, tenantID string) ([]models.StoredImage, error) {
+	byID := make(map[string]*models.StoredImage)
+	var order []string
+
+	for _, kind := range []string{"original", "processed"} {
+		root := filepath.Join(fs.basePath, tenantID, kind)
+
+		entries, err := os.ReadDir(root)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, fmt.Errorf("os.ReadDir: %w", err)
+		}
+
+		for _, entry := range entries {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			if !entry.IsDir() {
+				continue
+			}
+
+			img, ok := byID[entry.Name()]
+			if !ok {
+				img = &models.StoredImage{ID: entry.Name()}
+				byID[entry.Name()] = img
+				order = append(order, entry.Name())
+			}
+
+			if err := latestModTime(filepath.Join(root, entry.Name()), img); err != nil {
+				return nil, fmt.Errorf("latestModTime: %w", err)
+			}
+		}
+	}
+
+	images := make([]models.StoredImage, 0, len(order))
+	for _, id := range order {
+		images = append(images, *byID[id])
+	}
+
+	return images, nil
+}
+
+// helpers
+func latestModTime(dir string, img *models.StoredImage) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(img.ModTime) {
+			img.ModTime = info.ModTime()
+		}
+
+		return nil
+	})
+}
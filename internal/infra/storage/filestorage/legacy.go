@@ -0,0 +1,186 @@
+package filestorage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/sunr3d/image-processor/models"
+)
+
+// Раскладка хранилища до появления тенантов: <base>/original/<id>/original.jpg,
+// <base>/processed/<id>/<type>.jpg и метаданные <metadata>/<id>.json. Такие данные относятся
+// к тенанту по умолчанию и переносятся в его пространство имен при старте процесса.
+
+// legacyImageFiles - файлы, по которым каталог <base>/<kind>/<id> распознается как каталог
+// изображения старой раскладки, а не каталог тенанта с тем же именем.
+var legacyImageFiles = map[string][]string{
+	"original":  {"original.jpg"},
+	"processed": {"resized.jpg", "thumbnail.jpg", "watermarked.jpg"},
+}
+
+// MigrateLegacy - переносит изображения старой раскладки в пространство имен DefaultTenantID.
+// Безопасна при одновременном запуске в app и worker: каталог переносится одним переименованием.
+// Возвращает количество перенесенных каталогов.
+func (fs *fileStorage) MigrateLegacy(ctx context.Context) (int, error) {
+	moved := 0
+
+	for kind, markers := range legacyImageFiles {
+		root := filepath.Join(fs.basePath, kind)
+
+		entries, err := os.ReadDir(root)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return moved, fmt.Errorf("os.ReadDir: %w", err)
+		}
+
+		for _, entry := range entries {
+			if err := ctx.Err(); err != nil {
+				return moved, err
+			}
+			src := filepath.Join(root, entry.Name())
+			if !entry.IsDir() || !hasAnyFile(src, markers) {
+				continue
+			}
+
+			dst := filepath.Join(fs.basePath, models.DefaultTenantID, kind, entry.Name())
+			if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+				return moved, fmt.Errorf("os.MkdirAll: %w", err)
+			}
+			if _, err := os.Stat(dst); err == nil {
+				zlog.Logger.Warn().Msgf("Каталог %s не перенесен: %s уже существует", src, dst)
+				continue
+			}
+			if err := os.Rename(src, dst); err != nil {
+				if os.IsNotExist(err) {
+					continue
+				}
+				return moved, fmt.Errorf("os.Rename: %w", err)
+			}
+			moved++
+		}
+
+		// Каталог остается, если в нем есть что-то кроме изображений старой раскладки.
+		os.Remove(root)
+	}
+
+	return moved, nil
+}
+
+// MigrateLegacy - переносит файлы метаданных старой раскладки в пространство имен DefaultTenantID,
+// проставляя тенанта и пути изображений в новой раскладке. Безопасна при одновременном запуске
+// в app и worker: уже перенесенный файл не перезаписывается. Возвращает количество перенесенных файлов.
+func (ms *metadataStorage) MigrateLegacy(ctx context.Context) (int, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	entries, err := os.ReadDir(ms.basePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("os.ReadDir: %w", err)
+	}
+
+	moved := 0
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return moved, err
+		}
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+
+		src := filepath.Join(ms.basePath, name)
+		meta, err := ReadLegacyMetadata(src)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return moved, fmt.Errorf("ReadLegacyMetadata %s: %w", src, err)
+		}
+
+		data, err := json.Marshal(meta)
+		if err != nil {
+			return moved, fmt.Errorf("json.Marshal: %w", err)
+		}
+
+		if err := os.MkdirAll(filepath.Join(ms.basePath, meta.TenantID), 0755); err != nil {
+			return moved, fmt.Errorf("os.MkdirAll: %w", err)
+		}
+		dst := ms.metaPath(meta.TenantID, meta.ID)
+		if err := writeBytesExclusive(dst, data, 0644); err != nil && !errors.Is(err, os.ErrExist) {
+			return moved, fmt.Errorf("writeBytesExclusive: %w", err)
+		}
+		if err := os.Remove(src); err != nil && !os.IsNotExist(err) {
+			return moved, fmt.Errorf("os.Remove: %w", err)
+		}
+		moved++
+	}
+
+	return moved, nil
+}
+
+// ReadLegacyMetadata - читает файл метаданных старой раскладки <metadata>/<id>.json и переводит
+// метаданные в тенант по умолчанию. Исходный файл не меняется.
+func ReadLegacyMetadata(path string) (*models.ImageMetadata, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var meta models.ImageMetadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal: %w", err)
+	}
+	if meta.ID == "" {
+		meta.ID = strings.TrimSuffix(filepath.Base(path), ".json")
+	}
+	if meta.TenantID == "" {
+		meta.TenantID = models.DefaultTenantID
+	}
+
+	meta.OriginalPath = legacyImagePath(meta.OriginalPath, meta.ID)
+	meta.ResizedPath = legacyImagePath(meta.ResizedPath, meta.ID)
+	meta.ThumbnailPath = legacyImagePath(meta.ThumbnailPath, meta.ID)
+	meta.WatermarkedPath = legacyImagePath(meta.WatermarkedPath, meta.ID)
+
+	return &meta, nil
+}
+
+// helpers
+func hasAnyFile(dir string, names []string) bool {
+	for _, name := range names {
+		if info, err := os.Stat(filepath.Join(dir, name)); err == nil && info.Mode().IsRegular() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// legacyImagePath - путь <base>/<kind>/<id>/<file> старой раскладки в пространстве имен
+// DefaultTenantID. Остальные пути не меняются.
+func legacyImagePath(path, id string) string {
+	dir := filepath.Dir(path)
+	if path == "" || filepath.Base(dir) != id {
+		return path
+	}
+
+	kindDir := filepath.Dir(dir)
+	kind := filepath.Base(kindDir)
+	if _, ok := legacyImageFiles[kind]; !ok {
+		return path
+	}
+
+	return filepath.Join(filepath.Dir(kindDir), models.DefaultTenantID, kind, id, filepath.Base(path))
+}
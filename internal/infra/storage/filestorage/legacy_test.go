@@ -0,0 +1,80 @@
+package filestorage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sunr3d/image-processor/models"
+)
+
+func TestFileStorage_MigrateLegacy(t *testing.T) {
+	ctx := context.Background()
+	base := t.TempDir()
+	writeFile(t, filepath.Join(base, "original", "img-1", "original.jpg"), "original")
+	writeFile(t, filepath.Join(base, "processed", "img-1", "thumbnail.jpg"), "thumbnail")
+	// Каталог тенанта "original" в новой раскладке не относится к старой.
+	writeFile(t, filepath.Join(base, "original", "original", "img-2", "original.jpg"), "tenant")
+
+	fs := NewFileStorage(base)
+
+	moved, err := fs.MigrateLegacy(ctx)
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, moved)
+	assert.Equal(t, "original", readImage(t, fs, models.DefaultTenantID, "img-1", "original"))
+	assert.Equal(t, "thumbnail", readImage(t, fs, models.DefaultTenantID, "img-1", "thumbnail"))
+	assert.Equal(t, "tenant", readImage(t, fs, "original", "img-2", "original"))
+
+	moved, err = fs.MigrateLegacy(ctx)
+
+	require.NoError(t, err)
+	assert.Zero(t, moved)
+}
+
+func TestMetadataStorage_MigrateLegacy(t *testing.T) {
+	ctx := context.Background()
+	base := t.TempDir()
+	writeFile(t, filepath.Join(base, "img-1.json"),
+		`{"ID":"img-1","OriginalPath":"storage/original/img-1/original.jpg","Status":"completed"}`)
+
+	ms := NewMetadataStorage(base)
+
+	moved, err := ms.MigrateLegacy(ctx)
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, moved)
+	assert.NoFileExists(t, filepath.Join(base, "img-1.json"))
+
+	meta, err := ms.Get(ctx, models.DefaultTenantID, "img-1")
+	require.NoError(t, err)
+	assert.Equal(t, models.DefaultTenantID, meta.TenantID)
+	assert.Equal(t, models.StatusCompleted, meta.Status)
+	assert.Equal(t, filepath.Join("storage", models.DefaultTenantID, "original", "img-1", "original.jpg"), meta.OriginalPath)
+}
+
+// helpers
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(data), 0644))
+}
+
+func readImage(t *testing.T, fs *fileStorage, tenantID, id, imageType string) string {
+	t.Helper()
+
+	r, _, err := fs.Open(context.Background(), tenantID, id, imageType)
+	require.NoError(t, err)
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+
+	return string(data)
+}
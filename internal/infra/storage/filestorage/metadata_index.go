@@ -0,0 +1,359 @@
+package filestorage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/sunr3d/image-processor/models"
+)
+
+// sortFields - поля сортировки, для которых индекс хранит упорядоченные записи.
+var sortFields = []string{models.SortByCreatedAt, models.SortByName, models.SortBySize}
+
+// metadataIndex - индекс метаданных тенантов в памяти. Записи этого процесса обновляют индекс
+// сразу. Записи других процессов (worker) обнаруживаются по времени изменения каталога тенанта:
+// файлы метаданных записываются переименованием, которое меняет время изменения каталога.
+// Только после такого изменения каталог перечитывается, и заново разбираются лишь изменившиеся файлы.
+type metadataIndex struct {
+	mu      sync.RWMutex
+	tenants map[string]*tenantIndex
+}
+
+// tenantIndex - записи тенанта, упорядоченные по каждому полю сортировки, и итоги использования хранилища.
+type tenantIndex struct {
+	entries map[string]*indexEntry
+	orders  map[string][]sortItem
+	usage   models.TenantUsage
+	// dirModTime - время изменения каталога тенанта, с которым сверен индекс.
+	dirModTime time.Time
+}
+
+type indexEntry struct {
+	meta    *models.ImageMetadata
+	modTime time.Time
+	size    int64
+}
+
+// sortItem - запись в порядке сортировки: по ключу сортировки, затем по ID.
+type sortItem struct {
+	key  string
+	meta *models.ImageMetadata
+}
+
+// rebuildRatio - если при сверке изменилось больше 1/rebuildRatio записей, порядки сортировки
+// строятся заново, а не обновляются по одной записи.
+const rebuildRatio = 16
+
+func newMetadataIndex() *metadataIndex {
+	return &metadataIndex{
+		tenants: make(map[string]*tenantIndex),
+	}
+}
+
+// view - вызывает fn с индексом тенанта, сверенным с каталогом dir. fn не должна менять индекс.
+func (idx *metadataIndex) view(dir, tenantID string, fn func(t *tenantIndex) error) error {
+	modTime, err := dirModTime(dir)
+	if err != nil {
+		return fmt.Errorf("dirModTime: %w", err)
+	}
+
+	idx.mu.RLock()
+	if t, ok := idx.tenants[tenantID]; ok && !modTime.IsZero() && t.dirModTime.Equal(modTime) {
+		defer idx.mu.RUnlock()
+		return fn(t)
+	}
+	idx.mu.RUnlock()
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	t, err := idx.sync(dir, tenantID, modTime)
+	if err != nil {
+		return fmt.Errorf("sync: %w", err)
+	}
+
+	return fn(t)
+}
+
+// put - обновляет запись индекса после записи файла метаданных. dirBefore - время изменения
+// каталога до записи: если индекс был сверен с ним, сверка после собственной записи не нужна.
+func (idx *metadataIndex) put(path string, meta *models.ImageMetadata, dirBefore time.Time) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	t := idx.tenant(meta.TenantID)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.delete(meta.ID, true)
+		return
+	}
+	t.set(copyMeta(meta), info.ModTime(), info.Size(), true)
+	t.advance(filepath.Dir(path), dirBefore)
+}
+
+// remove - удаляет запись индекса после удаления файла метаданных.
+func (idx *metadataIndex) remove(dir, tenantID, id string, dirBefore time.Time) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	t := idx.tenant(tenantID)
+	t.delete(id, true)
+	t.advance(dir, dirBefore)
+}
+
+// tenant - индекс тенанта; создается пустым. Вызывается под idx.mu.
+func (idx *metadataIndex) tenant(tenantID string) *tenantIndex {
+	t, ok := idx.tenants[tenantID]
+	if !ok {
+		t = &tenantIndex{
+			entries: make(map[string]*indexEntry),
+			orders:  make(map[string][]sortItem, len(sortFields)),
+			usage:   models.TenantUsage{TenantID: tenantID},
+		}
+		idx.tenants[tenantID] = t
+	}
+
+	return t
+}
+
+// sync - сверяет индекс тенанта с каталогом dir. Вызывается под idx.mu.
+func (idx *metadataIndex) sync(dir, tenantID string, modTime time.Time) (*tenantIndex, error) {
+	t := idx.tenant(tenantID)
+
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("os.ReadDir: %w", err)
+	}
+
+	type change struct {
+		meta    *models.ImageMetadata
+		modTime time.Time
+		size    int64
+	}
+	var changes []change
+
+	seen := make(map[string]struct{}, len(dirEntries))
+	for _, de := range dirEntries {
+		if de.IsDir() || !strings.HasSuffix(de.Name(), ".json") || isTempFile(de.Name()) {
+			continue
+		}
+
+		id := strings.TrimSuffix(de.Name(), ".json")
+		info, err := de.Info()
+		if err != nil {
+			continue
+		}
+
+		if cached, ok := t.entries[id]; ok && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+			seen[id] = struct{}{}
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, de.Name()))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("os.ReadFile: %w", err)
+		}
+
+		var meta models.ImageMetadata
+		if err := json.Unmarshal(data, &meta); err != nil {
+			zlog.Logger.Warn().Err(err).Msgf("Пропуск поврежденных метаданных: %s", de.Name())
+			continue
+		}
+		seen[id] = struct{}{}
+		changes = append(changes, change{meta: &meta, modTime: info.ModTime(), size: info.Size()})
+	}
+
+	var removed []string
+	for id := range t.entries {
+		if _, ok := seen[id]; !ok {
+			removed = append(removed, id)
+		}
+	}
+
+	// Большие изменения (первая загрузка каталога) дешевле отсортировать целиком.
+	incremental := (len(changes)+len(removed))*rebuildRatio <= len(t.entries)
+	for _, id := range removed {
+		t.delete(id, incremental)
+	}
+	for _, c := range changes {
+		t.set(c.meta, c.modTime, c.size, incremental)
+	}
+	if !incremental {
+		t.rebuildOrders()
+	}
+	t.dirModTime = modTime
+
+	return t, nil
+}
+
+// set - добавляет или заменяет запись. Без incremental порядки сортировки нужно перестроить
+// вызовом rebuildOrders.
+func (t *tenantIndex) set(meta *models.ImageMetadata, modTime time.Time, size int64, incremental bool) {
+	if old, ok := t.entries[meta.ID]; ok {
+		t.unlink(old.meta, incremental)
+	}
+
+	t.entries[meta.ID] = &indexEntry{meta: meta, modTime: modTime, size: size}
+	t.addUsage(meta, 1)
+	if !incremental {
+		return
+	}
+
+	for _, field := range sortFields {
+		item := sortItem{key: sortKey(field, meta), meta: meta}
+		order := t.orders[field]
+		i, _ := slices.BinarySearchFunc(order, item, compareItems)
+		t.orders[field] = slices.Insert(order, i, item)
+	}
+}
+
+// delete - удаляет запись. Без incremental порядки сортировки нужно перестроить вызовом rebuildOrders.
+func (t *tenantIndex) delete(id string, incremental bool) {
+	old, ok := t.entries[id]
+	if !ok {
+		return
+	}
+
+	t.unlink(old.meta, incremental)
+	delete(t.entries, id)
+}
+
+// unlink - вычитает запись из итогов и, если incremental, из порядков сортировки.
+func (t *tenantIndex) unlink(meta *models.ImageMetadata, incremental bool) {
+	t.addUsage(meta, -1)
+	if !incremental {
+		return
+	}
+
+	for _, field := range sortFields {
+		item := sortItem{key: sortKey(field, meta), meta: meta}
+		order := t.orders[field]
+		if i, found := slices.BinarySearchFunc(order, item, compareItems); found {
+			t.orders[field] = slices.Delete(order, i, i+1)
+		}
+	}
+}
+
+func (t *tenantIndex) rebuildOrders() {
+	for _, field := range sortFields {
+		order := make([]sortItem, 0, len(t.entries))
+		for _, e := range t.entries {
+			order = append(order, sortItem{key: sortKey(field, e.meta), meta: e.meta})
+		}
+		slices.SortFunc(order, compareItems)
+		t.orders[field] = order
+	}
+}
+
+// addUsage - прибавляет (sign = 1) или вычитает (sign = -1) изображение из итогов тенанта.
+// Удаленные изображения в итогах не учитываются.
+func (t *tenantIndex) addUsage(meta *models.ImageMetadata, sign int) {
+	if meta.Deleted() {
+		return
+	}
+
+	t.usage.OriginalsCount += sign
+	t.usage.OriginalsBytes += int64(sign) * meta.OriginalSize
+	t.usage.DerivativesCount += sign * meta.DerivativesCount()
+	t.usage.DerivativesBytes += int64(sign) * meta.ProcessedSize
+}
+
+// advance - после собственной записи в dir переносит время сверки на новое время изменения
+// каталога, если до записи индекс был сверен. Иначе каталог будет перечитан при следующем чтении.
+func (t *tenantIndex) advance(dir string, dirBefore time.Time) {
+	if t.dirModTime.IsZero() || !t.dirModTime.Equal(dirBefore) {
+		return
+	}
+
+	if modTime, err := dirModTime(dir); err == nil {
+		t.dirModTime = modTime
+	}
+}
+
+// paginate - отбирает страницу метаданных по keyset-курсору из записей, упорядоченных
+// по возрастанию ключа сортировки запроса.
+func paginate(items []sortItem, q *models.ImageQuery) (*models.ImagePage, error) {
+	cursor, err := q.PageCursor()
+	if err != nil {
+		return nil, err
+	}
+
+	n := len(items)
+	at := func(i int) sortItem {
+		if q.Desc {
+			return items[n-1-i]
+		}
+		return items[i]
+	}
+
+	start := 0
+	if cursor != nil {
+		pivot := sortItem{key: cursor.Key, meta: &models.ImageMetadata{ID: cursor.ID}}
+		start = sort.Search(n, func(i int) bool {
+			if q.Desc {
+				return compareItems(at(i), pivot) < 0
+			}
+			return compareItems(at(i), pivot) > 0
+		})
+	}
+
+	page := &models.ImagePage{Items: make([]*models.ImageMetadata, 0, max(q.Limit, 0))}
+	for i := start; i < n && q.Limit > 0; i++ {
+		meta := at(i).meta
+		if !q.Matches(meta) {
+			continue
+		}
+		if len(page.Items) == q.Limit {
+			page.NextCursor = q.NextCursor(page.Items[len(page.Items)-1])
+			break
+		}
+		page.Items = append(page.Items, copyMeta(meta))
+	}
+
+	return page, nil
+}
+
+// helpers
+func compareItems(a, b sortItem) int {
+	if c := strings.Compare(a.key, b.key); c != 0 {
+		return c
+	}
+
+	return strings.Compare(a.meta.ID, b.meta.ID)
+}
+
+func sortKey(field string, meta *models.ImageMetadata) string {
+	return (&models.ImageQuery{SortBy: field}).SortKey(meta)
+}
+
+// dirModTime - время изменения каталога; нулевое, если каталога нет.
+func dirModTime(dir string) (time.Time, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, fmt.Errorf("os.Stat: %w", err)
+	}
+
+	return info.ModTime(), nil
+}
+
+func copyMeta(meta *models.ImageMetadata) *models.ImageMetadata {
+	m := *meta
+	m.Tags = append([]string(nil), meta.Tags...)
+	return &m
+}
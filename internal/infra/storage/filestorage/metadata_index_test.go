@@ -0,0 +1,153 @@
+package filestorage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sunr3d/image-processor/models"
+)
+
+func TestPaginate(t *testing.T) {
+	created := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	idx := newMetadataIndex()
+	tenant := idx.tenant("t1")
+	for i := range 5 {
+		tenant.set(&models.ImageMetadata{
+			ID:        fmt.Sprintf("img-%d", i),
+			TenantID:  "t1",
+			Status:    models.StatusCompleted,
+			CreatedAt: created.Add(time.Duration(i) * time.Hour),
+		}, time.Time{}, 0, true)
+	}
+	// Не подходит под фильтр и не должна занимать место на странице.
+	tenant.set(&models.ImageMetadata{ID: "img-failed", TenantID: "t1", Status: models.StatusFailed, CreatedAt: created}, time.Time{}, 0, true)
+
+	tests := []struct {
+		name string
+		desc bool
+		want [][]string
+	}{
+		{name: "asc", want: [][]string{{"img-0", "img-1"}, {"img-2", "img-3"}, {"img-4"}}},
+		{name: "desc", desc: true, want: [][]string{{"img-4", "img-3"}, {"img-2", "img-1"}, {"img-0"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &models.ImageQuery{
+				TenantID: "t1",
+				Statuses: []models.ImageStatus{models.StatusCompleted},
+				SortBy:   models.SortByCreatedAt,
+				Desc:     tt.desc,
+				Limit:    2,
+			}
+
+			var got [][]string
+			for {
+				page, err := paginate(tenant.orders[q.SortField()], q)
+				require.NoError(t, err)
+				got = append(got, ids(page.Items))
+
+				if page.NextCursor == "" {
+					break
+				}
+				q.Cursor = page.NextCursor
+			}
+
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMetadataStorage_ListAndUsage(t *testing.T) {
+	ctx := context.Background()
+	base := t.TempDir()
+	ms := NewMetadataStorage(base)
+
+	for i, name := range []string{"c.jpg", "a.jpg", "b.jpg"} {
+		require.NoError(t, ms.Save(ctx, &models.ImageMetadata{
+			ID:           fmt.Sprintf("img-%d", i),
+			TenantID:     "t1",
+			OriginalName: name,
+			OriginalSize: 100,
+		}))
+	}
+
+	page, err := ms.List(ctx, &models.ImageQuery{TenantID: "t1", SortBy: models.SortByName, Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"img-1", "img-2", "img-0"}, ids(page.Items))
+
+	meta, err := ms.Get(ctx, "t1", "img-1")
+	require.NoError(t, err)
+	meta.ResizedPath = "resized.jpg"
+	meta.ProcessedSize = 50
+	require.NoError(t, ms.Update(ctx, meta))
+	require.NoError(t, ms.Delete(ctx, "t1", "img-2"))
+
+	usage, err := ms.Usage(ctx, "t1")
+	require.NoError(t, err)
+	assert.Equal(t, models.TenantUsage{TenantID: "t1", OriginalsCount: 2, OriginalsBytes: 200, DerivativesCount: 1, DerivativesBytes: 50}, *usage)
+
+	// Запись другого процесса подхватывается по изменению каталога тенанта.
+	other := NewMetadataStorage(base)
+	require.NoError(t, other.Save(ctx, &models.ImageMetadata{ID: "img-9", TenantID: "t1", OriginalName: "0.jpg", OriginalSize: 7}))
+	touchDir(t, filepath.Join(base, "t1"))
+
+	page, err = ms.List(ctx, &models.ImageQuery{TenantID: "t1", SortBy: models.SortByName, Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"img-9", "img-1", "img-0"}, ids(page.Items))
+
+	usage, err = ms.Usage(ctx, "t1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(207), usage.OriginalsBytes)
+}
+
+func TestMetadataStorage_SaveWithTask_Quota(t *testing.T) {
+	ctx := context.Background()
+	ms := NewMetadataStorage(t.TempDir())
+	quota := models.Quota{MaxImages: 2}
+
+	save := func(id string) error {
+		meta := &models.ImageMetadata{ID: id, TenantID: "t1", OriginalName: id + ".jpg", OriginalSize: 10}
+		return ms.SaveWithTask(ctx, meta, &models.ProcessingTask{TenantID: "t1", ImageID: id}, quota)
+	}
+
+	require.NoError(t, save("img-1"))
+	require.NoError(t, save("img-2"))
+	assert.ErrorIs(t, save("img-3"), models.ErrQuotaExceeded)
+
+	// Удаленное изображение освобождает квоту.
+	meta, err := ms.Get(ctx, "t1", "img-1")
+	require.NoError(t, err)
+	meta.DeletedAt = time.Now()
+	require.NoError(t, ms.Update(ctx, meta))
+
+	usage, err := ms.Usage(ctx, "t1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, usage.OriginalsCount)
+	assert.NoError(t, save("img-3"))
+}
+
+// helpers
+func ids(items []*models.ImageMetadata) []string {
+	result := make([]string, 0, len(items))
+	for _, meta := range items {
+		result = append(result, meta.ID)
+	}
+
+	return result
+}
+
+// touchDir - сдвигает время изменения каталога, чтобы тест не зависел от точности часов файловой системы.
+func touchDir(t *testing.T, dir string) {
+	t.Helper()
+
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(dir, future, future))
+}
@@ -18,6 +18,7 @@ var _ infra.MetadataStorage = (*metadataStorage)(nil)
 
 type metadataStorage struct {
 	basePath string
+	index    *metadataIndex
 	mu       sync.RWMutex
 }
 
@@ -25,39 +26,56 @@ type metadataStorage struct {
 func NewMetadataStorage(basePath string) *metadataStorage {
 	return &metadataStorage{
 		basePath: basePath,
+		index:    newMetadataIndex(),
 	}
 }
 
-// Save - сохраняет метаданные изображения.
+// Save - сохраняет метаданные нового изображения с версией 1 в пространстве имен его тенанта.
 func (ms *metadataStorage) Save(ctx context.Context, meta *models.ImageMetadata) error {
 	ms.mu.Lock()
 	defer ms.mu.Unlock()
 
-	if err := os.MkdirAll(ms.basePath, 0755); err != nil {
-		return fmt.Errorf("os.MkdirAll: %w", err)
-	}
+	return ms.save(meta)
+}
 
-	data, err := json.Marshal(meta)
-	if err != nil {
-		return fmt.Errorf("json.Marshal: %w", err)
+// SaveWithTask - сохраняет метаданные нового изображения, затем задачу на его обработку в outbox.
+// Транзакций у файлового хранилища нет: при сбое процесса между двумя записями изображение
+// останется без задачи, но ошибка брокера задачу уже не потеряет. Квота проверяется под той же
+// блокировкой, что и запись; как и для Update, между процессами гарантий нет.
+func (ms *metadataStorage) SaveWithTask(ctx context.Context, meta *models.ImageMetadata, task *models.ProcessingTask, quota models.Quota) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if !quota.Unlimited() {
+		var usage models.TenantUsage
+		if err := ms.index.view(filepath.Join(ms.basePath, meta.TenantID), meta.TenantID, func(t *tenantIndex) error {
+			usage = t.usage
+			return nil
+		}); err != nil {
+			return fmt.Errorf("index.view: %w", err)
+		}
+		if err := quota.Check(&usage, meta.OriginalSize); err != nil {
+			return err
+		}
 	}
 
-	path := filepath.Join(ms.basePath, fmt.Sprintf("%s.json", meta.ID))
-	if err := os.WriteFile(path, data, 0644); err != nil {
-		return fmt.Errorf("os.WriteFile: %w", err)
+	if err := ms.save(meta); err != nil {
+		return err
 	}
 
-	zlog.Logger.Info().Msgf("Метаданные изображения сохранены: %s", path)
+	if err := ms.insertTask(task); err != nil {
+		return fmt.Errorf("insertTask: %w", err)
+	}
 
 	return nil
 }
 
-// Get - получает метаданные изображения по ID.
-func (ms *metadataStorage) Get(ctx context.Context, id string) (*models.ImageMetadata, error) {
+// Get - получает метаданные изображения тенанта по ID.
+func (ms *metadataStorage) Get(ctx context.Context, tenantID, id string) (*models.ImageMetadata, error) {
 	ms.mu.RLock()
 	defer ms.mu.RUnlock()
 
-	path := filepath.Join(ms.basePath, fmt.Sprintf("%s.json", id))
+	path := ms.metaPath(tenantID, id)
 	data, err := os.ReadFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -71,44 +89,172 @@ func (ms *metadataStorage) Get(ctx context.Context, id string) (*models.ImageMet
 		return nil, fmt.Errorf("json.Unmarshal: %w", err)
 	}
 
+	if meta.TenantID != tenantID {
+		return nil, fmt.Errorf("метаданные изображения не найдены: %s", id)
+	}
+
 	return &meta, nil
 }
 
-// Update - обновляет метаданные изображения.
+// Update - обновляет метаданные изображения, если версия в файле совпадает с meta.Version.
+// Проверка защищает от потерянных обновлений внутри процесса; между процессами гарантий нет.
 func (ms *metadataStorage) Update(ctx context.Context, meta *models.ImageMetadata) error {
 	ms.mu.Lock()
 	defer ms.mu.Unlock()
 
-	path := filepath.Join(ms.basePath, fmt.Sprintf("%s.json", meta.ID))
+	return ms.update(meta)
+}
 
-	data, err := json.Marshal(meta)
-	if err != nil {
-		return fmt.Errorf("json.Marshal: %w", err)
-	}
+// UpdateWithTask - обновляет метаданные, как Update, затем записывает задачу на обработку в outbox.
+func (ms *metadataStorage) UpdateWithTask(ctx context.Context, meta *models.ImageMetadata, task *models.ProcessingTask) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
 
-	if err := os.WriteFile(path, data, 0644); err != nil {
-		return fmt.Errorf("os.WriteFile: %w", err)
+	if err := ms.update(meta); err != nil {
+		return err
 	}
 
-	zlog.Logger.Info().Msgf("Метаданные изображения обновлены (%s): %s", meta.ID, path)
+	if err := ms.insertTask(task); err != nil {
+		return fmt.Errorf("insertTask: %w", err)
+	}
 
 	return nil
 }
 
-// Delete - удаляет метаданные изображения по ID.
-func (ms *metadataStorage) Delete(ctx context.Context, id string) error {
+// Delete - удаляет метаданные изображения тенанта по ID.
+func (ms *metadataStorage) Delete(ctx context.Context, tenantID, id string) error {
 	ms.mu.Lock()
 	defer ms.mu.Unlock()
 
-	path := filepath.Join(ms.basePath, fmt.Sprintf("%s.json", id))
+	path := ms.metaPath(tenantID, id)
+	dirBefore, _ := dirModTime(filepath.Dir(path))
 	if err := os.Remove(path); err != nil {
 		if os.IsNotExist(err) {
 			return fmt.Errorf("метаданные изображения не найдены: %s", id)
 		}
 		return fmt.Errorf("os.Remove: %w", err)
 	}
+	ms.index.remove(filepath.Dir(path), tenantID, id, dirBefore)
 
 	zlog.Logger.Info().Msgf("Метаданные изображения удалены (%s): %s", id, path)
 
 	return nil
 }
+
+// Usage - подсчитывает объем и количество оригиналов и производных неудаленных изображений тенанта.
+func (ms *metadataStorage) Usage(ctx context.Context, tenantID string) (*models.TenantUsage, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	var usage models.TenantUsage
+	if err := ms.index.view(filepath.Join(ms.basePath, tenantID), tenantID, func(t *tenantIndex) error {
+		usage = t.usage
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("index.view: %w", err)
+	}
+
+	return &usage, nil
+}
+
+// List - возвращает страницу метаданных тенанта, удовлетворяющих запросу.
+func (ms *metadataStorage) List(ctx context.Context, query *models.ImageQuery) (*models.ImagePage, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	var page *models.ImagePage
+	if err := ms.index.view(filepath.Join(ms.basePath, query.TenantID), query.TenantID, func(t *tenantIndex) error {
+		var err error
+		page, err = paginate(t.orders[query.SortField()], query)
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("index.view: %w", err)
+	}
+
+	return page, nil
+}
+
+// Recover - перемещает в карантин недописанные и поврежденные файлы метаданных.
+// Вызывается при старте процесса и возвращает количество перемещенных файлов.
+func (ms *metadataStorage) Recover(ctx context.Context) (int, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	moved, err := quarantineScan(ms.basePath, checkMetadataFile)
+	if err != nil {
+		return moved, fmt.Errorf("quarantineScan: %w", err)
+	}
+
+	return moved, nil
+}
+
+// helpers
+// save - записывает метаданные нового изображения. Вызывается под ms.mu.
+func (ms *metadataStorage) save(meta *models.ImageMetadata) error {
+	if err := os.MkdirAll(filepath.Join(ms.basePath, meta.TenantID), 0755); err != nil {
+		return fmt.Errorf("os.MkdirAll: %w", err)
+	}
+
+	meta.Version = 1
+
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %w", err)
+	}
+
+	path := ms.metaPath(meta.TenantID, meta.ID)
+	dirBefore, _ := dirModTime(filepath.Dir(path))
+	if err := writeBytesAtomic(path, data, 0644); err != nil {
+		return fmt.Errorf("writeBytesAtomic: %w", err)
+	}
+	ms.index.put(path, meta, dirBefore)
+
+	zlog.Logger.Info().Msgf("Метаданные изображения сохранены: %s", path)
+
+	return nil
+}
+
+// update - записывает метаданные с проверкой версии. Вызывается под ms.mu.
+func (ms *metadataStorage) update(meta *models.ImageMetadata) error {
+	path := ms.metaPath(meta.TenantID, meta.ID)
+
+	current, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("метаданные изображения не найдены: %s", meta.ID)
+		}
+		return fmt.Errorf("os.ReadFile: %w", err)
+	}
+
+	var stored models.ImageMetadata
+	if err := json.Unmarshal(current, &stored); err != nil {
+		return fmt.Errorf("json.Unmarshal: %w", err)
+	}
+
+	if stored.Version != meta.Version {
+		return fmt.Errorf("%w: %s (версия %d, в хранилище %d)", models.ErrVersionConflict, meta.ID, meta.Version, stored.Version)
+	}
+
+	updated := *meta
+	updated.Version++
+
+	data, err := json.Marshal(&updated)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %w", err)
+	}
+
+	dirBefore, _ := dirModTime(filepath.Dir(path))
+	if err := writeBytesAtomic(path, data, 0644); err != nil {
+		return fmt.Errorf("writeBytesAtomic: %w", err)
+	}
+	meta.Version = updated.Version
+	ms.index.put(path, meta, dirBefore)
+
+	zlog.Logger.Info().Msgf("Метаданные изображения обновлены (%s): %s", meta.ID, path)
+
+	return nil
+}
+
+func (ms *metadataStorage) metaPath(tenantID, id string) string {
+	return filepath.Join(ms.basePath, tenantID, fmt.Sprintf("%s.json", id))
+}
@@ -0,0 +1,195 @@
+package filestorage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/sunr3d/image-processor/internal/interfaces/infra"
+	"github.com/sunr3d/image-processor/models"
+)
+
+var _ infra.Outbox = (*metadataStorage)(nil)
+
+// outboxDir - каталог внутри хранилища метаданных с записями outbox, по файлу на задачу.
+const outboxDir = ".outbox"
+
+// ClaimTasks - захватывает до limit записей outbox, готовых к публикации, на время lease.
+// Захват защищен только мьютексом процесса, поэтому relay должен работать в одном процессе.
+func (ms *metadataStorage) ClaimTasks(ctx context.Context, limit int, lease time.Duration) ([]*models.OutboxEntry, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	all, err := ms.listTasks()
+	if err != nil {
+		return nil, fmt.Errorf("listTasks: %w", err)
+	}
+
+	now := time.Now()
+	var entries []*models.OutboxEntry
+	for _, entry := range all {
+		if !entry.AvailableAt.After(now) {
+			entries = append(entries, entry)
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].AvailableAt.Equal(entries[j].AvailableAt) {
+			return entries[i].AvailableAt.Before(entries[j].AvailableAt)
+		}
+		return entries[i].ID < entries[j].ID
+	})
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	for _, entry := range entries {
+		entry.Attempts++
+		entry.AvailableAt = now.Add(lease)
+		if err := ms.writeTask(entry); err != nil {
+			return nil, fmt.Errorf("writeTask: %w", err)
+		}
+	}
+
+	return entries, nil
+}
+
+// CompleteTask - удаляет опубликованную запись outbox.
+func (ms *metadataStorage) CompleteTask(ctx context.Context, id string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if err := os.Remove(ms.taskPath(id)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("os.Remove: %w", err)
+	}
+
+	return nil
+}
+
+// RetryTask - откладывает повторную публикацию записи outbox на delay.
+func (ms *metadataStorage) RetryTask(ctx context.Context, id string, delay time.Duration, cause string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	entry, err := ms.readTask(id)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("запись outbox не найдена: %s", id)
+		}
+		return fmt.Errorf("readTask: %w", err)
+	}
+
+	entry.AvailableAt = time.Now().Add(delay)
+	entry.LastError = cause
+	if err := ms.writeTask(entry); err != nil {
+		return fmt.Errorf("writeTask: %w", err)
+	}
+
+	return nil
+}
+
+// HasTask - сообщает, ждет ли в outbox публикации задача на обработку изображения.
+func (ms *metadataStorage) HasTask(ctx context.Context, tenantID, imageID string) (bool, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	entries, err := ms.listTasks()
+	if err != nil {
+		return false, fmt.Errorf("listTasks: %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.Task.TenantID == tenantID && entry.Task.ImageID == imageID {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// helpers
+// insertTask - добавляет задачу в outbox. Вызывается под ms.mu.
+func (ms *metadataStorage) insertTask(task *models.ProcessingTask) error {
+	if err := os.MkdirAll(filepath.Join(ms.basePath, outboxDir), 0755); err != nil {
+		return fmt.Errorf("os.MkdirAll: %w", err)
+	}
+
+	now := time.Now()
+	entry := &models.OutboxEntry{
+		ID:          uuid.New().String(),
+		Task:        *task,
+		CreatedAt:   now,
+		AvailableAt: now,
+	}
+
+	return ms.writeTask(entry)
+}
+
+// listTasks - читает все записи outbox. Вызывается под ms.mu.
+func (ms *metadataStorage) listTasks() ([]*models.OutboxEntry, error) {
+	files, err := os.ReadDir(filepath.Join(ms.basePath, outboxDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("os.ReadDir: %w", err)
+	}
+
+	var entries []*models.OutboxEntry
+	for _, f := range files {
+		if f.IsDir() || isTempFile(f.Name()) || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+
+		entry, err := ms.readTask(strings.TrimSuffix(f.Name(), ".json"))
+		if err != nil {
+			// Поврежденную запись уберет в карантин Recover при следующем старте.
+			if !os.IsNotExist(err) {
+				zlog.Logger.Warn().Err(err).Msgf("Не удалось прочитать запись outbox: %s", f.Name())
+			}
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func (ms *metadataStorage) readTask(id string) (*models.OutboxEntry, error) {
+	data, err := os.ReadFile(ms.taskPath(id))
+	if err != nil {
+		return nil, err
+	}
+
+	var entry models.OutboxEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal: %w", err)
+	}
+
+	return &entry, nil
+}
+
+func (ms *metadataStorage) writeTask(entry *models.OutboxEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %w", err)
+	}
+
+	if err := writeBytesAtomic(ms.taskPath(entry.ID), data, 0644); err != nil {
+		return fmt.Errorf("writeBytesAtomic: %w", err)
+	}
+
+	return nil
+}
+
+func (ms *metadataStorage) taskPath(id string) string {
+	return filepath.Join(ms.basePath, outboxDir, id+".json")
+}
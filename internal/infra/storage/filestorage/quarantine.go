@@ -0,0 +1,176 @@
+package filestorage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/wb-go/wbf/zlog"
+)
+
+// quarantineDir - каталог внутри хранилища, куда перемещаются недописанные файлы.
+const quarantineDir = ".quarantine"
+
+// tempMinAge - минимальный возраст временного файла, после которого он считается брошенным.
+// Защищает записи, которые в момент сканирования ведет соседний процесс (app или worker).
+const tempMinAge = time.Minute
+
+var (
+	jpegSOI = []byte{0xFF, 0xD8}
+	jpegEOI = []byte{0xFF, 0xD9}
+)
+
+// fileCheck - возвращает причину, по которой файл нужно поместить в карантин, или пустую строку.
+// Для файла, которого уже нет, возвращает пустую строку.
+type fileCheck func(path string, info fs.FileInfo) (string, error)
+
+// quarantineScan - обходит basePath и перемещает в карантин брошенные временные файлы
+// и файлы, не прошедшие check. Файлы, удаленные или переименованные соседним процессом
+// во время обхода, пропускаются. Возвращает количество перемещенных файлов.
+func quarantineScan(basePath string, check fileCheck) (int, error) {
+	moved := 0
+
+	err := filepath.WalkDir(basePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				if path == basePath {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			if path != basePath && d.Name() == quarantineDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return fmt.Errorf("d.Info: %w", err)
+		}
+
+		reason := ""
+		if isTempFile(d.Name()) {
+			if time.Since(info.ModTime()) < tempMinAge {
+				return nil
+			}
+			reason = "брошенный временный файл"
+		} else if reason, err = check(path, info); err != nil {
+			return fmt.Errorf("check: %w", err)
+		}
+		if reason == "" {
+			return nil
+		}
+
+		dst, err := quarantineFile(basePath, path)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return fmt.Errorf("quarantineFile: %w", err)
+		}
+		moved++
+		zlog.Logger.Warn().Msgf("Файл помещен в карантин (%s): %s -> %s", reason, path, dst)
+
+		return nil
+	})
+	if err != nil {
+		return moved, fmt.Errorf("filepath.WalkDir: %w", err)
+	}
+
+	return moved, nil
+}
+
+// quarantineFile - перемещает файл в карантин с сохранением относительного пути. Если файла
+// уже нет, возвращает ошибку, для которой errors.Is(err, fs.ErrNotExist).
+func quarantineFile(basePath, path string) (string, error) {
+	rel, err := filepath.Rel(basePath, path)
+	if err != nil {
+		return "", fmt.Errorf("filepath.Rel: %w", err)
+	}
+
+	dst := filepath.Join(basePath, quarantineDir, rel)
+	if _, err := os.Stat(dst); err == nil {
+		dst = fmt.Sprintf("%s.%d", dst, time.Now().UnixNano())
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return "", fmt.Errorf("os.MkdirAll: %w", err)
+	}
+	if err := os.Rename(path, dst); err != nil {
+		return "", fmt.Errorf("os.Rename: %w", err)
+	}
+
+	return dst, nil
+}
+
+// checkImageFile - распознает пустые файлы, а среди обработанных версий (их всегда кодирует
+// сервис в JPEG) - обрезанные файлы без маркера конца изображения. Оригиналы загружаются
+// пользователями в произвольном виде и проверяются только на пустоту.
+func checkImageFile(path string, info fs.FileInfo) (string, error) {
+	if info.Size() == 0 {
+		return "пустой файл", nil
+	}
+	if filepath.Base(filepath.Dir(filepath.Dir(path))) != "processed" {
+		return "", nil
+	}
+	if info.Size() < int64(len(jpegSOI)+len(jpegEOI)) {
+		return "обрезанное изображение", nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("os.Open: %w", err)
+	}
+	defer f.Close()
+
+	head := make([]byte, len(jpegSOI))
+	if _, err := io.ReadFull(f, head); err != nil {
+		return "", fmt.Errorf("io.ReadFull: %w", err)
+	}
+	tail := make([]byte, len(jpegEOI))
+	if _, err := f.ReadAt(tail, info.Size()-int64(len(tail))); err != nil {
+		return "", fmt.Errorf("f.ReadAt: %w", err)
+	}
+	if !bytes.Equal(head, jpegSOI) || !bytes.Equal(tail, jpegEOI) {
+		return "обрезанное изображение", nil
+	}
+
+	return "", nil
+}
+
+// checkMetadataFile - распознает JSON файлы метаданных, которые не удается разобрать.
+func checkMetadataFile(path string, info fs.FileInfo) (string, error) {
+	if !strings.HasSuffix(path, ".json") {
+		return "", nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("os.ReadFile: %w", err)
+	}
+	if !json.Valid(data) {
+		return "поврежденный JSON", nil
+	}
+
+	return "", nil
+}
@@ -0,0 +1,128 @@
+package filestorage
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuarantineScan_Images(t *testing.T) {
+	base := t.TempDir()
+	processed := filepath.Join(base, "t1", "processed")
+	original := filepath.Join(base, "t1", "original")
+
+	writeFile(t, filepath.Join(processed, "img-1", "thumbnail.jpg"), "\xFF\xD8jpeg\xFF\xD9")
+	writeFile(t, filepath.Join(processed, "img-2", "thumbnail.jpg"), "\xFF\xD8trunc")
+	writeFile(t, filepath.Join(original, "img-1", "original.jpg"), "any upload")
+	writeFile(t, filepath.Join(original, "img-3", "original.jpg"), "")
+
+	abandoned := filepath.Join(original, "img-4", ".original.jpg.1.tmp")
+	writeFile(t, abandoned, "partial")
+	old := time.Now().Add(-2 * tempMinAge)
+	require.NoError(t, os.Chtimes(abandoned, old, old))
+	// Свежий временный файл может дописывать соседний процесс.
+	writeFile(t, filepath.Join(original, "img-5", ".original.jpg.2.tmp"), "partial")
+
+	moved, err := quarantineScan(base, checkImageFile)
+
+	require.NoError(t, err)
+	assert.Equal(t, 3, moved)
+	assert.Equal(t, []string{
+		"t1/original/img-3/original.jpg",
+		"t1/original/img-4/.original.jpg.1.tmp",
+		"t1/processed/img-2/thumbnail.jpg",
+	}, listFiles(t, filepath.Join(base, quarantineDir)))
+	assert.Equal(t, []string{
+		"original/img-1/original.jpg",
+		"original/img-5/.original.jpg.2.tmp",
+		"processed/img-1/thumbnail.jpg",
+	}, listFiles(t, filepath.Join(base, "t1")))
+
+	// Карантин не сканируется повторно.
+	moved, err = quarantineScan(base, checkImageFile)
+
+	require.NoError(t, err)
+	assert.Zero(t, moved)
+}
+
+func TestQuarantineScan_Metadata(t *testing.T) {
+	base := t.TempDir()
+	writeFile(t, filepath.Join(base, "t1", "img-1.json"), `{"ID":"img-1"}`)
+	writeFile(t, filepath.Join(base, "t1", "img-2.json"), `{"ID":"im`)
+
+	moved, err := quarantineScan(base, checkMetadataFile)
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, moved)
+	assert.Equal(t, []string{"t1/img-2.json"}, listFiles(t, filepath.Join(base, quarantineDir)))
+}
+
+func TestQuarantineScan_MissingBase(t *testing.T) {
+	moved, err := quarantineScan(filepath.Join(t.TempDir(), "missing"), checkMetadataFile)
+
+	require.NoError(t, err)
+	assert.Zero(t, moved)
+}
+
+func TestFileCheck_RemovedFile(t *testing.T) {
+	tests := []struct {
+		name  string
+		path  string
+		check fileCheck
+	}{
+		{name: "image", path: filepath.Join("processed", "img-1", "thumbnail.jpg"), check: checkImageFile},
+		{name: "metadata", path: "img-1.json", check: checkMetadataFile},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.path)
+			writeFile(t, path, "data")
+			info, err := os.Stat(path)
+			require.NoError(t, err)
+			// Файл удален соседним процессом между обходом каталога и проверкой.
+			require.NoError(t, os.Remove(path))
+
+			reason, err := tt.check(path, info)
+
+			require.NoError(t, err)
+			assert.Empty(t, reason)
+		})
+	}
+}
+
+func TestQuarantineFile_RemovedFile(t *testing.T) {
+	base := t.TempDir()
+
+	_, err := quarantineFile(base, filepath.Join(base, "t1", "img-1.json"))
+
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+}
+
+// helpers
+// listFiles - пути файлов внутри dir относительно dir, в порядке обхода.
+func listFiles(t *testing.T, dir string) []string {
+	t.Helper()
+
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	require.NoError(t, err)
+
+	return files
+}
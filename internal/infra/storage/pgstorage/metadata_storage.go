@@ -0,0 +1,446 @@
+package pgstorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/wb-go/wbf/dbpg"
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/sunr3d/image-processor/internal/interfaces/infra"
+	"github.com/sunr3d/image-processor/models"
+)
+
+var _ infra.MetadataStorage = (*metadataStorage)(nil)
+
+const usageQuery = `SELECT
+	COUNT(*),
+	COALESCE(SUM(original_size), 0),
+	COALESCE(SUM((resized_path <> '')::int + (thumbnail_path <> '')::int + (watermarked_path <> '')::int), 0),
+	COALESCE(SUM(processed_size), 0)
+	FROM images WHERE tenant_id = $1 AND deleted_at IS NULL`
+
+const imageColumns = `tenant_id, id, original_name, original_path, resized_path, thumbnail_path, watermarked_path,
+	original_size, processed_size, format, width, height, tags, status, error_message, created_at, updated_at, version,
+	tier, accessed_at, expires_at, deleted_at, attempts, priority, correlation_id`
+
+type metadataStorage struct {
+	db *dbpg.DB
+}
+
+// NewMetadataStorage - конструктор MetadataStorage на PostgreSQL. Применяет миграции схемы.
+func NewMetadataStorage(ctx context.Context, dsn string) (*metadataStorage, error) {
+	db, err := dbpg.New(dsn, nil, &dbpg.Options{
+		MaxOpenConns:    10,
+		MaxIdleConns:    5,
+		ConnMaxLifetime: 30 * time.Minute,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("dbpg.New: %w", err)
+	}
+
+	if err := db.Master.PingContext(ctx); err != nil {
+		db.Master.Close()
+		return nil, fmt.Errorf("db.Ping: %w", err)
+	}
+
+	if err := migrate(ctx, db); err != nil {
+		db.Master.Close()
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+
+	zlog.Logger.Info().Msg("Хранилище метаданных PostgreSQL подключено")
+
+	return &metadataStorage{db: db}, nil
+}
+
+// Save - сохраняет метаданные нового изображения с версией 1.
+func (ms *metadataStorage) Save(ctx context.Context, meta *models.ImageMetadata) error {
+	return ms.save(ctx, meta, nil, models.Quota{})
+}
+
+// SaveWithTask - сохраняет метаданные нового изображения и задачу на его обработку в outbox
+// одной транзакцией. Проверка квоты выполняется в той же транзакции под блокировкой тенанта
+// (pg_advisory_xact_lock), поэтому параллельные загрузки тенанта не превысят квоту.
+func (ms *metadataStorage) SaveWithTask(ctx context.Context, meta *models.ImageMetadata, task *models.ProcessingTask, quota models.Quota) error {
+	return ms.save(ctx, meta, task, quota)
+}
+
+// Get - получает метаданные изображения тенанта по ID.
+func (ms *metadataStorage) Get(ctx context.Context, tenantID, id string) (*models.ImageMetadata, error) {
+	row := ms.db.Master.QueryRowContext(ctx, `SELECT `+imageColumns+` FROM images WHERE tenant_id = $1 AND id = $2`, tenantID, id)
+
+	meta, err := scanImage(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("метаданные изображения не найдены: %s", id)
+		}
+		return nil, fmt.Errorf("scanImage: %w", err)
+	}
+
+	return meta, nil
+}
+
+// Update - обновляет метаданные, если с момента чтения их никто не изменил (meta.Version совпадает
+// с версией в БД). Иначе возвращает models.ErrVersionConflict, не перезаписывая чужие изменения.
+func (ms *metadataStorage) Update(ctx context.Context, meta *models.ImageMetadata) error {
+	return ms.update(ctx, meta, nil)
+}
+
+// UpdateWithTask - обновляет метаданные, как Update, и в той же транзакции записывает задачу
+// на обработку в outbox.
+func (ms *metadataStorage) UpdateWithTask(ctx context.Context, meta *models.ImageMetadata, task *models.ProcessingTask) error {
+	return ms.update(ctx, meta, task)
+}
+
+// Delete - удаляет метаданные изображения тенанта по ID.
+func (ms *metadataStorage) Delete(ctx context.Context, tenantID, id string) error {
+	res, err := ms.db.ExecContext(ctx, `DELETE FROM images WHERE tenant_id = $1 AND id = $2`, tenantID, id)
+	if err != nil {
+		return fmt.Errorf("db.ExecContext: %w", err)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("метаданные изображения не найдены: %s", id)
+	}
+
+	zlog.Logger.Info().Msgf("Метаданные изображения удалены: %s", id)
+
+	return nil
+}
+
+// Usage - подсчитывает объем и количество оригиналов и производных неудаленных изображений тенанта.
+func (ms *metadataStorage) Usage(ctx context.Context, tenantID string) (*models.TenantUsage, error) {
+	usage, err := scanUsage(ms.db.QueryRowContext(ctx, usageQuery, tenantID), tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("scanUsage: %w", err)
+	}
+
+	return usage, nil
+}
+
+// List - возвращает страницу метаданных тенанта, удовлетворяющих запросу.
+func (ms *metadataStorage) List(ctx context.Context, query *models.ImageQuery) (*models.ImagePage, error) {
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	where := []string{"tenant_id = " + arg(query.TenantID)}
+
+	switch {
+	case !query.DeletedBefore.IsZero():
+		where = append(where, "deleted_at < "+arg(query.DeletedBefore))
+	case !query.WithDeleted:
+		where = append(where, "deleted_at IS NULL")
+	}
+	if len(query.Statuses) > 0 {
+		statuses := make([]string, 0, len(query.Statuses))
+		for _, st := range query.Statuses {
+			statuses = append(statuses, string(st))
+		}
+		where = append(where, "status = ANY("+arg(pq.Array(statuses))+")")
+	}
+	if !query.CreatedFrom.IsZero() {
+		where = append(where, "created_at >= "+arg(query.CreatedFrom))
+	}
+	if !query.CreatedTo.IsZero() {
+		where = append(where, "created_at < "+arg(query.CreatedTo))
+	}
+	if !query.ExpiresBefore.IsZero() {
+		where = append(where, "expires_at < "+arg(query.ExpiresBefore))
+	}
+	if !query.UpdatedBefore.IsZero() {
+		where = append(where, "updated_at < "+arg(query.UpdatedBefore))
+	}
+	if query.NameContains != "" {
+		where = append(where, "strpos(name_lower, "+arg(strings.ToLower(query.NameContains))+") > 0")
+	}
+	if query.Format != "" {
+		where = append(where, "lower(format) = "+arg(strings.ToLower(query.Format)))
+	}
+
+	bounds := []struct {
+		cond  string
+		value int
+	}{
+		{"width >= ", query.MinWidth},
+		{"width <= ", query.MaxWidth},
+		{"height >= ", query.MinHeight},
+		{"height <= ", query.MaxHeight},
+	}
+	for _, b := range bounds {
+		if b.value > 0 {
+			where = append(where, b.cond+arg(b.value))
+		}
+	}
+
+	if len(query.Tags) > 0 {
+		where = append(where, "tags @> "+arg(pq.Array(normalizeTags(query.Tags))))
+	}
+
+	sortCol := sortColumn(query.SortBy)
+	op, order := ">", "ASC"
+	if query.Desc {
+		op, order = "<", "DESC"
+	}
+
+	cursor, err := query.PageCursor()
+	if err != nil {
+		return nil, err
+	}
+	if cursor != nil {
+		key, err := cursorValue(query.SortBy, cursor.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		where = append(where, fmt.Sprintf("(%s, id) %s (%s, %s)", sortCol, op, arg(key), arg(cursor.ID)))
+	}
+
+	stmt := fmt.Sprintf(`SELECT %s FROM images WHERE %s ORDER BY %s %s, id %s LIMIT %s`,
+		imageColumns, strings.Join(where, " AND "), sortCol, order, order, arg(query.Limit+1))
+
+	rows, err := ms.db.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, fmt.Errorf("db.QueryContext: %w", err)
+	}
+	defer rows.Close()
+
+	page := &models.ImagePage{}
+	for rows.Next() {
+		meta, err := scanImage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scanImage: %w", err)
+		}
+		page.Items = append(page.Items, meta)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows.Err: %w", err)
+	}
+
+	if len(page.Items) > query.Limit {
+		page.Items = page.Items[:query.Limit]
+		last := page.Items[len(page.Items)-1]
+		page.NextCursor = query.NextCursor(last)
+	}
+
+	return page, nil
+}
+
+// Close - закрывает соединения с БД.
+func (ms *metadataStorage) Close() error {
+	if err := ms.db.Master.Close(); err != nil {
+		zlog.Logger.Warn().Err(err).Msg("db.Close")
+		return err
+	}
+
+	return nil
+}
+
+// helpers
+// save - сохраняет метаданные нового изображения и, если task задана, задачу в outbox.
+func (ms *metadataStorage) save(ctx context.Context, meta *models.ImageMetadata, task *models.ProcessingTask, quota models.Quota) error {
+	tx, err := ms.db.Master.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("db.BeginTx: %w", err)
+	}
+	defer tx.Rollback()
+
+	if !quota.Unlimited() {
+		if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, meta.TenantID); err != nil {
+			return fmt.Errorf("pg_advisory_xact_lock: %w", err)
+		}
+
+		usage, err := scanUsage(tx.QueryRowContext(ctx, usageQuery, meta.TenantID), meta.TenantID)
+		if err != nil {
+			return fmt.Errorf("scanUsage: %w", err)
+		}
+		if err := quota.Check(usage, meta.OriginalSize); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO images (`+imageColumns+`, name_lower)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, 1, $18, $19, $20, $21, $22, $23, $24, $25)`,
+		meta.TenantID, meta.ID, meta.OriginalName, meta.OriginalPath, meta.ResizedPath, meta.ThumbnailPath,
+		meta.WatermarkedPath, meta.OriginalSize, meta.ProcessedSize, meta.Format, meta.Width, meta.Height,
+		pq.Array(normalizeTags(meta.Tags)), string(meta.Status), meta.ErrorMessage, meta.CreatedAt, meta.UpdatedAt,
+		tierValue(meta.Tier), meta.AccessedAt, nullTime(meta.ExpiresAt), nullTime(meta.DeletedAt), meta.Attempts,
+		string(meta.Priority), meta.CorrelationID, strings.ToLower(meta.OriginalName),
+	); err != nil {
+		return fmt.Errorf("tx.ExecContext: %w", err)
+	}
+
+	if task != nil {
+		if err := insertTask(ctx, tx, task); err != nil {
+			return fmt.Errorf("insertTask: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("tx.Commit: %w", err)
+	}
+	meta.Version = 1
+
+	zlog.Logger.Info().Msgf("Метаданные изображения сохранены: %s", meta.ID)
+
+	return nil
+}
+
+func (ms *metadataStorage) update(ctx context.Context, meta *models.ImageMetadata, task *models.ProcessingTask) error {
+	tx, err := ms.db.Master.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("db.BeginTx: %w", err)
+	}
+	defer tx.Rollback()
+
+	var version int64
+	err = tx.QueryRowContext(ctx, `UPDATE images SET
+		original_name = $1, name_lower = $2, original_path = $3, resized_path = $4, thumbnail_path = $5,
+		watermarked_path = $6, original_size = $7, processed_size = $8, format = $9, width = $10, height = $11,
+		tags = $12, status = $13, error_message = $14, created_at = $15, updated_at = $16, tier = $17,
+		accessed_at = $18, expires_at = $19, deleted_at = $20, attempts = $21, priority = $22, correlation_id = $23,
+		version = version + 1
+		WHERE tenant_id = $24 AND id = $25 AND version = $26
+		RETURNING version`,
+		meta.OriginalName, strings.ToLower(meta.OriginalName), meta.OriginalPath, meta.ResizedPath, meta.ThumbnailPath,
+		meta.WatermarkedPath, meta.OriginalSize, meta.ProcessedSize, meta.Format, meta.Width, meta.Height,
+		pq.Array(normalizeTags(meta.Tags)), string(meta.Status), meta.ErrorMessage, meta.CreatedAt, meta.UpdatedAt,
+		tierValue(meta.Tier), meta.AccessedAt, nullTime(meta.ExpiresAt), nullTime(meta.DeletedAt), meta.Attempts,
+		string(meta.Priority), meta.CorrelationID, meta.TenantID, meta.ID, meta.Version,
+	).Scan(&version)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("tx.QueryRowContext: %w", err)
+		}
+
+		var exists bool
+		if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM images WHERE tenant_id = $1 AND id = $2)`,
+			meta.TenantID, meta.ID).Scan(&exists); err != nil {
+			return fmt.Errorf("tx.QueryRowContext: %w", err)
+		}
+		if !exists {
+			return fmt.Errorf("метаданные изображения не найдены: %s", meta.ID)
+		}
+
+		return fmt.Errorf("%w: %s (версия %d)", models.ErrVersionConflict, meta.ID, meta.Version)
+	}
+
+	if task != nil {
+		if err := insertTask(ctx, tx, task); err != nil {
+			return fmt.Errorf("insertTask: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("tx.Commit: %w", err)
+	}
+	meta.Version = version
+
+	zlog.Logger.Info().Msgf("Метаданные изображения обновлены: %s (версия %d)", meta.ID, version)
+
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanUsage(row scanner, tenantID string) (*models.TenantUsage, error) {
+	usage := &models.TenantUsage{TenantID: tenantID}
+
+	if err := row.Scan(&usage.OriginalsCount, &usage.OriginalsBytes, &usage.DerivativesCount, &usage.DerivativesBytes); err != nil {
+		return nil, fmt.Errorf("row.Scan: %w", err)
+	}
+
+	return usage, nil
+}
+
+func scanImage(row scanner) (*models.ImageMetadata, error) {
+	var (
+		meta                   models.ImageMetadata
+		status, tier, priority string
+		expiresAt              sql.NullTime
+		deletedAt              sql.NullTime
+	)
+
+	if err := row.Scan(
+		&meta.TenantID, &meta.ID, &meta.OriginalName, &meta.OriginalPath, &meta.ResizedPath, &meta.ThumbnailPath,
+		&meta.WatermarkedPath, &meta.OriginalSize, &meta.ProcessedSize, &meta.Format, &meta.Width, &meta.Height,
+		pq.Array(&meta.Tags), &status, &meta.ErrorMessage, &meta.CreatedAt, &meta.UpdatedAt, &meta.Version,
+		&tier, &meta.AccessedAt, &expiresAt, &deletedAt, &meta.Attempts, &priority, &meta.CorrelationID,
+	); err != nil {
+		return nil, err
+	}
+
+	meta.Status = models.ImageStatus(status)
+	meta.Tier = models.StorageTier(tier)
+	meta.Priority = models.TaskPriority(priority)
+	meta.ExpiresAt = expiresAt.Time
+	meta.DeletedAt = deletedAt.Time
+	if len(meta.Tags) == 0 {
+		meta.Tags = nil
+	}
+
+	return &meta, nil
+}
+
+// tierValue - пустой уровень хранения означает горячий.
+func tierValue(tier models.StorageTier) string {
+	if tier == "" {
+		return string(models.TierHot)
+	}
+	return string(tier)
+}
+
+// nullTime - нулевое время хранится как NULL.
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+func normalizeTags(tags []string) []string {
+	result := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		result = append(result, strings.ToLower(tag))
+	}
+
+	return result
+}
+
+func sortColumn(sortBy string) string {
+	switch sortBy {
+	case models.SortByName:
+		return "name_lower"
+	case models.SortBySize:
+		return "original_size"
+	default:
+		return "created_at"
+	}
+}
+
+func cursorValue(sortBy, key string) (any, error) {
+	switch sortBy {
+	case models.SortByName:
+		return key, nil
+	case models.SortBySize:
+		size, err := strconv.ParseInt(key, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("некорректный курсор: %w", err)
+		}
+		return size, nil
+	default:
+		t, err := time.Parse(models.SortTimeLayout, key)
+		if err != nil {
+			return nil, fmt.Errorf("некорректный курсор: %w", err)
+		}
+		return t, nil
+	}
+}
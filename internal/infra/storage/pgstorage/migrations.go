@@ -0,0 +1,119 @@
+package pgstorage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/wb-go/wbf/dbpg"
+	"github.com/wb-go/wbf/zlog"
+)
+
+// migrationLockID - ключ advisory lock, под которым узлы применяют миграции по очереди.
+const migrationLockID = 7310452
+
+// migrations - схема БД по версиям. Применённые миграции не редактируются, изменения схемы
+// добавляются новой миграцией в конец списка.
+var migrations = []string{
+	// 1: изображения с версией записи для оптимистичной блокировки и индексы для поиска.
+	`CREATE TABLE images (
+		tenant_id        TEXT        NOT NULL,
+		id               TEXT        NOT NULL,
+		original_name    TEXT        NOT NULL DEFAULT '',
+		name_lower       TEXT        NOT NULL DEFAULT '',
+		original_path    TEXT        NOT NULL DEFAULT '',
+		resized_path     TEXT        NOT NULL DEFAULT '',
+		thumbnail_path   TEXT        NOT NULL DEFAULT '',
+		watermarked_path TEXT        NOT NULL DEFAULT '',
+		original_size    BIGINT      NOT NULL DEFAULT 0,
+		processed_size   BIGINT      NOT NULL DEFAULT 0,
+		format           TEXT        NOT NULL DEFAULT '',
+		width            INTEGER     NOT NULL DEFAULT 0,
+		height           INTEGER     NOT NULL DEFAULT 0,
+		tags             TEXT[]      NOT NULL DEFAULT '{}',
+		status           TEXT        NOT NULL,
+		error_message    TEXT        NOT NULL DEFAULT '',
+		created_at       TIMESTAMPTZ NOT NULL,
+		updated_at       TIMESTAMPTZ NOT NULL,
+		version          BIGINT      NOT NULL DEFAULT 1,
+		PRIMARY KEY (tenant_id, id)
+	);
+	CREATE INDEX idx_images_created ON images (tenant_id, created_at, id);
+	CREATE INDEX idx_images_name ON images (tenant_id, name_lower, id);
+	CREATE INDEX idx_images_size ON images (tenant_id, original_size, id);
+	CREATE INDEX idx_images_status ON images (tenant_id, status, created_at);
+	CREATE INDEX idx_images_tags ON images USING GIN (tags);`,
+	// 2: уровень хранения и время последнего обращения для политик жизненного цикла.
+	`ALTER TABLE images ADD COLUMN tier TEXT NOT NULL DEFAULT 'hot';
+	ALTER TABLE images ADD COLUMN accessed_at TIMESTAMPTZ NOT NULL DEFAULT '0001-01-01 00:00:00+00';`,
+	// 3: срок хранения изображения.
+	`ALTER TABLE images ADD COLUMN expires_at TIMESTAMPTZ;
+	CREATE INDEX idx_images_expires ON images (tenant_id, expires_at) WHERE expires_at IS NOT NULL;`,
+	// 4: мягкое удаление.
+	`ALTER TABLE images ADD COLUMN deleted_at TIMESTAMPTZ;
+	CREATE INDEX idx_images_deleted ON images (tenant_id, deleted_at) WHERE deleted_at IS NOT NULL;`,
+	// 5: outbox задач на обработку.
+	`CREATE TABLE outbox (
+		id           UUID        PRIMARY KEY,
+		payload      JSONB       NOT NULL,
+		attempts     INTEGER     NOT NULL DEFAULT 0,
+		last_error   TEXT        NOT NULL DEFAULT '',
+		created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+		available_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	);
+	CREATE INDEX idx_outbox_available ON outbox (available_at);`,
+	// 6: счетчик повторных постановок зависших задач в очередь.
+	`ALTER TABLE images ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0;`,
+	// 7: приоритет и ID корреляции последней задачи на обработку.
+	`ALTER TABLE images ADD COLUMN priority TEXT NOT NULL DEFAULT '',
+		ADD COLUMN correlation_id TEXT NOT NULL DEFAULT '';`,
+	// 8: тенант и ID изображения задачи outbox в индексируемых колонках для HasTask.
+	`ALTER TABLE outbox ADD COLUMN tenant_id TEXT NOT NULL DEFAULT '',
+		ADD COLUMN image_id TEXT NOT NULL DEFAULT '';
+	UPDATE outbox SET tenant_id = COALESCE(payload->>'TenantID', ''), image_id = COALESCE(payload->>'ImageID', '');
+	CREATE INDEX idx_outbox_image ON outbox (tenant_id, image_id);`,
+}
+
+// migrate - применяет недостающие миграции в одной транзакции под advisory lock.
+func migrate(ctx context.Context, db *dbpg.DB) error {
+	tx, err := db.Master.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("db.BeginTx: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationLockID); err != nil {
+		return fmt.Errorf("pg_advisory_xact_lock: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`); err != nil {
+		return fmt.Errorf("tx.ExecContext: %w", err)
+	}
+
+	var current int
+	if err := tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("tx.QueryRowContext: %w", err)
+	}
+
+	for i := current; i < len(migrations); i++ {
+		version := i + 1
+
+		if _, err := tx.ExecContext(ctx, migrations[i]); err != nil {
+			return fmt.Errorf("миграция %d: %w", version, err)
+		}
+
+		if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version) VALUES ($1)`, version); err != nil {
+			return fmt.Errorf("tx.ExecContext: %w", err)
+		}
+
+		zlog.Logger.Info().Msgf("Применена миграция схемы метаданных: %d", version)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("tx.Commit: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package pgstorage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/sunr3d/image-processor/internal/interfaces/infra"
+	"github.com/sunr3d/image-processor/models"
+)
+
+var _ infra.Outbox = (*metadataStorage)(nil)
+
+// ClaimTasks - захватывает до limit записей outbox, готовых к публикации, на время lease.
+// Записи, захваченные параллельной транзакцией, пропускаются (SKIP LOCKED), поэтому relay
+// нескольких экземпляров app не публикуют одну задачу одновременно.
+func (ms *metadataStorage) ClaimTasks(ctx context.Context, limit int, lease time.Duration) ([]*models.OutboxEntry, error) {
+	now := time.Now()
+
+	rows, err := ms.db.Master.QueryContext(ctx, `WITH claimed AS (
+			SELECT id FROM outbox WHERE available_at <= $1
+			ORDER BY available_at, id LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE outbox o SET attempts = o.attempts + 1, available_at = $3
+		FROM claimed WHERE o.id = claimed.id
+		RETURNING o.id, o.payload, o.attempts, o.last_error, o.created_at, o.available_at`,
+		now, limit, now.Add(lease))
+	if err != nil {
+		return nil, fmt.Errorf("db.QueryContext: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []*models.OutboxEntry
+	for rows.Next() {
+		var (
+			entry   models.OutboxEntry
+			payload []byte
+		)
+		if err := rows.Scan(&entry.ID, &payload, &entry.Attempts, &entry.LastError, &entry.CreatedAt, &entry.AvailableAt); err != nil {
+			return nil, fmt.Errorf("rows.Scan: %w", err)
+		}
+		if err := json.Unmarshal(payload, &entry.Task); err != nil {
+			return nil, fmt.Errorf("json.Unmarshal: %w", err)
+		}
+		entries = append(entries, &entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows.Err: %w", err)
+	}
+
+	return entries, nil
+}
+
+// CompleteTask - удаляет опубликованную запись outbox.
+func (ms *metadataStorage) CompleteTask(ctx context.Context, id string) error {
+	if _, err := ms.db.Master.ExecContext(ctx, `DELETE FROM outbox WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("db.ExecContext: %w", err)
+	}
+
+	return nil
+}
+
+// RetryTask - откладывает повторную публикацию записи outbox на delay.
+func (ms *metadataStorage) RetryTask(ctx context.Context, id string, delay time.Duration, cause string) error {
+	res, err := ms.db.Master.ExecContext(ctx, `UPDATE outbox SET available_at = $1, last_error = $2 WHERE id = $3`,
+		time.Now().Add(delay), cause, id)
+	if err != nil {
+		return fmt.Errorf("db.ExecContext: %w", err)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("запись outbox не найдена: %s", id)
+	}
+
+	return nil
+}
+
+// HasTask - сообщает, ждет ли в outbox публикации задача на обработку изображения.
+func (ms *metadataStorage) HasTask(ctx context.Context, tenantID, imageID string) (bool, error) {
+	var exists bool
+	if err := ms.db.Master.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM outbox
+		WHERE tenant_id = $1 AND image_id = $2)`,
+		tenantID, imageID).Scan(&exists); err != nil {
+		return false, fmt.Errorf("db.QueryRowContext: %w", err)
+	}
+
+	return exists, nil
+}
+
+// helpers
+func insertTask(ctx context.Context, tx *sql.Tx, task *models.ProcessingTask) error {
+	payload, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO outbox (id, payload, tenant_id, image_id) VALUES ($1, $2, $3, $4)`,
+		uuid.New().String(), payload, task.TenantID, task.ImageID); err != nil {
+		return fmt.Errorf("tx.ExecContext: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,252 @@
+package s3storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/sunr3d/image-processor/internal/interfaces/infra"
+	"github.com/sunr3d/image-processor/models"
+)
+
+var _ infra.ImageStorage = (*imageStorage)(nil)
+
+// imageTypes - типы изображений, хранимые для каждого ID.
+var imageTypes = []string{"original", "resized", "thumbnail", "watermarked"}
+
+// minPartSize - минимальный размер части multipart загрузки, допустимый в S3.
+const minPartSize = 5 << 20
+
+// Config - параметры подключения к S3-совместимому хранилищу.
+type Config struct {
+	Endpoint string
+	// PublicEndpoint - адрес хранилища, доступный клиентам; используется для подписанных ссылок.
+	// Если пуст, ссылки подписываются для Endpoint.
+	PublicEndpoint string
+	AccessKey      string
+	SecretKey      string
+	Bucket         string
+	Region         string
+	UseSSL         bool
+	// Transport - HTTP транспорт клиента, например с собственным пулом корневых сертификатов.
+	// Если nil, используется транспорт по умолчанию.
+	Transport http.RoundTripper
+	// PartSize - размер части multipart загрузки в байтах; объекты крупнее загружаются частями.
+	PartSize uint64
+}
+
+type imageStorage struct {
+	client    *minio.Client
+	presigner *minio.Client
+	bucket    string
+	partSize  uint64
+}
+
+// NewImageStorage - конструктор ImageStorage поверх S3. Создает бакет, если его нет.
+func NewImageStorage(ctx context.Context, cfg Config) (*imageStorage, error) {
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.PartSize < minPartSize {
+		cfg.PartSize = minPartSize
+	}
+
+	client, err := newClient(cfg.Endpoint, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("newClient: %w", err)
+	}
+
+	presigner := client
+	if cfg.PublicEndpoint != "" {
+		presigner, err = newClient(cfg.PublicEndpoint, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("newClient public: %w", err)
+		}
+	}
+
+	exists, err := client.BucketExists(ctx, cfg.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("client.BucketExists: %w", err)
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, cfg.Bucket, minio.MakeBucketOptions{Region: cfg.Region}); err != nil {
+			return nil, fmt.Errorf("client.MakeBucket: %w", err)
+		}
+		zlog.Logger.Info().Msgf("Создан бакет S3: %s", cfg.Bucket)
+	}
+
+	return &imageStorage{
+		client:    client,
+		presigner: presigner,
+		bucket:    cfg.Bucket,
+		partSize:  cfg.PartSize,
+	}, nil
+}
+
+// SaveOriginal - потоково загружает оригинал изображения тенанта и возвращает ключ объекта.
+// Оригиналы крупнее PartSize и потоки неизвестного размера загружаются через multipart upload.
+func (s *imageStorage) SaveOriginal(ctx context.Context, tenantID, id string, r io.Reader, size int64) (string, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", fmt.Errorf("io.ReadFull: %w", err)
+	}
+	head = head[:n]
+
+	key := objectKey(tenantID, id, "original")
+	if err := s.put(ctx, key, io.MultiReader(bytes.NewReader(head), r), size, http.DetectContentType(head)); err != nil {
+		return "", fmt.Errorf("s.put: %w", err)
+	}
+
+	zlog.Logger.Info().Msgf("Оригинал изображения сохранен в s3://%s/%s", s.bucket, key)
+
+	return key, nil
+}
+
+// SaveProcessed - загружает обработанное изображение тенанта с указанием типа и возвращает ключ объекта.
+func (s *imageStorage) SaveProcessed(ctx context.Context, tenantID, id, imageType string, r io.Reader, size int64) (string, error) {
+	key := objectKey(tenantID, id, imageType)
+	if err := s.put(ctx, key, r, size, "image/jpeg"); err != nil {
+		return "", fmt.Errorf("s.put: %w", err)
+	}
+
+	zlog.Logger.Info().Msgf("Обработанное изображение (type: %s) сохранено в s3://%s/%s", imageType, s.bucket, key)
+
+	return key, nil
+}
+
+// Open - открывает объект изображения тенанта по его ID и типу для чтения с произвольным доступом.
+func (s *imageStorage) Open(ctx context.Context, tenantID, id, imageType string) (io.ReadSeekCloser, *models.ObjectInfo, error) {
+	if !validImageType(imageType) {
+		return nil, nil, fmt.Errorf("неизвестный тип изображения: %s", imageType)
+	}
+
+	key := objectKey(tenantID, id, imageType)
+	obj, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("client.GetObject: %w", err)
+	}
+
+	// GetObject ленивый: отсутствие объекта выясняется только при первом обращении.
+	oi, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		return nil, nil, s.mapErr(key, err)
+	}
+
+	return obj, objectInfo(oi), nil
+}
+
+// Stat - возвращает сведения об объекте изображения тенанта по его ID и типу.
+func (s *imageStorage) Stat(ctx context.Context, tenantID, id, imageType string) (*models.ObjectInfo, error) {
+	if !validImageType(imageType) {
+		return nil, fmt.Errorf("неизвестный тип изображения: %s", imageType)
+	}
+
+	key := objectKey(tenantID, id, imageType)
+	oi, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, s.mapErr(key, err)
+	}
+
+	return objectInfo(oi), nil
+}
+
+// PresignURL - выдает подписанную ссылку на объект изображения, действующую ttl.
+func (s *imageStorage) PresignURL(ctx context.Context, tenantID, id, imageType string, ttl time.Duration) (string, error) {
+	if _, err := s.Stat(ctx, tenantID, id, imageType); err != nil {
+		return "", fmt.Errorf("s.Stat: %w", err)
+	}
+
+	key := objectKey(tenantID, id, imageType)
+	u, err := s.presigner.PresignedGetObject(ctx, s.bucket, key, ttl, nil)
+	if err != nil {
+		return "", fmt.Errorf("presigner.PresignedGetObject: %w", err)
+	}
+
+	return u.String(), nil
+}
+
+// DeleteImage - удаляет объекты изображения тенанта (оригинал и обработанные версии) по его ID.
+// Раскладка ключей фиксирована, поэтому объекты удаляются по известным ключам без листинга бакета.
+func (s *imageStorage) DeleteImage(ctx context.Context, tenantID, id string) error {
+	for _, imageType := range imageTypes {
+		key := objectKey(tenantID, id, imageType)
+		if err := s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{}); err != nil {
+			zlog.Logger.Warn().Err(err).Msgf("Ошибка удаления объекта: %s", key)
+		}
+	}
+
+	zlog.Logger.Info().Msgf("Изображение %s успешно удалено", id)
+
+	return nil
+}
+
+// helpers
+func (s *imageStorage) put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	_, err := s.client.PutObject(ctx, s.bucket, key, r, size, minio.PutObjectOptions{
+		ContentType: contentType,
+		PartSize:    s.partSize,
+	})
+	if err != nil {
+		return fmt.Errorf("client.PutObject: %w", err)
+	}
+
+	return nil
+}
+
+func objectInfo(oi minio.ObjectInfo) *models.ObjectInfo {
+	return &models.ObjectInfo{
+		Size:        oi.Size,
+		ContentType: oi.ContentType,
+		ModTime:     oi.LastModified,
+	}
+}
+
+func newClient(endpoint string, cfg Config) (*minio.Client, error) {
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:     credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure:    cfg.UseSSL,
+		Region:    cfg.Region,
+		Transport: cfg.Transport,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("minio.New: %w", err)
+	}
+
+	return client, nil
+}
+
+func (s *imageStorage) mapErr(key string, err error) error {
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchKey", "NoSuchBucket":
+		return fmt.Errorf("%w: s3://%s/%s", models.ErrImageNotFound, s.bucket, key)
+	default:
+		return fmt.Errorf("client.StatObject: %w", err)
+	}
+}
+
+// objectKey - ключ объекта повторяет раскладку файлового хранилища.
+func objectKey(tenantID, id, imageType string) string {
+	if imageType == "original" {
+		return path.Join(tenantID, "original", id, "original.jpg")
+	}
+	return path.Join(tenantID, "processed", id, imageType+".jpg")
+}
+
+func validImageType(imageType string) bool {
+	for _, t := range imageTypes {
+		if t == imageType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,548 @@
+package sqlitestorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wb-go/wbf/zlog"
+	_ "modernc.org/sqlite"
+
+	"github.com/sunr3d/image-processor/internal/interfaces/infra"
+	"github.com/sunr3d/image-processor/models"
+)
+
+var _ infra.MetadataStorage = (*metadataStorage)(nil)
+
+const usageQuery = `SELECT
+	COUNT(*),
+	COALESCE(SUM(original_size), 0),
+	COALESCE(SUM((resized_path != '') + (thumbnail_path != '') + (watermarked_path != '')), 0),
+	COALESCE(SUM(processed_size), 0)
+	FROM images WHERE tenant_id = ? AND deleted_at = ''`
+
+const imageColumns = `tenant_id, id, original_name, original_path, resized_path, thumbnail_path, watermarked_path,
+	original_size, processed_size, format, width, height, status, error_message, created_at, updated_at,
+	tier, accessed_at, expires_at, deleted_at, attempts, priority, correlation_id, version`
+
+type metadataStorage struct {
+	db *sql.DB
+}
+
+// NewMetadataStorage - конструктор MetadataStorage на SQLite. Открывает (или создает) файл БД
+// и применяет миграции схемы.
+func NewMetadataStorage(ctx context.Context, path string) (*metadataStorage, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("os.MkdirAll: %w", err)
+	}
+
+	dsn := "file:" + path + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)&_txlock=immediate"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("sql.Open: %w", err)
+	}
+
+	if err := migrate(ctx, db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+
+	zlog.Logger.Info().Msgf("Хранилище метаданных SQLite открыто: %s", path)
+
+	return &metadataStorage{db: db}, nil
+}
+
+// Save - сохраняет метаданные нового изображения с версией 1 вместе с тегами.
+func (ms *metadataStorage) Save(ctx context.Context, meta *models.ImageMetadata) error {
+	return ms.save(ctx, meta, nil, models.Quota{})
+}
+
+// SaveWithTask - сохраняет метаданные нового изображения и задачу на его обработку в outbox
+// одной транзакцией. Транзакция захватывает блокировку записи БД, поэтому проверка квоты
+// и вставка не пересекаются с параллельными загрузками.
+func (ms *metadataStorage) SaveWithTask(ctx context.Context, meta *models.ImageMetadata, task *models.ProcessingTask, quota models.Quota) error {
+	return ms.save(ctx, meta, task, quota)
+}
+
+// Get - получает метаданные изображения тенанта по ID.
+func (ms *metadataStorage) Get(ctx context.Context, tenantID, id string) (*models.ImageMetadata, error) {
+	row := ms.db.QueryRowContext(ctx, `SELECT `+imageColumns+` FROM images WHERE tenant_id = ? AND id = ?`, tenantID, id)
+
+	meta, err := scanImage(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("метаданные изображения не найдены: %s", id)
+		}
+		return nil, fmt.Errorf("scanImage: %w", err)
+	}
+
+	tags, err := ms.loadTags(ctx, tenantID, []string{id})
+	if err != nil {
+		return nil, fmt.Errorf("loadTags: %w", err)
+	}
+	meta.Tags = tags[id]
+
+	return meta, nil
+}
+
+// Update - обновляет метаданные, если с момента чтения их никто не изменил (meta.Version совпадает
+// с версией в БД). Иначе возвращает models.ErrVersionConflict.
+func (ms *metadataStorage) Update(ctx context.Context, meta *models.ImageMetadata) error {
+	return ms.update(ctx, meta, nil)
+}
+
+// UpdateWithTask - обновляет метаданные, как Update, и в той же транзакции записывает задачу
+// на обработку в outbox.
+func (ms *metadataStorage) UpdateWithTask(ctx context.Context, meta *models.ImageMetadata, task *models.ProcessingTask) error {
+	return ms.update(ctx, meta, task)
+}
+
+// Delete - удаляет метаданные изображения тенанта по ID.
+func (ms *metadataStorage) Delete(ctx context.Context, tenantID, id string) error {
+	res, err := ms.db.ExecContext(ctx, `DELETE FROM images WHERE tenant_id = ? AND id = ?`, tenantID, id)
+	if err != nil {
+		return fmt.Errorf("db.ExecContext: %w", err)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("метаданные изображения не найдены: %s", id)
+	}
+
+	zlog.Logger.Info().Msgf("Метаданные изображения удалены: %s", id)
+
+	return nil
+}
+
+// Usage - подсчитывает объем и количество оригиналов и производных неудаленных изображений тенанта.
+func (ms *metadataStorage) Usage(ctx context.Context, tenantID string) (*models.TenantUsage, error) {
+	usage, err := scanUsage(ms.db.QueryRowContext(ctx, usageQuery, tenantID), tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("scanUsage: %w", err)
+	}
+
+	return usage, nil
+}
+
+// List - возвращает страницу метаданных тенанта, удовлетворяющих запросу.
+func (ms *metadataStorage) List(ctx context.Context, query *models.ImageQuery) (*models.ImagePage, error) {
+	where := []string{"tenant_id = ?"}
+	args := []any{query.TenantID}
+
+	switch {
+	case !query.DeletedBefore.IsZero():
+		where = append(where, "deleted_at != '' AND deleted_at < ?")
+		args = append(args, formatTime(query.DeletedBefore))
+	case !query.WithDeleted:
+		where = append(where, "deleted_at = ''")
+	}
+	if len(query.Statuses) > 0 {
+		where = append(where, "status IN ("+placeholders(len(query.Statuses))+")")
+		for _, st := range query.Statuses {
+			args = append(args, string(st))
+		}
+	}
+	if !query.CreatedFrom.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, formatTime(query.CreatedFrom))
+	}
+	if !query.CreatedTo.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, formatTime(query.CreatedTo))
+	}
+	if !query.ExpiresBefore.IsZero() {
+		where = append(where, "expires_at != '' AND expires_at < ?")
+		args = append(args, formatTime(query.ExpiresBefore))
+	}
+	if !query.UpdatedBefore.IsZero() {
+		where = append(where, "updated_at < ?")
+		args = append(args, formatTime(query.UpdatedBefore))
+	}
+	if query.NameContains != "" {
+		where = append(where, "instr(name_lower, ?) > 0")
+		args = append(args, strings.ToLower(query.NameContains))
+	}
+	if query.Format != "" {
+		where = append(where, "lower(format) = ?")
+		args = append(args, strings.ToLower(query.Format))
+	}
+
+	bounds := []struct {
+		cond  string
+		value int
+	}{
+		{"width >= ?", query.MinWidth},
+		{"width <= ?", query.MaxWidth},
+		{"height >= ?", query.MinHeight},
+		{"height <= ?", query.MaxHeight},
+	}
+	for _, b := range bounds {
+		if b.value > 0 {
+			where = append(where, b.cond)
+			args = append(args, b.value)
+		}
+	}
+
+	if len(query.Tags) > 0 {
+		where = append(where, `(SELECT COUNT(*) FROM image_tags t
+			WHERE t.tenant_id = images.tenant_id AND t.image_id = images.id AND t.tag IN (`+placeholders(len(query.Tags))+`)) = ?`)
+		for _, tag := range query.Tags {
+			args = append(args, strings.ToLower(tag))
+		}
+		args = append(args, len(query.Tags))
+	}
+
+	sortCol := sortColumn(query.SortBy)
+	op, order := ">", "ASC"
+	if query.Desc {
+		op, order = "<", "DESC"
+	}
+
+	cursor, err := query.PageCursor()
+	if err != nil {
+		return nil, err
+	}
+	if cursor != nil {
+		key, err := cursorValue(query.SortBy, cursor.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		where = append(where, fmt.Sprintf("(%s, id) %s (?, ?)", sortCol, op))
+		args = append(args, key, cursor.ID)
+	}
+
+	stmt := fmt.Sprintf(`SELECT %s FROM images WHERE %s ORDER BY %s %s, id %s LIMIT ?`,
+		imageColumns, strings.Join(where, " AND "), sortCol, order, order)
+	args = append(args, query.Limit+1)
+
+	rows, err := ms.db.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, fmt.Errorf("db.QueryContext: %w", err)
+	}
+	defer rows.Close()
+
+	page := &models.ImagePage{}
+	for rows.Next() {
+		meta, err := scanImage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scanImage: %w", err)
+		}
+		page.Items = append(page.Items, meta)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows.Err: %w", err)
+	}
+
+	if len(page.Items) > query.Limit {
+		page.Items = page.Items[:query.Limit]
+		last := page.Items[len(page.Items)-1]
+		page.NextCursor = query.NextCursor(last)
+	}
+
+	ids := make([]string, 0, len(page.Items))
+	for _, meta := range page.Items {
+		ids = append(ids, meta.ID)
+	}
+
+	tags, err := ms.loadTags(ctx, query.TenantID, ids)
+	if err != nil {
+		return nil, fmt.Errorf("loadTags: %w", err)
+	}
+	for _, meta := range page.Items {
+		meta.Tags = tags[meta.ID]
+	}
+
+	return page, nil
+}
+
+// Close - закрывает соединение с БД.
+func (ms *metadataStorage) Close() error {
+	if err := ms.db.Close(); err != nil {
+		zlog.Logger.Warn().Err(err).Msg("db.Close")
+		return err
+	}
+
+	return nil
+}
+
+// helpers
+// save - сохраняет метаданные нового изображения и, если task задана, задачу в outbox.
+func (ms *metadataStorage) save(ctx context.Context, meta *models.ImageMetadata, task *models.ProcessingTask, quota models.Quota) error {
+	tx, err := ms.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("db.BeginTx: %w", err)
+	}
+	defer tx.Rollback()
+
+	if !quota.Unlimited() {
+		usage, err := scanUsage(tx.QueryRowContext(ctx, usageQuery, meta.TenantID), meta.TenantID)
+		if err != nil {
+			return fmt.Errorf("scanUsage: %w", err)
+		}
+		if err := quota.Check(usage, meta.OriginalSize); err != nil {
+			return err
+		}
+	}
+
+	args := imageArgs(meta)
+	if _, err := tx.ExecContext(ctx, `INSERT INTO images (`+imageColumns+`, name_lower)
+		VALUES (`+placeholders(len(args))+`, 1, ?)`,
+		append(args, strings.ToLower(meta.OriginalName))...,
+	); err != nil {
+		return fmt.Errorf("tx.ExecContext: %w", err)
+	}
+
+	if err := replaceTags(ctx, tx, meta); err != nil {
+		return fmt.Errorf("replaceTags: %w", err)
+	}
+
+	if task != nil {
+		if err := insertTask(ctx, tx, task); err != nil {
+			return fmt.Errorf("insertTask: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("tx.Commit: %w", err)
+	}
+	meta.Version = 1
+
+	zlog.Logger.Info().Msgf("Метаданные изображения сохранены: %s", meta.ID)
+
+	return nil
+}
+
+func (ms *metadataStorage) update(ctx context.Context, meta *models.ImageMetadata, task *models.ProcessingTask) error {
+	tx, err := ms.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("db.BeginTx: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `UPDATE images SET
+		original_name = ?, name_lower = ?, original_path = ?, resized_path = ?, thumbnail_path = ?,
+		watermarked_path = ?, original_size = ?, processed_size = ?, format = ?, width = ?, height = ?,
+		status = ?, error_message = ?, created_at = ?, updated_at = ?, tier = ?, accessed_at = ?,
+		expires_at = ?, deleted_at = ?, attempts = ?, priority = ?, correlation_id = ?, version = version + 1
+		WHERE tenant_id = ? AND id = ? AND version = ?`,
+		meta.OriginalName, strings.ToLower(meta.OriginalName), meta.OriginalPath, meta.ResizedPath, meta.ThumbnailPath,
+		meta.WatermarkedPath, meta.OriginalSize, meta.ProcessedSize, meta.Format, meta.Width, meta.Height,
+		string(meta.Status), meta.ErrorMessage, formatTime(meta.CreatedAt), formatTime(meta.UpdatedAt),
+		tierValue(meta.Tier), formatTime(meta.AccessedAt), formatOptionalTime(meta.ExpiresAt),
+		formatOptionalTime(meta.DeletedAt), meta.Attempts, string(meta.Priority), meta.CorrelationID,
+		meta.TenantID, meta.ID, meta.Version,
+	)
+	if err != nil {
+		return fmt.Errorf("tx.ExecContext: %w", err)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		var exists bool
+		if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM images WHERE tenant_id = ? AND id = ?)`,
+			meta.TenantID, meta.ID).Scan(&exists); err != nil {
+			return fmt.Errorf("tx.QueryRowContext: %w", err)
+		}
+		if !exists {
+			return fmt.Errorf("метаданные изображения не найдены: %s", meta.ID)
+		}
+
+		return fmt.Errorf("%w: %s (версия %d)", models.ErrVersionConflict, meta.ID, meta.Version)
+	}
+
+	if err := replaceTags(ctx, tx, meta); err != nil {
+		return fmt.Errorf("replaceTags: %w", err)
+	}
+
+	if task != nil {
+		if err := insertTask(ctx, tx, task); err != nil {
+			return fmt.Errorf("insertTask: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("tx.Commit: %w", err)
+	}
+	meta.Version++
+
+	zlog.Logger.Info().Msgf("Метаданные изображения обновлены: %s (версия %d)", meta.ID, meta.Version)
+
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanUsage(row scanner, tenantID string) (*models.TenantUsage, error) {
+	usage := &models.TenantUsage{TenantID: tenantID}
+
+	if err := row.Scan(&usage.OriginalsCount, &usage.OriginalsBytes, &usage.DerivativesCount, &usage.DerivativesBytes); err != nil {
+		return nil, fmt.Errorf("row.Scan: %w", err)
+	}
+
+	return usage, nil
+}
+
+func scanImage(row scanner) (*models.ImageMetadata, error) {
+	var (
+		meta                                        models.ImageMetadata
+		status, tier, priority                      string
+		createdAt, updatedAt, accessedAt, expiresAt string
+		deletedAt                                   string
+	)
+
+	if err := row.Scan(
+		&meta.TenantID, &meta.ID, &meta.OriginalName, &meta.OriginalPath, &meta.ResizedPath, &meta.ThumbnailPath,
+		&meta.WatermarkedPath, &meta.OriginalSize, &meta.ProcessedSize, &meta.Format, &meta.Width, &meta.Height,
+		&status, &meta.ErrorMessage, &createdAt, &updatedAt, &tier, &accessedAt, &expiresAt, &deletedAt, &meta.Attempts,
+		&priority, &meta.CorrelationID, &meta.Version,
+	); err != nil {
+		return nil, err
+	}
+
+	meta.Status = models.ImageStatus(status)
+	meta.Tier = models.StorageTier(tier)
+	meta.Priority = models.TaskPriority(priority)
+	for _, f := range []struct {
+		dst   *time.Time
+		value string
+	}{
+		{&meta.CreatedAt, createdAt},
+		{&meta.UpdatedAt, updatedAt},
+		{&meta.AccessedAt, accessedAt},
+		{&meta.ExpiresAt, expiresAt},
+		{&meta.DeletedAt, deletedAt},
+	} {
+		t, err := parseTime(f.value)
+		if err != nil {
+			return nil, fmt.Errorf("метаданные изображения %s: %w", meta.ID, err)
+		}
+		*f.dst = t
+	}
+
+	return &meta, nil
+}
+
+func imageArgs(meta *models.ImageMetadata) []any {
+	return []any{
+		meta.TenantID, meta.ID, meta.OriginalName, meta.OriginalPath, meta.ResizedPath, meta.ThumbnailPath,
+		meta.WatermarkedPath, meta.OriginalSize, meta.ProcessedSize, meta.Format, meta.Width, meta.Height,
+		string(meta.Status), meta.ErrorMessage, formatTime(meta.CreatedAt), formatTime(meta.UpdatedAt),
+		tierValue(meta.Tier), formatTime(meta.AccessedAt), formatOptionalTime(meta.ExpiresAt),
+		formatOptionalTime(meta.DeletedAt), meta.Attempts, string(meta.Priority), meta.CorrelationID,
+	}
+}
+
+// tierValue - пустой уровень хранения означает горячий.
+func tierValue(tier models.StorageTier) string {
+	if tier == "" {
+		return string(models.TierHot)
+	}
+	return string(tier)
+}
+
+func replaceTags(ctx context.Context, tx *sql.Tx, meta *models.ImageMetadata) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM image_tags WHERE tenant_id = ? AND image_id = ?`, meta.TenantID, meta.ID); err != nil {
+		return fmt.Errorf("tx.ExecContext: %w", err)
+	}
+
+	for _, tag := range meta.Tags {
+		if _, err := tx.ExecContext(ctx, `INSERT OR IGNORE INTO image_tags (tenant_id, image_id, tag) VALUES (?, ?, ?)`,
+			meta.TenantID, meta.ID, strings.ToLower(tag)); err != nil {
+			return fmt.Errorf("tx.ExecContext: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (ms *metadataStorage) loadTags(ctx context.Context, tenantID string, ids []string) (map[string][]string, error) {
+	tags := make(map[string][]string, len(ids))
+	if len(ids) == 0 {
+		return tags, nil
+	}
+
+	args := []any{tenantID}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+
+	rows, err := ms.db.QueryContext(ctx, `SELECT image_id, tag FROM image_tags
+		WHERE tenant_id = ? AND image_id IN (`+placeholders(len(ids))+`) ORDER BY tag`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("db.QueryContext: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, tag string
+		if err := rows.Scan(&id, &tag); err != nil {
+			return nil, fmt.Errorf("rows.Scan: %w", err)
+		}
+		tags[id] = append(tags[id], tag)
+	}
+
+	return tags, rows.Err()
+}
+
+func sortColumn(sortBy string) string {
+	switch sortBy {
+	case models.SortByName:
+		return "name_lower"
+	case models.SortBySize:
+		return "original_size"
+	default:
+		return "created_at"
+	}
+}
+
+func cursorValue(sortBy, key string) (any, error) {
+	if sortBy != models.SortBySize {
+		return key, nil
+	}
+
+	size, err := strconv.ParseInt(key, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("некорректный курсор: %w", err)
+	}
+
+	return size, nil
+}
+
+// parseTime - разбирает время, записанное formatTime или formatOptionalTime. Пустая строка -
+// время не задано. Некорректное значение - ошибка, а не нулевое время: для ExpiresAt и DeletedAt
+// нулевое время означает "бессрочно" и "не удалено".
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(models.SortTimeLayout, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("некорректное время %q: %w", value, err)
+	}
+
+	return t, nil
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(models.SortTimeLayout)
+}
+
+// formatOptionalTime - нулевое время хранится пустой строкой, чтобы не попадать в сравнения по времени.
+func formatOptionalTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return formatTime(t)
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
@@ -0,0 +1,313 @@
+package sqlitestorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sunr3d/image-processor/models"
+)
+
+func TestNewMetadataStorage_Migrations(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metadata.db")
+
+	ms, err := NewMetadataStorage(ctx, path)
+	require.NoError(t, err)
+	require.NoError(t, ms.Close())
+
+	// Повторное открытие не применяет миграции заново.
+	ms, err = NewMetadataStorage(ctx, path)
+	require.NoError(t, err)
+	defer ms.Close()
+
+	var count, version int
+	require.NoError(t, ms.db.QueryRowContext(ctx, `SELECT COUNT(*), MAX(version) FROM schema_migrations`).Scan(&count, &version))
+	assert.Equal(t, len(migrations), count)
+	assert.Equal(t, len(migrations), version)
+}
+
+func TestMetadataStorage_SaveGet_OK(t *testing.T) {
+	ms := newTestStorage(t)
+	ctx := context.Background()
+
+	meta := newTestMeta("t1", "img-1")
+	meta.ExpiresAt = meta.CreatedAt.Add(time.Hour)
+	meta.Priority = models.PriorityBulk
+	meta.CorrelationID = "req-1"
+	require.NoError(t, ms.Save(ctx, meta))
+	assert.Equal(t, int64(1), meta.Version)
+
+	got, err := ms.Get(ctx, "t1", "img-1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cats"}, got.Tags)
+	assert.Equal(t, int64(1), got.Version)
+	assert.True(t, meta.CreatedAt.Equal(got.CreatedAt))
+	assert.True(t, meta.ExpiresAt.Equal(got.ExpiresAt))
+	assert.True(t, got.DeletedAt.IsZero())
+	assert.Equal(t, models.PriorityBulk, got.Priority)
+	assert.Equal(t, "req-1", got.CorrelationID)
+
+	_, err = ms.Get(ctx, "t2", "img-1")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "не найдены")
+}
+
+func TestMetadataStorage_Get_CorruptTime(t *testing.T) {
+	ms := newTestStorage(t)
+	ctx := context.Background()
+
+	require.NoError(t, ms.Save(ctx, newTestMeta("t1", "img-1")))
+	_, err := ms.db.ExecContext(ctx, `UPDATE images SET deleted_at = 'вчера' WHERE id = 'img-1'`)
+	require.NoError(t, err)
+
+	_, err = ms.Get(ctx, "t1", "img-1")
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "некорректное время")
+}
+
+func TestMetadataStorage_Update_LostUpdate(t *testing.T) {
+	ms := newTestStorage(t)
+	ctx := context.Background()
+
+	require.NoError(t, ms.Save(ctx, newTestMeta("t1", "img-1")))
+
+	first, err := ms.Get(ctx, "t1", "img-1")
+	require.NoError(t, err)
+	second, err := ms.Get(ctx, "t1", "img-1")
+	require.NoError(t, err)
+
+	first.Status = models.StatusProcessing
+	first.CorrelationID = "req-2"
+	require.NoError(t, ms.Update(ctx, first))
+	assert.Equal(t, int64(2), first.Version)
+
+	second.Status = models.StatusFailed
+	err = ms.Update(ctx, second)
+	assert.True(t, errors.Is(err, models.ErrVersionConflict))
+
+	got, err := ms.Get(ctx, "t1", "img-1")
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusProcessing, got.Status)
+	assert.Equal(t, "req-2", got.CorrelationID)
+
+	err = ms.Update(ctx, newTestMeta("t1", "img-2"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "не найдены")
+}
+
+func TestMetadataStorage_List_Filters(t *testing.T) {
+	ms := newTestStorage(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	cat := newTestMeta("t1", "cat")
+	cat.OriginalName = "Cat.JPG"
+	cat.Width, cat.Height = 800, 600
+	cat.Status = models.StatusCompleted
+
+	dog := newTestMeta("t1", "dog")
+	dog.OriginalName = "dog.png"
+	dog.Format = "png"
+	dog.Tags = []string{"dogs"}
+	dog.ExpiresAt = now.Add(-time.Hour)
+
+	deleted := newTestMeta("t1", "deleted")
+	deleted.DeletedAt = now.Add(-time.Hour)
+
+	for _, meta := range []*models.ImageMetadata{cat, dog, deleted, newTestMeta("t2", "other")} {
+		require.NoError(t, ms.Save(ctx, meta))
+	}
+
+	tests := []struct {
+		name  string
+		query models.ImageQuery
+		want  []string
+	}{
+		{name: "tenant", query: models.ImageQuery{}, want: []string{"cat", "dog"}},
+		{name: "status", query: models.ImageQuery{Statuses: []models.ImageStatus{models.StatusCompleted}}, want: []string{"cat"}},
+		{name: "name", query: models.ImageQuery{NameContains: "cat"}, want: []string{"cat"}},
+		{name: "format", query: models.ImageQuery{Format: "PNG"}, want: []string{"dog"}},
+		{name: "size", query: models.ImageQuery{MinWidth: 800, MaxHeight: 600}, want: []string{"cat"}},
+		{name: "tags", query: models.ImageQuery{Tags: []string{"cats"}}, want: []string{"cat"}},
+		{name: "expires before", query: models.ImageQuery{ExpiresBefore: now}, want: []string{"dog"}},
+		{name: "with deleted", query: models.ImageQuery{WithDeleted: true}, want: []string{"cat", "deleted", "dog"}},
+		{name: "deleted before", query: models.ImageQuery{DeletedBefore: now}, want: []string{"deleted"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := tt.query
+			q.TenantID = "t1"
+			q.SortBy = models.SortByName
+			q.Limit = 10
+
+			page, err := ms.List(ctx, &q)
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, ids(page.Items))
+		})
+	}
+}
+
+func TestMetadataStorage_List_Pagination(t *testing.T) {
+	ms := newTestStorage(t)
+	ctx := context.Background()
+
+	base := time.Now()
+	for i := range 5 {
+		meta := newTestMeta("t1", fmt.Sprintf("img-%d", i))
+		meta.CreatedAt = base.Add(time.Duration(i) * time.Second)
+		require.NoError(t, ms.Save(ctx, meta))
+	}
+
+	query := &models.ImageQuery{TenantID: "t1", SortBy: models.SortByCreatedAt, Desc: true, Limit: 2}
+
+	var pages [][]string
+	for {
+		page, err := ms.List(ctx, query)
+		require.NoError(t, err)
+		pages = append(pages, ids(page.Items))
+		if page.NextCursor == "" {
+			break
+		}
+		query.Cursor = page.NextCursor
+	}
+
+	assert.Equal(t, [][]string{{"img-4", "img-3"}, {"img-2", "img-1"}, {"img-0"}}, pages)
+
+	// Курсор привязан к сортировке, для которой выдан.
+	query.SortBy = models.SortBySize
+	_, err := ms.List(ctx, query)
+	assert.Error(t, err)
+
+	usage, err := ms.Usage(ctx, "t1")
+	require.NoError(t, err)
+	assert.Equal(t, 5, usage.OriginalsCount)
+}
+
+func TestMetadataStorage_SaveWithTask_Quota(t *testing.T) {
+	ms := newTestStorage(t)
+	ctx := context.Background()
+	quota := models.Quota{MaxImages: 3}
+
+	// Удаленное изображение квоту не занимает.
+	deleted := newTestMeta("t1", "img-deleted")
+	deleted.DeletedAt = time.Now()
+	require.NoError(t, ms.Save(ctx, deleted))
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		saved    int
+		rejected int
+	)
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			meta := newTestMeta("t1", fmt.Sprintf("img-%d", i))
+			err := ms.SaveWithTask(ctx, meta, &models.ProcessingTask{TenantID: "t1", ImageID: meta.ID}, quota)
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				saved++
+			case errors.Is(err, models.ErrQuotaExceeded):
+				rejected++
+			default:
+				t.Errorf("SaveWithTask: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 3, saved)
+	assert.Equal(t, 7, rejected)
+
+	usage, err := ms.Usage(ctx, "t1")
+	require.NoError(t, err)
+	assert.Equal(t, 3, usage.OriginalsCount)
+}
+
+func TestMetadataStorage_Outbox(t *testing.T) {
+	ms := newTestStorage(t)
+	ctx := context.Background()
+
+	meta := newTestMeta("t1", "img-1")
+	require.NoError(t, ms.SaveWithTask(ctx, meta, &models.ProcessingTask{TenantID: "t1", ImageID: meta.ID}, models.Quota{}))
+
+	has, err := ms.HasTask(ctx, "t1", meta.ID)
+	require.NoError(t, err)
+	assert.True(t, has)
+
+	claim := func() []*models.OutboxEntry {
+		entries, err := ms.ClaimTasks(ctx, 10, time.Minute)
+		require.NoError(t, err)
+		return entries
+	}
+
+	entries := claim()
+	require.Len(t, entries, 1)
+	assert.Equal(t, meta.ID, entries[0].Task.ImageID)
+	assert.Equal(t, 1, entries[0].Attempts)
+	assert.False(t, entries[0].CreatedAt.IsZero())
+
+	// Захваченная запись скрыта до конца аренды или до RetryTask.
+	assert.Empty(t, claim())
+	require.NoError(t, ms.RetryTask(ctx, entries[0].ID, -time.Second, "broker is down"))
+
+	entries = claim()
+	require.Len(t, entries, 1)
+	assert.Equal(t, 2, entries[0].Attempts)
+	assert.Equal(t, "broker is down", entries[0].LastError)
+
+	require.NoError(t, ms.CompleteTask(ctx, entries[0].ID))
+	assert.Error(t, ms.RetryTask(ctx, entries[0].ID, 0, ""))
+
+	has, err = ms.HasTask(ctx, "t1", meta.ID)
+	require.NoError(t, err)
+	assert.False(t, has)
+}
+
+// helpers
+func newTestStorage(t *testing.T) *metadataStorage {
+	t.Helper()
+
+	ms, err := NewMetadataStorage(context.Background(), filepath.Join(t.TempDir(), "metadata.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { ms.Close() })
+
+	return ms
+}
+
+func newTestMeta(tenantID, id string) *models.ImageMetadata {
+	now := time.Now()
+	return &models.ImageMetadata{
+		ID:           id,
+		TenantID:     tenantID,
+		OriginalName: id + ".jpg",
+		Status:       models.StatusPending,
+		Tags:         []string{"cats"},
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+}
+
+func ids(items []*models.ImageMetadata) []string {
+	result := make([]string, 0, len(items))
+	for _, meta := range items {
+		result = append(result, meta.ID)
+	}
+
+	return result
+}
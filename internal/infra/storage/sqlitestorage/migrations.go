@@ -0,0 +1,135 @@
+package sqlitestorage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/wb-go/wbf/zlog"
+)
+
+// migrations - схема БД по версиям. Применённые миграции не редактируются, изменения схемы
+// добавляются новой миграцией в конец списка.
+var migrations = []string{
+	// 1: изображения, теги и индексы для поиска.
+	`CREATE TABLE images (
+		tenant_id        TEXT    NOT NULL,
+		id               TEXT    NOT NULL,
+		original_name    TEXT    NOT NULL DEFAULT '',
+		name_lower       TEXT    NOT NULL DEFAULT '',
+		original_path    TEXT    NOT NULL DEFAULT '',
+		resized_path     TEXT    NOT NULL DEFAULT '',
+		thumbnail_path   TEXT    NOT NULL DEFAULT '',
+		watermarked_path TEXT    NOT NULL DEFAULT '',
+		original_size    INTEGER NOT NULL DEFAULT 0,
+		processed_size   INTEGER NOT NULL DEFAULT 0,
+		format           TEXT    NOT NULL DEFAULT '',
+		width            INTEGER NOT NULL DEFAULT 0,
+		height           INTEGER NOT NULL DEFAULT 0,
+		status           TEXT    NOT NULL,
+		error_message    TEXT    NOT NULL DEFAULT '',
+		created_at       TEXT    NOT NULL,
+		updated_at       TEXT    NOT NULL,
+		PRIMARY KEY (tenant_id, id)
+	);
+	CREATE TABLE image_tags (
+		tenant_id TEXT NOT NULL,
+		image_id  TEXT NOT NULL,
+		tag       TEXT NOT NULL,
+		PRIMARY KEY (tenant_id, image_id, tag),
+		FOREIGN KEY (tenant_id, image_id) REFERENCES images (tenant_id, id) ON DELETE CASCADE
+	);
+	CREATE INDEX idx_images_created ON images (tenant_id, created_at, id);
+	CREATE INDEX idx_images_name ON images (tenant_id, name_lower, id);
+	CREATE INDEX idx_images_size ON images (tenant_id, original_size, id);
+	CREATE INDEX idx_images_status ON images (tenant_id, status, created_at);
+	CREATE INDEX idx_image_tags_tag ON image_tags (tenant_id, tag);`,
+	// 2: версия записи для оптимистичной блокировки.
+	`ALTER TABLE images ADD COLUMN version INTEGER NOT NULL DEFAULT 1;`,
+	// 3: уровень хранения и время последнего обращения для политик жизненного цикла.
+	`ALTER TABLE images ADD COLUMN tier TEXT NOT NULL DEFAULT 'hot';
+	ALTER TABLE images ADD COLUMN accessed_at TEXT NOT NULL DEFAULT '';`,
+	// 4: срок хранения изображения.
+	`ALTER TABLE images ADD COLUMN expires_at TEXT NOT NULL DEFAULT '';
+	CREATE INDEX idx_images_expires ON images (tenant_id, expires_at) WHERE expires_at != '';`,
+	// 5: мягкое удаление.
+	`ALTER TABLE images ADD COLUMN deleted_at TEXT NOT NULL DEFAULT '';
+	CREATE INDEX idx_images_deleted ON images (tenant_id, deleted_at) WHERE deleted_at != '';`,
+	// 6: outbox задач на обработку.
+	`CREATE TABLE outbox (
+		id           TEXT    PRIMARY KEY,
+		payload      TEXT    NOT NULL,
+		attempts     INTEGER NOT NULL DEFAULT 0,
+		last_error   TEXT    NOT NULL DEFAULT '',
+		created_at   TEXT    NOT NULL,
+		available_at TEXT    NOT NULL
+	);
+	CREATE INDEX idx_outbox_available ON outbox (available_at);`,
+	// 7: счетчик повторных постановок зависших задач в очередь.
+	`ALTER TABLE images ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0;`,
+	// 8: приоритет и ID корреляции последней задачи на обработку.
+	`ALTER TABLE images ADD COLUMN priority TEXT NOT NULL DEFAULT '';
+	ALTER TABLE images ADD COLUMN correlation_id TEXT NOT NULL DEFAULT '';`,
+	// 9: тенант и ID изображения задачи outbox в индексируемых колонках для HasTask.
+	`ALTER TABLE outbox ADD COLUMN tenant_id TEXT NOT NULL DEFAULT '';
+	ALTER TABLE outbox ADD COLUMN image_id TEXT NOT NULL DEFAULT '';
+	UPDATE outbox SET tenant_id = COALESCE(json_extract(payload, '$.TenantID'), ''),
+		image_id = COALESCE(json_extract(payload, '$.ImageID'), '');
+	CREATE INDEX idx_outbox_image ON outbox (tenant_id, image_id);`,
+}
+
+// migrate - применяет недостающие миграции, каждую в отдельной транзакции. Транзакции
+// открываются с BEGIN IMMEDIATE, поэтому app и worker, стартующие одновременно, не применят
+// одну миграцию дважды.
+func migrate(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`); err != nil {
+		return fmt.Errorf("db.ExecContext: %w", err)
+	}
+
+	for {
+		applied, err := applyNextMigration(ctx, db)
+		if err != nil {
+			return err
+		}
+		if !applied {
+			return nil
+		}
+	}
+}
+
+func applyNextMigration(ctx context.Context, db *sql.DB) (bool, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("db.BeginTx: %w", err)
+	}
+	defer tx.Rollback()
+
+	var current int
+	if err := tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return false, fmt.Errorf("tx.QueryRowContext: %w", err)
+	}
+
+	if current >= len(migrations) {
+		return false, nil
+	}
+
+	version := current + 1
+	if _, err := tx.ExecContext(ctx, migrations[current]); err != nil {
+		return false, fmt.Errorf("миграция %d: %w", version, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version) VALUES (?)`, version); err != nil {
+		return false, fmt.Errorf("tx.ExecContext: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("tx.Commit: %w", err)
+	}
+
+	zlog.Logger.Info().Msgf("Применена миграция схемы метаданных: %d", version)
+
+	return true, nil
+}
@@ -0,0 +1,127 @@
+package sqlitestorage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/sunr3d/image-processor/internal/interfaces/infra"
+	"github.com/sunr3d/image-processor/models"
+)
+
+var _ infra.Outbox = (*metadataStorage)(nil)
+
+// ClaimTasks - захватывает до limit записей outbox, готовых к публикации, на время lease.
+// Транзакции открываются с BEGIN IMMEDIATE, поэтому одну запись не захватят два relay.
+func (ms *metadataStorage) ClaimTasks(ctx context.Context, limit int, lease time.Duration) ([]*models.OutboxEntry, error) {
+	tx, err := ms.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("db.BeginTx: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	rows, err := tx.QueryContext(ctx, `SELECT id, payload, attempts, last_error, created_at FROM outbox
+		WHERE available_at <= ? ORDER BY available_at, id LIMIT ?`, formatTime(now), limit)
+	if err != nil {
+		return nil, fmt.Errorf("tx.QueryContext: %w", err)
+	}
+
+	var entries []*models.OutboxEntry
+	for rows.Next() {
+		var (
+			entry              models.OutboxEntry
+			payload, createdAt string
+		)
+		if err := rows.Scan(&entry.ID, &payload, &entry.Attempts, &entry.LastError, &createdAt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("rows.Scan: %w", err)
+		}
+		if err := json.Unmarshal([]byte(payload), &entry.Task); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("json.Unmarshal: %w", err)
+		}
+		if entry.CreatedAt, err = parseTime(createdAt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("запись outbox %s: %w", entry.ID, err)
+		}
+		entries = append(entries, &entry)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows.Err: %w", err)
+	}
+
+	availableAt := now.Add(lease)
+	for _, entry := range entries {
+		if _, err := tx.ExecContext(ctx, `UPDATE outbox SET attempts = attempts + 1, available_at = ? WHERE id = ?`,
+			formatTime(availableAt), entry.ID); err != nil {
+			return nil, fmt.Errorf("tx.ExecContext: %w", err)
+		}
+		entry.Attempts++
+		entry.AvailableAt = availableAt
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("tx.Commit: %w", err)
+	}
+
+	return entries, nil
+}
+
+// CompleteTask - удаляет опубликованную запись outbox.
+func (ms *metadataStorage) CompleteTask(ctx context.Context, id string) error {
+	if _, err := ms.db.ExecContext(ctx, `DELETE FROM outbox WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("db.ExecContext: %w", err)
+	}
+
+	return nil
+}
+
+// RetryTask - откладывает повторную публикацию записи outbox на delay.
+func (ms *metadataStorage) RetryTask(ctx context.Context, id string, delay time.Duration, cause string) error {
+	res, err := ms.db.ExecContext(ctx, `UPDATE outbox SET available_at = ?, last_error = ? WHERE id = ?`,
+		formatTime(time.Now().Add(delay)), cause, id)
+	if err != nil {
+		return fmt.Errorf("db.ExecContext: %w", err)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("запись outbox не найдена: %s", id)
+	}
+
+	return nil
+}
+
+// HasTask - сообщает, ждет ли в outbox публикации задача на обработку изображения.
+func (ms *metadataStorage) HasTask(ctx context.Context, tenantID, imageID string) (bool, error) {
+	var exists bool
+	if err := ms.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM outbox
+		WHERE tenant_id = ? AND image_id = ?)`,
+		tenantID, imageID).Scan(&exists); err != nil {
+		return false, fmt.Errorf("db.QueryRowContext: %w", err)
+	}
+
+	return exists, nil
+}
+
+// helpers
+func insertTask(ctx context.Context, tx *sql.Tx, task *models.ProcessingTask) error {
+	payload, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %w", err)
+	}
+
+	now := formatTime(time.Now())
+	if _, err := tx.ExecContext(ctx, `INSERT INTO outbox (id, payload, tenant_id, image_id, created_at, available_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		uuid.New().String(), string(payload), task.TenantID, task.ImageID, now, now); err != nil {
+		return fmt.Errorf("tx.ExecContext: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,143 @@
+package tieredstorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/sunr3d/image-processor/internal/interfaces/infra"
+	"github.com/sunr3d/image-processor/models"
+)
+
+var (
+	_ infra.ImageStorage = (*imageStorage)(nil)
+	_ infra.ColdStorage  = (*imageStorage)(nil)
+)
+
+type imageStorage struct {
+	hot  infra.ImageStorage
+	cold infra.ImageStorage
+}
+
+// NewImageStorage - конструктор ImageStorage с горячим и холодным уровнями. Новые изображения
+// пишутся в hot, в cold переносятся только оригиналы.
+func NewImageStorage(hot, cold infra.ImageStorage) *imageStorage {
+	return &imageStorage{
+		hot:  hot,
+		cold: cold,
+	}
+}
+
+// SaveOriginal - сохраняет оригинал изображения тенанта в горячий уровень.
+func (ts *imageStorage) SaveOriginal(ctx context.Context, tenantID, id string, r io.Reader, size int64) (string, error) {
+	return ts.hot.SaveOriginal(ctx, tenantID, id, r, size)
+}
+
+// SaveProcessed - сохраняет обработанное изображение тенанта в горячий уровень.
+func (ts *imageStorage) SaveProcessed(ctx context.Context, tenantID, id, imageType string, r io.Reader, size int64) (string, error) {
+	return ts.hot.SaveProcessed(ctx, tenantID, id, imageType, r, size)
+}
+
+// Open - открывает изображение из горячего уровня; оригинал, которого там нет, читается из архива.
+func (ts *imageStorage) Open(ctx context.Context, tenantID, id, imageType string) (io.ReadSeekCloser, *models.ObjectInfo, error) {
+	rc, info, err := ts.hot.Open(ctx, tenantID, id, imageType)
+	if err == nil || imageType != "original" || !isNotFound(err) {
+		return rc, info, err
+	}
+
+	return ts.cold.Open(ctx, tenantID, id, imageType)
+}
+
+// Stat - возвращает сведения об изображении из горячего уровня, для оригинала - с откатом на архив.
+func (ts *imageStorage) Stat(ctx context.Context, tenantID, id, imageType string) (*models.ObjectInfo, error) {
+	info, err := ts.hot.Stat(ctx, tenantID, id, imageType)
+	if err == nil || imageType != "original" || !isNotFound(err) {
+		return info, err
+	}
+
+	return ts.cold.Stat(ctx, tenantID, id, imageType)
+}
+
+// PresignURL - выдает подписанную ссылку горячего уровня, для оригинала - с откатом на архив.
+func (ts *imageStorage) PresignURL(ctx context.Context, tenantID, id, imageType string, ttl time.Duration) (string, error) {
+	url, err := ts.hot.PresignURL(ctx, tenantID, id, imageType, ttl)
+	if err == nil || imageType != "original" || !isNotFound(err) {
+		return url, err
+	}
+
+	return ts.cold.PresignURL(ctx, tenantID, id, imageType, ttl)
+}
+
+// DeleteImage - удаляет изображение тенанта с обоих уровней.
+func (ts *imageStorage) DeleteImage(ctx context.Context, tenantID, id string) error {
+	if err := ts.hot.DeleteImage(ctx, tenantID, id); err != nil {
+		return fmt.Errorf("hot.DeleteImage: %w", err)
+	}
+	if err := ts.cold.DeleteImage(ctx, tenantID, id); err != nil {
+		return fmt.Errorf("cold.DeleteImage: %w", err)
+	}
+
+	return nil
+}
+
+// Archive - копирует оригинал в холодный уровень и удаляет из горячего оригинал и производные.
+// Если оригинала в горячем уровне уже нет, считается, что он заархивирован ранее.
+func (ts *imageStorage) Archive(ctx context.Context, tenantID, id string) error {
+	rc, info, err := ts.hot.Open(ctx, tenantID, id, "original")
+	if err != nil {
+		if isNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("hot.Open: %w", err)
+	}
+	defer rc.Close()
+
+	if _, err := ts.cold.SaveOriginal(ctx, tenantID, id, rc, info.Size); err != nil {
+		return fmt.Errorf("cold.SaveOriginal: %w", err)
+	}
+
+	if err := ts.hot.DeleteImage(ctx, tenantID, id); err != nil {
+		return fmt.Errorf("hot.DeleteImage: %w", err)
+	}
+
+	zlog.Logger.Info().Msgf("Оригинал изображения %s перенесен в холодное хранилище", id)
+
+	return nil
+}
+
+// Restore - возвращает оригинал из холодного уровня в горячий и удаляет архивную копию.
+// Если оригинал уже в горячем уровне, ничего не делает.
+func (ts *imageStorage) Restore(ctx context.Context, tenantID, id string) error {
+	if _, err := ts.hot.Stat(ctx, tenantID, id, "original"); err == nil {
+		return nil
+	} else if !isNotFound(err) {
+		return fmt.Errorf("hot.Stat: %w", err)
+	}
+
+	rc, info, err := ts.cold.Open(ctx, tenantID, id, "original")
+	if err != nil {
+		return fmt.Errorf("cold.Open: %w", err)
+	}
+	defer rc.Close()
+
+	if _, err := ts.hot.SaveOriginal(ctx, tenantID, id, rc, info.Size); err != nil {
+		return fmt.Errorf("hot.SaveOriginal: %w", err)
+	}
+
+	if err := ts.cold.DeleteImage(ctx, tenantID, id); err != nil {
+		zlog.Logger.Warn().Err(err).Msgf("Ошибка удаления архивной копии изображения %s", id)
+	}
+
+	zlog.Logger.Info().Msgf("Оригинал изображения %s восстановлен из холодного хранилища", id)
+
+	return nil
+}
+
+// helpers
+func isNotFound(err error) bool {
+	return errors.Is(err, models.ErrImageNotFound)
+}
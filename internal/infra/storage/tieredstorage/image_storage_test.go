@@ -0,0 +1,107 @@
+package tieredstorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sunr3d/image-processor/internal/infra/storage/filestorage"
+	"github.com/sunr3d/image-processor/mocks"
+	"github.com/sunr3d/image-processor/models"
+)
+
+func newTestStorage(t *testing.T) *imageStorage {
+	t.Helper()
+
+	return NewImageStorage(filestorage.NewFileStorage(t.TempDir()), filestorage.NewFileStorage(t.TempDir()))
+}
+
+func readAll(t *testing.T, ts *imageStorage, imageType string) string {
+	t.Helper()
+
+	rc, _, err := ts.Open(context.Background(), "acme", "img-1", imageType)
+	require.NoError(t, err)
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	require.NoError(t, err)
+
+	return string(data)
+}
+
+func TestImageStorage_ArchiveRestore(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestStorage(t)
+
+	_, err := ts.SaveOriginal(ctx, "acme", "img-1", strings.NewReader("original"), 8)
+	require.NoError(t, err)
+	_, err = ts.SaveProcessed(ctx, "acme", "img-1", "thumbnail", strings.NewReader("thumb"), 5)
+	require.NoError(t, err)
+
+	require.NoError(t, ts.Archive(ctx, "acme", "img-1"))
+
+	_, err = ts.hot.Stat(ctx, "acme", "img-1", "original")
+	assert.Error(t, err)
+	_, err = ts.hot.Stat(ctx, "acme", "img-1", "thumbnail")
+	assert.Error(t, err, "производные удаляются при архивации")
+
+	// Оригинал остается доступным для чтения прямо из архива.
+	assert.Equal(t, "original", readAll(t, ts, "original"))
+
+	// Повторная архивация не ошибка.
+	require.NoError(t, ts.Archive(ctx, "acme", "img-1"))
+
+	require.NoError(t, ts.Restore(ctx, "acme", "img-1"))
+
+	_, err = ts.hot.Stat(ctx, "acme", "img-1", "original")
+	assert.NoError(t, err)
+	_, err = ts.cold.Stat(ctx, "acme", "img-1", "original")
+	assert.Error(t, err, "архивная копия удаляется после восстановления")
+	assert.Equal(t, "original", readAll(t, ts, "original"))
+
+	// Повторное восстановление не ошибка.
+	require.NoError(t, ts.Restore(ctx, "acme", "img-1"))
+}
+
+func TestImageStorage_DerivedNotReadFromCold(t *testing.T) {
+	ts := newTestStorage(t)
+
+	_, _, err := ts.Open(context.Background(), "acme", "img-1", "thumbnail")
+
+	assert.ErrorIs(t, err, models.ErrImageNotFound)
+}
+
+func TestImageStorage_ColdFallbackOnlyOnNotFound(t *testing.T) {
+	ctx := context.Background()
+	hot := mocks.NewImageStorage(t)
+	cold := mocks.NewImageStorage(t)
+	ts := NewImageStorage(hot, cold)
+
+	// Текст ошибки не важен: к архиву ведет только models.ErrImageNotFound.
+	hot.EXPECT().
+		Stat(ctx, "acme", "img-1", "original").
+		Return(nil, errors.New("client.StatObject: бакет не найден в регионе")).
+		Once()
+
+	_, err := ts.Stat(ctx, "acme", "img-1", "original")
+	assert.Error(t, err)
+
+	hot.EXPECT().
+		Stat(ctx, "acme", "img-1", "original").
+		Return(nil, fmt.Errorf("%w: s3://hot/acme", models.ErrImageNotFound)).
+		Once()
+	cold.EXPECT().
+		Stat(ctx, "acme", "img-1", "original").
+		Return(&models.ObjectInfo{Size: 8}, nil).
+		Once()
+
+	info, err := ts.Stat(ctx, "acme", "img-1", "original")
+	require.NoError(t, err)
+	assert.Equal(t, int64(8), info.Size)
+}
@@ -11,7 +11,25 @@ type Subscriber interface {
 	Subscribe(ctx context.Context, handler func(ctx context.Context, task *models.ProcessingTask) error) error
 }
 
+// Publisher - публикация задач в брокер. Задача передается в конверте с версией схемы
+// и служебными полями; подписчики передают обработчику задачу из конверта.
+//
 //go:generate go run github.com/vektra/mockery/v2@v2.53.2 --name=Publisher --output=../../../mocks --filename=mock_publisher.go --with-expecter
 type Publisher interface {
-	Publish(ctx context.Context, task *models.ProcessingTask) error
+	Publish(ctx context.Context, env *models.TaskEnvelope) error
+}
+
+// DeadLetterQueue - очередь задач, которые не удалось обработать после всех повторов, и сообщений,
+// которые не удалось разобрать. Replay возвращает до limit сообщений в основную очередь.
+//
+//go:generate go run github.com/vektra/mockery/v2@v2.53.2 --name=DeadLetterQueue --output=../../../mocks --filename=mock_dead_letter_queue.go --with-expecter
+type DeadLetterQueue interface {
+	Replay(ctx context.Context, limit int) (int, error)
+}
+
+// EventPublisher - публикация событий об окончании обработки изображений для других сервисов.
+//
+//go:generate go run github.com/vektra/mockery/v2@v2.53.2 --name=EventPublisher --output=../../../mocks --filename=mock_event_publisher.go --with-expecter
+type EventPublisher interface {
+	PublishEvent(ctx context.Context, event *models.ImageEvent) error
 }
@@ -2,23 +2,64 @@ package infra
 
 import (
 	"context"
-	"mime/multipart"
+	"io"
+	"time"
 
 	"github.com/sunr3d/image-processor/models"
 )
 
+// ImageStorage - хранилище изображений с потоковым чтением и записью (size = -1, если размер неизвестен).
+//
 //go:generate go run github.com/vektra/mockery/v2@v2.53.2 --name=ImageStorage --output=../../../mocks --filename=mock_image_storage.go --with-expecter
 type ImageStorage interface {
-	SaveOriginal(ctx context.Context, id string, file multipart.File, filename string) (string, error)
-	SaveProcessed(ctx context.Context, id, imageType string, data []byte) (string, error)
-	GetPath(id, imageType string) (string, error)
-	DeleteImage(ctx context.Context, id string) error
+	SaveOriginal(ctx context.Context, tenantID, id string, r io.Reader, size int64) (string, error)
+	SaveProcessed(ctx context.Context, tenantID, id, imageType string, r io.Reader, size int64) (string, error)
+	Open(ctx context.Context, tenantID, id, imageType string) (io.ReadSeekCloser, *models.ObjectInfo, error)
+	Stat(ctx context.Context, tenantID, id, imageType string) (*models.ObjectInfo, error)
+	PresignURL(ctx context.Context, tenantID, id, imageType string, ttl time.Duration) (string, error)
+	DeleteImage(ctx context.Context, tenantID, id string) error
+}
+
+// ColdStorage - холодный уровень хранения оригиналов. Archive переносит оригинал в архив и удаляет
+// горячие копии вместе с производными, Restore возвращает оригинал в основное хранилище.
+//
+//go:generate go run github.com/vektra/mockery/v2@v2.53.2 --name=ColdStorage --output=../../../mocks --filename=mock_cold_storage.go --with-expecter
+type ColdStorage interface {
+	Archive(ctx context.Context, tenantID, id string) error
+	Restore(ctx context.Context, tenantID, id string) error
+}
+
+// ImageInventory - перечисление содержимого хранилища изображений для сверки с метаданными.
+//
+//go:generate go run github.com/vektra/mockery/v2@v2.53.2 --name=ImageInventory --output=../../../mocks --filename=mock_image_inventory.go --with-expecter
+type ImageInventory interface {
+	Tenants(ctx context.Context) ([]string, error)
+	Images(ctx context.Context, tenantID string) ([]models.StoredImage, error)
 }
 
 //go:generate go run github.com/vektra/mockery/v2@v2.53.2 --name=MetadataStorage --output=../../../mocks --filename=mock_metadata_storage.go --with-expecter
 type MetadataStorage interface {
 	Save(ctx context.Context, meta *models.ImageMetadata) error
-	Get(ctx context.Context, id string) (*models.ImageMetadata, error)
+	Get(ctx context.Context, tenantID, id string) (*models.ImageMetadata, error)
 	Update(ctx context.Context, meta *models.ImageMetadata) error
-	Delete(ctx context.Context, id string) error
+	Delete(ctx context.Context, tenantID, id string) error
+	Usage(ctx context.Context, tenantID string) (*models.TenantUsage, error)
+	List(ctx context.Context, query *models.ImageQuery) (*models.ImagePage, error)
+}
+
+// Outbox - журнал задач на обработку (transactional outbox). SaveWithTask и UpdateWithTask
+// записывают задачу вместе с метаданными, relay публикует ее в брокер. SaveWithTask атомарно
+// с записью проверяет квоты тенанта и при превышении возвращает models.ErrQuotaExceeded. ClaimTasks захватывает
+// готовые к публикации записи на время lease, CompleteTask удаляет опубликованную запись,
+// RetryTask откладывает повтор публикации на delay. HasTask сообщает, ждет ли в outbox
+// задача на обработку изображения.
+//
+//go:generate go run github.com/vektra/mockery/v2@v2.53.2 --name=Outbox --output=../../../mocks --filename=mock_outbox.go --with-expecter
+type Outbox interface {
+	SaveWithTask(ctx context.Context, meta *models.ImageMetadata, task *models.ProcessingTask, quota models.Quota) error
+	UpdateWithTask(ctx context.Context, meta *models.ImageMetadata, task *models.ProcessingTask) error
+	ClaimTasks(ctx context.Context, limit int, lease time.Duration) ([]*models.OutboxEntry, error)
+	CompleteTask(ctx context.Context, id string) error
+	RetryTask(ctx context.Context, id string, delay time.Duration, cause string) error
+	HasTask(ctx context.Context, tenantID, imageID string) (bool, error)
 }
@@ -2,15 +2,20 @@ package services
 
 import (
 	"context"
-	"mime/multipart"
+	"io"
 
 	"github.com/sunr3d/image-processor/models"
 )
 
 //go:generate go run github.com/vektra/mockery/v2@v2.53.2 --name=ImageService --output=../../../mocks --filename=mock_image_service.go --with-expecter
 type ImageService interface {
-	UploadImage(ctx context.Context, file multipart.File, filename string) (string, error)
-	GetImage(ctx context.Context, id, imageType string) (string, error)
-	DeleteImage(ctx context.Context, id string) error
-	GetImgMeta(ctx context.Context, id string) (*models.ImageMetadata, error)
+	UploadImage(ctx context.Context, tenantID string, file io.ReadSeeker, filename string, opts models.UploadOptions) (string, error)
+	GetImage(ctx context.Context, tenantID, id, imageType string) (*models.ImageContent, error)
+	DeleteImage(ctx context.Context, tenantID, id string) error
+	RestoreImage(ctx context.Context, tenantID, id string) error
+	RetryImage(ctx context.Context, tenantID, id string) error
+	ReplayDeadLetters(ctx context.Context, limit int) (int, error)
+	GetImgMeta(ctx context.Context, tenantID, id string) (*models.ImageMetadata, error)
+	GetUsage(ctx context.Context, tenantID string) (*models.TenantUsage, error)
+	ListImages(ctx context.Context, tenantID string, query *models.ImageQuery) (*models.ImagePage, error)
 }
@@ -0,0 +1,302 @@
+package gc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/sunr3d/image-processor/internal/interfaces/infra"
+	"github.com/sunr3d/image-processor/models"
+)
+
+type collector struct {
+	imgStorage  infra.ImageStorage
+	inventory   infra.ImageInventory
+	metaStorage infra.MetadataStorage
+	outbox      infra.Outbox
+	tenantIDs   []string
+	minAge      time.Duration
+}
+
+// New - конструктор сборщика мусора, сверяющего хранилище изображений с метаданными.
+// Файлы без метаданных моложе minAge не считаются брошенными: их может прямо сейчас
+// записывать загрузка, еще не сохранившая метаданные.
+func New(
+	imgStorage infra.ImageStorage,
+	inventory infra.ImageInventory,
+	metaStorage infra.MetadataStorage,
+	outbox infra.Outbox,
+	tenants []models.Tenant,
+	minAge time.Duration,
+) *collector {
+	return &collector{
+		imgStorage:  imgStorage,
+		inventory:   inventory,
+		metaStorage: metaStorage,
+		outbox:      outbox,
+		tenantIDs:   models.TenantIDs(tenants),
+		minAge:      minAge,
+	}
+}
+
+// Run - сверяет хранилище с метаданными всех тенантов. С repair = false только сообщает
+// о несоответствиях; с repair = true удаляет брошенные файлы и метаданные без оригинала,
+// а изображения без производных ставит на повторную обработку.
+func (c *collector) Run(ctx context.Context, repair bool) (*models.GCReport, error) {
+	tenantIDs, err := c.tenants(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("tenants: %w", err)
+	}
+
+	report := &models.GCReport{}
+	for _, tenantID := range tenantIDs {
+		if err := c.checkTenant(ctx, tenantID, repair, report); err != nil {
+			return report, fmt.Errorf("checkTenant %s: %w", tenantID, err)
+		}
+	}
+
+	return report, nil
+}
+
+// helpers
+// tenants - настроенные тенанты и тенанты, найденные в хранилище (например, удаленные из конфигурации).
+func (c *collector) tenants(ctx context.Context) ([]string, error) {
+	stored, err := c.inventory.Tenants(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("inventory.Tenants: %w", err)
+	}
+
+	seen := make(map[string]struct{})
+	var tenantIDs []string
+	for _, id := range append(append([]string{}, c.tenantIDs...), stored...) {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		tenantIDs = append(tenantIDs, id)
+	}
+
+	return tenantIDs, nil
+}
+
+func (c *collector) checkTenant(ctx context.Context, tenantID string, repair bool, report *models.GCReport) error {
+	stored, err := c.inventory.Images(ctx, tenantID)
+	if err != nil {
+		return fmt.Errorf("inventory.Images: %w", err)
+	}
+
+	known := make(map[string]struct{})
+	query := &models.ImageQuery{
+		TenantID:    tenantID,
+		WithDeleted: true,
+		SortBy:      models.SortByCreatedAt,
+		Limit:       models.MaxPageLimit,
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		page, err := c.metaStorage.List(ctx, query)
+		if err != nil {
+			return fmt.Errorf("metaStorage.List: %w", err)
+		}
+
+		for _, meta := range page.Items {
+			known[meta.ID] = struct{}{}
+			report.ImagesChecked++
+
+			issue, err := c.checkMeta(ctx, meta)
+			if err != nil {
+				return fmt.Errorf("checkMeta %s: %w", meta.ID, err)
+			}
+			if issue == nil {
+				continue
+			}
+
+			if repair {
+				c.repair(ctx, issue, meta)
+			}
+			report.Issues = append(report.Issues, *issue)
+		}
+
+		if page.NextCursor == "" {
+			break
+		}
+		query.Cursor = page.NextCursor
+	}
+
+	threshold := time.Now().Add(-c.minAge)
+	for _, img := range stored {
+		if _, ok := known[img.ID]; ok || img.ModTime.After(threshold) {
+			continue
+		}
+
+		issue := &models.GCIssue{
+			Kind:     models.GCOrphanFiles,
+			TenantID: tenantID,
+			ImageID:  img.ID,
+			Details:  fmt.Sprintf("файлы изменены %s, метаданных нет", img.ModTime.Format(time.RFC3339)),
+		}
+		if repair {
+			c.repair(ctx, issue, nil)
+		}
+		report.Issues = append(report.Issues, *issue)
+	}
+
+	return nil
+}
+
+// checkMeta - проверяет наличие файлов изображения. Архивные оригиналы не проверяются:
+// они лежат в холодном хранилище, а производных у них нет. Файлы удаленных изображений
+// дожидаются фоновой очистки и тоже не проверяются.
+func (c *collector) checkMeta(ctx context.Context, meta *models.ImageMetadata) (*models.GCIssue, error) {
+	if meta.Tier == models.TierCold || meta.Deleted() {
+		return nil, nil
+	}
+
+	exists, err := c.exists(ctx, meta.TenantID, meta.ID, "original")
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return &models.GCIssue{
+			Kind:     models.GCMissingOriginal,
+			TenantID: meta.TenantID,
+			ImageID:  meta.ID,
+			Details:  fmt.Sprintf("статус %s, оригинала нет", meta.Status),
+		}, nil
+	}
+
+	if meta.Status != models.StatusCompleted {
+		return nil, nil
+	}
+
+	var missing []string
+	for _, d := range derivatives(meta) {
+		if d.path == "" {
+			continue
+		}
+		exists, err := c.exists(ctx, meta.TenantID, meta.ID, d.imageType)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			missing = append(missing, d.imageType)
+		}
+	}
+	if len(missing) == 0 {
+		return nil, nil
+	}
+
+	return &models.GCIssue{
+		Kind:     models.GCMissingDerivatives,
+		TenantID: meta.TenantID,
+		ImageID:  meta.ID,
+		Details:  "нет производных: " + strings.Join(missing, ", "),
+	}, nil
+}
+
+func (c *collector) exists(ctx context.Context, tenantID, id, imageType string) (bool, error) {
+	if _, err := c.imgStorage.Stat(ctx, tenantID, id, imageType); err != nil {
+		if errors.Is(err, models.ErrImageNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("imgStorage.Stat: %w", err)
+	}
+
+	return true, nil
+}
+
+// repair - исправляет несоответствие. Ошибка исправления не прерывает сверку: несоответствие
+// остается в отчете неисправленным.
+func (c *collector) repair(ctx context.Context, issue *models.GCIssue, meta *models.ImageMetadata) {
+	var err error
+	switch issue.Kind {
+	case models.GCOrphanFiles:
+		err = c.removeOrphan(ctx, issue.TenantID, issue.ImageID)
+	case models.GCMissingOriginal:
+		err = c.removeDangling(ctx, meta)
+	case models.GCMissingDerivatives:
+		err = c.reprocess(ctx, meta)
+	}
+
+	if err != nil {
+		zlog.Logger.Warn().Err(err).Msgf("Не удалось исправить %s для изображения %s", issue.Kind, issue.ImageID)
+		return
+	}
+	issue.Repaired = true
+}
+
+// removeOrphan - удаляет файлы без метаданных, если метаданные не появились с начала сверки.
+func (c *collector) removeOrphan(ctx context.Context, tenantID, id string) error {
+	if _, err := c.metaStorage.Get(ctx, tenantID, id); err == nil {
+		return fmt.Errorf("метаданные изображения %s появились во время сверки", id)
+	} else if !strings.Contains(err.Error(), "не найден") {
+		return fmt.Errorf("metaStorage.Get: %w", err)
+	}
+
+	if err := c.imgStorage.DeleteImage(ctx, tenantID, id); err != nil {
+		return fmt.Errorf("imgStorage.DeleteImage: %w", err)
+	}
+
+	return nil
+}
+
+// removeDangling - удаляет метаданные изображения без оригинала вместе с оставшимися производными.
+func (c *collector) removeDangling(ctx context.Context, meta *models.ImageMetadata) error {
+	if err := c.metaStorage.Delete(ctx, meta.TenantID, meta.ID); err != nil {
+		return fmt.Errorf("metaStorage.Delete: %w", err)
+	}
+
+	if err := c.imgStorage.DeleteImage(ctx, meta.TenantID, meta.ID); err != nil {
+		return fmt.Errorf("imgStorage.DeleteImage: %w", err)
+	}
+
+	return nil
+}
+
+// reprocess - сбрасывает производные изображения и ставит его на повторную обработку: задача
+// записывается в outbox вместе с метаданными и публикуется relay процесса app.
+func (c *collector) reprocess(ctx context.Context, meta *models.ImageMetadata) error {
+	meta.Status = models.StatusPending
+	meta.Attempts = 0
+	meta.ResizedPath = ""
+	meta.ThumbnailPath = ""
+	meta.WatermarkedPath = ""
+	meta.ProcessedSize = 0
+	meta.UpdatedAt = time.Now()
+
+	// Повторная обработка после сверки не должна задерживать интерактивные загрузки.
+	task := &models.ProcessingTask{
+		TenantID:     meta.TenantID,
+		ImageID:      meta.ID,
+		OriginalPath: meta.OriginalPath,
+		Priority:     models.PriorityBulk,
+	}
+	meta.Priority = task.Priority
+	meta.CorrelationID = task.CorrelationID
+	if err := c.outbox.UpdateWithTask(ctx, meta, task); err != nil {
+		return fmt.Errorf("outbox.UpdateWithTask: %w", err)
+	}
+
+	return nil
+}
+
+type derivative struct {
+	imageType string
+	path      string
+}
+
+func derivatives(meta *models.ImageMetadata) []derivative {
+	return []derivative{
+		{"resized", meta.ResizedPath},
+		{"thumbnail", meta.ThumbnailPath},
+		{"watermarked", meta.WatermarkedPath},
+	}
+}
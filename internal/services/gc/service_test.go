@@ -0,0 +1,132 @@
+package gc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sunr3d/image-processor/mocks"
+	"github.com/sunr3d/image-processor/models"
+)
+
+var errNotFound = fmt.Errorf("%w: test", models.ErrImageNotFound)
+
+type gcMocks struct {
+	imgStorage  *mocks.ImageStorage
+	inventory   *mocks.ImageInventory
+	metaStorage *mocks.MetadataStorage
+	outbox      *mocks.Outbox
+}
+
+// setupTenant - тенант acme: ok - все на месте, dangling - нет оригинала, broken - нет миниатюры,
+// archived - оригинал в архиве, orphan - старые файлы без метаданных, fresh - свежие файлы
+// без метаданных (идет загрузка).
+func setupTenant(t *testing.T) (*collector, gcMocks) {
+	t.Helper()
+
+	m := gcMocks{
+		imgStorage:  mocks.NewImageStorage(t),
+		inventory:   mocks.NewImageInventory(t),
+		metaStorage: mocks.NewMetadataStorage(t),
+		outbox:      mocks.NewOutbox(t),
+	}
+
+	old := time.Now().Add(-2 * time.Hour)
+
+	m.inventory.EXPECT().Tenants(mock.Anything).Return([]string{"acme"}, nil).Once()
+	m.inventory.EXPECT().Images(mock.Anything, "acme").Return([]models.StoredImage{
+		{ID: "ok", ModTime: old},
+		{ID: "broken", ModTime: old},
+		{ID: "orphan", ModTime: old},
+		{ID: "fresh", ModTime: time.Now()},
+	}, nil).Once()
+
+	m.metaStorage.EXPECT().
+		List(mock.Anything, mock.MatchedBy(func(q *models.ImageQuery) bool { return q.TenantID == "acme" })).
+		Return(&models.ImagePage{Items: []*models.ImageMetadata{
+			{ID: "ok", TenantID: "acme", Status: models.StatusCompleted, ThumbnailPath: "t"},
+			{ID: "dangling", TenantID: "acme", Status: models.StatusCompleted, ThumbnailPath: "t"},
+			{ID: "broken", TenantID: "acme", Status: models.StatusCompleted, ThumbnailPath: "t"},
+			{ID: "archived", TenantID: "acme", Status: models.StatusCompleted, Tier: models.TierCold},
+		}}, nil).
+		Once()
+
+	m.imgStorage.EXPECT().Stat(mock.Anything, "acme", "ok", mock.Anything).Return(&models.ObjectInfo{}, nil).Times(2)
+	m.imgStorage.EXPECT().Stat(mock.Anything, "acme", "dangling", "original").Return(nil, errNotFound).Once()
+	m.imgStorage.EXPECT().Stat(mock.Anything, "acme", "broken", "original").Return(&models.ObjectInfo{}, nil).Once()
+	m.imgStorage.EXPECT().Stat(mock.Anything, "acme", "broken", "thumbnail").Return(nil, errNotFound).Once()
+
+	c := New(m.imgStorage, m.inventory, m.metaStorage, m.outbox, []models.Tenant{{ID: "acme"}}, time.Hour)
+	c.tenantIDs = []string{"acme"}
+
+	return c, m
+}
+
+func TestCollector_Run_DryRun(t *testing.T) {
+	c, _ := setupTenant(t)
+
+	report, err := c.Run(context.Background(), false)
+
+	require.NoError(t, err)
+	assert.Equal(t, 4, report.ImagesChecked)
+	assert.Equal(t, 1, report.Count(models.GCOrphanFiles))
+	assert.Equal(t, 1, report.Count(models.GCMissingOriginal))
+	assert.Equal(t, 1, report.Count(models.GCMissingDerivatives))
+	for _, issue := range report.Issues {
+		assert.False(t, issue.Repaired)
+	}
+}
+
+func TestCollector_Run_Repair(t *testing.T) {
+	c, m := setupTenant(t)
+
+	// dangling: метаданные и остатки файлов удаляются.
+	m.metaStorage.EXPECT().Delete(mock.Anything, "acme", "dangling").Return(nil).Once()
+	m.imgStorage.EXPECT().DeleteImage(mock.Anything, "acme", "dangling").Return(nil).Once()
+
+	// broken: производные сбрасываются, изображение уходит на повторную обработку.
+	m.outbox.EXPECT().
+		UpdateWithTask(mock.Anything,
+			mock.MatchedBy(func(meta *models.ImageMetadata) bool {
+				return meta.ID == "broken" && meta.Status == models.StatusPending && meta.ThumbnailPath == ""
+			}),
+			mock.MatchedBy(func(task *models.ProcessingTask) bool {
+				return task.ImageID == "broken" && task.TenantID == "acme" && task.Priority == models.PriorityBulk
+			})).
+		Return(nil).
+		Once()
+
+	// orphan: файлы удаляются после повторной проверки метаданных.
+	m.metaStorage.EXPECT().
+		Get(mock.Anything, "acme", "orphan").
+		Return(nil, errors.New("метаданные изображения не найдены: orphan")).
+		Once()
+	m.imgStorage.EXPECT().DeleteImage(mock.Anything, "acme", "orphan").Return(nil).Once()
+
+	report, err := c.Run(context.Background(), true)
+
+	require.NoError(t, err)
+	require.Len(t, report.Issues, 3)
+	for _, issue := range report.Issues {
+		assert.True(t, issue.Repaired, issue.ImageID)
+	}
+}
+
+func TestCollector_Tenants_Merged(t *testing.T) {
+	inventory := mocks.NewImageInventory(t)
+	inventory.EXPECT().Tenants(mock.Anything).Return([]string{"acme", "removed"}, nil).Once()
+
+	c := New(mocks.NewImageStorage(t), inventory, mocks.NewMetadataStorage(t), mocks.NewOutbox(t),
+		[]models.Tenant{{ID: "acme"}}, time.Hour)
+
+	tenants, err := c.tenants(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"acme", "removed"}, tenants)
+}
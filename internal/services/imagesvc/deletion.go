@@ -0,0 +1,99 @@
+package imagesvc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/sunr3d/image-processor/models"
+)
+
+// maxUpdateAttempts - сколько раз перечитываются метаданные, если их параллельно изменил worker.
+const maxUpdateAttempts = 3
+
+// DeleteImage - удаляет изображение тенанта по его ID. Удаление мягкое: изображение пропадает
+// из чтения и поиска, но restoreWindow его можно восстановить; файлы удаляет фоновая очистка.
+func (is *imageService) DeleteImage(ctx context.Context, tenantID, id string) error {
+	err := is.updateMeta(ctx, tenantID, id, func(meta *models.ImageMetadata) error {
+		if meta.Deleted() {
+			return fmt.Errorf("метаданные изображения не найдены: %s", id)
+		}
+
+		now := time.Now()
+		meta.DeletedAt = now
+		meta.UpdatedAt = now
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("updateMeta: %w", err)
+	}
+
+	zlog.Logger.Info().Msgf("Изображение %s удалено, восстановление возможно в течение %s", id, is.restoreWindow)
+
+	return nil
+}
+
+// RestoreImage - восстанавливает удаленное изображение тенанта, если окно восстановления не истекло.
+func (is *imageService) RestoreImage(ctx context.Context, tenantID, id string) error {
+	err := is.updateMeta(ctx, tenantID, id, func(meta *models.ImageMetadata) error {
+		if !meta.Deleted() {
+			return fmt.Errorf("изображение не удалено: %s", id)
+		}
+		if time.Since(meta.DeletedAt) > is.restoreWindow {
+			return fmt.Errorf("срок восстановления изображения истек: %s", id)
+		}
+
+		meta.DeletedAt = time.Time{}
+		meta.UpdatedAt = time.Now()
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("updateMeta: %w", err)
+	}
+
+	zlog.Logger.Info().Msgf("Изображение %s восстановлено", id)
+
+	return nil
+}
+
+// helpers
+// getActive - получает метаданные изображения; удаленное изображение считается ненайденным.
+func (is *imageService) getActive(ctx context.Context, tenantID, id string) (*models.ImageMetadata, error) {
+	meta, err := is.metaStorage.Get(ctx, tenantID, id)
+	if err != nil {
+		return nil, fmt.Errorf("metaStorage.Get: %w", err)
+	}
+	if meta.Deleted() {
+		return nil, fmt.Errorf("метаданные изображения не найдены: %s", id)
+	}
+
+	return meta, nil
+}
+
+// updateMeta - читает метаданные, применяет к ним mutate и сохраняет. При конфликте версий
+// (метаданные параллельно изменил worker) повторяет попытку на свежей версии.
+func (is *imageService) updateMeta(ctx context.Context, tenantID, id string, mutate func(*models.ImageMetadata) error) error {
+	for attempt := 1; ; attempt++ {
+		meta, err := is.metaStorage.Get(ctx, tenantID, id)
+		if err != nil {
+			return fmt.Errorf("metaStorage.Get: %w", err)
+		}
+
+		if err := mutate(meta); err != nil {
+			return err
+		}
+
+		err = is.metaStorage.Update(ctx, meta)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, models.ErrVersionConflict) || attempt == maxUpdateAttempts {
+			return fmt.Errorf("metaStorage.Update: %w", err)
+		}
+	}
+}
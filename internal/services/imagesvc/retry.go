@@ -0,0 +1,68 @@
+package imagesvc
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/sunr3d/image-processor/models"
+)
+
+// RetryImage - ставит изображение тенанта, обработка которого завершилась ошибкой, на повторную
+// обработку. Архивный оригинал сначала возвращается из холодного хранилища.
+func (is *imageService) RetryImage(ctx context.Context, tenantID, id string) error {
+	meta, err := is.getActive(ctx, tenantID, id)
+	if err != nil {
+		return fmt.Errorf("getActive: %w", err)
+	}
+
+	if meta.Status != models.StatusFailed {
+		return fmt.Errorf("изображение не в статусе failed: %s (статус %s)", id, meta.Status)
+	}
+
+	if meta.Tier == models.TierCold {
+		if err := is.restore(ctx, meta); err != nil {
+			return fmt.Errorf("restore: %w", err)
+		}
+		return nil
+	}
+
+	meta.Status = models.StatusPending
+	meta.Attempts = 0
+	meta.ErrorMessage = ""
+	meta.UpdatedAt = time.Now()
+
+	task := &models.ProcessingTask{
+		TenantID:      meta.TenantID,
+		ImageID:       meta.ID,
+		OriginalPath:  meta.OriginalPath,
+		Priority:      meta.Priority,
+		CorrelationID: models.CorrelationIDFromContext(ctx),
+	}
+	meta.CorrelationID = task.CorrelationID
+	if err := is.outbox.UpdateWithTask(ctx, meta, task); err != nil {
+		return fmt.Errorf("outbox.UpdateWithTask: %w", err)
+	}
+
+	zlog.Logger.Info().Msgf("Изображение %s поставлено в очередь на повторную обработку", id)
+
+	return nil
+}
+
+// ReplayDeadLetters - возвращает до limit задач из очереди необработанных задач в основную очередь.
+func (is *imageService) ReplayDeadLetters(ctx context.Context, limit int) (int, error) {
+	if is.deadLetters == nil {
+		return 0, fmt.Errorf("очередь необработанных задач не настроена")
+	}
+
+	replayed, err := is.deadLetters.Replay(ctx, limit)
+	if err != nil {
+		return replayed, fmt.Errorf("deadLetters.Replay: %w", err)
+	}
+
+	zlog.Logger.Info().Msgf("Из очереди необработанных задач возвращено задач: %d", replayed)
+
+	return replayed, nil
+}
@@ -2,9 +2,13 @@ package imagesvc
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"mime/multipart"
-	"os"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
 	"time"
 
 	"github.com/google/uuid"
@@ -19,106 +23,275 @@ import (
 var _ services.ImageService = (*imageService)(nil)
 
 type imageService struct {
-	imgStorage  infra.ImageStorage
-	metaStorage infra.MetadataStorage
-	publisher   infra.Publisher
+	imgStorage    infra.ImageStorage
+	metaStorage   infra.MetadataStorage
+	outbox        infra.Outbox
+	tenants       map[string]models.Tenant
+	presignTTL    time.Duration
+	coldStorage   infra.ColdStorage
+	restoreWindow time.Duration
+	deadLetters   infra.DeadLetterQueue
 }
 
 // New - конструктор imageService.
-func New(imgStorage infra.ImageStorage, metaStorage infra.MetadataStorage, publisher infra.Publisher) *imageService {
+// presignTTL > 0 включает отдачу изображений редиректом на подписанную ссылку хранилища,
+// если хранилище их поддерживает; иначе байты проксируются через сервис.
+// coldStorage - холодный уровень для восстановления архивных оригиналов (nil - без архива).
+// restoreWindow - сколько удаленное изображение можно восстановить до окончательного удаления.
+// Задачи на обработку записываются в outbox вместе с метаданными и публикуются relay.
+// deadLetters - очередь необработанных задач для повтора администратором (nil - не настроена).
+func New(
+	imgStorage infra.ImageStorage,
+	metaStorage infra.MetadataStorage,
+	outbox infra.Outbox,
+	tenants []models.Tenant,
+	presignTTL time.Duration,
+	coldStorage infra.ColdStorage,
+	restoreWindow time.Duration,
+	deadLetters infra.DeadLetterQueue,
+) *imageService {
+	byID := make(map[string]models.Tenant, len(tenants))
+	for _, t := range tenants {
+		byID[t.ID] = t
+	}
+
 	return &imageService{
-		imgStorage:  imgStorage,
-		metaStorage: metaStorage,
-		publisher:   publisher,
+		imgStorage:    imgStorage,
+		metaStorage:   metaStorage,
+		outbox:        outbox,
+		tenants:       byID,
+		presignTTL:    presignTTL,
+		coldStorage:   coldStorage,
+		restoreWindow: restoreWindow,
+		deadLetters:   deadLetters,
 	}
 }
 
-// UploadImage - загружает оригинальное изображение, сохраняет метаданные и передает задачу на обработку в брокер.
-func (is *imageService) UploadImage(ctx context.Context, file multipart.File, filename string) (string, error) {
+// UploadImage - загружает оригинальное изображение тенанта и сохраняет метаданные вместе с задачей
+// на обработку в outbox. Недоступность брокера не мешает загрузке: задачу опубликует relay.
+func (is *imageService) UploadImage(ctx context.Context, tenantID string, file io.ReadSeeker, filename string, opts models.UploadOptions) (string, error) {
+	size, err := fileSize(file)
+	if err != nil {
+		return "", fmt.Errorf("fileSize: %w", err)
+	}
+
+	if err := is.checkQuota(ctx, tenantID, size); err != nil {
+		return "", fmt.Errorf("checkQuota: %w", err)
+	}
+
+	imgCfg, format, err := probeImage(file)
+	if err != nil {
+		zlog.Logger.Warn().Err(err).Msgf("Не удалось определить формат и размеры изображения: %s", filename)
+	}
+
 	id := uuid.New().String()
+	now := time.Now()
 
-	zlog.Logger.Info().Msgf("Начало загрузки изображения: %s (ID: %s)", filename, id)
+	zlog.Logger.Info().Msgf("Начало загрузки изображения: %s (ID: %s, тенант: %s)", filename, id, tenantID)
 
-	path, err := is.imgStorage.SaveOriginal(ctx, id, file, filename)
+	path, err := is.imgStorage.SaveOriginal(ctx, tenantID, id, file, size)
 	if err != nil {
 		return "", fmt.Errorf("imgStorage.SaveOriginal: %w", err)
 	}
 
 	meta := &models.ImageMetadata{
 		ID:           id,
+		TenantID:     tenantID,
 		OriginalName: filename,
 		OriginalPath: path,
+		OriginalSize: size,
+		Format:       format,
+		Width:        imgCfg.Width,
+		Height:       imgCfg.Height,
+		Tags:         opts.Tags,
+		Tier:         models.TierHot,
 		Status:       models.StatusPending,
-		CreatedAt:    time.Now(),
-		UpdatedAt:    time.Now(),
-	}
-
-	if err := is.metaStorage.Save(ctx, meta); err != nil {
-		return "", fmt.Errorf("metaStorage.Save: %w", err)
+		CreatedAt:    now,
+		UpdatedAt:    now,
+		AccessedAt:   now,
+		ExpiresAt:    is.expiresAt(tenantID, opts.TTL, now),
 	}
 
 	task := &models.ProcessingTask{
-		ImageID:      id,
-		OriginalPath: path,
+		TenantID:      tenantID,
+		ImageID:       id,
+		OriginalPath:  path,
+		Priority:      opts.Priority,
+		CorrelationID: models.CorrelationIDFromContext(ctx),
 	}
+	meta.Priority = task.Priority
+	meta.CorrelationID = task.CorrelationID
 
-	if err := is.publisher.Publish(ctx, task); err != nil {
-		return "", fmt.Errorf("broker.Publish: %w", err)
+	// Квота проверяется повторно атомарно с записью: параллельные загрузки могли пройти checkQuota.
+	if err := is.outbox.SaveWithTask(ctx, meta, task, is.tenants[tenantID].Quota()); err != nil {
+		if errors.Is(err, models.ErrQuotaExceeded) {
+			if delErr := is.imgStorage.DeleteImage(ctx, tenantID, id); delErr != nil {
+				zlog.Logger.Warn().Err(delErr).Msgf("Не удалось удалить оригинал изображения %s сверх квоты", id)
+			}
+		}
+		return "", fmt.Errorf("outbox.SaveWithTask: %w", err)
 	}
 
-	zlog.Logger.Info().Msgf("Изображение %s успешно загружено и передано на обработку", id)
+	zlog.Logger.Info().Msgf("Изображение %s успешно загружено и поставлено в очередь на обработку", id)
 
 	return id, nil
 }
 
-// GetImage - получает путь к изображению по его ID и типу.
-func (is *imageService) GetImage(ctx context.Context, id, imageType string) (string, error) {
-	meta, err := is.metaStorage.Get(ctx, id)
+// GetImage - получает изображение тенанта по его ID и типу: поток байт или подписанную ссылку.
+func (is *imageService) GetImage(ctx context.Context, tenantID, id, imageType string) (*models.ImageContent, error) {
+	meta, err := is.getActive(ctx, tenantID, id)
 	if err != nil {
-		return "", fmt.Errorf("metaStorage.Get: %w", err)
+		return nil, fmt.Errorf("getActive: %w", err)
+	}
+
+	if meta.Tier == models.TierCold {
+		if err := is.restore(ctx, meta); err != nil {
+			return nil, fmt.Errorf("restore: %w", err)
+		}
 	}
 
 	if imageType != "original" && meta.Status != models.StatusCompleted {
-		return "", fmt.Errorf("изображение еще не обработано, статус: %s", meta.Status)
+		return nil, fmt.Errorf("изображение еще не обработано, статус: %s", meta.Status)
+	}
+
+	is.touch(ctx, meta)
+
+	if is.presignTTL > 0 {
+		url, err := is.imgStorage.PresignURL(ctx, tenantID, id, imageType, is.presignTTL)
+		if err == nil {
+			return &models.ImageContent{RedirectURL: url}, nil
+		}
+		if !errors.Is(err, models.ErrPresignNotSupported) {
+			return nil, fmt.Errorf("imgStorage.PresignURL: %w", err)
+		}
 	}
 
-	path, err := is.imgStorage.GetPath(id, imageType)
+	body, info, err := is.imgStorage.Open(ctx, tenantID, id, imageType)
 	if err != nil {
-		return "", fmt.Errorf("imgStorage.GetPath: %w", err)
+		return nil, fmt.Errorf("imgStorage.Open: %w", err)
 	}
 
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		return "", fmt.Errorf("изображение не найдено: %s", path)
+	return &models.ImageContent{
+		Body:        body,
+		ContentType: contentType(meta, imageType),
+		Size:        info.Size,
+		ModTime:     info.ModTime,
+	}, nil
+}
+
+func (is *imageService) GetImgMeta(ctx context.Context, tenantID, id string) (*models.ImageMetadata, error) {
+	meta, err := is.getActive(ctx, tenantID, id)
+	if err != nil {
+		return nil, fmt.Errorf("getActive: %w", err)
 	}
 
-	return path, nil
+	return meta, nil
 }
 
-// DeleteImage - удаляет изображение по его ID.
-func (is *imageService) DeleteImage(ctx context.Context, id string) error {
-	if _, err := is.metaStorage.Get(ctx, id); err != nil {
-		return fmt.Errorf("metaStorage.Get: %w", err)
+// GetUsage - возвращает использование хранилища тенантом вместе с его квотами.
+func (is *imageService) GetUsage(ctx context.Context, tenantID string) (*models.TenantUsage, error) {
+	usage, err := is.metaStorage.Usage(ctx, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("metaStorage.Usage: %w", err)
 	}
 
-	if err := is.metaStorage.Delete(ctx, id); err != nil {
-		return fmt.Errorf("metaStorage.Delete: %w", err)
+	tenant := is.tenants[tenantID]
+	usage.MaxImages = tenant.MaxImages
+	usage.MaxBytes = tenant.MaxBytes
+
+	return usage, nil
+}
+
+// ListImages - ищет изображения тенанта с фильтрами, сортировкой и пагинацией по курсору.
+func (is *imageService) ListImages(ctx context.Context, tenantID string, query *models.ImageQuery) (*models.ImagePage, error) {
+	query.TenantID = tenantID
+
+	if query.Limit <= 0 {
+		query.Limit = models.DefaultPageLimit
 	}
+	query.Limit = min(query.Limit, models.MaxPageLimit)
 
-	if err := is.imgStorage.DeleteImage(ctx, id); err != nil {
-		zlog.Logger.Warn().Err(err).Msgf("Ошибка удаления файлов для: %s", id)
+	switch query.SortBy {
+	case "":
+		query.SortBy = models.SortByCreatedAt
+	case models.SortByCreatedAt, models.SortByName, models.SortBySize:
+	default:
+		return nil, fmt.Errorf("некорректное поле сортировки: %s", query.SortBy)
+	}
+
+	page, err := is.metaStorage.List(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("metaStorage.List: %w", err)
+	}
+
+	return page, nil
+}
+
+// helpers
+// checkQuota - предварительная проверка квоты до сохранения оригинала, чтобы не загружать
+// изображение, которое заведомо не поместится.
+func (is *imageService) checkQuota(ctx context.Context, tenantID string, size int64) error {
+	quota := is.tenants[tenantID].Quota()
+	if quota.Unlimited() {
 		return nil
 	}
 
-	zlog.Logger.Info().Msgf("Изображение %s и его метаданные успешно удалены", id)
+	usage, err := is.metaStorage.Usage(ctx, tenantID)
+	if err != nil {
+		return fmt.Errorf("metaStorage.Usage: %w", err)
+	}
+
+	return quota.Check(usage, size)
+}
 
-	return nil
+// expiresAt - момент истечения срока хранения: TTL загрузки, иначе срок по умолчанию тенанта.
+// Нулевое время означает бессрочное хранение.
+func (is *imageService) expiresAt(tenantID string, ttl time.Duration, now time.Time) time.Time {
+	if ttl <= 0 {
+		ttl = is.tenants[tenantID].DefaultTTL
+	}
+	if ttl <= 0 {
+		return time.Time{}
+	}
+
+	return now.Add(ttl)
 }
 
-func (is *imageService) GetImgMeta(ctx context.Context, id string) (*models.ImageMetadata, error) {
-	meta, err := is.metaStorage.Get(ctx, id)
+// probeImage - читает заголовок изображения, чтобы определить формат и размеры, и возвращает файл в начало.
+func probeImage(file io.ReadSeeker) (image.Config, string, error) {
+	cfg, format, decodeErr := image.DecodeConfig(file)
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return image.Config{}, "", fmt.Errorf("file.Seek: %w", err)
+	}
+
+	if decodeErr != nil {
+		return image.Config{}, "", fmt.Errorf("image.DecodeConfig: %w", decodeErr)
+	}
+
+	return cfg, format, nil
+}
+
+func fileSize(file io.ReadSeeker) (int64, error) {
+	size, err := file.Seek(0, io.SeekEnd)
 	if err != nil {
-		return nil, fmt.Errorf("metaStorage.Get: %w", err)
+		return 0, fmt.Errorf("file.Seek: %w", err)
 	}
 
-	return meta, nil
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("file.Seek: %w", err)
+	}
+
+	return size, nil
+}
+
+// contentType - обработанные версии всегда JPEG, у оригинала берется распознанный при загрузке формат.
+func contentType(meta *models.ImageMetadata, imageType string) string {
+	if imageType != "original" {
+		return "image/jpeg"
+	}
+	if meta.Format == "" {
+		return "application/octet-stream"
+	}
+	return "image/" + meta.Format
 }
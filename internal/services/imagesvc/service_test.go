@@ -3,11 +3,15 @@ package imagesvc
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 
 	"github.com/sunr3d/image-processor/mocks"
 	"github.com/sunr3d/image-processor/models"
@@ -18,81 +22,473 @@ func TestImageService_UploadImage_OK(t *testing.T) {
 	ctx := context.Background()
 	imgStorage := mocks.NewImageStorage(t)
 	metaStorage := mocks.NewMetadataStorage(t)
-	publisher := mocks.NewPublisher(t)
+	outbox := mocks.NewOutbox(t)
 
 	imgStorage.EXPECT().
-		SaveOriginal(ctx, mock.AnythingOfType("string"), mock.Anything, "test.jpg").
+		SaveOriginal(ctx, models.DefaultTenantID, mock.AnythingOfType("string"), mock.Anything, int64(18)).
 		Return("/path/to/original", nil).
 		Once()
 
-	metaStorage.EXPECT().
-		Save(ctx, mock.AnythingOfType("*models.ImageMetadata")).
-		Return(nil).
-		Once()
-
-	publisher.EXPECT().
-		Publish(ctx, mock.AnythingOfType("*models.ProcessingTask")).
+	outbox.EXPECT().
+		SaveWithTask(ctx,
+			mock.MatchedBy(func(m *models.ImageMetadata) bool { return m.Status == models.StatusPending }),
+			mock.MatchedBy(func(task *models.ProcessingTask) bool { return task.OriginalPath == "/path/to/original" }),
+			models.Quota{}).
 		Return(nil).
 		Once()
 
-	svc := New(imgStorage, metaStorage, publisher)
+	svc := New(imgStorage, metaStorage, outbox, nil, 0, nil, time.Hour, nil)
 
 	content := []byte("test image content")
 	reader := bytes.NewReader(content)
 	file := &mockMultipartFile{reader: reader, filename: "test.jpg"}
 
-	id, err := svc.UploadImage(ctx, file, "test.jpg")
+	id, err := svc.UploadImage(ctx, models.DefaultTenantID, file, "test.jpg", models.UploadOptions{})
 
 	assert.NoError(t, err)
 	assert.NotEmpty(t, id)
 }
 
+func TestImageService_UploadImage_Priority(t *testing.T) {
+	ctx := context.Background()
+	imgStorage := mocks.NewImageStorage(t)
+	metaStorage := mocks.NewMetadataStorage(t)
+	outbox := mocks.NewOutbox(t)
+
+	imgStorage.EXPECT().
+		SaveOriginal(ctx, models.DefaultTenantID, mock.AnythingOfType("string"), mock.Anything, int64(18)).
+		Return("/path/to/original", nil).
+		Once()
+
+	outbox.EXPECT().
+		SaveWithTask(ctx,
+			mock.MatchedBy(func(m *models.ImageMetadata) bool { return m.Priority == models.PriorityBulk }),
+			mock.MatchedBy(func(task *models.ProcessingTask) bool { return task.Priority == models.PriorityBulk }),
+			models.Quota{}).
+		Return(nil).
+		Once()
+
+	svc := New(imgStorage, metaStorage, outbox, nil, 0, nil, time.Hour, nil)
+
+	file := &mockMultipartFile{reader: bytes.NewReader([]byte("test image content")), filename: "test.jpg"}
+
+	_, err := svc.UploadImage(ctx, models.DefaultTenantID, file, "test.jpg", models.UploadOptions{Priority: models.PriorityBulk})
+
+	assert.NoError(t, err)
+}
+
+func TestImageService_UploadImage_TTL(t *testing.T) {
+	tests := []struct {
+		name string
+		ttl  time.Duration
+		want time.Duration
+	}{
+		{name: "upload ttl", ttl: time.Hour, want: time.Hour},
+		{name: "tenant default", want: 72 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			imgStorage := mocks.NewImageStorage(t)
+			metaStorage := mocks.NewMetadataStorage(t)
+			outbox := mocks.NewOutbox(t)
+
+			imgStorage.EXPECT().
+				SaveOriginal(ctx, "acme", mock.AnythingOfType("string"), mock.Anything, int64(4)).
+				Return("/path/to/original", nil).
+				Once()
+
+			outbox.EXPECT().
+				SaveWithTask(ctx, mock.MatchedBy(func(m *models.ImageMetadata) bool {
+					return m.ExpiresAt.Sub(m.CreatedAt) == tt.want
+				}), mock.AnythingOfType("*models.ProcessingTask"), models.Quota{}).
+				Return(nil).
+				Once()
+
+			tenants := []models.Tenant{{ID: "acme", APIKey: "key", DefaultTTL: 72 * time.Hour}}
+			svc := New(imgStorage, metaStorage, outbox, tenants, 0, nil, time.Hour, nil)
+
+			_, err := svc.UploadImage(ctx, "acme", bytes.NewReader([]byte("test")), "preview.png", models.UploadOptions{TTL: tt.ttl})
+
+			assert.NoError(t, err)
+		})
+	}
+}
+
 func TestImageService_UploadImage_Error(t *testing.T) {
 	ctx := context.Background()
 	imgStorage := mocks.NewImageStorage(t)
 	metaStorage := mocks.NewMetadataStorage(t)
-	publisher := mocks.NewPublisher(t)
+	outbox := mocks.NewOutbox(t)
 
 	imgStorage.EXPECT().
-		SaveOriginal(ctx, mock.AnythingOfType("string"), mock.Anything, "test.jpg").
+		SaveOriginal(ctx, models.DefaultTenantID, mock.AnythingOfType("string"), mock.Anything, int64(18)).
 		Return("", assert.AnError).
 		Once()
 
-	svc := New(imgStorage, metaStorage, publisher)
+	svc := New(imgStorage, metaStorage, outbox, nil, 0, nil, time.Hour, nil)
 
 	content := []byte("test image content")
 	reader := bytes.NewReader(content)
 	file := &mockMultipartFile{reader: reader, filename: "test.jpg"}
 
-	id, err := svc.UploadImage(ctx, file, "test.jpg")
+	id, err := svc.UploadImage(ctx, models.DefaultTenantID, file, "test.jpg", models.UploadOptions{})
 
 	assert.Error(t, err)
 	assert.Empty(t, id)
 }
 
+func TestImageService_UploadImage_QuotaExceeded(t *testing.T) {
+	ctx := context.Background()
+	imgStorage := mocks.NewImageStorage(t)
+	metaStorage := mocks.NewMetadataStorage(t)
+	outbox := mocks.NewOutbox(t)
+
+	metaStorage.EXPECT().
+		Usage(ctx, "acme").
+		Return(&models.TenantUsage{TenantID: "acme", OriginalsCount: 2}, nil).
+		Once()
+
+	tenants := []models.Tenant{{ID: "acme", APIKey: "key", MaxImages: 2}}
+	svc := New(imgStorage, metaStorage, outbox, tenants, 0, nil, time.Hour, nil)
+
+	file := &mockMultipartFile{reader: bytes.NewReader([]byte("test image content")), filename: "test.jpg"}
+
+	id, err := svc.UploadImage(ctx, "acme", file, "test.jpg", models.UploadOptions{})
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "превышена квота")
+	assert.Empty(t, id)
+}
+
+func TestImageService_UploadImage_BytesQuotaExceeded(t *testing.T) {
+	ctx := context.Background()
+	imgStorage := mocks.NewImageStorage(t)
+	metaStorage := mocks.NewMetadataStorage(t)
+	outbox := mocks.NewOutbox(t)
+
+	metaStorage.EXPECT().
+		Usage(ctx, "acme").
+		Return(&models.TenantUsage{TenantID: "acme", OriginalsBytes: 60, DerivativesBytes: 30}, nil).
+		Once()
+
+	tenants := []models.Tenant{{ID: "acme", APIKey: "key", MaxBytes: 100}}
+	svc := New(imgStorage, metaStorage, outbox, tenants, 0, nil, time.Hour, nil)
+
+	file := &mockMultipartFile{reader: bytes.NewReader([]byte("test image content")), filename: "test.jpg"}
+
+	id, err := svc.UploadImage(ctx, "acme", file, "test.jpg", models.UploadOptions{})
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "байт")
+	assert.Empty(t, id)
+}
+
+func TestImageService_UploadImage_QuotaExceededOnSave(t *testing.T) {
+	ctx := context.Background()
+	imgStorage := mocks.NewImageStorage(t)
+	metaStorage := mocks.NewMetadataStorage(t)
+	outbox := mocks.NewOutbox(t)
+
+	// Предварительная проверка проходит, но параллельная загрузка успела занять квоту.
+	metaStorage.EXPECT().
+		Usage(ctx, "acme").
+		Return(&models.TenantUsage{TenantID: "acme", OriginalsCount: 1}, nil).
+		Once()
+
+	imgStorage.EXPECT().
+		SaveOriginal(ctx, "acme", mock.AnythingOfType("string"), mock.Anything, int64(18)).
+		Return("/path/to/original", nil).
+		Once()
+
+	outbox.EXPECT().
+		SaveWithTask(ctx, mock.Anything, mock.Anything, models.Quota{MaxImages: 2}).
+		Return(fmt.Errorf("%w тенанта acme: 2 из 2 изображений", models.ErrQuotaExceeded)).
+		Once()
+
+	imgStorage.EXPECT().
+		DeleteImage(ctx, "acme", mock.AnythingOfType("string")).
+		Return(nil).
+		Once()
+
+	tenants := []models.Tenant{{ID: "acme", APIKey: "key", MaxImages: 2}}
+	svc := New(imgStorage, metaStorage, outbox, tenants, 0, nil, time.Hour, nil)
+
+	file := &mockMultipartFile{reader: bytes.NewReader([]byte("test image content")), filename: "test.jpg"}
+
+	id, err := svc.UploadImage(ctx, "acme", file, "test.jpg", models.UploadOptions{})
+
+	assert.ErrorIs(t, err, models.ErrQuotaExceeded)
+	assert.Empty(t, id)
+}
+
+// GetUsage tests.
+func TestImageService_GetUsage_OK(t *testing.T) {
+	ctx := context.Background()
+	imgStorage := mocks.NewImageStorage(t)
+	metaStorage := mocks.NewMetadataStorage(t)
+	outbox := mocks.NewOutbox(t)
+
+	metaStorage.EXPECT().
+		Usage(ctx, "acme").
+		Return(&models.TenantUsage{TenantID: "acme", OriginalsCount: 1, OriginalsBytes: 10}, nil).
+		Once()
+
+	tenants := []models.Tenant{{ID: "acme", APIKey: "key", MaxImages: 5, MaxBytes: 1000}}
+	svc := New(imgStorage, metaStorage, outbox, tenants, 0, nil, time.Hour, nil)
+
+	usage, err := svc.GetUsage(ctx, "acme")
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, usage.OriginalsCount)
+	assert.Equal(t, 5, usage.MaxImages)
+	assert.Equal(t, int64(1000), usage.MaxBytes)
+}
+
 // GetImage tests.
 func TestImageService_GetImage_OK(t *testing.T) {
 	ctx := context.Background()
 	imgStorage := mocks.NewImageStorage(t)
 	metaStorage := mocks.NewMetadataStorage(t)
-	publisher := mocks.NewPublisher(t)
+	outbox := mocks.NewOutbox(t)
+
+	metaStorage.EXPECT().
+		Get(ctx, models.DefaultTenantID, "test-id").
+		Return(&models.ImageMetadata{ID: "test-id", TenantID: models.DefaultTenantID, Format: "png"}, nil).
+		Once()
+
+	imgStorage.EXPECT().
+		Open(ctx, models.DefaultTenantID, "test-id", "original").
+		Return(nopSeekCloser{bytes.NewReader([]byte("test image content"))}, &models.ObjectInfo{Size: 18}, nil).
+		Once()
+
+	svc := New(imgStorage, metaStorage, outbox, nil, 0, nil, time.Hour, nil)
+
+	content, err := svc.GetImage(ctx, models.DefaultTenantID, "test-id", "original")
+
+	require.NoError(t, err)
+	defer content.Body.Close()
+	assert.Equal(t, "image/png", content.ContentType)
+	assert.Equal(t, int64(18), content.Size)
+	assert.Empty(t, content.RedirectURL)
+
+	data, err := io.ReadAll(content.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "test image content", string(data))
+}
+
+func TestImageService_GetImage_Presigned(t *testing.T) {
+	ctx := context.Background()
+	imgStorage := mocks.NewImageStorage(t)
+	metaStorage := mocks.NewMetadataStorage(t)
+	outbox := mocks.NewOutbox(t)
+
+	metaStorage.EXPECT().
+		Get(ctx, models.DefaultTenantID, "test-id").
+		Return(&models.ImageMetadata{ID: "test-id", TenantID: models.DefaultTenantID, Status: models.StatusCompleted}, nil).
+		Once()
+
+	imgStorage.EXPECT().
+		PresignURL(ctx, models.DefaultTenantID, "test-id", "thumbnail", time.Minute).
+		Return("https://s3.example.com/signed", nil).
+		Once()
+
+	svc := New(imgStorage, metaStorage, outbox, nil, time.Minute, nil, time.Hour, nil)
+
+	content, err := svc.GetImage(ctx, models.DefaultTenantID, "test-id", "thumbnail")
+
+	require.NoError(t, err)
+	assert.Equal(t, "https://s3.example.com/signed", content.RedirectURL)
+	assert.Nil(t, content.Body)
+}
+
+func TestImageService_GetImage_PresignNotSupported(t *testing.T) {
+	ctx := context.Background()
+	imgStorage := mocks.NewImageStorage(t)
+	metaStorage := mocks.NewMetadataStorage(t)
+	outbox := mocks.NewOutbox(t)
+
+	metaStorage.EXPECT().
+		Get(ctx, models.DefaultTenantID, "test-id").
+		Return(&models.ImageMetadata{ID: "test-id", TenantID: models.DefaultTenantID, Status: models.StatusCompleted}, nil).
+		Once()
+
+	imgStorage.EXPECT().
+		PresignURL(ctx, models.DefaultTenantID, "test-id", "thumbnail", time.Minute).
+		Return("", models.ErrPresignNotSupported).
+		Once()
+
+	imgStorage.EXPECT().
+		Open(ctx, models.DefaultTenantID, "test-id", "thumbnail").
+		Return(nopSeekCloser{bytes.NewReader([]byte("thumb"))}, &models.ObjectInfo{Size: 5}, nil).
+		Once()
+
+	svc := New(imgStorage, metaStorage, outbox, nil, time.Minute, nil, time.Hour, nil)
+
+	content, err := svc.GetImage(ctx, models.DefaultTenantID, "test-id", "thumbnail")
+
+	require.NoError(t, err)
+	assert.Equal(t, "image/jpeg", content.ContentType)
+	assert.NotNil(t, content.Body)
+}
+
+func TestImageService_GetImage_OtherTenant(t *testing.T) {
+	ctx := context.Background()
+	imgStorage := mocks.NewImageStorage(t)
+	metaStorage := mocks.NewMetadataStorage(t)
+	outbox := mocks.NewOutbox(t)
 
 	metaStorage.EXPECT().
-		Get(ctx, "test-id").
-		Return(&models.ImageMetadata{ID: "test-id"}, nil).
+		Get(ctx, "beta", "test-id").
+		Return(nil, errors.New("метаданные изображения не найдены: test-id")).
+		Once()
+
+	svc := New(imgStorage, metaStorage, outbox, nil, 0, nil, time.Hour, nil)
+
+	content, err := svc.GetImage(ctx, "beta", "test-id", "original")
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "не найдены")
+	assert.Nil(t, content)
+}
+
+func TestImageService_GetImage_RestoresCold(t *testing.T) {
+	ctx := context.Background()
+	imgStorage := mocks.NewImageStorage(t)
+	metaStorage := mocks.NewMetadataStorage(t)
+	outbox := mocks.NewOutbox(t)
+	coldStorage := mocks.NewColdStorage(t)
+
+	metaStorage.EXPECT().
+		Get(ctx, "acme", "test-id").
+		Return(&models.ImageMetadata{
+			ID:       "test-id",
+			TenantID: "acme",
+			Status:   models.StatusCompleted,
+			Tier:     models.TierCold,
+			Priority: models.PriorityBulk,
+		}, nil).
+		Once()
+
+	coldStorage.EXPECT().
+		Restore(ctx, "acme", "test-id").
+		Return(nil).
+		Once()
+
+	outbox.EXPECT().
+		UpdateWithTask(ctx,
+			mock.MatchedBy(func(m *models.ImageMetadata) bool {
+				return m.Tier == models.TierHot && m.Status == models.StatusPending && m.Priority == models.PriorityBulk
+			}),
+			mock.MatchedBy(func(task *models.ProcessingTask) bool {
+				// Восстановленное изображение обрабатывается с прежним приоритетом.
+				return task.TenantID == "acme" && task.ImageID == "test-id" && task.Priority == models.PriorityBulk
+			})).
+		Return(nil).
+		Once()
+
+	svc := New(imgStorage, metaStorage, outbox, nil, 0, coldStorage, time.Hour, nil)
+
+	content, err := svc.GetImage(ctx, "acme", "test-id", "thumbnail")
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "еще не обработано")
+	assert.Nil(t, content)
+}
+
+func TestImageService_GetImage_TouchesStale(t *testing.T) {
+	ctx := context.Background()
+	imgStorage := mocks.NewImageStorage(t)
+	metaStorage := mocks.NewMetadataStorage(t)
+	outbox := mocks.NewOutbox(t)
+	coldStorage := mocks.NewColdStorage(t)
+
+	metaStorage.EXPECT().
+		Get(ctx, "acme", "test-id").
+		Return(&models.ImageMetadata{
+			ID:        "test-id",
+			TenantID:  "acme",
+			Status:    models.StatusCompleted,
+			Tier:      models.TierHot,
+			CreatedAt: time.Now().Add(-48 * time.Hour),
+		}, nil).
+		Once()
+
+	metaStorage.EXPECT().
+		Update(ctx, mock.MatchedBy(func(m *models.ImageMetadata) bool {
+			return time.Since(m.AccessedAt) < time.Minute
+		})).
+		Return(nil).
 		Once()
 
 	imgStorage.EXPECT().
-		GetPath("test-id", "original").
-		Return("/path/to/image", nil).
+		Open(ctx, "acme", "test-id", "thumbnail").
+		Return(nopSeekCloser{bytes.NewReader([]byte("thumb"))}, &models.ObjectInfo{Size: 5}, nil).
+		Once()
+
+	svc := New(imgStorage, metaStorage, outbox, nil, 0, coldStorage, time.Hour, nil)
+
+	content, err := svc.GetImage(ctx, "acme", "test-id", "thumbnail")
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), content.Size)
+}
+
+// ListImages tests.
+func TestImageService_ListImages_Defaults(t *testing.T) {
+	ctx := context.Background()
+	imgStorage := mocks.NewImageStorage(t)
+	metaStorage := mocks.NewMetadataStorage(t)
+	outbox := mocks.NewOutbox(t)
+
+	metaStorage.EXPECT().
+		List(ctx, mock.MatchedBy(func(q *models.ImageQuery) bool {
+			return q.TenantID == "acme" && q.Limit == models.DefaultPageLimit && q.SortBy == models.SortByCreatedAt
+		})).
+		Return(&models.ImagePage{Items: []*models.ImageMetadata{{ID: "test-id", TenantID: "acme"}}}, nil).
+		Once()
+
+	svc := New(imgStorage, metaStorage, outbox, nil, 0, nil, time.Hour, nil)
+
+	page, err := svc.ListImages(ctx, "acme", &models.ImageQuery{TenantID: "beta"})
+
+	require.NoError(t, err)
+	assert.Len(t, page.Items, 1)
+}
+
+func TestImageService_ListImages_LimitClamped(t *testing.T) {
+	ctx := context.Background()
+	imgStorage := mocks.NewImageStorage(t)
+	metaStorage := mocks.NewMetadataStorage(t)
+	outbox := mocks.NewOutbox(t)
+
+	metaStorage.EXPECT().
+		List(ctx, mock.MatchedBy(func(q *models.ImageQuery) bool {
+			return q.Limit == models.MaxPageLimit
+		})).
+		Return(&models.ImagePage{}, nil).
 		Once()
 
-	svc := New(imgStorage, metaStorage, publisher)
+	svc := New(imgStorage, metaStorage, outbox, nil, 0, nil, time.Hour, nil)
 
-	path, err := svc.GetImage(ctx, "test-id", "original")
+	_, err := svc.ListImages(ctx, "acme", &models.ImageQuery{Limit: 10000})
 
 	assert.NoError(t, err)
-	assert.Equal(t, "/path/to/image", path)
+}
+
+func TestImageService_ListImages_InvalidSort(t *testing.T) {
+	ctx := context.Background()
+	imgStorage := mocks.NewImageStorage(t)
+	metaStorage := mocks.NewMetadataStorage(t)
+	outbox := mocks.NewOutbox(t)
+
+	svc := New(imgStorage, metaStorage, outbox, nil, 0, nil, time.Hour, nil)
+
+	page, err := svc.ListImages(ctx, "acme", &models.ImageQuery{SortBy: "color"})
+
+	assert.Error(t, err)
+	assert.Nil(t, page)
 }
 
 // DeleteImage tests.
@@ -100,30 +496,219 @@ func TestImageService_DeleteImage_OK(t *testing.T) {
 	ctx := context.Background()
 	imgStorage := mocks.NewImageStorage(t)
 	metaStorage := mocks.NewMetadataStorage(t)
-	publisher := mocks.NewPublisher(t)
+	outbox := mocks.NewOutbox(t)
 
 	metaStorage.EXPECT().
-		Get(ctx, "test-id").
-		Return(&models.ImageMetadata{ID: "test-id"}, nil).
+		Get(ctx, models.DefaultTenantID, "test-id").
+		Return(&models.ImageMetadata{ID: "test-id", TenantID: models.DefaultTenantID}, nil).
 		Once()
 
-	imgStorage.EXPECT().
-		DeleteImage(ctx, "test-id").
+	metaStorage.EXPECT().
+		Update(ctx, mock.MatchedBy(func(m *models.ImageMetadata) bool { return m.Deleted() })).
 		Return(nil).
 		Once()
 
+	svc := New(imgStorage, metaStorage, outbox, nil, 0, nil, time.Hour, nil)
+
+	err := svc.DeleteImage(ctx, models.DefaultTenantID, "test-id")
+
+	assert.NoError(t, err)
+}
+
+func TestImageService_DeleteImage_RetryOnConflict(t *testing.T) {
+	ctx := context.Background()
+	imgStorage := mocks.NewImageStorage(t)
+	metaStorage := mocks.NewMetadataStorage(t)
+	outbox := mocks.NewOutbox(t)
+
 	metaStorage.EXPECT().
-		Delete(ctx, "test-id").
+		Get(ctx, models.DefaultTenantID, "test-id").
+		RunAndReturn(func(context.Context, string, string) (*models.ImageMetadata, error) {
+			return &models.ImageMetadata{ID: "test-id", TenantID: models.DefaultTenantID}, nil
+		}).
+		Twice()
+
+	metaStorage.EXPECT().
+		Update(ctx, mock.Anything).
+		Return(models.ErrVersionConflict).
+		Once()
+
+	metaStorage.EXPECT().
+		Update(ctx, mock.Anything).
 		Return(nil).
 		Once()
 
-	svc := New(imgStorage, metaStorage, publisher)
+	svc := New(imgStorage, metaStorage, outbox, nil, 0, nil, time.Hour, nil)
 
-	err := svc.DeleteImage(ctx, "test-id")
+	err := svc.DeleteImage(ctx, models.DefaultTenantID, "test-id")
 
 	assert.NoError(t, err)
 }
 
+func TestImageService_DeletedImage_Hidden(t *testing.T) {
+	ctx := context.Background()
+	imgStorage := mocks.NewImageStorage(t)
+	metaStorage := mocks.NewMetadataStorage(t)
+	outbox := mocks.NewOutbox(t)
+
+	metaStorage.EXPECT().
+		Get(ctx, models.DefaultTenantID, "test-id").
+		Return(&models.ImageMetadata{ID: "test-id", TenantID: models.DefaultTenantID, DeletedAt: time.Now()}, nil).
+		Times(3)
+
+	svc := New(imgStorage, metaStorage, outbox, nil, 0, nil, time.Hour, nil)
+
+	_, err := svc.GetImage(ctx, models.DefaultTenantID, "test-id", "original")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "не найдены")
+
+	_, err = svc.GetImgMeta(ctx, models.DefaultTenantID, "test-id")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "не найдены")
+
+	err = svc.DeleteImage(ctx, models.DefaultTenantID, "test-id")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "не найдены")
+}
+
+// RestoreImage tests.
+func TestImageService_RestoreImage(t *testing.T) {
+	tests := []struct {
+		name      string
+		deletedAt time.Time
+		wantErr   string
+	}{
+		{name: "within window", deletedAt: time.Now().Add(-time.Minute)},
+		{name: "window expired", deletedAt: time.Now().Add(-2 * time.Hour), wantErr: "срок восстановления"},
+		{name: "not deleted", wantErr: "не удалено"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			imgStorage := mocks.NewImageStorage(t)
+			metaStorage := mocks.NewMetadataStorage(t)
+			outbox := mocks.NewOutbox(t)
+
+			metaStorage.EXPECT().
+				Get(ctx, "acme", "test-id").
+				Return(&models.ImageMetadata{ID: "test-id", TenantID: "acme", DeletedAt: tt.deletedAt}, nil).
+				Once()
+
+			if tt.wantErr == "" {
+				metaStorage.EXPECT().
+					Update(ctx, mock.MatchedBy(func(m *models.ImageMetadata) bool { return !m.Deleted() })).
+					Return(nil).
+					Once()
+			}
+
+			svc := New(imgStorage, metaStorage, outbox, nil, 0, nil, time.Hour, nil)
+
+			err := svc.RestoreImage(ctx, "acme", "test-id")
+
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+// RetryImage tests.
+func TestImageService_RetryImage(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  models.ImageStatus
+		wantErr string
+	}{
+		{name: "failed", status: models.StatusFailed},
+		{name: "completed", status: models.StatusCompleted, wantErr: "не в статусе failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			imgStorage := mocks.NewImageStorage(t)
+			metaStorage := mocks.NewMetadataStorage(t)
+			outbox := mocks.NewOutbox(t)
+
+			metaStorage.EXPECT().
+				Get(ctx, "acme", "test-id").
+				Return(&models.ImageMetadata{
+					ID:           "test-id",
+					TenantID:     "acme",
+					Status:       tt.status,
+					Attempts:     3,
+					ErrorMessage: "disk is full",
+					Priority:     models.PriorityBulk,
+				}, nil).
+				Once()
+
+			if tt.wantErr == "" {
+				outbox.EXPECT().
+					UpdateWithTask(ctx,
+						mock.MatchedBy(func(m *models.ImageMetadata) bool {
+							return m.Status == models.StatusPending && m.Attempts == 0 && m.ErrorMessage == "" &&
+								m.Priority == models.PriorityBulk
+						}),
+						mock.MatchedBy(func(task *models.ProcessingTask) bool {
+							return task.ImageID == "test-id" && task.Priority == models.PriorityBulk
+						})).
+					Return(nil).
+					Once()
+			}
+
+			svc := New(imgStorage, metaStorage, outbox, nil, 0, nil, time.Hour, nil)
+
+			err := svc.RetryImage(ctx, "acme", "test-id")
+
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+// ReplayDeadLetters tests.
+func TestImageService_ReplayDeadLetters_OK(t *testing.T) {
+	ctx := context.Background()
+	deadLetters := mocks.NewDeadLetterQueue(t)
+
+	deadLetters.EXPECT().
+		Replay(ctx, 50).
+		Return(7, nil).
+		Once()
+
+	svc := New(mocks.NewImageStorage(t), mocks.NewMetadataStorage(t), mocks.NewOutbox(t), nil, 0, nil, time.Hour, deadLetters)
+
+	replayed, err := svc.ReplayDeadLetters(ctx, 50)
+
+	require.NoError(t, err)
+	assert.Equal(t, 7, replayed)
+}
+
+func TestImageService_ReplayDeadLetters_NotConfigured(t *testing.T) {
+	svc := New(mocks.NewImageStorage(t), mocks.NewMetadataStorage(t), mocks.NewOutbox(t), nil, 0, nil, time.Hour, nil)
+
+	_, err := svc.ReplayDeadLetters(context.Background(), 50)
+
+	assert.Error(t, err)
+}
+
+// nopSeekCloser - io.ReadSeekCloser поверх io.ReadSeeker без освобождения ресурсов.
+type nopSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (nopSeekCloser) Close() error {
+	return nil
+}
+
 // Mock для multipart.File
 type mockMultipartFile struct {
 	reader   io.Reader
@@ -143,6 +728,9 @@ func (m *mockMultipartFile) ReadAt(p []byte, off int64) (n int, err error) {
 }
 
 func (m *mockMultipartFile) Seek(offset int64, whence int) (int64, error) {
+	if seeker, ok := m.reader.(io.Seeker); ok {
+		return seeker.Seek(offset, whence)
+	}
 	return 0, nil
 }
 
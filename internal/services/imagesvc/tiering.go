@@ -0,0 +1,84 @@
+package imagesvc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/sunr3d/image-processor/models"
+)
+
+// accessTouchInterval - как часто фиксируется обращение к изображению. Время обращения нужно
+// политикам жизненного цикла с точностью до дней, поэтому писать его на каждое чтение незачем.
+const accessTouchInterval = time.Hour
+
+// restore - возвращает архивный оригинал в горячее хранилище и ставит изображение в очередь
+// на повторное создание производных, удаленных при архивации.
+func (is *imageService) restore(ctx context.Context, meta *models.ImageMetadata) error {
+	if is.coldStorage == nil {
+		return fmt.Errorf("изображение %s в архиве, но холодное хранилище не настроено", meta.ID)
+	}
+
+	if err := is.coldStorage.Restore(ctx, meta.TenantID, meta.ID); err != nil {
+		return fmt.Errorf("coldStorage.Restore: %w", err)
+	}
+
+	now := time.Now()
+	meta.Tier = models.TierHot
+	meta.Status = models.StatusPending
+	meta.Attempts = 0
+	meta.ErrorMessage = ""
+	meta.AccessedAt = now
+	meta.UpdatedAt = now
+
+	task := &models.ProcessingTask{
+		TenantID:      meta.TenantID,
+		ImageID:       meta.ID,
+		OriginalPath:  meta.OriginalPath,
+		Priority:      meta.Priority,
+		CorrelationID: models.CorrelationIDFromContext(ctx),
+	}
+	meta.CorrelationID = task.CorrelationID
+
+	if err := is.outbox.UpdateWithTask(ctx, meta, task); err != nil {
+		if !errors.Is(err, models.ErrVersionConflict) {
+			return fmt.Errorf("outbox.UpdateWithTask: %w", err)
+		}
+
+		// Изображение параллельно восстановил другой запрос - берем его версию метаданных.
+		fresh, err := is.metaStorage.Get(ctx, meta.TenantID, meta.ID)
+		if err != nil {
+			return fmt.Errorf("metaStorage.Get: %w", err)
+		}
+		*meta = *fresh
+
+		return nil
+	}
+
+	zlog.Logger.Info().Msgf("Изображение %s восстановлено из архива и поставлено в очередь на повторную обработку", meta.ID)
+
+	return nil
+}
+
+// touch - фиксирует обращение к изображению не чаще accessTouchInterval. Без холодного хранилища
+// время обращения никому не нужно. Пока изображение обрабатывается, метаданными владеет worker,
+// поэтому время обращения не пишется.
+func (is *imageService) touch(ctx context.Context, meta *models.ImageMetadata) {
+	if is.coldStorage == nil {
+		return
+	}
+	if meta.Status != models.StatusCompleted && meta.Status != models.StatusFailed {
+		return
+	}
+	if time.Since(meta.LastAccess()) < accessTouchInterval {
+		return
+	}
+
+	meta.AccessedAt = time.Now()
+	if err := is.metaStorage.Update(ctx, meta); err != nil {
+		zlog.Logger.Warn().Err(err).Msgf("Не удалось зафиксировать обращение к изображению %s", meta.ID)
+	}
+}
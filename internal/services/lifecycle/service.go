@@ -0,0 +1,125 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/sunr3d/image-processor/internal/interfaces/infra"
+	"github.com/sunr3d/image-processor/internal/services/periodic"
+	"github.com/sunr3d/image-processor/models"
+)
+
+type lifecycle struct {
+	coldStorage infra.ColdStorage
+	metaStorage infra.MetadataStorage
+	tenantIDs   []string
+	coldAfter   time.Duration
+	interval    time.Duration
+}
+
+// New - конструктор Lifecycle. Оригиналы, к которым не обращались дольше coldAfter,
+// переносятся в холодное хранилище; проверка выполняется каждые interval.
+func New(coldStor infra.ColdStorage, metaStor infra.MetadataStorage, tenants []models.Tenant, coldAfter, interval time.Duration) *lifecycle {
+	return &lifecycle{
+		coldStorage: coldStor,
+		metaStorage: metaStor,
+		tenantIDs:   models.TenantIDs(tenants),
+		coldAfter:   coldAfter,
+		interval:    interval,
+	}
+}
+
+// Start - периодически архивирует неиспользуемые оригиналы до отмены контекста.
+func (l *lifecycle) Start(ctx context.Context) error {
+	zlog.Logger.Info().Msgf("Политики жизненного цикла запущены: архивация после %s без обращений", l.coldAfter)
+
+	periodic.Run(ctx, l.interval, func(ctx context.Context) bool {
+		archived, err := l.archiveStale(ctx)
+		if err != nil {
+			zlog.Logger.Error().Err(err).Msg("Ошибка архивации изображений")
+		} else if archived > 0 {
+			zlog.Logger.Info().Msgf("Перенесено в холодное хранилище изображений: %d", archived)
+		}
+		return false
+	})
+
+	return nil
+}
+
+// helpers
+func (l *lifecycle) archiveStale(ctx context.Context) (int, error) {
+	threshold := time.Now().Add(-l.coldAfter)
+	archived := 0
+
+	for _, tenantID := range l.tenantIDs {
+		query := &models.ImageQuery{
+			TenantID: tenantID,
+			Statuses: []models.ImageStatus{models.StatusCompleted, models.StatusFailed},
+			SortBy:   models.SortByCreatedAt,
+			Limit:    models.MaxPageLimit,
+		}
+
+		for {
+			if err := ctx.Err(); err != nil {
+				return archived, err
+			}
+
+			page, err := l.metaStorage.List(ctx, query)
+			if err != nil {
+				return archived, fmt.Errorf("metaStorage.List: %w", err)
+			}
+
+			for _, meta := range page.Items {
+				if meta.Tier == models.TierCold || !meta.LastAccess().Before(threshold) {
+					continue
+				}
+
+				ok, err := l.archive(ctx, meta)
+				if err != nil {
+					zlog.Logger.Warn().Err(err).Msgf("Не удалось перенести изображение %s в архив", meta.ID)
+					continue
+				}
+				if ok {
+					archived++
+				}
+			}
+
+			if page.NextCursor == "" {
+				break
+			}
+			query.Cursor = page.NextCursor
+		}
+	}
+
+	return archived, nil
+}
+
+// archive - сначала помечает изображение архивным, затем переносит файлы. Если перенос не удался,
+// изображение остается доступным: восстановление при обращении не требует архивной копии
+// и заново создает производные. Возвращает false, если изображение изменилось во время архивации.
+func (l *lifecycle) archive(ctx context.Context, meta *models.ImageMetadata) (bool, error) {
+	meta.Tier = models.TierCold
+	meta.ResizedPath = ""
+	meta.ThumbnailPath = ""
+	meta.WatermarkedPath = ""
+	meta.ProcessedSize = 0
+	meta.UpdatedAt = time.Now()
+
+	if err := l.metaStorage.Update(ctx, meta); err != nil {
+		if errors.Is(err, models.ErrVersionConflict) {
+			zlog.Logger.Info().Msgf("Изображение %s изменено во время архивации, пропуск", meta.ID)
+			return false, nil
+		}
+		return false, fmt.Errorf("metaStorage.Update: %w", err)
+	}
+
+	if err := l.coldStorage.Archive(ctx, meta.TenantID, meta.ID); err != nil {
+		return false, fmt.Errorf("coldStorage.Archive: %w", err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,87 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sunr3d/image-processor/mocks"
+	"github.com/sunr3d/image-processor/models"
+)
+
+func TestLifecycle_New_DefaultTenant(t *testing.T) {
+	l := New(mocks.NewColdStorage(t), mocks.NewMetadataStorage(t), nil, time.Hour, time.Minute)
+
+	assert.Equal(t, []string{models.DefaultTenantID}, l.tenantIDs)
+}
+
+// archiveStale tests.
+func TestLifecycle_ArchiveStale_OK(t *testing.T) {
+	ctx := context.Background()
+	coldStorage := mocks.NewColdStorage(t)
+	metaStorage := mocks.NewMetadataStorage(t)
+
+	old := time.Now().Add(-48 * time.Hour)
+	stale := &models.ImageMetadata{ID: "stale", TenantID: "acme", ThumbnailPath: "/t.jpg", ProcessedSize: 10, CreatedAt: old}
+	fresh := &models.ImageMetadata{ID: "fresh", TenantID: "acme", CreatedAt: old, AccessedAt: time.Now()}
+	cold := &models.ImageMetadata{ID: "cold", TenantID: "acme", Tier: models.TierCold, CreatedAt: old}
+
+	metaStorage.EXPECT().
+		List(ctx, mock.MatchedBy(func(q *models.ImageQuery) bool { return q.TenantID == "acme" && q.Cursor == "" })).
+		Return(&models.ImagePage{Items: []*models.ImageMetadata{stale, fresh}, NextCursor: "next"}, nil).
+		Once()
+
+	metaStorage.EXPECT().
+		List(ctx, mock.MatchedBy(func(q *models.ImageQuery) bool { return q.Cursor == "next" })).
+		Return(&models.ImagePage{Items: []*models.ImageMetadata{cold}}, nil).
+		Once()
+
+	metaStorage.EXPECT().
+		Update(ctx, mock.MatchedBy(func(m *models.ImageMetadata) bool {
+			return m.ID == "stale" && m.Tier == models.TierCold && m.ThumbnailPath == "" && m.ProcessedSize == 0
+		})).
+		Return(nil).
+		Once()
+
+	coldStorage.EXPECT().
+		Archive(ctx, "acme", "stale").
+		Return(nil).
+		Once()
+
+	l := New(coldStorage, metaStorage, []models.Tenant{{ID: "acme"}}, 24*time.Hour, time.Minute)
+
+	archived, err := l.archiveStale(ctx)
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, archived)
+}
+
+func TestLifecycle_ArchiveStale_VersionConflict(t *testing.T) {
+	ctx := context.Background()
+	coldStorage := mocks.NewColdStorage(t)
+	metaStorage := mocks.NewMetadataStorage(t)
+
+	stale := &models.ImageMetadata{ID: "stale", TenantID: "acme", CreatedAt: time.Now().Add(-48 * time.Hour)}
+
+	metaStorage.EXPECT().
+		List(ctx, mock.Anything).
+		Return(&models.ImagePage{Items: []*models.ImageMetadata{stale}}, nil).
+		Once()
+
+	metaStorage.EXPECT().
+		Update(ctx, mock.Anything).
+		Return(fmt.Errorf("%w: stale", models.ErrVersionConflict)).
+		Once()
+
+	l := New(coldStorage, metaStorage, []models.Tenant{{ID: "acme"}}, 24*time.Hour, time.Minute)
+
+	archived, err := l.archiveStale(ctx)
+
+	require.NoError(t, err)
+	assert.Equal(t, 0, archived)
+}
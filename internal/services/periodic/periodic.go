@@ -0,0 +1,29 @@
+// Package periodic - общий цикл фоновых сервисов, выполняющих работу по таймеру.
+package periodic
+
+import (
+	"context"
+	"time"
+)
+
+// Run - выполняет tick сразу и затем каждые interval до отмены ctx. Если tick возвращает true
+// (работа осталась), следующий запуск выполняется сразу, не дожидаясь таймера.
+func Run(ctx context.Context, interval time.Duration, tick func(ctx context.Context) bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if tick(ctx) {
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
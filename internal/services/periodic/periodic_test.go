@@ -0,0 +1,34 @@
+package periodic
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// Первые два запуска оставляют работу и повторяются без ожидания таймера.
+	calls := 0
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Run(ctx, time.Hour, func(ctx context.Context) bool {
+			calls++
+			if calls == 3 {
+				cancel()
+			}
+			return calls < 3
+		})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run не завершился после отмены контекста")
+	}
+	assert.Equal(t, 3, calls)
+}
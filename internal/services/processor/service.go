@@ -6,6 +6,7 @@ import (
 	"image"
 	"image/color"
 	"image/jpeg"
+	"io"
 
 	"github.com/disintegration/imaging"
 	"github.com/wb-go/wbf/zlog"
@@ -30,13 +31,14 @@ func New(thumbSize, resizeW int) *imageProcessor {
 }
 
 // Process - обрабатывает изображение в трех вариантах: resized, thumbnail, watermarked.
-func (p *imageProcessor) Process(imagePath string) (*models.ProcessedImages, error) {
-	img, err := imaging.Open(imagePath)
+func (p *imageProcessor) Process(r io.Reader) (*models.ProcessedImages, error) {
+	img, err := imaging.Decode(r)
 	if err != nil {
-		return nil, fmt.Errorf("imaging.Open: %w", err)
+		return nil, fmt.Errorf("imaging.Decode: %w", err)
 	}
 
-	zlog.Logger.Info().Msgf("Начало обработки изображения: %s", imagePath)
+	bounds := img.Bounds()
+	zlog.Logger.Info().Msgf("Начало обработки изображения %dx%d", bounds.Dx(), bounds.Dy())
 
 	// 1. Resize
 	resized := imaging.Resize(img, p.resizeWidth, 0, imaging.Lanczos)
@@ -59,12 +61,17 @@ func (p *imageProcessor) Process(imagePath string) (*models.ProcessedImages, err
 		return nil, fmt.Errorf("encodeToJPEG Watermarked: %w", err)
 	}
 
-	zlog.Logger.Info().Msgf("Обработка изображения %s завершена", imagePath)
+	zlog.Logger.Info().Msg("Обработка изображения завершена")
 
 	return &models.ProcessedImages{
 		Resized:     resizedBytes,
 		Thumbnail:   thumbnailBytes,
 		Watermarked: watermarkedBytes,
+		Sizes: map[string]models.ImageSize{
+			"resized":     sizeOf(resized),
+			"thumbnail":   sizeOf(thumbnail),
+			"watermarked": sizeOf(watermarked),
+		},
 	}, nil
 }
 
@@ -80,6 +87,10 @@ func encodeToJPEG(img image.Image) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+func sizeOf(img image.Image) models.ImageSize {
+	return models.ImageSize{Width: img.Bounds().Dx(), Height: img.Bounds().Dy()}
+}
+
 func (p *imageProcessor) addWatermark(img image.Image) image.Image {
 	overlay := image.NewRGBA(img.Bounds())
 
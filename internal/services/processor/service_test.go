@@ -2,15 +2,19 @@ package processor
 
 import (
 	"bytes"
+	"errors"
 	"image"
 	"image/color"
 	"image/jpeg"
 	"os"
 	"path/filepath"
 	"testing"
+	"testing/iotest"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/sunr3d/image-processor/models"
 )
 
 func TestImageProcessor_New(t *testing.T) {
@@ -24,37 +28,36 @@ func TestImageProcessor_New(t *testing.T) {
 func TestImageProcessor_Process_OK(t *testing.T) {
 	processor := New(200, 800)
 	testImagePath := createTestImage(t)
-	defer os.Remove(testImagePath)
+	file, err := os.Open(testImagePath)
+	require.NoError(t, err)
+	defer file.Close()
 
-	result, err := processor.Process(testImagePath)
+	result, err := processor.Process(file)
 
 	require.NoError(t, err)
 	assert.NotNil(t, result)
 	assert.NotEmpty(t, result.Resized)
 	assert.NotEmpty(t, result.Thumbnail)
 	assert.NotEmpty(t, result.Watermarked)
+	assert.Equal(t, models.ImageSize{Width: 800, Height: 800}, result.Sizes["resized"])
+	assert.Equal(t, models.ImageSize{Width: 200, Height: 200}, result.Sizes["thumbnail"])
+	assert.Equal(t, models.ImageSize{Width: 100, Height: 100}, result.Sizes["watermarked"])
 }
 
-func TestImageProcessor_Process_FileNotFound(t *testing.T) {
+func TestImageProcessor_Process_ReadError(t *testing.T) {
 	processor := New(200, 800)
-	nonExistentPath := "/path/to/non/existent/image.jpg"
 
-	result, err := processor.Process(nonExistentPath)
+	result, err := processor.Process(iotest.ErrReader(errors.New("read failed")))
 
 	assert.Error(t, err)
 	assert.Nil(t, result)
-	assert.Contains(t, err.Error(), "imaging.Open")
+	assert.Contains(t, err.Error(), "imaging.Decode")
 }
 
 func TestImageProcessor_Process_InvalidFile(t *testing.T) {
 	processor := New(200, 800)
 
-	tempFile := filepath.Join(t.TempDir(), "invalid.jpg")
-	err := os.WriteFile(tempFile, []byte("not an image"), 0644)
-	require.NoError(t, err)
-	defer os.Remove(tempFile)
-
-	result, err := processor.Process(tempFile)
+	result, err := processor.Process(bytes.NewReader([]byte("not an image")))
 
 	assert.Error(t, err)
 	assert.Nil(t, result)
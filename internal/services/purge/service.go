@@ -0,0 +1,109 @@
+package purge
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/sunr3d/image-processor/internal/interfaces/infra"
+	"github.com/sunr3d/image-processor/internal/services/periodic"
+	"github.com/sunr3d/image-processor/models"
+)
+
+type purger struct {
+	imgStorage    infra.ImageStorage
+	metaStorage   infra.MetadataStorage
+	tenantIDs     []string
+	restoreWindow time.Duration
+	interval      time.Duration
+}
+
+// New - конструктор Purger. Каждые interval окончательно удаляет файлы и метаданные изображений,
+// удаленных раньше, чем restoreWindow назад.
+func New(imgStor infra.ImageStorage, metaStor infra.MetadataStorage, tenants []models.Tenant, restoreWindow, interval time.Duration) *purger {
+	return &purger{
+		imgStorage:    imgStor,
+		metaStorage:   metaStor,
+		tenantIDs:     models.TenantIDs(tenants),
+		restoreWindow: restoreWindow,
+		interval:      interval,
+	}
+}
+
+// Start - периодически очищает удаленные изображения до отмены контекста.
+func (p *purger) Start(ctx context.Context) error {
+	zlog.Logger.Info().Msgf("Очистка удаленных изображений запущена: окно восстановления %s", p.restoreWindow)
+
+	periodic.Run(ctx, p.interval, func(ctx context.Context) bool {
+		purged, err := p.purgeDeleted(ctx)
+		if err != nil {
+			zlog.Logger.Error().Err(err).Msg("Ошибка очистки удаленных изображений")
+		} else if purged > 0 {
+			zlog.Logger.Info().Msgf("Окончательно удалено изображений: %d", purged)
+		}
+		return false
+	})
+
+	return nil
+}
+
+// helpers
+func (p *purger) purgeDeleted(ctx context.Context) (int, error) {
+	threshold := time.Now().Add(-p.restoreWindow)
+	purged := 0
+
+	for _, tenantID := range p.tenantIDs {
+		query := &models.ImageQuery{
+			TenantID:      tenantID,
+			DeletedBefore: threshold,
+			SortBy:        models.SortByCreatedAt,
+			Limit:         models.MaxPageLimit,
+		}
+
+		for {
+			if err := ctx.Err(); err != nil {
+				return purged, err
+			}
+
+			page, err := p.metaStorage.List(ctx, query)
+			if err != nil {
+				return purged, fmt.Errorf("metaStorage.List: %w", err)
+			}
+
+			for _, meta := range page.Items {
+				if err := p.purge(ctx, meta); err != nil {
+					zlog.Logger.Warn().Err(err).Msgf("Не удалось окончательно удалить изображение %s", meta.ID)
+					continue
+				}
+				purged++
+			}
+
+			if page.NextCursor == "" {
+				break
+			}
+			query.Cursor = page.NextCursor
+		}
+	}
+
+	return purged, nil
+}
+
+// purge - удаляет сначала файлы, затем метаданные: если удаление файлов не удалось,
+// запись остается и очистка повторится в следующем проходе.
+func (p *purger) purge(ctx context.Context, meta *models.ImageMetadata) error {
+	if err := p.imgStorage.DeleteImage(ctx, meta.TenantID, meta.ID); err != nil {
+		return fmt.Errorf("imgStorage.DeleteImage: %w", err)
+	}
+
+	if err := p.metaStorage.Delete(ctx, meta.TenantID, meta.ID); err != nil {
+		if strings.Contains(err.Error(), "не найден") {
+			return nil
+		}
+		return fmt.Errorf("metaStorage.Delete: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package purge
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sunr3d/image-processor/mocks"
+	"github.com/sunr3d/image-processor/models"
+)
+
+func TestPurger_PurgeDeleted_OK(t *testing.T) {
+	ctx := context.Background()
+	imgStorage := mocks.NewImageStorage(t)
+	metaStorage := mocks.NewMetadataStorage(t)
+
+	deletedAt := time.Now().Add(-48 * time.Hour)
+
+	metaStorage.EXPECT().
+		List(ctx, mock.MatchedBy(func(q *models.ImageQuery) bool {
+			return q.TenantID == "acme" && time.Since(q.DeletedBefore) >= 24*time.Hour
+		})).
+		Return(&models.ImagePage{Items: []*models.ImageMetadata{
+			{ID: "img-1", TenantID: "acme", DeletedAt: deletedAt},
+			{ID: "img-2", TenantID: "acme", DeletedAt: deletedAt},
+		}}, nil).
+		Once()
+
+	imgStorage.EXPECT().DeleteImage(ctx, "acme", "img-1").Return(nil).Once()
+	metaStorage.EXPECT().Delete(ctx, "acme", "img-1").Return(nil).Once()
+
+	// Если файлы удалить не удалось, метаданные остаются до следующего прохода.
+	imgStorage.EXPECT().DeleteImage(ctx, "acme", "img-2").Return(errors.New("disk error")).Once()
+
+	p := New(imgStorage, metaStorage, []models.Tenant{{ID: "acme"}}, 24*time.Hour, time.Minute)
+
+	purged, err := p.purgeDeleted(ctx)
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+}
@@ -0,0 +1,122 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/sunr3d/image-processor/internal/interfaces/infra"
+	"github.com/sunr3d/image-processor/internal/services/periodic"
+	"github.com/sunr3d/image-processor/models"
+)
+
+const (
+	// claimLease - на сколько захваченная запись скрывается от других relay. Если процесс упадет
+	// посреди публикации, запись снова станет доступна по истечении аренды.
+	claimLease = time.Minute
+	// maxRetryDelay - верхняя граница экспоненциальной задержки между попытками публикации.
+	maxRetryDelay = 5 * time.Minute
+)
+
+type relay struct {
+	outbox    infra.Outbox
+	publisher infra.Publisher
+	interval  time.Duration
+	batchSize int
+}
+
+// New - конструктор Relay. Каждые interval публикует задачи из outbox в брокер пачками
+// по batchSize; неудачные публикации повторяются с экспоненциальной задержкой.
+func New(outbox infra.Outbox, publisher infra.Publisher, interval time.Duration, batchSize int) *relay {
+	return &relay{
+		outbox:    outbox,
+		publisher: publisher,
+		interval:  interval,
+		batchSize: batchSize,
+	}
+}
+
+// Start - публикует задачи из outbox до отмены контекста. Полная пачка означает, что
+// в outbox остались записи, поэтому следующая забирается сразу, без ожидания interval.
+func (r *relay) Start(ctx context.Context) error {
+	zlog.Logger.Info().Msgf("Публикация задач из outbox запущена, период %s", r.interval)
+
+	// Полная пачка - в outbox, вероятно, остались задачи: следующая публикуется сразу.
+	periodic.Run(ctx, r.interval, func(ctx context.Context) bool {
+		claimed, err := r.relayBatch(ctx)
+		if err != nil {
+			zlog.Logger.Error().Err(err).Msg("Ошибка публикации задач из outbox")
+		}
+		return err == nil && claimed == r.batchSize
+	})
+
+	return nil
+}
+
+// helpers
+// relayBatch - захватывает пачку записей outbox и публикует их. Возвращает количество
+// захваченных записей; ошибка публикации отдельной задачи не прерывает пачку.
+func (r *relay) relayBatch(ctx context.Context) (int, error) {
+	entries, err := r.outbox.ClaimTasks(ctx, r.batchSize, claimLease)
+	if err != nil {
+		return 0, fmt.Errorf("outbox.ClaimTasks: %w", err)
+	}
+
+	published := 0
+	for _, entry := range entries {
+		if err := r.publisher.Publish(ctx, envelope(entry)); err != nil {
+			delay := retryDelay(entry.Attempts)
+			zlog.Logger.Warn().Err(err).Msgf("Не удалось опубликовать задачу для изображения %s (попытка %d), повтор через %s",
+				entry.Task.ImageID, entry.Attempts, delay)
+
+			if err := r.outbox.RetryTask(ctx, entry.ID, delay, err.Error()); err != nil {
+				zlog.Logger.Warn().Err(err).Msgf("Не удалось отложить запись outbox %s", entry.ID)
+			}
+			continue
+		}
+
+		// Если удаление не удастся, задача будет опубликована повторно после аренды:
+		// повторная обработка изображения безопасна, потерянная задача - нет.
+		if err := r.outbox.CompleteTask(ctx, entry.ID); err != nil {
+			zlog.Logger.Warn().Err(err).Msgf("Не удалось удалить опубликованную запись outbox %s", entry.ID)
+			continue
+		}
+		published++
+	}
+
+	if published > 0 {
+		zlog.Logger.Info().Msgf("Опубликовано задач из outbox: %d", published)
+	}
+
+	return len(entries), nil
+}
+
+// envelope - конверт задачи записи outbox. Все публикации одной записи получают одинаковый ключ
+// идемпотентности - ID записи; он же служит ID корреляции задач, поставленных не из запроса.
+func envelope(entry *models.OutboxEntry) *models.TaskEnvelope {
+	env := models.NewTaskEnvelope(entry.Task)
+	if !entry.CreatedAt.IsZero() {
+		env.CreatedAt = entry.CreatedAt.UTC()
+	}
+	env.Attempt = max(entry.Attempts, 1)
+	env.IdempotencyKey = entry.ID
+	if env.CorrelationID == "" {
+		env.CorrelationID = entry.ID
+	}
+
+	return env
+}
+
+// retryDelay - экспоненциальная задержка перед повторной публикацией: 1с, 2с, 4с... до maxRetryDelay.
+func retryDelay(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	if attempts > 20 {
+		return maxRetryDelay
+	}
+
+	return min(time.Second<<(attempts-1), maxRetryDelay)
+}
@@ -0,0 +1,77 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sunr3d/image-processor/mocks"
+	"github.com/sunr3d/image-processor/models"
+)
+
+func TestRelay_RelayBatch_OK(t *testing.T) {
+	ctx := context.Background()
+	outbox := mocks.NewOutbox(t)
+	publisher := mocks.NewPublisher(t)
+
+	outbox.EXPECT().
+		ClaimTasks(ctx, 10, claimLease).
+		Return([]*models.OutboxEntry{
+			{ID: "e-1", Task: models.ProcessingTask{TenantID: "acme", ImageID: "img-1", CorrelationID: "req-1"}, Attempts: 1},
+			{ID: "e-2", Task: models.ProcessingTask{TenantID: "acme", ImageID: "img-2"}, Attempts: 3},
+		}, nil).
+		Once()
+
+	publisher.EXPECT().
+		Publish(ctx, mock.MatchedBy(func(env *models.TaskEnvelope) bool {
+			return env.ImageID == "img-1" && env.IdempotencyKey == "e-1" && env.CorrelationID == "req-1" && env.Attempt == 1
+		})).
+		Return(nil).
+		Once()
+	outbox.EXPECT().CompleteTask(ctx, "e-1").Return(nil).Once()
+
+	publisher.EXPECT().
+		Publish(ctx, mock.MatchedBy(func(env *models.TaskEnvelope) bool {
+			return env.ImageID == "img-2" && env.IdempotencyKey == "e-2" && env.CorrelationID == "e-2" && env.Attempt == 3
+		})).
+		Return(errors.New("kafka is down")).
+		Once()
+	outbox.EXPECT().RetryTask(ctx, "e-2", 4*time.Second, "kafka is down").Return(nil).Once()
+
+	r := New(outbox, publisher, time.Second, 10)
+
+	claimed, err := r.relayBatch(ctx)
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, claimed)
+}
+
+func TestRelay_RelayBatch_ClaimError(t *testing.T) {
+	ctx := context.Background()
+	outbox := mocks.NewOutbox(t)
+
+	outbox.EXPECT().
+		ClaimTasks(ctx, 10, claimLease).
+		Return(nil, errors.New("db is down")).
+		Once()
+
+	r := New(outbox, mocks.NewPublisher(t), time.Second, 10)
+
+	claimed, err := r.relayBatch(ctx)
+
+	assert.Error(t, err)
+	assert.Equal(t, 0, claimed)
+}
+
+func TestRetryDelay(t *testing.T) {
+	assert.Equal(t, time.Second, retryDelay(0))
+	assert.Equal(t, time.Second, retryDelay(1))
+	assert.Equal(t, 8*time.Second, retryDelay(4))
+	assert.Equal(t, maxRetryDelay, retryDelay(10))
+	assert.Equal(t, maxRetryDelay, retryDelay(100))
+}
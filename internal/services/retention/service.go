@@ -0,0 +1,94 @@
+package retention
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/sunr3d/image-processor/internal/interfaces/infra"
+	"github.com/sunr3d/image-processor/internal/interfaces/services"
+	"github.com/sunr3d/image-processor/internal/services/periodic"
+	"github.com/sunr3d/image-processor/models"
+)
+
+type reaper struct {
+	imageSvc    services.ImageService
+	metaStorage infra.MetadataStorage
+	tenantIDs   []string
+	interval    time.Duration
+}
+
+// New - конструктор Reaper. Каждые interval удаляет изображения с истекшим сроком хранения
+// через imageSvc.DeleteImage, чтобы удаление шло тем же путем, что и по запросу клиента.
+func New(imageSvc services.ImageService, metaStor infra.MetadataStorage, tenants []models.Tenant, interval time.Duration) *reaper {
+	return &reaper{
+		imageSvc:    imageSvc,
+		metaStorage: metaStor,
+		tenantIDs:   models.TenantIDs(tenants),
+		interval:    interval,
+	}
+}
+
+// Start - периодически удаляет изображения с истекшим сроком хранения до отмены контекста.
+func (r *reaper) Start(ctx context.Context) error {
+	zlog.Logger.Info().Msgf("Удаление изображений с истекшим сроком хранения запущено, период %s", r.interval)
+
+	periodic.Run(ctx, r.interval, func(ctx context.Context) bool {
+		deleted, err := r.reapExpired(ctx)
+		if err != nil {
+			zlog.Logger.Error().Err(err).Msg("Ошибка удаления изображений с истекшим сроком хранения")
+		} else if deleted > 0 {
+			zlog.Logger.Info().Msgf("Удалено изображений с истекшим сроком хранения: %d", deleted)
+		}
+		return false
+	})
+
+	return nil
+}
+
+// helpers
+func (r *reaper) reapExpired(ctx context.Context) (int, error) {
+	now := time.Now()
+	deleted := 0
+
+	for _, tenantID := range r.tenantIDs {
+		query := &models.ImageQuery{
+			TenantID:      tenantID,
+			ExpiresBefore: now,
+			SortBy:        models.SortByCreatedAt,
+			Limit:         models.MaxPageLimit,
+		}
+
+		for {
+			if err := ctx.Err(); err != nil {
+				return deleted, err
+			}
+
+			page, err := r.metaStorage.List(ctx, query)
+			if err != nil {
+				return deleted, fmt.Errorf("metaStorage.List: %w", err)
+			}
+
+			for _, meta := range page.Items {
+				if err := r.imageSvc.DeleteImage(ctx, tenantID, meta.ID); err != nil {
+					// Изображение могли удалить параллельно - это не ошибка.
+					if !strings.Contains(err.Error(), "не найден") {
+						zlog.Logger.Warn().Err(err).Msgf("Не удалось удалить изображение %s с истекшим сроком хранения", meta.ID)
+					}
+					continue
+				}
+				deleted++
+			}
+
+			if page.NextCursor == "" {
+				break
+			}
+			query.Cursor = page.NextCursor
+		}
+	}
+
+	return deleted, nil
+}
@@ -0,0 +1,75 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sunr3d/image-processor/mocks"
+	"github.com/sunr3d/image-processor/models"
+)
+
+func TestReaper_ReapExpired_OK(t *testing.T) {
+	ctx := context.Background()
+	imageSvc := mocks.NewImageService(t)
+	metaStorage := mocks.NewMetadataStorage(t)
+
+	expired := time.Now().Add(-time.Minute)
+
+	metaStorage.EXPECT().
+		List(ctx, mock.MatchedBy(func(q *models.ImageQuery) bool {
+			return q.TenantID == "acme" && !q.ExpiresBefore.IsZero() && q.Cursor == ""
+		})).
+		Return(&models.ImagePage{
+			Items: []*models.ImageMetadata{
+				{ID: "img-1", TenantID: "acme", ExpiresAt: expired},
+				{ID: "img-2", TenantID: "acme", ExpiresAt: expired},
+			},
+			NextCursor: "next",
+		}, nil).
+		Once()
+
+	metaStorage.EXPECT().
+		List(ctx, mock.MatchedBy(func(q *models.ImageQuery) bool { return q.Cursor == "next" })).
+		Return(&models.ImagePage{
+			Items: []*models.ImageMetadata{{ID: "img-3", TenantID: "acme", ExpiresAt: expired}},
+		}, nil).
+		Once()
+
+	imageSvc.EXPECT().DeleteImage(ctx, "acme", "img-1").Return(nil).Once()
+	imageSvc.EXPECT().
+		DeleteImage(ctx, "acme", "img-2").
+		Return(errors.New("metaStorage.Get: метаданные изображения не найдены: img-2")).
+		Once()
+	imageSvc.EXPECT().DeleteImage(ctx, "acme", "img-3").Return(nil).Once()
+
+	r := New(imageSvc, metaStorage, []models.Tenant{{ID: "acme"}}, time.Minute)
+
+	deleted, err := r.reapExpired(ctx)
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+}
+
+func TestReaper_ReapExpired_ListError(t *testing.T) {
+	ctx := context.Background()
+	imageSvc := mocks.NewImageService(t)
+	metaStorage := mocks.NewMetadataStorage(t)
+
+	metaStorage.EXPECT().
+		List(ctx, mock.Anything).
+		Return(nil, errors.New("db is down")).
+		Once()
+
+	r := New(imageSvc, metaStorage, nil, time.Minute)
+
+	deleted, err := r.reapExpired(ctx)
+
+	assert.Error(t, err)
+	assert.Equal(t, 0, deleted)
+}
@@ -0,0 +1,200 @@
+package sweeper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/sunr3d/image-processor/internal/interfaces/infra"
+	"github.com/sunr3d/image-processor/internal/services/periodic"
+	"github.com/sunr3d/image-processor/models"
+)
+
+type sweeper struct {
+	metaStorage infra.MetadataStorage
+	outbox      infra.Outbox
+	events      infra.EventPublisher
+	tenantIDs   []string
+	threshold   time.Duration
+	maxAttempts int
+	interval    time.Duration
+}
+
+// New - конструктор Sweeper. Каждые interval ищет изображения, обработка которых началась больше
+// threshold назад и не завершилась (например, worker упал посреди обработки), и ставит их задачи
+// в очередь повторно. Так же ставятся в очередь изображения, которые дольше threshold ждут в pending
+// без задачи в outbox: задача могла не записаться из-за сбоя или уйти в DLQ, не дойдя до worker.
+// После maxAttempts повторных постановок изображение помечается failed и публикуется image.failed
+// (events = nil - события не публикуются).
+func New(
+	metaStor infra.MetadataStorage,
+	outbox infra.Outbox,
+	events infra.EventPublisher,
+	tenants []models.Tenant,
+	threshold time.Duration,
+	maxAttempts int,
+	interval time.Duration,
+) *sweeper {
+	return &sweeper{
+		metaStorage: metaStor,
+		outbox:      outbox,
+		events:      events,
+		tenantIDs:   models.TenantIDs(tenants),
+		threshold:   threshold,
+		maxAttempts: maxAttempts,
+		interval:    interval,
+	}
+}
+
+// Start - периодически ищет зависшие задачи до отмены контекста.
+func (s *sweeper) Start(ctx context.Context) error {
+	zlog.Logger.Info().Msgf("Поиск зависших задач запущен: порог %s, попыток %d", s.threshold, s.maxAttempts)
+
+	periodic.Run(ctx, s.interval, func(ctx context.Context) bool {
+		requeued, failed, err := s.sweepStuck(ctx)
+		if err != nil {
+			zlog.Logger.Error().Err(err).Msg("Ошибка поиска зависших задач")
+		} else if requeued > 0 || failed > 0 {
+			zlog.Logger.Warn().Msgf("Зависшие задачи: повторно поставлено в очередь %d, помечено failed %d", requeued, failed)
+		}
+		return false
+	})
+
+	return nil
+}
+
+// helpers
+func (s *sweeper) sweepStuck(ctx context.Context) (int, int, error) {
+	requeued, failed := 0, 0
+
+	for _, tenantID := range s.tenantIDs {
+		// Worker переводит изображение в processing с UpdatedAt - временем начала обработки,
+		// у pending UpdatedAt - время постановки задачи.
+		query := &models.ImageQuery{
+			TenantID:      tenantID,
+			Statuses:      []models.ImageStatus{models.StatusProcessing, models.StatusPending},
+			UpdatedBefore: time.Now().Add(-s.threshold),
+			SortBy:        models.SortByCreatedAt,
+			Limit:         models.MaxPageLimit,
+		}
+
+		for {
+			if err := ctx.Err(); err != nil {
+				return requeued, failed, err
+			}
+
+			page, err := s.metaStorage.List(ctx, query)
+			if err != nil {
+				return requeued, failed, fmt.Errorf("metaStorage.List: %w", err)
+			}
+
+			for _, meta := range page.Items {
+				act, err := s.handleStuck(ctx, meta)
+				if err != nil {
+					// Метаданные параллельно изменил worker - задача не зависла.
+					if !errors.Is(err, models.ErrVersionConflict) {
+						zlog.Logger.Warn().Err(err).Msgf("Не удалось обработать зависшую задачу изображения %s", meta.ID)
+					}
+					continue
+				}
+
+				switch act {
+				case actionRequeued:
+					requeued++
+				case actionFailed:
+					failed++
+				}
+			}
+
+			if page.NextCursor == "" {
+				break
+			}
+			query.Cursor = page.NextCursor
+		}
+	}
+
+	return requeued, failed, nil
+}
+
+type action int
+
+const (
+	actionSkipped action = iota
+	actionRequeued
+	actionFailed
+)
+
+// handleStuck - ставит задачу изображения в очередь повторно или, если попытки исчерпаны, помечает
+// изображение failed. Изображения, задача которых еще ждет публикации в outbox (брокер недоступен),
+// не трогаются: задача не потеряна, и повторная постановка не ускорит обработку. Pending-изображение
+// без задачи в outbox могло и просто ждать в длинной очереди брокера - тогда повторная задача
+// будет пропущена worker как уже обработанная.
+func (s *sweeper) handleStuck(ctx context.Context, meta *models.ImageMetadata) (action, error) {
+	queued, err := s.outbox.HasTask(ctx, meta.TenantID, meta.ID)
+	if err != nil {
+		return actionSkipped, fmt.Errorf("outbox.HasTask: %w", err)
+	}
+	if queued {
+		return actionSkipped, nil
+	}
+
+	meta.UpdatedAt = time.Now()
+
+	if meta.Attempts >= s.maxAttempts {
+		meta.Status = models.StatusFailed
+		meta.ErrorMessage = fmt.Sprintf("обработка не завершилась после %d повторных попыток", meta.Attempts)
+
+		if err := s.metaStorage.Update(ctx, meta); err != nil {
+			return actionSkipped, fmt.Errorf("metaStorage.Update: %w", err)
+		}
+
+		zlog.Logger.Warn().Msgf("Изображение %s помечено failed: попытки обработки исчерпаны", meta.ID)
+		s.publishFailed(ctx, meta)
+
+		return actionFailed, nil
+	}
+
+	meta.Attempts++
+	meta.Status = models.StatusPending
+
+	task := &models.ProcessingTask{
+		TenantID:      meta.TenantID,
+		ImageID:       meta.ID,
+		OriginalPath:  meta.OriginalPath,
+		Priority:      meta.Priority,
+		CorrelationID: meta.CorrelationID,
+	}
+	if err := s.outbox.UpdateWithTask(ctx, meta, task); err != nil {
+		return actionSkipped, fmt.Errorf("outbox.UpdateWithTask: %w", err)
+	}
+
+	zlog.Logger.Info().Msgf("Зависшая задача изображения %s повторно поставлена в очередь (попытка %d из %d)",
+		meta.ID, meta.Attempts, s.maxAttempts)
+
+	return actionRequeued, nil
+}
+
+// publishFailed - публикует image.failed для изображения, обработку которого поиск зависших задач
+// прекратил. Статус уже сохранен, поэтому ошибка публикации только пишется в лог.
+func (s *sweeper) publishFailed(ctx context.Context, meta *models.ImageMetadata) {
+	if s.events == nil {
+		return
+	}
+
+	event := &models.ImageEvent{
+		Type:          models.EventImageFailed,
+		TenantID:      meta.TenantID,
+		ImageID:       meta.ID,
+		CorrelationID: meta.CorrelationID,
+		Width:         meta.Width,
+		Height:        meta.Height,
+		Error:         meta.ErrorMessage,
+		OccurredAt:    time.Now().UTC(),
+	}
+	if err := s.events.PublishEvent(ctx, event); err != nil {
+		zlog.Logger.Warn().Err(err).Msgf("Не удалось опубликовать событие %s изображения %s", event.Type, event.ImageID)
+	}
+}
@@ -0,0 +1,164 @@
+package sweeper
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sunr3d/image-processor/mocks"
+	"github.com/sunr3d/image-processor/models"
+)
+
+func TestSweeper_SweepStuck_OK(t *testing.T) {
+	ctx := context.Background()
+	metaStorage := mocks.NewMetadataStorage(t)
+	outbox := mocks.NewOutbox(t)
+
+	old := time.Now().Add(-time.Hour)
+	crashed := &models.ImageMetadata{
+		ID:            "crashed",
+		TenantID:      "acme",
+		Status:        models.StatusProcessing,
+		Attempts:      1,
+		Priority:      models.PriorityBulk,
+		CorrelationID: "req-1",
+		UpdatedAt:     old,
+	}
+	exhausted := &models.ImageMetadata{
+		ID:            "exhausted",
+		TenantID:      "acme",
+		Status:        models.StatusProcessing,
+		Attempts:      3,
+		CorrelationID: "req-3",
+		UpdatedAt:     old,
+	}
+	queued := &models.ImageMetadata{ID: "queued", TenantID: "acme", Status: models.StatusProcessing, UpdatedAt: old}
+	raced := &models.ImageMetadata{ID: "raced", TenantID: "acme", Status: models.StatusProcessing, UpdatedAt: old}
+
+	metaStorage.EXPECT().
+		List(ctx, mock.MatchedBy(func(q *models.ImageQuery) bool {
+			return q.TenantID == "acme" &&
+				assert.ObjectsAreEqual([]models.ImageStatus{models.StatusProcessing, models.StatusPending}, q.Statuses) &&
+				time.Since(q.UpdatedBefore) >= 15*time.Minute
+		})).
+		Return(&models.ImagePage{Items: []*models.ImageMetadata{crashed, exhausted, queued, raced}}, nil).
+		Once()
+
+	outbox.EXPECT().HasTask(ctx, "acme", "crashed").Return(false, nil).Once()
+	outbox.EXPECT().
+		UpdateWithTask(ctx,
+			mock.MatchedBy(func(m *models.ImageMetadata) bool {
+				return m.ID == "crashed" && m.Status == models.StatusPending && m.Attempts == 2
+			}),
+			mock.MatchedBy(func(task *models.ProcessingTask) bool {
+				return task.ImageID == "crashed" && task.Priority == models.PriorityBulk && task.CorrelationID == "req-1"
+			})).
+		Return(nil).
+		Once()
+
+	outbox.EXPECT().HasTask(ctx, "acme", "exhausted").Return(false, nil).Once()
+	metaStorage.EXPECT().
+		Update(ctx, mock.MatchedBy(func(m *models.ImageMetadata) bool {
+			return m.ID == "exhausted" && m.Status == models.StatusFailed && m.ErrorMessage != ""
+		})).
+		Return(nil).
+		Once()
+
+	events := mocks.NewEventPublisher(t)
+	events.EXPECT().
+		PublishEvent(ctx, mock.MatchedBy(func(event *models.ImageEvent) bool {
+			return event.Type == models.EventImageFailed && event.TenantID == "acme" && event.ImageID == "exhausted" &&
+				event.CorrelationID == "req-3" && event.Error != ""
+		})).
+		Return(nil).
+		Once()
+
+	// Задача еще ждет публикации в outbox - изображение не трогается.
+	outbox.EXPECT().HasTask(ctx, "acme", "queued").Return(true, nil).Once()
+
+	// Worker взял задачу, пока шел поиск.
+	outbox.EXPECT().HasTask(ctx, "acme", "raced").Return(false, nil).Once()
+	outbox.EXPECT().
+		UpdateWithTask(ctx, mock.MatchedBy(func(m *models.ImageMetadata) bool { return m.ID == "raced" }), mock.Anything).
+		Return(fmt.Errorf("%w: raced", models.ErrVersionConflict)).
+		Once()
+
+	s := New(metaStorage, outbox, events, []models.Tenant{{ID: "acme"}}, 15*time.Minute, 3, time.Minute)
+
+	requeued, failed, err := s.sweepStuck(ctx)
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, requeued)
+	assert.Equal(t, 1, failed)
+}
+
+// Задача pending-изображения не записалась в outbox или ушла в DLQ - изображение ставится в очередь заново.
+func TestSweeper_SweepStuck_OrphanedPending(t *testing.T) {
+	ctx := context.Background()
+	metaStorage := mocks.NewMetadataStorage(t)
+	outbox := mocks.NewOutbox(t)
+
+	old := time.Now().Add(-time.Hour)
+	orphaned := &models.ImageMetadata{
+		ID:            "orphaned",
+		TenantID:      "acme",
+		Status:        models.StatusPending,
+		Priority:      models.PriorityInteractive,
+		CorrelationID: "req-2",
+		UpdatedAt:     old,
+	}
+	waiting := &models.ImageMetadata{ID: "waiting", TenantID: "acme", Status: models.StatusPending, UpdatedAt: old}
+
+	metaStorage.EXPECT().
+		List(ctx, mock.Anything).
+		Return(&models.ImagePage{Items: []*models.ImageMetadata{orphaned, waiting}}, nil).
+		Once()
+
+	outbox.EXPECT().HasTask(ctx, "acme", "orphaned").Return(false, nil).Once()
+	outbox.EXPECT().
+		UpdateWithTask(ctx,
+			mock.MatchedBy(func(m *models.ImageMetadata) bool {
+				return m.ID == "orphaned" && m.Status == models.StatusPending && m.Attempts == 1 &&
+					m.UpdatedAt.After(old)
+			}),
+			mock.MatchedBy(func(task *models.ProcessingTask) bool {
+				return task.ImageID == "orphaned" && task.Priority == models.PriorityInteractive &&
+					task.CorrelationID == "req-2"
+			})).
+		Return(nil).
+		Once()
+
+	// Задача ждет публикации в outbox - повторная постановка не нужна.
+	outbox.EXPECT().HasTask(ctx, "acme", "waiting").Return(true, nil).Once()
+
+	s := New(metaStorage, outbox, nil, []models.Tenant{{ID: "acme"}}, 15*time.Minute, 3, time.Minute)
+
+	requeued, failed, err := s.sweepStuck(ctx)
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, requeued)
+	assert.Zero(t, failed)
+}
+
+func TestSweeper_SweepStuck_ListError(t *testing.T) {
+	ctx := context.Background()
+	metaStorage := mocks.NewMetadataStorage(t)
+
+	metaStorage.EXPECT().
+		List(ctx, mock.Anything).
+		Return(nil, assert.AnError).
+		Once()
+
+	s := New(metaStorage, mocks.NewOutbox(t), nil, nil, 15*time.Minute, 3, time.Minute)
+
+	requeued, failed, err := s.sweepStuck(ctx)
+
+	assert.Error(t, err)
+	assert.Zero(t, requeued)
+	assert.Zero(t, failed)
+}
@@ -1,8 +1,11 @@
 package worker
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/wb-go/wbf/zlog"
@@ -12,52 +15,135 @@ import (
 	"github.com/sunr3d/image-processor/models"
 )
 
+// requeueTimeout - сколько ждать возврата изображения прерванной задачи в статус pending при остановке.
+const requeueTimeout = 10 * time.Second
+
 type worker struct {
-	processor   services.ImageProcessor
-	imgStorage  infra.ImageStorage
-	metaStorage infra.MetadataStorage
-	subscriber  infra.Subscriber
+	processor     services.ImageProcessor
+	imgStorage    infra.ImageStorage
+	metaStorage   infra.MetadataStorage
+	subscriber    infra.Subscriber
+	events        infra.EventPublisher
+	shutdownGrace time.Duration
+
+	// Счетчики задач при остановке: завершенные за время shutdownGrace и возвращенные в очередь.
+	drained  atomic.Int64
+	requeued atomic.Int64
 }
 
-// New - конструктор Worker.
-func New(proc services.ImageProcessor, imgStor infra.ImageStorage, metaStor infra.MetadataStorage, sub infra.Subscriber) *worker {
+// New - конструктор Worker. При остановке начатые задачи получают shutdownGrace на завершение,
+// изображения незавершенных возвращаются в статус pending, а сами задачи остаются неподтвержденными
+// и доставляются брокером повторно. events получает события image.completed и image.failed
+// (nil - события не публикуются).
+func New(
+	proc services.ImageProcessor,
+	imgStor infra.ImageStorage,
+	metaStor infra.MetadataStorage,
+	sub infra.Subscriber,
+	events infra.EventPublisher,
+	shutdownGrace time.Duration,
+) *worker {
 	return &worker{
-		processor:   proc,
-		imgStorage:  imgStor,
-		metaStorage: metaStor,
-		subscriber:  sub,
+		processor:     proc,
+		imgStorage:    imgStor,
+		metaStorage:   metaStor,
+		subscriber:    sub,
+		events:        events,
+		shutdownGrace: shutdownGrace,
 	}
 }
 
 func (w *worker) Start(ctx context.Context) error {
 	zlog.Logger.Info().Msg("Worker запущен, ожидание задач из брокера...")
 
-	return w.subscriber.Subscribe(ctx, w.processTask)
+	// Задачи выполняются в отдельном контексте: после остановки ctx начатые задачи
+	// дорабатывают shutdownGrace, и только затем прерываются.
+	workCtx, cancelWork := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelWork()
+
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-stopped:
+			return
+		}
+
+		zlog.Logger.Info().Msgf("Остановка worker: ожидание начатых задач до %s", w.shutdownGrace)
+		timer := time.NewTimer(w.shutdownGrace)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+			zlog.Logger.Warn().Msg("Время на завершение задач истекло, незавершенные задачи возвращаются в очередь")
+			cancelWork()
+		case <-stopped:
+		}
+	}()
+
+	err := w.subscriber.Subscribe(ctx, func(attemptCtx context.Context, task *models.ProcessingTask) error {
+		taskCtx := workCtx
+		if models.IsLastAttempt(attemptCtx) {
+			taskCtx = models.WithLastAttempt(workCtx)
+		}
+
+		err := w.processTask(taskCtx, task)
+		if ctx.Err() != nil && err == nil {
+			w.drained.Add(1)
+		}
+		return err
+	})
+
+	if ctx.Err() != nil {
+		zlog.Logger.Info().Msgf("Worker остановлен: задач завершено после сигнала остановки %d, возвращено в очередь %d",
+			w.drained.Load(), w.requeued.Load())
+	}
+
+	return err
 }
 
 func (w *worker) processTask(ctx context.Context, task *models.ProcessingTask) error {
 	zlog.Logger.Info().Msgf("Обработка задачи: %s", task.ImageID)
 
-	meta, err := w.setMetaToProcessing(ctx, task.ImageID)
+	if task.TenantID == "" {
+		task.TenantID = models.DefaultTenantID
+	}
+
+	meta, err := w.metaStorage.Get(ctx, task.TenantID, task.ImageID)
 	if err != nil {
+		return fmt.Errorf("metaStorage.Get: %w", err)
+	}
+
+	// Брокер доставляет задачи "хотя бы один раз": после сбоя до подтверждения задача придет
+	// повторно, и уже выполненную работу повторять не нужно. Событие image.completed при этом
+	// не публикуется повторно: его уже опубликовала обработка, сохранившая статус.
+	if reason := skipReason(meta); reason != "" {
+		zlog.Logger.Info().Msgf("Задача %s пропущена: %s", task.ImageID, reason)
+		return nil
+	}
+
+	if err := w.setMetaToProcessing(ctx, meta); err != nil {
 		return fmt.Errorf("setMetaToProcessing: %w", err)
 	}
 
-	result, err := w.processImg(task.OriginalPath)
+	result, err := w.processImg(ctx, task.TenantID, task.ImageID)
 	if err != nil {
-		w.handleProcessingErr(ctx, meta, err)
-		return fmt.Errorf("processImage: %w", err)
+		return errors.Join(fmt.Errorf("processImage: %w", err), w.handleProcessingErr(ctx, meta, task, err))
 	}
 
-	paths, err := w.saveImages(ctx, task.ImageID, result)
+	paths, err := w.saveImages(ctx, task.TenantID, task.ImageID, result)
 	if err != nil {
-		w.handleProcessingErr(ctx, meta, err)
-		return fmt.Errorf("saveImages: %w", err)
+		return errors.Join(fmt.Errorf("saveImages: %w", err), w.handleProcessingErr(ctx, meta, task, err))
 	}
 
-	if err := w.setMetaToCompleted(ctx, meta, paths); err != nil {
+	if err := w.setMetaToCompleted(ctx, meta, paths, result); err != nil {
+		if ctx.Err() != nil {
+			w.requeue(meta, task)
+		}
 		return fmt.Errorf("setMetaToCompleted: %w", err)
 	}
+	w.publishEvent(ctx, completedEvent(meta, task, result))
 
 	zlog.Logger.Info().Msgf("Задача %s успешно обработана", task.ImageID)
 
@@ -65,24 +151,37 @@ func (w *worker) processTask(ctx context.Context, task *models.ProcessingTask) e
 }
 
 // helpers
-func (w *worker) setMetaToProcessing(ctx context.Context, imageID string) (*models.ImageMetadata, error) {
-	meta, err := w.metaStorage.Get(ctx, imageID)
-	if err != nil {
-		return nil, fmt.Errorf("metaStorage.Get: %w", err)
+// skipReason - причина не обрабатывать изображение повторно или пустая строка.
+func skipReason(meta *models.ImageMetadata) string {
+	switch {
+	case meta.Status == models.StatusCompleted:
+		return "изображение уже обработано"
+	case meta.Deleted():
+		return "изображение удалено"
+	default:
+		return ""
 	}
+}
 
+func (w *worker) setMetaToProcessing(ctx context.Context, meta *models.ImageMetadata) error {
 	meta.Status = models.StatusProcessing
 	meta.UpdatedAt = time.Now()
 
 	if err := w.metaStorage.Update(ctx, meta); err != nil {
-		return nil, fmt.Errorf("metaStorage.Update: %w", err)
+		return fmt.Errorf("metaStorage.Update: %w", err)
 	}
 
-	return meta, nil
+	return nil
 }
 
-func (w *worker) processImg(imagePath string) (*models.ProcessedImages, error) {
-	result, err := w.processor.Process(imagePath)
+func (w *worker) processImg(ctx context.Context, tenantID, imageID string) (*models.ProcessedImages, error) {
+	original, _, err := w.imgStorage.Open(ctx, tenantID, imageID, "original")
+	if err != nil {
+		return nil, fmt.Errorf("imgStorage.Open: %w", err)
+	}
+	defer original.Close()
+
+	result, err := w.processor.Process(original)
 	if err != nil {
 		return nil, fmt.Errorf("processor.Process: %w", err)
 	}
@@ -90,25 +189,25 @@ func (w *worker) processImg(imagePath string) (*models.ProcessedImages, error) {
 	return result, nil
 }
 
-func (w *worker) saveImages(ctx context.Context, imageID string, result *models.ProcessedImages) (map[string]string, error) {
+func (w *worker) saveImages(ctx context.Context, tenantID, imageID string, result *models.ProcessedImages) (map[string]string, error) {
 	paths := make(map[string]string)
 
 	// 1. Resized
-	resizedPath, err := w.imgStorage.SaveProcessed(ctx, imageID, "resized", result.Resized)
+	resizedPath, err := w.imgStorage.SaveProcessed(ctx, tenantID, imageID, "resized", bytes.NewReader(result.Resized), int64(len(result.Resized)))
 	if err != nil {
 		return nil, fmt.Errorf("imgStorage.SaveProcessed Resized: %w", err)
 	}
 	paths["resized"] = resizedPath
 
 	// 2. Thumbnail
-	thumbnailPath, err := w.imgStorage.SaveProcessed(ctx, imageID, "thumbnail", result.Thumbnail)
+	thumbnailPath, err := w.imgStorage.SaveProcessed(ctx, tenantID, imageID, "thumbnail", bytes.NewReader(result.Thumbnail), int64(len(result.Thumbnail)))
 	if err != nil {
 		return nil, fmt.Errorf("imgStorage.SaveProcessed Thumbnail: %w", err)
 	}
 	paths["thumbnail"] = thumbnailPath
 
 	// 3. Watermarked
-	watermarkedPath, err := w.imgStorage.SaveProcessed(ctx, imageID, "watermarked", result.Watermarked)
+	watermarkedPath, err := w.imgStorage.SaveProcessed(ctx, tenantID, imageID, "watermarked", bytes.NewReader(result.Watermarked), int64(len(result.Watermarked)))
 	if err != nil {
 		return nil, fmt.Errorf("imgStorage.SaveProcessed Watermarked: %w", err)
 	}
@@ -117,11 +216,12 @@ func (w *worker) saveImages(ctx context.Context, imageID string, result *models.
 	return paths, nil
 }
 
-func (w *worker) setMetaToCompleted(ctx context.Context, meta *models.ImageMetadata, paths map[string]string) error {
+func (w *worker) setMetaToCompleted(ctx context.Context, meta *models.ImageMetadata, paths map[string]string, result *models.ProcessedImages) error {
 	meta.Status = models.StatusCompleted
 	meta.ResizedPath = paths["resized"]
 	meta.ThumbnailPath = paths["thumbnail"]
 	meta.WatermarkedPath = paths["watermarked"]
+	meta.ProcessedSize = int64(len(result.Resized) + len(result.Thumbnail) + len(result.Watermarked))
 	meta.UpdatedAt = time.Now()
 
 	if err := w.metaStorage.Update(ctx, meta); err != nil {
@@ -131,7 +231,17 @@ func (w *worker) setMetaToCompleted(ctx context.Context, meta *models.ImageMetad
 	return nil
 }
 
-func (w *worker) handleProcessingErr(ctx context.Context, meta *models.ImageMetadata, procErr error) error {
+// handleProcessingErr - после последней попытки, когда задача уходит в DLQ, помечает изображение
+// failed и публикует image.failed. До этого изображение остается в processing: задачу повторит брокер.
+// Если обработка прервана остановкой worker, задача вместо этого возвращается в очередь.
+func (w *worker) handleProcessingErr(ctx context.Context, meta *models.ImageMetadata, task *models.ProcessingTask, procErr error) error {
+	if ctx.Err() != nil {
+		return w.requeue(meta, task)
+	}
+	if !models.IsLastAttempt(ctx) {
+		return nil
+	}
+
 	meta.Status = models.StatusFailed
 	meta.ErrorMessage = procErr.Error()
 	meta.UpdatedAt = time.Now()
@@ -139,6 +249,88 @@ func (w *worker) handleProcessingErr(ctx context.Context, meta *models.ImageMeta
 	if err := w.metaStorage.Update(ctx, meta); err != nil {
 		return fmt.Errorf("metaStorage.Update: %w", err)
 	}
+	w.publishEvent(ctx, failedEvent(meta, task))
+
+	return nil
+}
+
+// publishEvent - публикует событие об обработке. Статус изображения уже сохранен, поэтому ошибка
+// публикации не прерывает задачу: она пишется в лог, а статус остается доступен через API.
+func (w *worker) publishEvent(ctx context.Context, event *models.ImageEvent) {
+	if w.events == nil {
+		return
+	}
+
+	if err := w.events.PublishEvent(ctx, event); err != nil {
+		zlog.Logger.Warn().Err(err).Msgf("Не удалось опубликовать событие %s изображения %s", event.Type, event.ImageID)
+	}
+}
+
+// completedEvent - событие image.completed с сохраненными вариантами изображения.
+func completedEvent(meta *models.ImageMetadata, task *models.ProcessingTask, result *models.ProcessedImages) *models.ImageEvent {
+	event := imageEvent(models.EventImageCompleted, meta, task)
+
+	variants := []struct {
+		name string
+		path string
+		data []byte
+	}{
+		{name: "resized", path: meta.ResizedPath, data: result.Resized},
+		{name: "thumbnail", path: meta.ThumbnailPath, data: result.Thumbnail},
+		{name: "watermarked", path: meta.WatermarkedPath, data: result.Watermarked},
+	}
+	for _, v := range variants {
+		size := result.Sizes[v.name]
+		event.Variants = append(event.Variants, models.ImageVariant{
+			Name:   v.name,
+			Path:   v.path,
+			Size:   int64(len(v.data)),
+			Width:  size.Width,
+			Height: size.Height,
+		})
+	}
+
+	return event
+}
+
+// failedEvent - событие image.failed с текстом ошибки обработки.
+func failedEvent(meta *models.ImageMetadata, task *models.ProcessingTask) *models.ImageEvent {
+	event := imageEvent(models.EventImageFailed, meta, task)
+	event.Error = meta.ErrorMessage
+
+	return event
+}
+
+func imageEvent(eventType models.ImageEventType, meta *models.ImageMetadata, task *models.ProcessingTask) *models.ImageEvent {
+	return &models.ImageEvent{
+		Type:          eventType,
+		TenantID:      task.TenantID,
+		ImageID:       task.ImageID,
+		CorrelationID: task.CorrelationID,
+		Width:         meta.Width,
+		Height:        meta.Height,
+		OccurredAt:    time.Now().UTC(),
+	}
+}
+
+// requeue - возвращает изображение прерванной задачи в статус pending. Новая задача не ставится:
+// прерванная остается неподтвержденной и доставляется брокером повторно, а если брокер ее потерял,
+// изображение найдет поиск зависших задач. Вызывается после отмены контекста задачи, поэтому
+// использует собственный таймаут.
+func (w *worker) requeue(meta *models.ImageMetadata, task *models.ProcessingTask) error {
+	ctx, cancel := context.WithTimeout(context.Background(), requeueTimeout)
+	defer cancel()
+
+	meta.Status = models.StatusPending
+	meta.UpdatedAt = time.Now()
+
+	if err := w.metaStorage.Update(ctx, meta); err != nil {
+		zlog.Logger.Error().Err(err).Msgf("Не удалось вернуть прерванную задачу %s в очередь", task.ImageID)
+		return fmt.Errorf("metaStorage.Update: %w", err)
+	}
+	w.requeued.Add(1)
+
+	zlog.Logger.Info().Msgf("Прерванная задача %s возвращена в очередь", task.ImageID)
 
 	return nil
 }
@@ -3,11 +3,16 @@ package worker
 import (
 	"context"
 	"errors"
+	"io"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/wb-go/wbf/retry"
 
+	"github.com/sunr3d/image-processor/internal/infra/broker/consume"
 	"github.com/sunr3d/image-processor/mocks"
 	"github.com/sunr3d/image-processor/models"
 )
@@ -18,7 +23,7 @@ func TestWorker_New(t *testing.T) {
 	mockMetaStorage := mocks.NewMetadataStorage(t)
 	mockSubscriber := mocks.NewSubscriber(t)
 
-	worker := New(mockProcessor, mockImgStorage, mockMetaStorage, mockSubscriber)
+	worker := New(mockProcessor, mockImgStorage, mockMetaStorage, mockSubscriber, nil, time.Second)
 
 	assert.NotNil(t, worker)
 }
@@ -32,17 +37,23 @@ func TestWorker_ProcessTask_OK(t *testing.T) {
 	mockMetaStorage := mocks.NewMetadataStorage(t)
 	mockSubscriber := mocks.NewSubscriber(t)
 
+	mockImgStorage.EXPECT().
+		Open(ctx, models.DefaultTenantID, "test-id", "original").
+		Return(nopSeekCloser{strings.NewReader("original data")}, &models.ObjectInfo{Size: 13}, nil).
+		Once()
+
 	mockProcessor.EXPECT().
-		Process("/path/to/original").
+		Process(mock.Anything).
 		Return(&models.ProcessedImages{
 			Resized:     []byte("resized data"),
 			Thumbnail:   []byte("thumbnail data"),
 			Watermarked: []byte("watermarked data"),
+			Sizes:       map[string]models.ImageSize{"thumbnail": {Width: 200, Height: 200}},
 		}, nil).
 		Once()
 
 	mockMetaStorage.EXPECT().
-		Get(ctx, "test-id").
+		Get(ctx, models.DefaultTenantID, "test-id").
 		Return(&models.ImageMetadata{ID: "test-id"}, nil).
 		Once()
 
@@ -52,17 +63,17 @@ func TestWorker_ProcessTask_OK(t *testing.T) {
 		Once()
 
 	mockImgStorage.EXPECT().
-		SaveProcessed(ctx, "test-id", "resized", []byte("resized data")).
+		SaveProcessed(ctx, models.DefaultTenantID, "test-id", "resized", mock.Anything, int64(12)).
 		Return("/path/to/resized", nil).
 		Once()
 
 	mockImgStorage.EXPECT().
-		SaveProcessed(ctx, "test-id", "thumbnail", []byte("thumbnail data")).
+		SaveProcessed(ctx, models.DefaultTenantID, "test-id", "thumbnail", mock.Anything, int64(14)).
 		Return("/path/to/thumbnail", nil).
 		Once()
 
 	mockImgStorage.EXPECT().
-		SaveProcessed(ctx, "test-id", "watermarked", []byte("watermarked data")).
+		SaveProcessed(ctx, models.DefaultTenantID, "test-id", "watermarked", mock.Anything, int64(16)).
 		Return("/path/to/watermarked", nil).
 		Once()
 
@@ -71,33 +82,52 @@ func TestWorker_ProcessTask_OK(t *testing.T) {
 		Return(nil).
 		Once()
 
-	worker := New(mockProcessor, mockImgStorage, mockMetaStorage, mockSubscriber)
+	mockEvents := mocks.NewEventPublisher(t)
+	mockEvents.EXPECT().
+		PublishEvent(ctx, mock.MatchedBy(func(event *models.ImageEvent) bool {
+			return event.Type == models.EventImageCompleted && event.ImageID == "test-id" &&
+				event.CorrelationID == "req-1" && len(event.Variants) == 3 &&
+				event.Variants[1] == models.ImageVariant{Name: "thumbnail", Path: "/path/to/thumbnail", Size: 14, Width: 200, Height: 200}
+		})).
+		Return(errors.New("broker is down")).
+		Once()
+
+	worker := New(mockProcessor, mockImgStorage, mockMetaStorage, mockSubscriber, mockEvents, time.Second)
 
 	task := &models.ProcessingTask{
-		ImageID:      "test-id",
-		OriginalPath: "/path/to/original",
+		TenantID:      models.DefaultTenantID,
+		ImageID:       "test-id",
+		OriginalPath:  "/path/to/original",
+		CorrelationID: "req-1",
 	}
 
 	err := worker.processTask(ctx, task)
 
+	// Ошибка публикации события не прерывает задачу: статус уже сохранен.
 	assert.NoError(t, err)
 }
 
 func TestWorker_ProcessTask_Error(t *testing.T) {
-	ctx := context.Background()
+	// image.failed публикуется только после последней попытки.
+	ctx := models.WithLastAttempt(context.Background())
 
 	mockProcessor := mocks.NewImageProcessor(t)
 	mockImgStorage := mocks.NewImageStorage(t)
 	mockMetaStorage := mocks.NewMetadataStorage(t)
 	mockSubscriber := mocks.NewSubscriber(t)
 
+	mockImgStorage.EXPECT().
+		Open(ctx, models.DefaultTenantID, "test-id", "original").
+		Return(nopSeekCloser{strings.NewReader("original data")}, &models.ObjectInfo{Size: 13}, nil).
+		Once()
+
 	mockProcessor.EXPECT().
-		Process("/path/to/original").
+		Process(mock.Anything).
 		Return(nil, errors.New("processing failed")).
 		Once()
 
 	mockMetaStorage.EXPECT().
-		Get(ctx, "test-id").
+		Get(ctx, models.DefaultTenantID, "test-id").
 		Return(&models.ImageMetadata{ID: "test-id"}, nil).
 		Once()
 
@@ -111,9 +141,19 @@ func TestWorker_ProcessTask_Error(t *testing.T) {
 		Return(nil).
 		Once()
 
-	worker := New(mockProcessor, mockImgStorage, mockMetaStorage, mockSubscriber)
+	mockEvents := mocks.NewEventPublisher(t)
+	mockEvents.EXPECT().
+		PublishEvent(ctx, mock.MatchedBy(func(event *models.ImageEvent) bool {
+			return event.Type == models.EventImageFailed && event.ImageID == "test-id" &&
+				strings.Contains(event.Error, "processing failed") && len(event.Variants) == 0
+		})).
+		Return(nil).
+		Once()
+
+	worker := New(mockProcessor, mockImgStorage, mockMetaStorage, mockSubscriber, mockEvents, time.Second)
 
 	task := &models.ProcessingTask{
+		TenantID:     models.DefaultTenantID,
 		ImageID:      "test-id",
 		OriginalPath: "/path/to/original",
 	}
@@ -124,6 +164,48 @@ func TestWorker_ProcessTask_Error(t *testing.T) {
 	assert.Contains(t, err.Error(), "processing failed")
 }
 
+func TestWorker_ProcessTask_FailedStatusError(t *testing.T) {
+	ctx := models.WithLastAttempt(context.Background())
+
+	mockProcessor := mocks.NewImageProcessor(t)
+	mockImgStorage := mocks.NewImageStorage(t)
+	mockMetaStorage := mocks.NewMetadataStorage(t)
+
+	mockMetaStorage.EXPECT().
+		Get(ctx, models.DefaultTenantID, "test-id").
+		Return(&models.ImageMetadata{ID: "test-id"}, nil).
+		Once()
+
+	mockMetaStorage.EXPECT().
+		Update(ctx, mock.MatchedBy(func(meta *models.ImageMetadata) bool { return meta.Status == models.StatusProcessing })).
+		Return(nil).
+		Once()
+
+	mockImgStorage.EXPECT().
+		Open(ctx, models.DefaultTenantID, "test-id", "original").
+		Return(nopSeekCloser{strings.NewReader("original data")}, &models.ObjectInfo{Size: 13}, nil).
+		Once()
+
+	mockProcessor.EXPECT().
+		Process(mock.Anything).
+		Return(nil, errors.New("processing failed")).
+		Once()
+
+	mockMetaStorage.EXPECT().
+		Update(ctx, mock.MatchedBy(func(meta *models.ImageMetadata) bool { return meta.Status == models.StatusFailed })).
+		Return(errors.New("update failed")).
+		Once()
+
+	worker := New(mockProcessor, mockImgStorage, mockMetaStorage, mocks.NewSubscriber(t), mocks.NewEventPublisher(t), time.Second)
+
+	err := worker.processTask(ctx, &models.ProcessingTask{TenantID: models.DefaultTenantID, ImageID: "test-id"})
+
+	// Ошибка сохранения статуса failed не теряется, а события без сохраненного статуса нет.
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "processing failed")
+	assert.Contains(t, err.Error(), "update failed")
+}
+
 func TestWorker_ProcessTask_SaveImagesError(t *testing.T) {
 	ctx := context.Background()
 
@@ -132,8 +214,13 @@ func TestWorker_ProcessTask_SaveImagesError(t *testing.T) {
 	mockMetaStorage := mocks.NewMetadataStorage(t)
 	mockSubscriber := mocks.NewSubscriber(t)
 
+	mockImgStorage.EXPECT().
+		Open(ctx, models.DefaultTenantID, "test-id", "original").
+		Return(nopSeekCloser{strings.NewReader("original data")}, &models.ObjectInfo{Size: 13}, nil).
+		Once()
+
 	mockProcessor.EXPECT().
-		Process("/path/to/original").
+		Process(mock.Anything).
 		Return(&models.ProcessedImages{
 			Resized:     []byte("resized data"),
 			Thumbnail:   []byte("thumbnail data"),
@@ -142,7 +229,7 @@ func TestWorker_ProcessTask_SaveImagesError(t *testing.T) {
 		Once()
 
 	mockMetaStorage.EXPECT().
-		Get(ctx, "test-id").
+		Get(ctx, models.DefaultTenantID, "test-id").
 		Return(&models.ImageMetadata{ID: "test-id"}, nil).
 		Once()
 
@@ -152,24 +239,21 @@ func TestWorker_ProcessTask_SaveImagesError(t *testing.T) {
 		Once()
 
 	mockImgStorage.EXPECT().
-		SaveProcessed(ctx, "test-id", "resized", []byte("resized data")).
+		SaveProcessed(ctx, models.DefaultTenantID, "test-id", "resized", mock.Anything, int64(12)).
 		Return("", errors.New("save failed")).
 		Once()
 
-	mockMetaStorage.EXPECT().
-		Update(ctx, mock.AnythingOfType("*models.ImageMetadata")).
-		Return(nil).
-		Once()
-
-	worker := New(mockProcessor, mockImgStorage, mockMetaStorage, mockSubscriber)
+	worker := New(mockProcessor, mockImgStorage, mockMetaStorage, mockSubscriber, nil, time.Second)
 
 	task := &models.ProcessingTask{
+		TenantID:     models.DefaultTenantID,
 		ImageID:      "test-id",
 		OriginalPath: "/path/to/original",
 	}
 
 	err := worker.processTask(ctx, task)
 
+	// Попытка не последняя: изображение остается в processing до повтора брокером.
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "save failed")
 }
@@ -182,8 +266,13 @@ func TestWorker_ProcessTask_UpdateMetadataError(t *testing.T) {
 	mockMetaStorage := mocks.NewMetadataStorage(t)
 	mockSubscriber := mocks.NewSubscriber(t)
 
+	mockImgStorage.EXPECT().
+		Open(ctx, models.DefaultTenantID, "test-id", "original").
+		Return(nopSeekCloser{strings.NewReader("original data")}, &models.ObjectInfo{Size: 13}, nil).
+		Once()
+
 	mockProcessor.EXPECT().
-		Process("/path/to/original").
+		Process(mock.Anything).
 		Return(&models.ProcessedImages{
 			Resized:     []byte("resized data"),
 			Thumbnail:   []byte("thumbnail data"),
@@ -192,7 +281,7 @@ func TestWorker_ProcessTask_UpdateMetadataError(t *testing.T) {
 		Once()
 
 	mockMetaStorage.EXPECT().
-		Get(ctx, "test-id").
+		Get(ctx, models.DefaultTenantID, "test-id").
 		Return(&models.ImageMetadata{ID: "test-id"}, nil).
 		Once()
 
@@ -202,17 +291,17 @@ func TestWorker_ProcessTask_UpdateMetadataError(t *testing.T) {
 		Once()
 
 	mockImgStorage.EXPECT().
-		SaveProcessed(ctx, "test-id", "resized", []byte("resized data")).
+		SaveProcessed(ctx, models.DefaultTenantID, "test-id", "resized", mock.Anything, int64(12)).
 		Return("/path/to/resized", nil).
 		Once()
 
 	mockImgStorage.EXPECT().
-		SaveProcessed(ctx, "test-id", "thumbnail", []byte("thumbnail data")).
+		SaveProcessed(ctx, models.DefaultTenantID, "test-id", "thumbnail", mock.Anything, int64(14)).
 		Return("/path/to/thumbnail", nil).
 		Once()
 
 	mockImgStorage.EXPECT().
-		SaveProcessed(ctx, "test-id", "watermarked", []byte("watermarked data")).
+		SaveProcessed(ctx, models.DefaultTenantID, "test-id", "watermarked", mock.Anything, int64(16)).
 		Return("/path/to/watermarked", nil).
 		Once()
 
@@ -221,9 +310,10 @@ func TestWorker_ProcessTask_UpdateMetadataError(t *testing.T) {
 		Return(errors.New("update failed")).
 		Once()
 
-	worker := New(mockProcessor, mockImgStorage, mockMetaStorage, mockSubscriber)
+	worker := New(mockProcessor, mockImgStorage, mockMetaStorage, mockSubscriber, mocks.NewEventPublisher(t), time.Second)
 
 	task := &models.ProcessingTask{
+		TenantID:     models.DefaultTenantID,
 		ImageID:      "test-id",
 		OriginalPath: "/path/to/original",
 	}
@@ -233,3 +323,243 @@ func TestWorker_ProcessTask_UpdateMetadataError(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "update failed")
 }
+
+func TestWorker_ProcessTask_Redelivered(t *testing.T) {
+	tests := []struct {
+		name string
+		meta *models.ImageMetadata
+	}{
+		{name: "completed", meta: &models.ImageMetadata{ID: "test-id", Status: models.StatusCompleted}},
+		{name: "deleted", meta: &models.ImageMetadata{ID: "test-id", Status: models.StatusPending, DeletedAt: time.Now()}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			mockProcessor := mocks.NewImageProcessor(t)
+			mockImgStorage := mocks.NewImageStorage(t)
+			mockMetaStorage := mocks.NewMetadataStorage(t)
+			mockSubscriber := mocks.NewSubscriber(t)
+
+			mockMetaStorage.EXPECT().
+				Get(ctx, models.DefaultTenantID, "test-id").
+				Return(tt.meta, nil).
+				Once()
+
+			worker := New(mockProcessor, mockImgStorage, mockMetaStorage, mockSubscriber, nil, time.Second)
+
+			err := worker.processTask(ctx, &models.ProcessingTask{ImageID: "test-id"})
+
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestWorker_ProcessTask_RedeliveredNoEvent(t *testing.T) {
+	ctx := context.Background()
+
+	mockMetaStorage := mocks.NewMetadataStorage(t)
+
+	mockMetaStorage.EXPECT().
+		Get(ctx, models.DefaultTenantID, "test-id").
+		Return(&models.ImageMetadata{ID: "test-id", Status: models.StatusCompleted}, nil).
+		Once()
+
+	worker := New(mocks.NewImageProcessor(t), mocks.NewImageStorage(t), mockMetaStorage, mocks.NewSubscriber(t), mocks.NewEventPublisher(t), time.Second)
+
+	err := worker.processTask(ctx, &models.ProcessingTask{ImageID: "test-id"})
+
+	// image.completed уже опубликован обработкой, сохранившей статус, и при повторной доставке не дублируется.
+	assert.NoError(t, err)
+}
+
+func TestWorker_ProcessTask_Interrupted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	mockProcessor := mocks.NewImageProcessor(t)
+	mockImgStorage := mocks.NewImageStorage(t)
+	mockMetaStorage := mocks.NewMetadataStorage(t)
+	mockSubscriber := mocks.NewSubscriber(t)
+
+	mockMetaStorage.EXPECT().
+		Get(ctx, models.DefaultTenantID, "test-id").
+		Return(&models.ImageMetadata{ID: "test-id"}, nil).
+		Once()
+
+	mockMetaStorage.EXPECT().
+		Update(ctx, mock.AnythingOfType("*models.ImageMetadata")).
+		Return(nil).
+		Once()
+
+	mockImgStorage.EXPECT().
+		Open(ctx, models.DefaultTenantID, "test-id", "original").
+		Return(nil, nil, context.Canceled).
+		Once()
+
+	// Новая задача не ставится: прерванную брокер доставит повторно.
+	mockMetaStorage.EXPECT().
+		Update(mock.Anything, mock.MatchedBy(func(m *models.ImageMetadata) bool { return m.Status == models.StatusPending })).
+		Return(nil).
+		Once()
+
+	worker := New(mockProcessor, mockImgStorage, mockMetaStorage, mockSubscriber, mocks.NewEventPublisher(t), time.Second)
+
+	err := worker.processTask(ctx, &models.ProcessingTask{ImageID: "test-id"})
+
+	assert.Error(t, err)
+	assert.Equal(t, int64(1), worker.requeued.Load())
+}
+
+// Start tests.
+func TestWorker_Start_DrainsInFlight(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	mockProcessor := mocks.NewImageProcessor(t)
+	mockImgStorage := mocks.NewImageStorage(t)
+	mockMetaStorage := mocks.NewMetadataStorage(t)
+	mockSubscriber := mocks.NewSubscriber(t)
+
+	mockMetaStorage.EXPECT().
+		Get(mock.Anything, models.DefaultTenantID, "test-id").
+		Return(&models.ImageMetadata{ID: "test-id", Status: models.StatusCompleted}, nil).
+		Once()
+
+	mockSubscriber.EXPECT().
+		Subscribe(ctx, mock.Anything).
+		RunAndReturn(func(ctx context.Context, handler func(context.Context, *models.ProcessingTask) error) error {
+			cancel()
+			return handler(ctx, &models.ProcessingTask{ImageID: "test-id"})
+		}).
+		Once()
+
+	worker := New(mockProcessor, mockImgStorage, mockMetaStorage, mockSubscriber, nil, time.Second)
+
+	err := worker.Start(ctx)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), worker.drained.Load())
+	assert.Equal(t, int64(0), worker.requeued.Load())
+}
+
+func TestWorker_Start_RequeuesAfterGrace(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	mockProcessor := mocks.NewImageProcessor(t)
+	mockImgStorage := mocks.NewImageStorage(t)
+	mockMetaStorage := mocks.NewMetadataStorage(t)
+	mockSubscriber := mocks.NewSubscriber(t)
+
+	mockMetaStorage.EXPECT().
+		Get(mock.Anything, models.DefaultTenantID, "test-id").
+		Return(&models.ImageMetadata{ID: "test-id"}, nil).
+		Once()
+
+	mockMetaStorage.EXPECT().
+		Update(mock.Anything, mock.AnythingOfType("*models.ImageMetadata")).
+		Return(nil).
+		Once()
+
+	mockImgStorage.EXPECT().
+		Open(mock.Anything, models.DefaultTenantID, "test-id", "original").
+		RunAndReturn(func(ctx context.Context, _, _, _ string) (io.ReadSeekCloser, *models.ObjectInfo, error) {
+			<-ctx.Done()
+			return nil, nil, ctx.Err()
+		}).
+		Once()
+
+	mockMetaStorage.EXPECT().
+		Update(mock.Anything, mock.MatchedBy(func(m *models.ImageMetadata) bool { return m.Status == models.StatusPending })).
+		Return(nil).
+		Once()
+
+	mockSubscriber.EXPECT().
+		Subscribe(ctx, mock.Anything).
+		RunAndReturn(func(ctx context.Context, handler func(context.Context, *models.ProcessingTask) error) error {
+			cancel()
+			assert.Error(t, handler(ctx, &models.ProcessingTask{ImageID: "test-id"}))
+			return nil
+		}).
+		Once()
+
+	worker := New(mockProcessor, mockImgStorage, mockMetaStorage, mockSubscriber, nil, 10*time.Millisecond)
+
+	err := worker.Start(ctx)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), worker.drained.Load())
+	assert.Equal(t, int64(1), worker.requeued.Load())
+}
+
+func TestWorker_Start_FailedEventAfterRetries(t *testing.T) {
+	mockProcessor := mocks.NewImageProcessor(t)
+	mockImgStorage := mocks.NewImageStorage(t)
+	mockMetaStorage := mocks.NewMetadataStorage(t)
+	mockSubscriber := mocks.NewSubscriber(t)
+
+	mockMetaStorage.EXPECT().
+		Get(mock.Anything, models.DefaultTenantID, "test-id").
+		Return(&models.ImageMetadata{ID: "test-id"}, nil).
+		Times(3)
+
+	var statuses []models.ImageStatus
+	mockMetaStorage.EXPECT().
+		Update(mock.Anything, mock.AnythingOfType("*models.ImageMetadata")).
+		RunAndReturn(func(_ context.Context, meta *models.ImageMetadata) error {
+			statuses = append(statuses, meta.Status)
+			return nil
+		}).
+		Times(4)
+
+	mockImgStorage.EXPECT().
+		Open(mock.Anything, models.DefaultTenantID, "test-id", "original").
+		RunAndReturn(func(context.Context, string, string, string) (io.ReadSeekCloser, *models.ObjectInfo, error) {
+			return nopSeekCloser{strings.NewReader("original data")}, &models.ObjectInfo{Size: 13}, nil
+		}).
+		Times(3)
+
+	mockProcessor.EXPECT().
+		Process(mock.Anything).
+		Return(nil, errors.New("processing failed")).
+		Times(3)
+
+	mockEvents := mocks.NewEventPublisher(t)
+	mockEvents.EXPECT().
+		PublishEvent(mock.Anything, mock.MatchedBy(func(event *models.ImageEvent) bool {
+			return event.Type == models.EventImageFailed && event.ImageID == "test-id"
+		})).
+		Return(nil).
+		Once()
+
+	mockSubscriber.EXPECT().
+		Subscribe(mock.Anything, mock.Anything).
+		RunAndReturn(func(ctx context.Context, handler func(context.Context, *models.ProcessingTask) error) error {
+			attempts, err := consume.Handle(ctx, handler, &models.ProcessingTask{ImageID: "test-id"},
+				retry.Strategy{Attempts: 3, Delay: time.Millisecond, Backoff: 1})
+			assert.Equal(t, 3, attempts)
+			assert.Error(t, err)
+			return nil
+		}).
+		Once()
+
+	worker := New(mockProcessor, mockImgStorage, mockMetaStorage, mockSubscriber, mockEvents, time.Second)
+
+	err := worker.Start(context.Background())
+
+	// Промежуточные неудачи не помечают изображение failed и не публикуют image.failed:
+	// статус и событие появляются только после последней попытки.
+	assert.NoError(t, err)
+	assert.Equal(t, []models.ImageStatus{
+		models.StatusProcessing, models.StatusProcessing, models.StatusProcessing, models.StatusFailed,
+	}, statuses)
+}
+
+// nopSeekCloser - io.ReadSeekCloser поверх io.ReadSeeker без освобождения ресурсов.
+type nopSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (nopSeekCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"io"
+	"time"
+)
+
+// ObjectInfo - сведения о сохраненном объекте изображения, аналог os.FileInfo для любого хранилища.
+// ContentType может быть пустым, если хранилище его не запоминает.
+type ObjectInfo struct {
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// ImageContent - изображение для отдачи клиенту: поток байт либо подписанная ссылка на хранилище.
+// Заполнено ровно одно из полей Body и RedirectURL; Body закрывает вызывающая сторона.
+type ImageContent struct {
+	Body        io.ReadSeekCloser
+	ContentType string
+	Size        int64
+	ModTime     time.Time
+	RedirectURL string
+}
+
+// StoredImage - изображение, найденное в хранилище при инвентаризации. ModTime - время
+// последнего изменения любого из его файлов.
+type StoredImage struct {
+	ID      string
+	ModTime time.Time
+}
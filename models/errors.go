@@ -0,0 +1,15 @@
+package models
+
+import "errors"
+
+// ErrVersionConflict - метаданные были изменены другим процессом после чтения (lost update).
+var ErrVersionConflict = errors.New("конфликт версий метаданных")
+
+// ErrPresignNotSupported - хранилище изображений не умеет выдавать подписанные ссылки.
+var ErrPresignNotSupported = errors.New("хранилище не поддерживает подписанные ссылки")
+
+// ErrQuotaExceeded - новое изображение не умещается в квоты тенанта.
+var ErrQuotaExceeded = errors.New("превышена квота")
+
+// ErrImageNotFound - в хранилище изображений нет запрошенного файла или объекта.
+var ErrImageNotFound = errors.New("изображение не найдено")
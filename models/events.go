@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// ImageEventType - тип события об обработке изображения.
+type ImageEventType string
+
+const (
+	// EventImageCompleted - изображение обработано, варианты сохранены.
+	EventImageCompleted ImageEventType = "image.completed"
+	// EventImageFailed - обработка изображения завершилась ошибкой.
+	EventImageFailed ImageEventType = "image.failed"
+)
+
+// ImageVariant - сохраненный вариант обработанного изображения: resized, thumbnail или watermarked.
+type ImageVariant struct {
+	Name   string
+	Path   string
+	Size   int64 `json:",omitempty"`
+	Width  int   `json:",omitempty"`
+	Height int   `json:",omitempty"`
+}
+
+// ImageEvent - событие о завершении обработки изображения для других сервисов. Width и Height -
+// размеры оригинала; Variants заполняются для image.completed, Error - для image.failed.
+type ImageEvent struct {
+	Type          ImageEventType
+	TenantID      string
+	ImageID       string
+	CorrelationID string         `json:",omitempty"`
+	Width         int            `json:",omitempty"`
+	Height        int            `json:",omitempty"`
+	Variants      []ImageVariant `json:",omitempty"`
+	Error         string         `json:",omitempty"`
+	OccurredAt    time.Time
+}
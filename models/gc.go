@@ -0,0 +1,40 @@
+package models
+
+// GCIssueKind - вид несоответствия между хранилищем изображений и метаданными.
+type GCIssueKind string
+
+const (
+	// GCOrphanFiles - файлы изображения есть в хранилище, метаданных нет.
+	GCOrphanFiles GCIssueKind = "orphan_files"
+	// GCMissingOriginal - метаданные есть, оригинала в хранилище нет.
+	GCMissingOriginal GCIssueKind = "missing_original"
+	// GCMissingDerivatives - изображение обработано, но части производных в хранилище нет.
+	GCMissingDerivatives GCIssueKind = "missing_derivatives"
+)
+
+// GCIssue - найденное несоответствие. Repaired - исправлено ли оно в этом запуске.
+type GCIssue struct {
+	Kind     GCIssueKind
+	TenantID string
+	ImageID  string
+	Details  string
+	Repaired bool
+}
+
+// GCReport - результат сверки хранилища изображений с метаданными.
+type GCReport struct {
+	ImagesChecked int
+	Issues        []GCIssue
+}
+
+// Count - количество несоответствий заданного вида.
+func (r *GCReport) Count(kind GCIssueKind) int {
+	n := 0
+	for _, issue := range r.Issues {
+		if issue.Kind == kind {
+			n++
+		}
+	}
+
+	return n
+}
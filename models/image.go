@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"strings"
+	"time"
+)
 
 type ImageStatus string
 
@@ -11,21 +14,107 @@ const (
 	StatusFailed     ImageStatus = "failed"
 )
 
+// StorageTier - уровень хранения оригинала: горячий (основное хранилище) или холодный (архив).
+type StorageTier string
+
+const (
+	TierHot  StorageTier = "hot"
+	TierCold StorageTier = "cold"
+)
+
+// ImageMetadata - метаданные изображения. Attempts - сколько раз зависшая обработка изображения
+// ставилась в очередь повторно; счетчик сбрасывается при новой постановке на обработку
+// (восстановление из архива, повторная обработка). Priority и CorrelationID - поля последней
+// поставленной задачи на обработку, с которыми задача ставится в очередь повторно.
 type ImageMetadata struct {
 	ID              string
+	TenantID        string
 	OriginalName    string
 	OriginalPath    string
 	ResizedPath     string
 	ThumbnailPath   string
 	WatermarkedPath string
+	OriginalSize    int64
+	ProcessedSize   int64
+	Format          string
+	Width           int
+	Height          int
+	Tags            []string
+	Tier            StorageTier
+	AccessedAt      time.Time
+	ExpiresAt       time.Time
+	DeletedAt       time.Time
+	Version         int64
 	Status          ImageStatus
+	Attempts        int
+	Priority        TaskPriority `json:",omitempty"`
+	CorrelationID   string       `json:",omitempty"`
 	ErrorMessage    string
 	CreatedAt       time.Time
 	UpdatedAt       time.Time
 }
 
+type UploadOptions struct {
+	Tags []string
+	// TTL - срок хранения изображения; 0 - срок по умолчанию тенанта.
+	TTL time.Duration
+	// Priority - приоритет обработки; пустой - PriorityInteractive.
+	Priority TaskPriority
+}
+
+// ImageSize - размеры изображения в пикселях.
+type ImageSize struct {
+	Width  int
+	Height int
+}
+
+// ProcessedImages - варианты обработанного изображения. Sizes - размеры вариантов по имени
+// (resized, thumbnail, watermarked).
 type ProcessedImages struct {
 	Resized     []byte
 	Thumbnail   []byte
 	Watermarked []byte
+	Sizes       map[string]ImageSize
+}
+
+// DerivativesCount - количество сохраненных производных изображений.
+func (m *ImageMetadata) DerivativesCount() int {
+	count := 0
+	for _, path := range []string{m.ResizedPath, m.ThumbnailPath, m.WatermarkedPath} {
+		if path != "" {
+			count++
+		}
+	}
+
+	return count
+}
+
+// LastAccess - время последнего обращения к изображению; до первого обращения - время загрузки.
+func (m *ImageMetadata) LastAccess() time.Time {
+	if m.AccessedAt.IsZero() {
+		return m.CreatedAt
+	}
+
+	return m.AccessedAt
+}
+
+// Expired - истек ли срок хранения изображения к моменту now. Изображения без срока не истекают.
+func (m *ImageMetadata) Expired(now time.Time) bool {
+	return !m.ExpiresAt.IsZero() && m.ExpiresAt.Before(now)
+}
+
+// Deleted - удалено ли изображение (мягко, с возможностью восстановления).
+func (m *ImageMetadata) Deleted() bool {
+	return !m.DeletedAt.IsZero()
+}
+
+// HasTag - проверяет наличие тега у изображения.
+func (m *ImageMetadata) HasTag(tag string) bool {
+	for _, t := range m.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+
+	return false
 }
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// OutboxEntry - задача на обработку в журнале outbox, еще не опубликованная в брокер.
+// AvailableAt - когда запись можно забрать на публикацию: после захвата relay сдвигает его
+// на время аренды, после неудачной публикации - на задержку перед повтором.
+type OutboxEntry struct {
+	ID          string
+	Task        ProcessingTask
+	Attempts    int
+	LastError   string
+	CreatedAt   time.Time
+	AvailableAt time.Time
+}
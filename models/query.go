@@ -0,0 +1,206 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	SortByCreatedAt = "created_at"
+	SortByName      = "name"
+	SortBySize      = "size"
+
+	DefaultPageLimit = 50
+	MaxPageLimit     = 100
+
+	// SortTimeLayout - формат времени, при котором строковое сравнение совпадает с хронологическим.
+	SortTimeLayout = "2006-01-02T15:04:05.000000000Z"
+)
+
+// ImageQuery - параметры поиска изображений тенанта. Нулевые значения фильтров не ограничивают выборку.
+// ExpiresBefore отбирает изображения со сроком хранения, истекающим раньше указанного времени,
+// UpdatedBefore - изображения, метаданные которых не менялись с указанного времени.
+// Удаленные изображения по умолчанию не попадают в выборку: DeletedBefore отбирает только изображения,
+// удаленные раньше указанного времени, WithDeleted добавляет удаленные к остальным.
+type ImageQuery struct {
+	TenantID      string
+	Statuses      []ImageStatus
+	CreatedFrom   time.Time
+	CreatedTo     time.Time
+	ExpiresBefore time.Time
+	UpdatedBefore time.Time
+	DeletedBefore time.Time
+	WithDeleted   bool
+	NameContains  string
+	Format        string
+	MinWidth      int
+	MaxWidth      int
+	MinHeight     int
+	MaxHeight     int
+	Tags          []string
+	SortBy        string
+	Desc          bool
+	Cursor        string
+	Limit         int
+}
+
+type ImagePage struct {
+	Items      []*ImageMetadata
+	NextCursor string
+}
+
+// Matches - проверяет, удовлетворяют ли метаданные фильтрам запроса.
+func (q *ImageQuery) Matches(meta *ImageMetadata) bool {
+	if meta.TenantID != q.TenantID {
+		return false
+	}
+
+	switch {
+	case !q.DeletedBefore.IsZero():
+		if !meta.Deleted() || !meta.DeletedAt.Before(q.DeletedBefore) {
+			return false
+		}
+	case !q.WithDeleted:
+		if meta.Deleted() {
+			return false
+		}
+	}
+
+	if len(q.Statuses) > 0 {
+		found := false
+		for _, st := range q.Statuses {
+			if meta.Status == st {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if !q.CreatedFrom.IsZero() && meta.CreatedAt.Before(q.CreatedFrom) {
+		return false
+	}
+	if !q.CreatedTo.IsZero() && !meta.CreatedAt.Before(q.CreatedTo) {
+		return false
+	}
+
+	if !q.ExpiresBefore.IsZero() && !meta.Expired(q.ExpiresBefore) {
+		return false
+	}
+	if !q.UpdatedBefore.IsZero() && !meta.UpdatedAt.Before(q.UpdatedBefore) {
+		return false
+	}
+
+	if q.NameContains != "" && !strings.Contains(strings.ToLower(meta.OriginalName), strings.ToLower(q.NameContains)) {
+		return false
+	}
+	if q.Format != "" && !strings.EqualFold(meta.Format, q.Format) {
+		return false
+	}
+
+	if q.MinWidth > 0 && meta.Width < q.MinWidth {
+		return false
+	}
+	if q.MaxWidth > 0 && meta.Width > q.MaxWidth {
+		return false
+	}
+	if q.MinHeight > 0 && meta.Height < q.MinHeight {
+		return false
+	}
+	if q.MaxHeight > 0 && meta.Height > q.MaxHeight {
+		return false
+	}
+
+	for _, tag := range q.Tags {
+		if !meta.HasTag(tag) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// SortField - поле сортировки запроса; по умолчанию SortByCreatedAt.
+func (q *ImageQuery) SortField() string {
+	if q.SortBy == "" {
+		return SortByCreatedAt
+	}
+
+	return q.SortBy
+}
+
+// SortKey - ключ сортировки метаданных, сравнимый лексикографически.
+func (q *ImageQuery) SortKey(meta *ImageMetadata) string {
+	switch q.SortField() {
+	case SortByName:
+		return strings.ToLower(meta.OriginalName)
+	case SortBySize:
+		return fmt.Sprintf("%020d", meta.OriginalSize)
+	default:
+		return meta.CreatedAt.UTC().Format(SortTimeLayout)
+	}
+}
+
+// PageCursor - курсор запроса или nil для первой страницы. Курсор, выданный для другого поля
+// или направления сортировки, отклоняется: его позиция в другом порядке не имеет смысла.
+func (q *ImageQuery) PageCursor() (*PageCursor, error) {
+	if q.Cursor == "" {
+		return nil, nil
+	}
+
+	c, err := DecodeCursor(q.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.SortBy != q.SortField() || c.Desc != q.Desc {
+		return nil, fmt.Errorf("некорректный курсор: он выдан для другой сортировки")
+	}
+
+	return c, nil
+}
+
+// NextCursor - курсор страницы, следующей за last, в сортировке запроса.
+func (q *ImageQuery) NextCursor(last *ImageMetadata) string {
+	return EncodeCursor(PageCursor{
+		SortBy: q.SortField(),
+		Desc:   q.Desc,
+		Key:    q.SortKey(last),
+		ID:     last.ID,
+	})
+}
+
+// PageCursor - позиция последнего элемента страницы при keyset-пагинации и сортировка,
+// для которой она получена.
+type PageCursor struct {
+	SortBy string `json:"s"`
+	Desc   bool   `json:"d,omitempty"`
+	Key    string `json:"k"`
+	ID     string `json:"id"`
+}
+
+// EncodeCursor - кодирует курсор в непрозрачную строку.
+func EncodeCursor(c PageCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor - разбирает курсор, полученный от клиента.
+func DecodeCursor(raw string) (*PageCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, fmt.Errorf("некорректный курсор: %w", err)
+	}
+
+	var c PageCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("некорректный курсор: %w", err)
+	}
+
+	return &c, nil
+}
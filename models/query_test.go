@@ -0,0 +1,98 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImageQuery_Matches(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	meta := &ImageMetadata{
+		ID:           "img-1",
+		TenantID:     "t1",
+		OriginalName: "Cat.JPG",
+		Format:       "jpeg",
+		Width:        800,
+		Height:       600,
+		Tags:         []string{"Pets"},
+		Status:       StatusCompleted,
+		CreatedAt:    now,
+	}
+	deleted := *meta
+	deleted.DeletedAt = now
+
+	tests := []struct {
+		name  string
+		query ImageQuery
+		meta  *ImageMetadata
+		want  bool
+	}{
+		{name: "no filters", query: ImageQuery{TenantID: "t1"}, meta: meta, want: true},
+		{name: "other tenant", query: ImageQuery{TenantID: "t2"}, meta: meta, want: false},
+		{name: "status", query: ImageQuery{TenantID: "t1", Statuses: []ImageStatus{StatusPending, StatusCompleted}}, meta: meta, want: true},
+		{name: "other status", query: ImageQuery{TenantID: "t1", Statuses: []ImageStatus{StatusFailed}}, meta: meta, want: false},
+		{name: "created from", query: ImageQuery{TenantID: "t1", CreatedFrom: now}, meta: meta, want: true},
+		{name: "created to is exclusive", query: ImageQuery{TenantID: "t1", CreatedTo: now}, meta: meta, want: false},
+		{name: "name case insensitive", query: ImageQuery{TenantID: "t1", NameContains: "cat"}, meta: meta, want: true},
+		{name: "format", query: ImageQuery{TenantID: "t1", Format: "PNG"}, meta: meta, want: false},
+		{name: "width range", query: ImageQuery{TenantID: "t1", MinWidth: 800, MaxWidth: 1024}, meta: meta, want: true},
+		{name: "height too small", query: ImageQuery{TenantID: "t1", MinHeight: 700}, meta: meta, want: false},
+		{name: "tag", query: ImageQuery{TenantID: "t1", Tags: []string{"pets"}}, meta: meta, want: true},
+		{name: "missing tag", query: ImageQuery{TenantID: "t1", Tags: []string{"pets", "dogs"}}, meta: meta, want: false},
+		{name: "deleted hidden", query: ImageQuery{TenantID: "t1"}, meta: &deleted, want: false},
+		{name: "with deleted", query: ImageQuery{TenantID: "t1", WithDeleted: true}, meta: &deleted, want: true},
+		{name: "deleted before", query: ImageQuery{TenantID: "t1", DeletedBefore: now.Add(time.Second)}, meta: &deleted, want: true},
+		{name: "deleted before skips live", query: ImageQuery{TenantID: "t1", DeletedBefore: now.Add(time.Second)}, meta: meta, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.query.Matches(tt.meta))
+		})
+	}
+}
+
+func TestImageQuery_SortKey(t *testing.T) {
+	small := &ImageMetadata{OriginalName: "B.jpg", OriginalSize: 9, CreatedAt: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	large := &ImageMetadata{OriginalName: "a.jpg", OriginalSize: 10, CreatedAt: time.Date(2025, 1, 2, 0, 0, 0, 0, time.FixedZone("UTC+3", 3*3600))}
+
+	bySize := &ImageQuery{SortBy: SortBySize}
+	byName := &ImageQuery{SortBy: SortByName}
+	byDefault := &ImageQuery{}
+
+	assert.Less(t, bySize.SortKey(small), bySize.SortKey(large))
+	assert.Less(t, byName.SortKey(large), byName.SortKey(small))
+	assert.Less(t, byDefault.SortKey(small), byDefault.SortKey(large))
+	assert.Equal(t, SortByCreatedAt, byDefault.SortField())
+}
+
+func TestImageQuery_Cursor(t *testing.T) {
+	meta := &ImageMetadata{ID: "img-1", OriginalName: "Cat.jpg"}
+	q := &ImageQuery{SortBy: SortByName, Desc: true}
+
+	q.Cursor = q.NextCursor(meta)
+	cursor, err := q.PageCursor()
+
+	require.NoError(t, err)
+	assert.Equal(t, &PageCursor{SortBy: SortByName, Desc: true, Key: "cat.jpg", ID: "img-1"}, cursor)
+
+	tests := []struct {
+		name  string
+		query ImageQuery
+	}{
+		{name: "other field", query: ImageQuery{SortBy: SortBySize, Desc: true, Cursor: q.Cursor}},
+		{name: "other direction", query: ImageQuery{SortBy: SortByName, Cursor: q.Cursor}},
+		{name: "garbage", query: ImageQuery{SortBy: SortByName, Desc: true, Cursor: "not a cursor"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.query.PageCursor()
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "некорректный курсор")
+		})
+	}
+}
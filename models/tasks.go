@@ -1,6 +1,90 @@
 package models
 
+import (
+	"context"
+	"time"
+)
+
+// TaskPriority - приоритет задачи на обработку. Задачи разных приоритетов публикуются в разные
+// очереди, worker читает их с весами.
+type TaskPriority string
+
+const (
+	// PriorityInteractive - задачи пользователей, ожидающих результата (по умолчанию).
+	PriorityInteractive TaskPriority = "interactive"
+	// PriorityBulk - массовые загрузки, которые не должны задерживать интерактивные.
+	PriorityBulk TaskPriority = "bulk"
+)
+
+// ProcessingTask - задача на обработку изображения. OriginalPath оставлен для совместимости:
+// worker читает оригинал через ImageStorage по TenantID и ImageID. Пустой Priority
+// означает PriorityInteractive. CorrelationID связывает задачу с запросом, который ее поставил.
 type ProcessingTask struct {
-	ImageID      string
-	OriginalPath string
+	TenantID      string
+	ImageID       string
+	OriginalPath  string
+	Priority      TaskPriority `json:",omitempty"`
+	CorrelationID string       `json:",omitempty"`
+}
+
+// TaskType - тип задачи в конверте.
+type TaskType string
+
+// TaskTypeProcessImage - обработка загруженного изображения (ProcessingTask).
+const TaskTypeProcessImage TaskType = "image.process"
+
+// TaskSchemaVersion - текущая версия схемы конверта задачи. Версия 0 - задача без конверта,
+// как ее публиковали до появления версий.
+const TaskSchemaVersion = 1
+
+// TaskEnvelope - задача в брокере вместе со служебными полями. Поля задачи лежат на верхнем
+// уровне JSON рядом со служебными, поэтому worker, читающий задачи без конверта, разбирает
+// и конверт. Attempt - номер попытки публикации задачи, IdempotencyKey - ID записи outbox,
+// одинаковый у всех публикаций одной постановки задачи; нужен для поиска задачи в журналах.
+// Повторную обработку worker отсекает не по ключу, а по статусу изображения.
+type TaskEnvelope struct {
+	SchemaVersion  int       `json:",omitempty"`
+	Type           TaskType  `json:",omitempty"`
+	CreatedAt      time.Time `json:",omitzero"`
+	Attempt        int       `json:",omitempty"`
+	IdempotencyKey string    `json:",omitempty"`
+	ProcessingTask
+}
+
+// NewTaskEnvelope - конверт текущей версии схемы для задачи task, созданной сейчас.
+func NewTaskEnvelope(task ProcessingTask) *TaskEnvelope {
+	return &TaskEnvelope{
+		SchemaVersion:  TaskSchemaVersion,
+		Type:           TaskTypeProcessImage,
+		CreatedAt:      time.Now().UTC(),
+		Attempt:        1,
+		ProcessingTask: task,
+	}
+}
+
+type correlationIDKey struct{}
+
+// WithCorrelationID - контекст с ID корреляции запроса, который попадет в поставленные задачи.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+// CorrelationIDFromContext - ID корреляции из контекста или пустая строка.
+func CorrelationIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
+
+type lastAttemptKey struct{}
+
+// WithLastAttempt - контекст последней попытки обработки задачи: после ее неудачи задача
+// отправляется в DLQ.
+func WithLastAttempt(ctx context.Context) context.Context {
+	return context.WithValue(ctx, lastAttemptKey{}, true)
+}
+
+// IsLastAttempt - является ли попытка обработки задачи с контекстом ctx последней.
+func IsLastAttempt(ctx context.Context) bool {
+	last, _ := ctx.Value(lastAttemptKey{}).(bool)
+	return last
 }
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// DefaultTenantID - тенант, используемый в однотенантном режиме и для задач без TenantID.
+const DefaultTenantID = "default"
+
+// Tenant - тенант с квотами. DefaultTTL - срок хранения изображений, загруженных без TTL (0 - бессрочно).
+type Tenant struct {
+	ID         string
+	APIKey     string
+	MaxImages  int
+	MaxBytes   int64
+	DefaultTTL time.Duration
+}
+
+// Quota - квоты тенанта.
+func (t Tenant) Quota() Quota {
+	return Quota{MaxImages: t.MaxImages, MaxBytes: t.MaxBytes}
+}
+
+// TenantIDs - ID настроенных тенантов; в однотенантном режиме (тенанты не заданы) -
+// только DefaultTenantID.
+func TenantIDs(tenants []Tenant) []string {
+	if len(tenants) == 0 {
+		return []string{DefaultTenantID}
+	}
+
+	ids := make([]string, 0, len(tenants))
+	for _, t := range tenants {
+		ids = append(ids, t.ID)
+	}
+
+	return ids
+}
@@ -0,0 +1,12 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTenantIDs(t *testing.T) {
+	assert.Equal(t, []string{DefaultTenantID}, TenantIDs(nil))
+	assert.Equal(t, []string{"a", "b"}, TenantIDs([]Tenant{{ID: "a"}, {ID: "b"}}))
+}
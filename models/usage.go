@@ -0,0 +1,45 @@
+package models
+
+import "fmt"
+
+// TenantUsage - использование хранилища тенантом и его лимиты (0 - без ограничений).
+// Удаленные изображения в использовании не учитываются.
+type TenantUsage struct {
+	TenantID         string
+	OriginalsCount   int
+	OriginalsBytes   int64
+	DerivativesCount int
+	DerivativesBytes int64
+	MaxImages        int
+	MaxBytes         int64
+}
+
+// Quota - квоты тенанта на количество и объем изображений (0 - без ограничений).
+type Quota struct {
+	MaxImages int
+	MaxBytes  int64
+}
+
+// TotalBytes - суммарный объем оригиналов и производных изображений.
+func (u *TenantUsage) TotalBytes() int64 {
+	return u.OriginalsBytes + u.DerivativesBytes
+}
+
+// Unlimited - нет ни одной квоты.
+func (q Quota) Unlimited() bool {
+	return q.MaxImages <= 0 && q.MaxBytes <= 0
+}
+
+// Check - проверяет, что новое изображение размером size умещается в квоты при использовании usage.
+// Иначе возвращает ошибку с ErrQuotaExceeded.
+func (q Quota) Check(usage *TenantUsage, size int64) error {
+	if q.MaxImages > 0 && usage.OriginalsCount >= q.MaxImages {
+		return fmt.Errorf("%w тенанта %s: %d из %d изображений", ErrQuotaExceeded, usage.TenantID, usage.OriginalsCount, q.MaxImages)
+	}
+
+	if q.MaxBytes > 0 && usage.TotalBytes()+size > q.MaxBytes {
+		return fmt.Errorf("%w тенанта %s: %d + %d из %d байт", ErrQuotaExceeded, usage.TenantID, usage.TotalBytes(), size, q.MaxBytes)
+	}
+
+	return nil
+}
@@ -1,5 +1,17 @@
 let currentImageId = null;
 
+// API ключ тенанта (если на сервере настроены тенанты)
+const apiKeyInput = document.getElementById('api-key-input');
+apiKeyInput.value = localStorage.getItem('apiKey') || '';
+apiKeyInput.addEventListener('change', () => {
+    localStorage.setItem('apiKey', apiKeyInput.value.trim());
+});
+
+function authHeaders() {
+    const apiKey = apiKeyInput.value.trim();
+    return apiKey ? { 'X-API-Key': apiKey } : {};
+}
+
 // Загрузка изображения
 document.getElementById('upload-form').addEventListener('submit', async (e) => {
     e.preventDefault();
@@ -15,6 +27,7 @@ document.getElementById('upload-form').addEventListener('submit', async (e) => {
     try {
         const response = await fetch('/upload', {
             method: 'POST',
+            headers: authHeaders(),
             body: formData
         });
         
@@ -45,7 +58,7 @@ document.getElementById('search-form').addEventListener('submit', async (e) => {
     if (!imageId) return;
     
     try {
-        const response = await fetch(`/status/${imageId}`);
+        const response = await fetch(`/status/${imageId}`, { headers: authHeaders() });
         
         if (response.ok) {
             currentImageId = imageId;
@@ -68,7 +81,7 @@ async function checkStatus() {
     if (!currentImageId) return;
     
     try {
-        const response = await fetch(`/status/${currentImageId}`);
+        const response = await fetch(`/status/${currentImageId}`, { headers: authHeaders() });
         
         if (response.ok) {
             const status = await response.json();
@@ -100,7 +113,7 @@ async function showImages() {
     
     for (const type of types) {
         try {
-            const response = await fetch(`/image/${currentImageId}?type=${type}`);
+            const response = await fetch(`/image/${currentImageId}?type=${type}`, { headers: authHeaders() });
             if (response.ok) {
                 const blob = await response.blob();
                 const url = URL.createObjectURL(blob);
@@ -148,11 +161,15 @@ document.getElementById('delete-btn').addEventListener('click', async () => {
     
     try {
         const response = await fetch(`/image/${currentImageId}`, {
-            method: 'DELETE'
+            method: 'DELETE',
+            headers: authHeaders()
         });
         
         if (response.ok) {
-            alert('Изображение удалено');
+            if (confirm('Изображение удалено. Отменить удаление?')) {
+                await restoreImage(currentImageId);
+                return;
+            }
             resetForm();
         } else {
             alert('Ошибка удаления');
@@ -163,6 +180,25 @@ document.getElementById('delete-btn').addEventListener('click', async () => {
     }
 });
 
+// Восстановление удаленного изображения
+async function restoreImage(imageId) {
+    try {
+        const response = await fetch(`/image/${imageId}/restore`, {
+            method: 'POST',
+            headers: authHeaders()
+        });
+
+        if (response.ok) {
+            alert('Изображение восстановлено');
+        } else {
+            alert('Ошибка восстановления');
+        }
+
+    } catch (error) {
+        alert('Ошибка: ' + error.message);
+    }
+}
+
 // Кнопка "Назад"
 document.getElementById('back-btn').addEventListener('click', () => {
     resetForm();